@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// accessEntry is one request in the access log
+type accessEntry struct {
+	Time       time.Time `json:"time"`
+	ID         string    `json:"request_id"`
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	File       string    `json:"file,omitempty"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Duration   float64   `json:"duration_ms"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	Referer    string    `json:"referer,omitempty"`
+	proto      string
+}
+
+// accessRecorder wraps a ResponseWriter to record status and size
+type accessRecorder struct {
+	http.ResponseWriter
+	entry accessEntry
+	body  *shadowCapture // response kept for -shadow, or nil
+}
+
+func newAccessRecorder(w http.ResponseWriter, r *http.Request) *accessRecorder {
+	return &accessRecorder{
+		ResponseWriter: w,
+		entry: accessEntry{
+			Time:       time.Now(),
+			ID:         rfid(),
+			RemoteAddr: logAddr(r.RemoteAddr),
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			UserAgent:  logUserAgent(r.UserAgent()),
+			Referer:    r.Referer(),
+			proto:      r.Proto,
+		},
+	}
+}
+
+func (a *accessRecorder) WriteHeader(code int) {
+	if a.entry.Status == 0 {
+		a.entry.Status = code
+	}
+	a.ResponseWriter.WriteHeader(code)
+}
+
+func (a *accessRecorder) Write(b []byte) (int, error) {
+	if a.entry.Status == 0 {
+		a.entry.Status = http.StatusOK
+	}
+	n, err := a.ResponseWriter.Write(b)
+	a.entry.Bytes += int64(n)
+	if a.body != nil {
+		a.body.write(b[:n])
+	}
+	return n, err
+}
+
+// Flush sends what was written so far, for streamed responses and long
+// polls
+func (a *accessRecorder) Flush() {
+	if a.entry.Status == 0 {
+		a.entry.Status = http.StatusOK
+	}
+	if f, ok := a.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// access log destination, nil for the -log file
+var (
+	accessLog io.Writer
+	accessMu  sync.Mutex // keeps access log lines whole
+)
+
+// writeAccess writes one access log line
+func writeAccess(line []byte) {
+	w := accessLog
+	if w == nil {
+		w = logger.Writer()
+	}
+	accessMu.Lock()
+	w.Write(line)
+	accessMu.Unlock()
+}
+
+// combined formats the entry in the apache/ncsa combined log format
+func (e *accessEntry) combined() []byte {
+	size := "-"
+	if e.Bytes != 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+	quote := func(s string) string {
+		if s == "" {
+			return "\"-\""
+		}
+		return strconv.Quote(s)
+	}
+	host, _, err := net.SplitHostPort(e.RemoteAddr)
+	if err != nil {
+		host = e.RemoteAddr
+	}
+	return []byte(fmt.Sprintf("%s - - [%s] %s %d %s %s %s\n",
+		host, e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		quote(e.Method+" "+e.Path+" "+e.proto), e.Status, size,
+		quote(e.Referer), quote(e.UserAgent)))
+}
+
+// finish writes the access log line for the request
+func (a *accessRecorder) finish() {
+	elapsed := time.Since(a.entry.Time)
+	if a.entry.Status == 0 {
+		a.entry.Status = http.StatusOK
+	}
+	switch *logFormat {
+	case "json":
+		a.entry.Duration = float64(elapsed.Microseconds()) / 1000
+		b, err := json.Marshal(a.entry)
+		if err != nil {
+			logger.Println(a.entry.ID, "error encoding access log:", err)
+			return
+		}
+		writeAccess(append(b, '\n'))
+	case "combined":
+		writeAccess(a.entry.combined())
+	default:
+		logAt(levelInfo, a.entry.ID, a.entry.RemoteAddr, a.entry.Method, a.entry.Path, a.entry.Status, a.entry.Bytes, "bytes in", elapsed)
+	}
+}
+
+// logreq logs request details in the text log format, at -log-level
+// debug. structured formats get the same details from the access log
+// line instead.
+func logreq(v ...interface{}) {
+	if *logFormat == "text" {
+		logAt(levelDebug, v...)
+	}
+}
+
+// logreqf is logreq with a format
+func logreqf(format string, v ...interface{}) {
+	if *logFormat == "text" {
+		logfAt(levelDebug, format, v...)
+	}
+}
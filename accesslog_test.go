@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestJSONAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	*logFormat = "json"
+	defer func() {
+		logger.SetOutput(os.Stderr)
+		*logFormat = "text"
+	}()
+
+	req, _ := http.NewRequest("GET", "/index.md", nil)
+	req.RemoteAddr = "192.0.2.1:5555"
+	sendRequest(req)
+
+	var entry accessEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Logf("Expected exactly one json line, got %q: %v", buf.String(), err)
+		t.FailNow()
+	}
+	if entry.Status != 200 || entry.Path != "/index.md" || entry.Bytes == 0 || entry.RemoteAddr != "192.0.2.1:5555" {
+		t.Logf("Unexpected access log entry: %+v", entry)
+		t.FailNow()
+	}
+	if entry.File == "" || entry.ID == "" {
+		t.Logf("Expected resolved file and request id: %+v", entry)
+		t.FailNow()
+	}
+}
+
+func TestCombinedAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	accessLog = &buf
+	*logFormat = "combined"
+	defer func() {
+		accessLog = nil
+		*logFormat = "text"
+	}()
+
+	req, _ := http.NewRequest("GET", "/notafile", nil)
+	req.RemoteAddr = "192.0.2.1:5555"
+	req.Header.Set("User-Agent", "test/1.0")
+	sendRequest(req)
+
+	line := buf.String()
+	if !strings.HasPrefix(line, "192.0.2.1 - - [") {
+		t.Log("Expected combined log line, got:", line)
+		t.FailNow()
+	}
+	if !strings.HasSuffix(line, `] "GET /notafile HTTP/1.1" 404 19 "-" "test/1.0"`+"\n") {
+		t.Log("Unexpected combined log line:", line)
+		t.FailNow()
+	}
+}
+
+func TestAccessRecorderFlush(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	shaped := &shapedWriter{ResponseWriter: rec, r: req, s: newBandwidthShaper(0, 0, 0, 0)}
+	var w http.ResponseWriter = newAccessRecorder(shaped, req)
+	f, ok := w.(http.Flusher)
+	if !ok {
+		t.Log("Expected the access recorder to flush")
+		t.FailNow()
+	}
+	f.Flush()
+	if !rec.Flushed || w.(*accessRecorder).entry.Status != 200 {
+		t.Log("Expected the flush passed on through the shaper, and a 200 recorded")
+		t.Fail()
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// cidrList is a flag.Value holding networks, given as comma separated
+// or repeated flags. a plain address is treated as a single host network.
+type cidrList []*net.IPNet
+
+func (c *cidrList) String() string {
+	if c == nil {
+		return ""
+	}
+	var s []string
+	for _, n := range *c {
+		s = append(s, n.String())
+	}
+	return strings.Join(s, ",")
+}
+
+func (c *cidrList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return err
+		}
+		*c = append(*c, n)
+	}
+	return nil
+}
+
+// contains returns true if ip is in any of the networks
+func (c cidrList) contains(ip net.IP) bool {
+	for _, n := range c {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedIP applies the deny list, then the allow list (if not empty)
+func allowedIP(addr string, allow, deny cidrList) bool {
+	if len(allow) == 0 && len(deny) == 0 {
+		return true
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	if deny.contains(ip) {
+		return false
+	}
+	return len(allow) == 0 || allow.contains(ip)
+}
+
+// proxyList is the -trust-proxy flag: trusted proxy networks, loopback
+// when given without a value
+type proxyList struct{ cidrList }
+
+func (p *proxyList) IsBoolFlag() bool { return true }
+
+func (p *proxyList) Set(value string) error {
+	switch value {
+	case "true":
+		value = "127.0.0.0/8,::1"
+	case "false":
+		p.cidrList = nil
+		return nil
+	}
+	return p.cidrList.Set(value)
+}
+
+// forwardedFor returns the client address reported by trusted proxies in
+// X-Forwarded-For (the rightmost untrusted hop) or X-Real-IP, or the
+// peer address when it isn't a trusted proxy
+func forwardedFor(r *http.Request, trusted cidrList) string {
+	peer := clientIP(r)
+	if ip := net.ParseIP(peer); ip == nil || !trusted.contains(ip) {
+		return r.RemoteAddr
+	}
+	hops := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip.String()
+		if !trusted.contains(ip) {
+			break
+		}
+	}
+	if client == "" {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+			client = ip.String()
+		}
+	}
+	if client == "" {
+		return r.RemoteAddr
+	}
+	return client
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAllowedIP(t *testing.T) {
+	var allow, deny cidrList
+	if err := allow.Set("10.0.0.0/8, 192.168.1.5"); err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if err := deny.Set("10.1.0.0/16"); err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	tests := map[string]bool{
+		"10.0.0.1":    true,
+		"10.1.2.3":    false, // denied inside allowed range
+		"192.168.1.5": true,
+		"192.168.1.6": false,
+		"::1":         false,
+		"garbage":     false,
+	}
+	for addr, want := range tests {
+		if got := allowedIP(addr, allow, deny); got != want {
+			t.Logf("%s: expected %v, got %v", addr, want, got)
+			t.Fail()
+		}
+	}
+	if err := allow.Set("not-a-cidr/99"); err == nil {
+		t.Log("Expected error for bad cidr")
+		t.Fail()
+	}
+}
+
+func TestDenyRequest(t *testing.T) {
+	denyList.Set("192.0.2.0/24")
+	defer func() { denyList = nil }()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:5555"
+	resp := sendRequest(req)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Log("Expected 403, got:", resp.StatusCode)
+		t.FailNow()
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	var p proxyList
+	if err := p.Set("true"); err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if err := p.Set("10.0.0.0/8"); err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	tests := []struct {
+		peer, xff, realIP, want string
+	}{
+		{"127.0.0.1:4321", "203.0.113.7", "", "203.0.113.7"},
+		{"127.0.0.1:4321", "198.51.100.1, 203.0.113.7, 10.0.0.2", "", "203.0.113.7"}, // spoofed first hop
+		{"[::1]:4321", "", "2001:db8::1", "2001:db8::1"},
+		{"127.0.0.1:4321", "", "", "127.0.0.1:4321"},
+		{"203.0.113.9:4321", "198.51.100.1", "", "203.0.113.9:4321"}, // untrusted peer
+		{"10.1.1.1:80", "garbage", "198.51.100.2", "198.51.100.2"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "http://example.com/", nil)
+		r.RemoteAddr = test.peer
+		if test.xff != "" {
+			r.Header.Set("X-Forwarded-For", test.xff)
+		}
+		if test.realIP != "" {
+			r.Header.Set("X-Real-IP", test.realIP)
+		}
+		if got := forwardedFor(r, p.cidrList); got != test.want {
+			t.Logf("%s %q %q: expected %s, got %s", test.peer, test.xff, test.realIP, test.want, got)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// analytics snippets, keyed by -analytics provider.
+// text/template is used because html/template refuses the conditional
+// type attribute, so values are escaped explicitly with html and js.
+var analyticsTemplates = map[string]string{
+	"plausible": `<script defer data-domain="{{html .ID}}" src="{{html .URL}}/js/script.js"{{if .Consent}} type="text/plain" data-consent="analytics"{{end}}></script>
+`,
+	"matomo": `<script{{if .Consent}} type="text/plain" data-consent="analytics"{{end}}>
+var _paq = window._paq = window._paq || [];
+_paq.push(['trackPageView']);
+_paq.push(['enableLinkTracking']);
+(function() {
+	var u = "{{js .URL}}/";
+	_paq.push(['setTrackerUrl', u + 'matomo.php']);
+	_paq.push(['setSiteId', "{{js .ID}}"]);
+	var g = document.createElement('script');
+	g.async = true; g.src = u + 'matomo.js';
+	document.head.appendChild(g);
+})();
+</script>
+`,
+	"ga": `<script async src="{{html .URL}}/gtag/js?id={{html .ID}}"{{if .Consent}} type="text/plain" data-consent="analytics"{{end}}></script>
+<script{{if .Consent}} type="text/plain" data-consent="analytics"{{end}}>
+window.dataLayer = window.dataLayer || [];
+function gtag(){dataLayer.push(arguments);}
+gtag('js', new Date());
+gtag('config', "{{js .ID}}", {'anonymize_ip': true});
+</script>
+`,
+}
+
+// default analytics server, if -analytics-url is not set
+var analyticsURLs = map[string]string{
+	"plausible": "https://plausible.io",
+	"ga":        "https://www.googletagmanager.com",
+}
+
+// consentBanner asks before running scripts marked data-consent,
+// remembering the answer in localStorage
+const consentBanner = `<script>
+(function() {
+	var key = "markdownd-consent";
+	function run() {
+		var s = document.querySelectorAll('script[data-consent]');
+		for (var i = 0; i < s.length; i++) {
+			var n = document.createElement('script');
+			for (var j = 0; j < s[i].attributes.length; j++) {
+				var a = s[i].attributes[j];
+				if (a.name != "type" && a.name != "data-consent") n.setAttribute(a.name, a.value);
+			}
+			n.text = s[i].text;
+			s[i].parentNode.replaceChild(n, s[i]);
+		}
+	}
+	var answer = localStorage.getItem(key);
+	if (answer == "yes") { run(); return; }
+	if (answer == "no" || navigator.doNotTrack == "1") { return; }
+	document.addEventListener("DOMContentLoaded", function() {
+		var d = document.createElement('div');
+		d.id = "markdownd-consent";
+		d.style.cssText = "position:fixed;bottom:0;left:0;right:0;padding:1em;background:#333;color:#fff;text-align:center;z-index:1000";
+		d.innerHTML = 'This site uses privacy-friendly analytics. <button data-answer="yes">Accept</button> <button data-answer="no">Decline</button>';
+		d.addEventListener("click", function(e) {
+			var answer = e.target.getAttribute("data-answer");
+			if (!answer) return;
+			localStorage.setItem(key, answer);
+			d.parentNode.removeChild(d);
+			if (answer == "yes") run();
+		});
+		document.body.appendChild(d);
+	});
+})();
+</script>
+`
+
+// analyticsSnippet returns the html to inject for provider, or an error
+// if the provider is unknown
+func analyticsSnippet(provider, id, url string, consent bool) ([]byte, error) {
+	src, ok := analyticsTemplates[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown analytics provider: %q (try plausible, matomo, or ga)", provider)
+	}
+	if id == "" {
+		return nil, fmt.Errorf("analytics provider %q needs -analytics-id", provider)
+	}
+	if url == "" {
+		url = analyticsURLs[provider]
+	}
+	if url == "" {
+		return nil, fmt.Errorf("analytics provider %q needs -analytics-url", provider)
+	}
+	t, err := template.New(provider).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, struct {
+		ID, URL string
+		Consent bool
+	}{id, url, consent})
+	if err != nil {
+		return nil, err
+	}
+	if consent {
+		buf.WriteString(consentBanner)
+	}
+	return buf.Bytes(), nil
+}
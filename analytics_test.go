@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnalyticsSnippet(t *testing.T) {
+	b, err := analyticsSnippet("plausible", "example.com", "", false)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if !strings.Contains(string(b), `data-domain="example.com" src="https://plausible.io/js/script.js"`) {
+		t.Log("Expected plausible script, got:", string(b))
+		t.FailNow()
+	}
+
+	b, err = analyticsSnippet("ga", "G-1234", "", true)
+	if err != nil {
+		t.Log("Unexpected error:", err)
+		t.FailNow()
+	}
+	if !strings.Contains(string(b), `data-consent="analytics"`) || !strings.Contains(string(b), "markdownd-consent") {
+		t.Log("Expected consent gated script and banner, got:", string(b))
+		t.FailNow()
+	}
+
+	if _, err := analyticsSnippet("dummy", "x", "", false); err == nil {
+		t.Log("Expected error for unknown provider")
+		t.FailNow()
+	}
+	if _, err := analyticsSnippet("matomo", "1", "", false); err == nil {
+		t.Log("Expected error for matomo without url")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// authorized returns true if the request carries 'Authorization: Bearer <token>'
+// matching the -token flag. always true if no token is configured.
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return false
+	}
+	given := strings.TrimSpace(auth[7:])
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBearerToken(t *testing.T) {
+	*token = "s3cret"
+	defer func() { *token = "" }()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	resp := sendRequest(req)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Log("Expected 401 without token, got:", resp.StatusCode)
+		t.FailNow()
+	}
+
+	req.Header.Set("Authorization", "Bearer wrong")
+	resp = sendRequest(req)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Log("Expected 401 with wrong token, got:", resp.StatusCode)
+		t.FailNow()
+	}
+
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp = sendRequest(req)
+	if resp.StatusCode != http.StatusOK {
+		t.Log("Expected 200 with token, got:", resp.StatusCode)
+		t.FailNow()
+	}
+}
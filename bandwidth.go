@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// shapeChunk is the most written at once by a shaped response
+const shapeChunk = 16 << 10
+
+// byteBucket is a token bucket of bytes, refilling at rate per second up
+// to a second's worth. takes may overdraw it; the caller then waits for
+// the bucket to refill.
+type byteBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take takes n bytes at rate, returning how long to wait before sending
+func (b *byteBucket) take(rate float64, n int, now time.Time) time.Duration {
+	if b.last.IsZero() {
+		b.tokens = rate
+	}
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > rate {
+		b.tokens = rate
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// clientTransfer is what a client was sent today, and its bucket
+type clientTransfer struct {
+	bucket byteBucket
+	used   int64
+}
+
+// bandwidthShaper slows responses to -bandwidth in total and -bandwidth-ip
+// for each client, and counts them against the daily -quota and -quota-ip.
+// days are UTC. ipv6 clients count by their /64, the network of one host.
+type bandwidthShaper struct {
+	rate, ipRate   float64 // bytes per second, 0 for unlimited
+	quota, ipQuota int64   // bytes per day, 0 for unlimited
+
+	mu      sync.Mutex
+	total   byteBucket
+	clients map[string]*clientTransfer
+	day     string // the day used counts, 2006-01-02
+	used    int64  // sent today to everyone
+	swept   time.Time
+}
+
+// per ip bandwidth and quotas, if -bandwidth or -quota flags are set
+var shaper *bandwidthShaper
+
+func newBandwidthShaper(rate, ipRate, quota, ipQuota int64) *bandwidthShaper {
+	return &bandwidthShaper{
+		rate:    float64(rate),
+		ipRate:  float64(ipRate),
+		quota:   quota,
+		ipQuota: ipQuota,
+		clients: map[string]*clientTransfer{},
+	}
+}
+
+// bandwidthSizes parses -bandwidth, -bandwidth-ip, -quota and -quota-ip
+func bandwidthSizes() ([4]int64, error) {
+	var n [4]int64
+	for i, f := range []struct{ name, value string }{
+		{"bandwidth", *bandwidthAll}, {"bandwidth-ip", *bandwidthIP}, {"quota", *quotaAll}, {"quota-ip", *quotaIP},
+	} {
+		v, err := parseSize(f.value)
+		if err != nil {
+			return n, fmt.Errorf("-%s: %v", f.name, err)
+		}
+		n[i] = v
+	}
+	return n, nil
+}
+
+// transferKey groups ipv6 clients by their /64
+func transferKey(ip string) string {
+	if a := net.ParseIP(ip); a != nil && a.To4() == nil {
+		return a.Mask(net.CIDRMask(64, 128)).String() + "/64"
+	}
+	return ip
+}
+
+// client returns the transfer of ip for the day of now. caller holds s.mu
+func (s *bandwidthShaper) client(ip string, now time.Time) *clientTransfer {
+	if day := now.UTC().Format("2006-01-02"); day != s.day {
+		// a new day, the quotas start over
+		s.day, s.used, s.clients = day, 0, map[string]*clientTransfer{}
+	}
+	s.sweep(now)
+	key := transferKey(ip)
+	c, ok := s.clients[key]
+	if !ok {
+		c = &clientTransfer{}
+		s.clients[key] = c
+	}
+	return c
+}
+
+// sweep drops the clients idle long enough for their bucket to be full
+// again. without -quota-ip nothing else is kept of them; with it their
+// counts are kept until the day ends. caller holds s.mu
+func (s *bandwidthShaper) sweep(now time.Time) {
+	if s.ipQuota > 0 || now.Sub(s.swept) < time.Minute {
+		return
+	}
+	s.swept = now
+	for key, c := range s.clients {
+		if now.Sub(c.bucket.last) > time.Second {
+			delete(s.clients, key)
+		}
+	}
+}
+
+// overQuota returns the status for a client past its daily quota, 429, or
+// for everyone past the total, 509, and the time until the quotas reset.
+// it returns 0 while both have room.
+func (s *bandwidthShaper) overQuota(ip string, now time.Time) (int, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.client(ip, now)
+	code := 0
+	switch {
+	case s.quota > 0 && s.used >= s.quota:
+		code = 509
+	case s.ipQuota > 0 && c.used >= s.ipQuota:
+		code = http.StatusTooManyRequests
+	default:
+		return 0, 0
+	}
+	midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	return code, midnight.Sub(now)
+}
+
+// take counts n bytes sent to ip, returning how long to wait before
+// sending them
+func (s *bandwidthShaper) take(ip string, n int, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.client(ip, now)
+	c.used += int64(n)
+	s.used += int64(n)
+	var wait time.Duration
+	if s.rate > 0 {
+		wait = s.total.take(s.rate, n, now)
+	}
+	if s.ipRate > 0 {
+		if w := c.bucket.take(s.ipRate, n, now); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+// shapedWriter writes a response at the pace of the shaper
+type shapedWriter struct {
+	http.ResponseWriter
+	r  *http.Request
+	ip string
+	s  *bandwidthShaper
+}
+
+func (s *bandwidthShaper) writer(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	return &shapedWriter{ResponseWriter: w, r: r, ip: clientIP(r), s: s}
+}
+
+func (w *shapedWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > shapeChunk {
+			chunk = chunk[:shapeChunk]
+		}
+		if wait := w.s.take(w.ip, len(chunk), time.Now()); wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-w.r.Context().Done():
+				t.Stop()
+				return written, w.r.Context().Err()
+			}
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+// Flush sends what was written so far, for streamed responses and long
+// polls
+func (w *shapedWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestByteBucket(t *testing.T) {
+	now := time.Now()
+	var b byteBucket
+	if wait := b.take(1000, 1000, now); wait != 0 {
+		t.Log("expected a full bucket, waited", wait)
+		t.Fail()
+	}
+	if wait := b.take(1000, 500, now); wait != 500*time.Millisecond {
+		t.Log("expected to wait 500ms, got", wait)
+		t.Fail()
+	}
+	if wait := b.take(1000, 500, now.Add(time.Second)); wait != 0 {
+		t.Log("expected the bucket to refill, waited", wait)
+		t.Fail()
+	}
+}
+
+func TestBandwidthQuota(t *testing.T) {
+	s := newBandwidthShaper(0, 0, 10000, 1000)
+	now := time.Date(2026, 10, 14, 23, 0, 0, 0, time.UTC)
+	s.take("192.0.2.1", 1000, now)
+	if code, wait := s.overQuota("192.0.2.1", now); code != 429 || wait != time.Hour {
+		t.Log("expected 429 for an hour, got", code, wait)
+		t.Fail()
+	}
+	if code, _ := s.overQuota("192.0.2.2", now); code != 0 {
+		t.Log("expected another client to have room, got", code)
+		t.Fail()
+	}
+	// one host rotating its ipv6 addresses
+	s.take("2001:db8::1", 600, now)
+	s.take("2001:db8::2", 600, now)
+	if code, _ := s.overQuota("2001:db8::3", now); code != 429 {
+		t.Log("expected the /64 to share a quota, got", code)
+		t.Fail()
+	}
+	s.take("192.0.2.3", 9000, now)
+	if code, _ := s.overQuota("192.0.2.4", now); code != 509 {
+		t.Log("expected 509 past the total, got", code)
+		t.Fail()
+	}
+	if code, _ := s.overQuota("192.0.2.1", now.Add(time.Hour)); code != 0 {
+		t.Log("expected the quotas to reset the next day, got", code)
+		t.Fail()
+	}
+}
+
+func TestBandwidthShaping(t *testing.T) {
+	defer func(s *bandwidthShaper) { shaper = s }(shaper)
+	shaper = newBandwidthShaper(0, 100<<10, 0, 150<<10)
+	h := Handler{Root: fstest.MapFS{"big.txt": {Data: []byte(strings.Repeat("x", 200<<10))}}}
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/big.txt", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	h.ServeHTTP(rec, req)
+	if rec.Code != 200 || rec.Body.Len() != 200<<10 {
+		t.Fatal("expected the file, got", rec.Code, rec.Body.Len())
+	}
+	// a second's worth at once, and the rest at 100K/s
+	if took := time.Since(start); took < 900*time.Millisecond {
+		t.Log("expected about a second, took", took)
+		t.Fail()
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != 429 || rec.Header().Get("Retry-After") == "" {
+		t.Log("expected 429 past the quota, got", rec.Code, rec.Header())
+		t.Fail()
+	}
+}
+
+func TestBandwidthSweep(t *testing.T) {
+	s := newBandwidthShaper(0, 100<<10, 0, 0)
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	s.take("192.0.2.1", 1<<10, now)
+	s.take("192.0.2.2", 1<<10, now.Add(time.Minute))
+	s.take("192.0.2.3", 1<<10, now.Add(2*time.Minute))
+	if len(s.clients) != 1 {
+		t.Logf("expected the idle clients swept, %d left", len(s.clients))
+		t.Fail()
+	}
+
+	// with a per ip quota the counts are kept for the day
+	s = newBandwidthShaper(0, 100<<10, 0, 1<<20)
+	s.take("192.0.2.1", 1<<10, now)
+	s.take("192.0.2.2", 1<<10, now.Add(2*time.Minute))
+	if len(s.clients) != 2 {
+		t.Logf("expected the clients kept with -quota-ip, %d left", len(s.clients))
+		t.Fail()
+	}
+
+	var w http.ResponseWriter = &shapedWriter{ResponseWriter: httptest.NewRecorder(), s: s}
+	if _, ok := w.(http.Flusher); !ok {
+		t.Log("expected shaped responses to flush")
+		t.Fail()
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// blockKind is the type of a markdown block
+type blockKind int
+
+const (
+	blockParagraph blockKind = iota
+	blockHeading
+	blockListItem
+	blockCode
+	blockQuote
+	blockRule
+)
+
+// block is a simplified markdown block, for exports that don't speak html
+type block struct {
+	Kind    blockKind
+	Level   int    // heading level, or list nesting depth (0 = top)
+	Ordered bool   // numbered list item
+	Text    string // inline markup removed, code keeps its newlines
+	Raw     string // text with inline markup, empty for code and rules
+}
+
+// mdLink is a link or image found in inline markdown
+type mdLink struct {
+	Text string
+	URL  string
+}
+
+var (
+	reOrdered  = regexp.MustCompile(`^\d+[.)]\s+`)
+	reImage    = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	reLink     = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	reImageURL = regexp.MustCompile(`!\[([^\]]*)\]\(\s*([^)\s]+)[^)]*\)`)
+	reLinkURL  = regexp.MustCompile(`\[([^\]]*)\]\(\s*([^)\s]+)[^)]*\)`)
+	reTag      = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	reEmphasis = regexp.MustCompile(`(\*\*|__|\*|_|~~)([^*_~]+)(\*\*|__|\*|_|~~)`)
+)
+
+// parseBlocks splits markdown into blocks. this is not a full parser,
+// just enough structure for pdf and docx exports.
+func parseBlocks(md []byte) []block {
+	var (
+		blocks []block
+		para   []string
+		code   []string
+		fenced bool
+	)
+	flush := func() {
+		if len(para) != 0 {
+			raw := strings.Join(para, " ")
+			blocks = append(blocks, block{Kind: blockParagraph, Text: plainInline(raw), Raw: raw})
+			para = nil
+		}
+		if len(code) != 0 {
+			blocks = append(blocks, block{Kind: blockCode, Text: strings.Join(code, "\n")})
+			code = nil
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(md))
+	for scanner.Scan() {
+		raw := strings.TrimRight(scanner.Text(), " \t\r")
+		line := strings.TrimSpace(raw)
+
+		// fenced code
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			flush()
+			fenced = !fenced
+			continue
+		}
+		if fenced {
+			code = append(code, raw)
+			continue
+		}
+
+		indent := len(raw) - len(strings.TrimLeft(raw, " \t"))
+		if line != "" && len(code) != 0 && indent < 4 {
+			flush()
+		}
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "#"):
+			flush()
+			level := len(line) - len(strings.TrimLeft(line, "#"))
+			if level > 6 {
+				level = 6
+			}
+			text := strings.TrimSpace(strings.TrimRight(strings.TrimLeft(line, "#"), "#"))
+			blocks = append(blocks, block{Kind: blockHeading, Level: level, Text: plainInline(text), Raw: text})
+		case line == "---" || line == "***" || line == "___":
+			flush()
+			blocks = append(blocks, block{Kind: blockRule})
+		case strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ") || strings.HasPrefix(line, "+ "):
+			flush()
+			text := strings.TrimSpace(line[2:])
+			// task lists
+			text = strings.TrimPrefix(strings.TrimPrefix(text, "[ ] "), "[x] ")
+			blocks = append(blocks, block{Kind: blockListItem, Level: indent / 2, Text: plainInline(text), Raw: text})
+		case reOrdered.MatchString(line):
+			flush()
+			text := reOrdered.ReplaceAllString(line, "")
+			blocks = append(blocks, block{Kind: blockListItem, Level: indent / 2, Ordered: true, Text: plainInline(text), Raw: text})
+		case strings.HasPrefix(line, ">"):
+			flush()
+			text := strings.TrimSpace(strings.TrimLeft(line, ">"))
+			blocks = append(blocks, block{Kind: blockQuote, Text: plainInline(text), Raw: text})
+		case indent >= 4 && len(para) == 0:
+			// indented code
+			code = append(code, strings.TrimPrefix(strings.TrimPrefix(raw, "\t"), "    "))
+		default:
+			para = append(para, line)
+		}
+	}
+	flush()
+	return blocks
+}
+
+// listMarkers returns the bullet or number to show for each list item
+func listMarkers(blocks []block) []string {
+	markers := make([]string, len(blocks))
+	var counts [8]int
+	for i, b := range blocks {
+		if b.Kind != blockListItem {
+			counts = [8]int{}
+			continue
+		}
+		level := b.Level
+		if level >= len(counts) {
+			level = len(counts) - 1
+		}
+		for j := level + 1; j < len(counts); j++ {
+			counts[j] = 0
+		}
+		markers[i] = "•"
+		if b.Ordered {
+			counts[level]++
+			markers[i] = strconv.Itoa(counts[level]) + "."
+		}
+	}
+	return markers
+}
+
+// plainInline removes inline markdown (links, emphasis, code spans, html)
+func plainInline(s string) string {
+	s = reImage.ReplaceAllString(s, "$1")
+	s = reLink.ReplaceAllString(s, "$1")
+	s = reTag.ReplaceAllString(s, "")
+	for i := 0; i < 3; i++ {
+		s = reEmphasis.ReplaceAllString(s, "$2")
+	}
+	s = strings.Replace(s, "`", "", -1)
+	return strings.TrimSpace(s)
+}
+
+// inlineLinks returns the images and links in inline markdown.
+// images come first, then links.
+func inlineLinks(s string) []mdLink {
+	var links []mdLink
+	for _, m := range reImageURL.FindAllStringSubmatch(s, -1) {
+		links = append(links, mdLink{Text: m[1], URL: m[2]})
+	}
+	s = reImage.ReplaceAllString(s, "$1")
+	for _, m := range reLinkURL.FindAllStringSubmatch(s, -1) {
+		links = append(links, mdLink{Text: plainInline(m[1]), URL: m[2]})
+	}
+	return links
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseBlocks(t *testing.T) {
+	md := []byte("# Title\n\nsome *emphasis* and [a link](x.md)\ncontinued\n\n- one\n  - two\n1. first\n\n```\ncode\n\nmore\n```\n\n    indented\n    code\n\n> quote\n")
+	blocks := parseBlocks(md)
+	want := []block{
+		{Kind: blockHeading, Level: 1, Text: "Title", Raw: "Title"},
+		{Kind: blockParagraph, Text: "some emphasis and a link continued", Raw: "some *emphasis* and [a link](x.md) continued"},
+		{Kind: blockListItem, Text: "one", Raw: "one"},
+		{Kind: blockListItem, Level: 1, Text: "two", Raw: "two"},
+		{Kind: blockListItem, Ordered: true, Text: "first", Raw: "first"},
+		{Kind: blockCode, Text: "code\n\nmore"},
+		{Kind: blockCode, Text: "indented\ncode"},
+		{Kind: blockQuote, Text: "quote", Raw: "quote"},
+	}
+	if len(blocks) != len(want) {
+		t.Logf("Expected %d blocks, got %d: %#v", len(want), len(blocks), blocks)
+		t.FailNow()
+	}
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Logf("block %d: expected %#v, got %#v", i, want[i], blocks[i])
+			t.Fail()
+		}
+	}
+}
+
+func TestInlineLinks(t *testing.T) {
+	links := inlineLinks(`[![logo](/logo.png "Logo")](https://example.com) see [the *docs*](docs/index.md) and ![](x.png)`)
+	want := []mdLink{{"logo", "/logo.png"}, {"", "x.png"}, {"logo", "https://example.com"}, {"the docs", "docs/index.md"}}
+	if len(links) != len(want) {
+		t.Logf("Expected %v, got %v", want, links)
+		t.FailNow()
+	}
+	for i := range want {
+		if links[i] != want[i] {
+			t.Logf("link %d: expected %v, got %v", i, want[i], links[i])
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/aerth/markdownd/pkg/markdownd"
+)
+
+// browserURL is the address of the site on a listener, on localhost when
+// it listens on every address or on loopback, or "" for a unix socket
+func browserURL(ln net.Listener, prefix string) string {
+	u := markdownd.URL(ln.Addr())
+	if u == "" {
+		return ""
+	}
+	return strings.TrimSuffix(u, "/") + prefix + "/"
+}
+
+// openBrowser opens url in the default browser, without waiting for it
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBrowserURL(t *testing.T) {
+	for addr, expected := range map[string]string{
+		"127.0.0.1:0": "http://localhost:%d/docs/",
+		"[::]:0":      "http://localhost:%d/docs/",
+	} {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Log(addr, err)
+			continue
+		}
+		expected = fmt.Sprintf(expected, ln.Addr().(*net.TCPAddr).Port)
+		if got := browserURL(ln, "/docs"); got != expected {
+			t.Logf("%s: expected %q, got %q", addr, expected, got)
+			t.Fail()
+		}
+		ln.Close()
+	}
+
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ln, err := net.Listen("unix", filepath.Join(dir, "md.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if got := browserURL(ln, ""); got != "" {
+		t.Log("expected no url for a unix socket, got", got)
+		t.Fail()
+	}
+}
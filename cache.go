@@ -0,0 +1,113 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// byteCache keeps the most recently used values, dropping the least
+// recently used past limit bytes
+type byteCache struct {
+	mu    sync.Mutex
+	limit int64
+	items map[string]*list.Element
+	order *list.List // most recent first
+	size  int64
+}
+
+type cachedBytes struct {
+	key     string
+	b       []byte
+	expires time.Time // zero for never
+}
+
+func newByteCache(limit int64) *byteCache {
+	return &byteCache{limit: limit, items: map[string]*list.Element{}, order: list.New()}
+}
+
+func (c *byteCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if v := e.Value.(*cachedBytes); !v.expires.IsZero() && time.Now().After(v.expires) {
+		c.remove(e)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cachedBytes).b, true
+}
+
+// put keeps b for key, for maxAge or until dropped with 0
+func (c *byteCache) put(key string, b []byte, maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if int64(len(b)) > c.limit {
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+	v := &cachedBytes{key: key, b: b}
+	if maxAge > 0 {
+		v.expires = time.Now().Add(maxAge)
+	}
+	c.items[key] = c.order.PushFront(v)
+	c.size += int64(len(b))
+	c.trim()
+}
+
+// setLimit changes the limit, dropping values past it
+func (c *byteCache) setLimit(limit int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limit = limit
+	c.trim()
+}
+
+// usage returns the values kept and their bytes
+func (c *byteCache) usage() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items), c.size
+}
+
+func (c *byteCache) trim() {
+	for c.size > c.limit && c.order.Len() != 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *byteCache) remove(e *list.Element) {
+	v := c.order.Remove(e).(*cachedBytes)
+	delete(c.items, v.key)
+	c.size -= int64(len(v.b))
+}
+
+// renders keeps rendered html by the markdown it was rendered from, up to
+// -render-cache, so a page is rendered again only when its source changes
+var renders = newByteCache(32 << 20)
+
+// renderCached renders src with markdown2html, or returns the html kept
+// from rendering the same source before. store false renders without
+// keeping it, maxAge above 0 keeps it for only so long.
+func renderCached(src []byte, store bool, maxAge time.Duration) []byte {
+	sum := sha256.Sum256(src)
+	// the same source renders differently with other render flags
+	key := fmt.Sprintf("%s %t %t %t %s", hex.EncodeToString(sum[:]), *toc, *plain, *noInlineHTML, *rendererCmd)
+	if md, ok := renders.get(key); ok {
+		serverMetrics.cacheHit()
+		return md
+	}
+	md := markdown2html(src)
+	if store && renders.limit > 0 {
+		renders.put(key, md, maxAge)
+	}
+	return md
+}
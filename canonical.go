@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// reAbsoluteLink is an absolute link in rendered html
+var reAbsoluteLink = regexp.MustCompile(`(\s(?:href|src)=")(https?://[^"]*)"`)
+
+// linkRewrite replaces the start of absolute links, such as an internal
+// host name in pages served on a public mirror
+type linkRewrite struct {
+	From, To string
+}
+
+// linkRewriteList is the repeatable -rewrite-link flag
+type linkRewriteList []linkRewrite
+
+var linkRewrites linkRewriteList
+
+func (l *linkRewriteList) String() string {
+	if l == nil {
+		return ""
+	}
+	var s []string
+	for _, rw := range *l {
+		s = append(s, rw.From+"="+rw.To)
+	}
+	return strings.Join(s, " ")
+}
+
+// Set reads 'https://wiki.internal.corp/=https://wiki.example.com/'
+func (l *linkRewriteList) Set(value string) error {
+	rw, err := parseLinkRewrite(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, rw)
+	return nil
+}
+
+// parseLinkRewrite parses 'from=to', two absolute http or https urls
+func parseLinkRewrite(value string) (linkRewrite, error) {
+	i := strings.Index(value, "=http")
+	if i < 1 {
+		return linkRewrite{}, fmt.Errorf("expected from=to, such as 'https://wiki.internal.corp/=https://wiki.example.com/', got %q", value)
+	}
+	rw := linkRewrite{From: value[:i], To: value[i+1:]}
+	for _, u := range []string{rw.From, rw.To} {
+		if p, err := url.Parse(u); err != nil || (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+			return linkRewrite{}, fmt.Errorf("expected an http or https url, got %q in %q", u, value)
+		}
+	}
+	return rw, nil
+}
+
+// rewriteLinks applies the first matching rewrite to each absolute link
+// of the rendered page
+func rewriteLinks(page []byte, rewrites []linkRewrite) []byte {
+	if len(rewrites) == 0 {
+		return page
+	}
+	return reAbsoluteLink.ReplaceAllFunc(page, func(m []byte) []byte {
+		sub := reAbsoluteLink.FindSubmatch(m)
+		link := html.UnescapeString(string(sub[2]))
+		for _, rw := range rewrites {
+			if strings.HasPrefix(link, rw.From) {
+				return []byte(string(sub[1]) + html.EscapeString(rw.To+link[len(rw.From):]) + `"`)
+			}
+		}
+		return m
+	})
+}
+
+// parseCanonical checks a -canonical url, such as https://docs.example.com,
+// and returns it without a trailing slash
+func parseCanonical(value string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return "", fmt.Errorf("expected the scheme and host of the site, such as https://docs.example.com, got %q", value)
+	}
+	return strings.TrimSuffix(value, "/"), nil
+}
+
+// siteURL is scheme://host of the pages of h: the -canonical url of the
+// site, or the one requested
+func (h Handler) siteURL(r *http.Request) string {
+	if h.canonical != "" {
+		return h.canonical
+	}
+	return baseURL(r)
+}
+
+// canonicalLink is the <link rel="canonical"> of the page at urlpath, or
+// nil without -canonical
+func (h Handler) canonicalLink(urlpath string) []byte {
+	if h.canonical == "" {
+		return nil
+	}
+	return []byte(`<link rel="canonical" href="` + html.EscapeString(h.canonical+urlpath) + `">` + "\n")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRewriteLinks(t *testing.T) {
+	var l linkRewriteList
+	for _, v := range []string{"https://wiki.internal.corp/=https://wiki.example.com/", "http://build.internal.corp=https://ci.example.com"} {
+		if err := l.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, v := range []string{"https://wiki.internal.corp/", "wiki=https://wiki.example.com", "ftp://a.corp=https://b.example.com"} {
+		if err := l.Set(v); err == nil {
+			t.Logf("expected an error for %q", v)
+			t.Fail()
+		}
+	}
+	page := `<p><a href="https://wiki.internal.corp/runbooks?a=1&amp;b=2">x</a> <img src="http://build.internal.corp/badge.svg"> <a href="https://example.org/wiki.internal.corp/">y</a> <a href="/local">z</a></p>`
+	expected := `<p><a href="https://wiki.example.com/runbooks?a=1&amp;b=2">x</a> <img src="https://ci.example.com/badge.svg"> <a href="https://example.org/wiki.internal.corp/">y</a> <a href="/local">z</a></p>`
+	if got := string(rewriteLinks([]byte(page), l)); got != expected {
+		t.Logf("expected:\n%s\ngot:\n%s", expected, got)
+		t.Fail()
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	defer func(b bool) { *og = b }(*og)
+	*og = true
+	canonical, err := parseCanonical("https://docs.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseCanonical("https://docs.example.com/docs/"); err == nil {
+		t.Log("expected an error for a canonical url with a path")
+		t.Fail()
+	}
+	h := Handler{Root: fstest.MapFS{"guide.md": {Data: []byte("# Guide\n\nSee [the wiki](https://wiki.internal.corp/x).\n")}},
+		Prefix: "/docs", canonical: canonical, rewrites: []linkRewrite{{"https://wiki.internal.corp/", "https://wiki.example.com/"}}}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "http://docs.internal.corp/guide.md", nil))
+	body := rec.Body.String()
+	for _, s := range []string{
+		`<link rel="canonical" href="https://docs.example.com/docs/guide.md">`,
+		`<meta property="og:url" content="https://docs.example.com/docs/guide.md">`,
+		`href="https://wiki.example.com/x"`,
+	} {
+		if !strings.Contains(body, s) {
+			t.Logf("expected %s in:\n%s", s, body)
+			t.Fail()
+		}
+	}
+	if strings.Contains(body, "internal.corp") {
+		t.Log("internal host name in page:", body)
+		t.Fail()
+	}
+
+	v, err := parseVhost("docs.example.com=.,canonical=https://docs.example.com,rewrite=https://a.corp/=https://a.example.com/")
+	if err != nil || v.Canonical != "https://docs.example.com" || len(v.Rewrites) != 1 || v.Rewrites[0].To != "https://a.example.com/" {
+		t.Log("vhost options:", v, err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// changesPrefix is where the changes of a page are shown,
+// /_markdownd/api/changed/guide/intro.md
+const changesPrefix = "/_markdownd/api/changed/"
+
+// maxDiffLines bounds the lines compared line by line, past it the
+// changed middle of a page shows as removed and added whole
+const maxDiffLines = 2000
+
+// pageVersion is a rendering of a page and when it was first served
+type pageVersion struct {
+	html []byte
+	at   time.Time
+}
+
+// pageHistory is the current and previous renderings of a page
+type pageHistory struct {
+	key               string
+	current, previous pageVersion
+}
+
+func (p *pageHistory) size() int64 {
+	return int64(len(p.current.html) + len(p.previous.html))
+}
+
+// versionStore keeps the renderings of the most recently changed or
+// served pages, up to limit bytes
+type versionStore struct {
+	mu    sync.Mutex
+	limit int64
+	items map[string]*list.Element
+	order *list.List // most recent first
+	size  int64
+}
+
+// versions are the renderings kept for -changes
+var versions = newVersionStore(32 << 20)
+
+func newVersionStore(limit int64) *versionStore {
+	return &versionStore{limit: limit, items: map[string]*list.Element{}, order: list.New()}
+}
+
+// record notes the rendering b of the page key, served at now. a
+// rendering unlike the last becomes the current one, and the last the
+// previous one.
+func (s *versionStore) record(key string, b []byte, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[key]
+	if !ok {
+		e = s.order.PushFront(&pageHistory{key: key})
+		s.items[key] = e
+	}
+	s.order.MoveToFront(e)
+	p := e.Value.(*pageHistory)
+	if bytes.Equal(p.current.html, b) {
+		return
+	}
+	s.size -= p.size()
+	p.previous, p.current = p.current, pageVersion{html: append([]byte(nil), b...), at: now}
+	s.size += p.size()
+	for s.size > s.limit && s.order.Len() != 0 {
+		old := s.order.Remove(s.order.Back()).(*pageHistory)
+		delete(s.items, old.key)
+		s.size -= old.size()
+	}
+}
+
+// history returns the renderings of the page key, false without a
+// previous one
+func (s *versionStore) history(key string) (pageHistory, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[key]
+	if !ok || e.Value.(*pageHistory).previous.html == nil {
+		return pageHistory{}, false
+	}
+	return *e.Value.(*pageHistory), true
+}
+
+// versionKey names the page name of h in the version store
+func (h Handler) versionKey(name string) string {
+	return h.RootString + "\x00" + name
+}
+
+// diffOp is a line of a diff: ' ' kept, '-' removed, '+' added
+type diffOp struct {
+	op   byte
+	line string
+}
+
+// diffLines compares a and b line by line
+func diffLines(a, b []string) []diffOp {
+	var ops []diffOp
+	// the same start and end don't need comparing
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		ops = append(ops, diffOp{' ', a[start]})
+		start++
+	}
+	end := 0
+	for end < len(a)-start && end < len(b)-start && a[len(a)-1-end] == b[len(b)-1-end] {
+		end++
+	}
+	x, y := a[start:len(a)-end], b[start:len(b)-end]
+	if len(x) > maxDiffLines || len(y) > maxDiffLines {
+		for _, l := range x {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range y {
+			ops = append(ops, diffOp{'+', l})
+		}
+	} else {
+		// longest common subsequence, from the end
+		lcs := make([][]int32, len(x)+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, len(y)+1)
+		}
+		for i := len(x) - 1; i >= 0; i-- {
+			for j := len(y) - 1; j >= 0; j-- {
+				switch {
+				case x[i] == y[j]:
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				case lcs[i+1][j] >= lcs[i][j+1]:
+					lcs[i][j] = lcs[i+1][j]
+				default:
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(x) || j < len(y) {
+			switch {
+			case i < len(x) && j < len(y) && x[i] == y[j]:
+				ops = append(ops, diffOp{' ', x[i]})
+				i, j = i+1, j+1
+			case j == len(y) || i < len(x) && lcs[i+1][j] >= lcs[i][j+1]:
+				ops = append(ops, diffOp{'-', x[i]})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', y[j]})
+				j++
+			}
+		}
+	}
+	for _, l := range a[len(a)-end:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+// serveChanges answers /_markdownd/api/changed/<path> with the changes
+// between the previous and current rendering of a page served since
+// markdownd started
+func (h Handler) serveChanges(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, changesPrefix)
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += h.index()
+	}
+	b, err := fs.ReadFile(h.Root, name)
+	if !strings.HasSuffix(name, ".md") || !fs.ValidPath(name) || err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if fm, _ := parseFrontMatter(b); hideDraft(name, fm) {
+		http.NotFound(w, r)
+		return
+	}
+	p, ok := versions.history(h.versionKey(name))
+	if !ok {
+		http.Error(w, "404 no earlier version of "+name+" was served", http.StatusNotFound)
+		return
+	}
+	ops := diffLines(strings.Split(string(p.previous.html), "\n"), strings.Split(string(p.current.html), "\n"))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	var out bytes.Buffer
+	title := html.EscapeString(name)
+	fmt.Fprintf(&out, `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Changes to %s</title>
+<style>
+body { font: 14px system-ui, sans-serif; margin: 2em; }
+pre { font-size: 13px; line-height: 1.4; }
+del, ins { display: block; text-decoration: none; }
+del { background: #ffeef0; }
+ins { background: #e6ffed; }
+</style>
+</head>
+<body>
+<h1>Changes to <a href="%s">%s</a></h1>
+<p>rendered <time>%s</time>, before <time>%s</time></p>
+<pre class="diff">`, title, html.EscapeString(h.Prefix+h.pageURL(name)), title,
+		p.current.at.UTC().Format(time.RFC3339), p.previous.at.UTC().Format(time.RFC3339))
+	for _, op := range ops {
+		line := html.EscapeString(op.line)
+		switch op.op {
+		case '-':
+			out.WriteString("<del>- " + line + "</del>")
+		case '+':
+			out.WriteString("<ins>+ " + line + "</ins>")
+		default:
+			out.WriteString("  " + line + "\n")
+		}
+	}
+	out.WriteString("</pre>\n</body>\n</html>\n")
+	w.Write(out.Bytes())
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestDiffLines(t *testing.T) {
+	a := strings.Split("a b c d e", " ")
+	b := strings.Split("a c d x e", " ")
+	var got []string
+	for _, op := range diffLines(a, b) {
+		got = append(got, string(op.op)+op.line)
+	}
+	expected := " a -b  c  d +x  e"
+	if s := strings.Join(got, " "); s != expected {
+		t.Logf("expected %q, got %q", expected, s)
+		t.Fail()
+	}
+}
+
+func TestChanges(t *testing.T) {
+	defer func(b bool, v *versionStore) { *changes, versions = b, v }(*changes, versions)
+	*changes, versions = true, newVersionStore(1<<20)
+	fsys := fstest.MapFS{"page.md": {Data: []byte("# Page\n\nfirst words\n"), ModTime: time.Now().Add(-time.Hour)}}
+	h := Handler{Root: fsys}
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+	get("/page.md")
+	if rec := get(changesPrefix + "page.md"); rec.Code != 404 {
+		t.Logf("changes before any change: %d", rec.Code)
+		t.Fail()
+	}
+	fsys["page.md"] = &fstest.MapFile{Data: []byte("# Page\n\nnew words\n"), ModTime: time.Now()}
+	get("/page.md")
+	rec := get(changesPrefix + "page.md")
+	if body := rec.Body.String(); rec.Code != 200 || !strings.Contains(body, "<del>- &lt;p&gt;first words") || !strings.Contains(body, "<ins>+ &lt;p&gt;new words") {
+		t.Logf("changes: %d %s", rec.Code, body)
+		t.Fail()
+	}
+	if rec := get(changesPrefix + "missing.md"); rec.Code != 404 {
+		t.Logf("changes of a missing page: %d", rec.Code)
+		t.Fail()
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shurcooL/sanitized_anchor_name"
+)
+
+// links in a line of markdown: inline links and images, reference
+// definitions, and html href and src attributes
+var (
+	reCheckInline = regexp.MustCompile(`\]\(\s*<?([^)\s>]+)>?[^)]*\)`)
+	reCheckRef    = regexp.MustCompile(`^\s{0,3}\[[^\]]+\]:\s*<?([^\s>]+)`)
+	reCheckHTML   = regexp.MustCompile(`\s(?:href|src)\s*=\s*["']([^"']*)["']`)
+	reCodeSpan    = regexp.MustCompile("`+[^`]*`+")
+)
+
+// brokenLink is a link that doesn't resolve, lines start at 1
+type brokenLink struct {
+	File    string
+	Line    int
+	Link    string
+	Message string
+}
+
+// pageLink is a link found in a page
+type pageLink struct {
+	file string
+	line int
+	link string
+	wiki bool
+}
+
+// findLinks returns the links written in the page rel, outside of code
+func findLinks(rel string, b []byte) []pageLink {
+	_, md := parseFrontMatter(b)
+	line := 1
+	if bytes.HasSuffix(b, md) {
+		line += bytes.Count(b[:len(b)-len(md)], []byte("\n"))
+	}
+	var links []pageLink
+	var fenced bool
+	for _, text := range strings.Split(string(md), "\n") {
+		trimmed := strings.TrimSpace(text)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+		}
+		if !fenced && !strings.HasPrefix(text, "    ") && !strings.HasPrefix(text, "\t") {
+			text = reCodeSpan.ReplaceAllString(text, "")
+			for _, re := range []*regexp.Regexp{reCheckInline, reCheckRef, reCheckHTML} {
+				for _, m := range re.FindAllStringSubmatch(text, -1) {
+					links = append(links, pageLink{file: rel, line: line, link: m[1]})
+				}
+			}
+			for _, m := range reWikiLink.FindAllStringSubmatch(text, -1) {
+				links = append(links, pageLink{file: rel, line: line, link: strings.TrimSpace(m[1]) + m[2], wiki: true})
+			}
+		}
+		line++
+	}
+	return links
+}
+
+// checkLink reports what is wrong with an internal link, or "". external
+// links are left to checkExternal.
+func (h Handler) checkLink(pages []string, l pageLink) string {
+	if l.wiki {
+		target, anchor := l.link, ""
+		if i := strings.Index(target, "#"); i != -1 {
+			target, anchor = target[:i], target[i+1:]
+		}
+		page, ok := resolveWiki(pages, l.file, target)
+		if !ok {
+			return "no page named " + target
+		}
+		if anchor != "" && !hasAnchor(filepath.Join(h.RootString, filepath.FromSlash(page)), sanitized_anchor_name.Create(anchor)) {
+			return "no heading " + anchor + " in " + page
+		}
+		return ""
+	}
+	if l.link == "" || strings.HasPrefix(l.link, "{{") {
+		return ""
+	}
+	res := h.resolveLink(l.file, l.link)
+	switch {
+	case res.External:
+		return ""
+	case !res.Exists:
+		urlpath := strings.SplitN(res.URL, "#", 2)[0]
+		if _, _, ok := h.tagPage(urlpath); ok && *tagPages {
+			return ""
+		}
+		// a directory with a generated index
+		if abs, ok := h.localPath(urlpath); ok && h.index() == "gen" {
+			if fi, err := os.Stat(abs); err == nil && fi.IsDir() {
+				return ""
+			}
+		}
+		return "no such file"
+	case res.Anchor != "" && strings.HasSuffix(res.File, ".md") && !res.AnchorOK:
+		return "no heading #" + res.Anchor + " in " + strings.TrimPrefix(res.File, "/")
+	}
+	return ""
+}
+
+// hasAnchor reports whether the markdown file abs has a heading with the id
+func hasAnchor(abs, id string) bool {
+	b, err := ioutil.ReadFile(abs)
+	if err != nil {
+		return false
+	}
+	_, md := parseFrontMatter(b)
+	for _, a := range pageAnchors(md) {
+		if a == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLinks checks the links of every markdown file under the root,
+// and http and https links too with workers > 0
+func (h Handler) checkLinks(workers int) []brokenLink {
+	pages := h.wikiPages()
+	var broken []brokenLink
+	external := map[string][]pageLink{}
+	walkMarkdown(h.RootString, func(abs, rel string) error {
+		b, err := ioutil.ReadFile(abs)
+		if err != nil {
+			broken = append(broken, brokenLink{File: rel, Line: 1, Link: rel, Message: err.Error()})
+			return nil
+		}
+		for _, l := range findLinks(rel, b) {
+			if !l.wiki && (strings.HasPrefix(l.link, "http://") || strings.HasPrefix(l.link, "https://") || strings.HasPrefix(l.link, "//")) {
+				external[l.link] = append(external[l.link], l)
+				continue
+			}
+			if msg := h.checkLink(pages, l); msg != "" {
+				broken = append(broken, brokenLink{File: l.file, Line: l.line, Link: l.link, Message: msg})
+			}
+		}
+		return nil
+	})
+	if workers > 0 {
+		for link, msg := range checkExternal(external, workers) {
+			for _, l := range external[link] {
+				broken = append(broken, brokenLink{File: l.file, Line: l.line, Link: l.link, Message: msg})
+			}
+		}
+	}
+	sort.Slice(broken, func(i, j int) bool {
+		if broken[i].File != broken[j].File {
+			return broken[i].File < broken[j].File
+		}
+		return broken[i].Line < broken[j].Line
+	})
+	return broken
+}
+
+// checkExternal requests each url once with a pool of workers, and
+// returns what is wrong with the urls that fail
+func checkExternal(links map[string][]pageLink, workers int) map[string]string {
+	urls := make(chan string)
+	failed := map[string]string{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range urls {
+				if msg := checkURL(u); msg != "" {
+					mu.Lock()
+					failed[u] = msg
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for u := range links {
+		urls <- u
+	}
+	close(urls)
+	wg.Wait()
+	return failed
+}
+
+// checkURL requests u, with HEAD and then GET for servers refusing HEAD,
+// and returns the error or bad status, or ""
+func checkURL(u string) string {
+	if strings.HasPrefix(u, "//") {
+		u = "https:" + u
+	}
+	// the fragment is for the browser
+	if i := strings.Index(u, "#"); i != -1 {
+		u = u[:i]
+	}
+	var status int
+	for _, method := range []string{"HEAD", "GET"} {
+		req, err := http.NewRequest(method, u, nil)
+		if err != nil {
+			return err.Error()
+		}
+		req.Header.Set("User-Agent", serverheader)
+		resp, err := outboundClient().Do(req)
+		if err != nil {
+			return err.Error()
+		}
+		resp.Body.Close()
+		status = resp.StatusCode
+		if status < 400 {
+			return ""
+		}
+		if status != http.StatusMethodNotAllowed && status != http.StatusNotImplemented && status != http.StatusForbidden {
+			break
+		}
+	}
+	return fmt.Sprintf("%d %s", status, http.StatusText(status))
+}
+
+// checkCommand checks the links of a directory, 'markdownd check dir'
+func checkCommand(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	external := fs.Bool("external", false, "check http and https links too")
+	workers := fs.Int("workers", 8, "check this many external links at once")
+	index := fs.String("index", "index.md", "filename served for paths ending in '/', as with markdownd -index")
+	fs.BoolVar(tagPages, "tags", false, "links to tag pages resolve, as with markdownd -tags")
+	schemaFile := fs.String("schemas", "", "check front matter with this json file of schemas, as with markdownd -schemas")
+	outbound.flags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: markdownd check [flags] <directory>")
+		fmt.Fprintln(os.Stderr, "checks that links, wiki links and #anchors in every markdown file resolve\n"+
+			"to files and headings, and front matter follows -schemas, and exits 1 if not")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *workers < 1 {
+		fs.Usage()
+		os.Exit(111)
+	}
+	dir := prepareDirectory(fs.Arg(0))
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		fmt.Fprintln(os.Stderr, "check: not a directory:", fs.Arg(0))
+		os.Exit(111)
+	}
+	if *schemaFile != "" {
+		if err := schemas.readFile(*schemaFile); err != nil {
+			fmt.Fprintln(os.Stderr, "check:", err)
+			os.Exit(111)
+		}
+	}
+	h := Handler{Root: os.DirFS(dir), RootString: dir, Index: *index}
+	n := *workers
+	if !*external {
+		n = 0
+	}
+	broken := h.checkLinks(n)
+	for _, b := range broken {
+		fmt.Printf("%s:%d: %s: %s\n", filepath.Join(fs.Arg(0), filepath.FromSlash(b.File)), b.Line, b.Link, b.Message)
+	}
+	invalid := checkSchemas(dir)
+	for _, b := range invalid {
+		fmt.Printf("%s:%d: %s\n", filepath.Join(fs.Arg(0), filepath.FromSlash(b.File)), b.Line, b.Message)
+	}
+	if len(invalid) != 0 {
+		fmt.Fprintln(os.Stderr, len(invalid), "front matter problems")
+	}
+	if len(broken) != 0 {
+		fmt.Fprintln(os.Stderr, len(broken), "broken links")
+	}
+	if len(broken) != 0 || len(invalid) != 0 {
+		os.Exit(1)
+	}
+}
+
+// checkSchemas returns the front matter in dir that doesn't follow the
+// -schemas of its type
+func checkSchemas(dir string) []brokenLink {
+	var invalid []brokenLink
+	if len(schemas) == 0 {
+		return invalid
+	}
+	walkMarkdown(dir, func(abs, rel string) error {
+		if b, err := ioutil.ReadFile(abs); err == nil {
+			for _, d := range schemaDiagnostics(b) {
+				invalid = append(invalid, brokenLink{File: rel, Line: d.Line, Message: d.Message})
+			}
+		}
+		return nil
+	})
+	return invalid
+}
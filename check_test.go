@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckLinks(t *testing.T) {
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer remote.Close()
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	err = writeFiles(dir, map[string]string{
+		"index.md": "---\ntitle: Home\n---\n# Home\n\n" +
+			"[setup](guide/setup.md#install) [bad anchor](guide/setup.md#nope) [top](#home)\n" +
+			"[missing](nope.md) ![logo](img/logo.png) <a href=\"/guide/\">guide</a>\n" +
+			"[[Setup#Install]] [[Nowhere]] `[code](nope.md)`\n\n" +
+			"```\n[fenced](nope.md)\n```\n\n" +
+			"[ok](" + remote.URL + "/ok) [gone](" + remote.URL + "/gone) [mail](mailto:a@example.com)\n\n" +
+			"[ref]: other/\n",
+		"guide/index.md": "# Guide\n",
+		"guide/setup.md": "# Setup\n\n## Install\n\n[back](../index.md) [tags](/tags/)\n",
+		"img/logo.png":   "png",
+	}, false)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	root := prepareDirectory(dir)
+	h := Handler{Root: os.DirFS(root), RootString: root}
+	format := func(broken []brokenLink) string {
+		var lines []string
+		for _, b := range broken {
+			lines = append(lines, fmt.Sprintf("%s:%d: %s: %s", b.File, b.Line, b.Link, b.Message))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	defer func(on bool) { *tagPages = on }(*tagPages)
+	*tagPages = false
+	want := strings.Join([]string{
+		"guide/setup.md:5: /tags/: no such file",
+		"index.md:6: guide/setup.md#nope: no heading #nope in guide/setup.md",
+		"index.md:7: nope.md: no such file",
+		"index.md:8: Nowhere: no page named Nowhere",
+		"index.md:16: other/: no such file",
+	}, "\n")
+	if got := format(h.checkLinks(0)); got != want {
+		t.Logf("internal links:\n%s\nwant\n%s", got, want)
+		t.Fail()
+	}
+
+	*tagPages = true
+	want = strings.Join([]string{
+		"index.md:6: guide/setup.md#nope: no heading #nope in guide/setup.md",
+		"index.md:7: nope.md: no such file",
+		"index.md:8: Nowhere: no page named Nowhere",
+		"index.md:14: " + remote.URL + "/gone: 404 Not Found",
+		"index.md:16: other/: no such file",
+	}, "\n")
+	if got := format(h.checkLinks(2)); got != want {
+		t.Logf("with -tags and -external:\n%s\nwant\n%s", got, want)
+		t.Fail()
+	}
+}
@@ -0,0 +1,83 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command markdownd-wasm is the markdownd render pipeline compiled to
+// WebAssembly, for previews rendered in the browser. Build it with
+// 'make wasm' and load it with markdownd.js:
+//
+//	const md = await loadMarkdownd("markdownd.wasm")
+//	const page = md.render("# Title\n\ntext", {toc: true})
+//	preview.innerHTML = page.html
+//
+// It renders as markdownd.RenderPage does: front matter, markdown, the
+// table of contents and sanitizing. What the server adds around it is
+// left as written, as it needs the served directory, the request or the
+// server's flags:
+//
+//   - includes ('<!--include: file-->') and '{{< shortcodes >}}'
+//   - [[wiki links]] of -wiki
+//   - code block annotations and code tabs
+//   - -plugins, link rewrites and forms
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/aerth/markdownd/pkg/markdownd"
+)
+
+// options reads render options from a javascript object, which may be
+// undefined
+func options(v js.Value) markdownd.RenderOptions {
+	var o markdownd.RenderOptions
+	if v.Type() != js.TypeObject {
+		return o
+	}
+	flag := func(name string) bool {
+		f := v.Get(name)
+		return f.Type() == js.TypeBoolean && f.Bool()
+	}
+	o.TOC = flag("toc")
+	o.Plain = flag("plain")
+	o.NoInlineHTML = flag("noInlineHTML")
+	return o
+}
+
+// render is markdownd.render(source, options), returning
+// {html, title, frontMatter}
+func render(this js.Value, args []js.Value) interface{} {
+	if len(args) == 0 || args[0].Type() != js.TypeString {
+		return map[string]interface{}{"error": "render: expected markdown source as a string"}
+	}
+	var o js.Value
+	if len(args) > 1 {
+		o = args[1]
+	}
+	page := markdownd.RenderPage([]byte(args[0].String()), options(o))
+
+	// front matter values are strings or lists of strings
+	fm := map[string]interface{}{}
+	for k, v := range page.FrontMatter {
+		if list, ok := v.([]string); ok {
+			items := make([]interface{}, len(list))
+			for i, item := range list {
+				items[i] = item
+			}
+			v = items
+		}
+		fm[k] = v
+	}
+	return map[string]interface{}{
+		"html":        string(page.HTML),
+		"title":       page.Title,
+		"frontMatter": fm,
+	}
+}
+
+func main() {
+	js.Global().Set("markdownd", map[string]interface{}{
+		"render": js.FuncOf(render),
+	})
+	// keep the functions callable
+	select {}
+}
@@ -0,0 +1,51 @@
+// markdownd.js loads markdownd.wasm, the markdownd render pipeline, so
+// pages can be previewed in the browser as markdownd will serve them.
+// it needs wasm_exec.js from the go distribution loaded first ('make wasm'
+// copies both next to each other).
+//
+//	<script src="wasm_exec.js"></script>
+//	<script src="markdownd.js"></script>
+//	<script>
+//	loadMarkdownd("markdownd.wasm").then(md => {
+//		preview.innerHTML = md.render(editor.value, {toc: true}).html
+//	})
+//	</script>
+//
+// render(source, options) returns {html, title, frontMatter}, or {error}.
+// options are toc, plain and noInlineHTML, as the flags of markdownd.
+(function (root) {
+	"use strict";
+
+	var loading = null;
+
+	function loadMarkdownd(url) {
+		if (loading) {
+			return loading;
+		}
+		var go = new Go();
+		var start = function (result) {
+			go.run(result.instance);
+			return {
+				render: function (source, options) {
+					return root.markdownd.render(String(source), options || {});
+				}
+			};
+		};
+		if (WebAssembly.instantiateStreaming) {
+			loading = WebAssembly.instantiateStreaming(fetch(url), go.importObject).then(start);
+		} else {
+			loading = fetch(url).then(function (resp) {
+				return resp.arrayBuffer();
+			}).then(function (b) {
+				return WebAssembly.instantiate(b, go.importObject);
+			}).then(start);
+		}
+		return loading;
+	}
+
+	if (typeof module === "object" && module.exports) {
+		module.exports = loadMarkdownd;
+	} else {
+		root.loadMarkdownd = loadMarkdownd;
+	}
+})(typeof globalThis !== "undefined" ? globalThis : this);
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// a fence opening with an annotation after the language,
+	// ```go {3-5} or ```go {1,4 title="main.go"}
+	reFenceAnnotation = regexp.MustCompile("^(\\s*(?:```|~~~)[^`{]*?)\\s*\\{([^{}]*)\\}\\s*$")
+	reCodeTitle       = regexp.MustCompile(`title\s*=\s*(?:"([^"]*)"|(\S+))`)
+	reTabsShortcode   = regexp.MustCompile(`^\{\{<\s*(/?)tabs\s*>\}\}$`)
+	rePreBlock        = regexp.MustCompile(`(?s)<div class="highlight[^"]*"><pre[^>]*>(.*?)</pre></div>|<pre[^>]*>(.*?)</pre>`)
+	reCodeTag         = regexp.MustCompile(`^<code[^>]*>`)
+	reSpanTag         = regexp.MustCompile(`</?span[^>]*>`)
+)
+
+// codeAnnotation is what the fence of a code block asked for
+type codeAnnotation struct {
+	code  string   // the code, to find the block in the html
+	lines [][2]int // highlighted line ranges, from 1
+	title string
+	lang  string // from the info string, such as go
+	tabs  int    // the {{< tabs >}} group of the block, from 1, or 0
+	tab   string // its tab label: the title or the language
+}
+
+// highlighted reports whether line n is in a highlighted range
+func (a codeAnnotation) highlighted(n int) bool {
+	for _, r := range a.lines {
+		if n >= r[0] && n <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// tabLang is what ?lang= picks the tab with: its language, or its label
+func (a codeAnnotation) tabLang() string {
+	if a.lang != "" {
+		return a.lang
+	}
+	return a.tab
+}
+
+// forLang reports whether the tab is for the language lang, by its
+// language or label in any case
+func (a codeAnnotation) forLang(lang string) bool {
+	return lang != "" && (strings.EqualFold(a.lang, lang) || strings.EqualFold(a.tab, lang))
+}
+
+// parseCodeAnnotation reads '3-5', '1,4' and 'title="main.go"' from the
+// braces after a fence. unknown words are ignored.
+func parseCodeAnnotation(spec string) codeAnnotation {
+	var a codeAnnotation
+	if m := reCodeTitle.FindStringSubmatch(spec); m != nil {
+		a.title = m[1] + m[2]
+		spec = strings.Replace(spec, m[0], " ", 1)
+	}
+	for _, word := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		from, to := word, word
+		if i := strings.IndexByte(word, '-'); i != -1 {
+			from, to = word[:i], word[i+1:]
+		}
+		a1, err1 := strconv.Atoi(from)
+		a2, err2 := strconv.Atoi(to)
+		if err1 == nil && err2 == nil && a1 >= 1 && a2 >= a1 {
+			a.lines = append(a.lines, [2]int{a1, a2})
+		}
+	}
+	return a
+}
+
+// codeAnnotations removes the annotations from the fences of md, so the
+// renderer sees only the language, and returns them in order. the code
+// blocks between '{{< tabs >}}' and '{{< /tabs >}}' lines become tabs,
+// labelled by their title or language.
+func codeAnnotations(md []byte) ([]byte, []codeAnnotation) {
+	if !bytes.Contains(md, []byte("{")) {
+		return md, nil
+	}
+	var annotations []codeAnnotation
+	var out bytes.Buffer
+	var fence string // the opening fence, while in a block
+	var current *codeAnnotation
+	var code []string
+	var tabs, group int
+	for _, line := range strings.SplitAfter(string(md), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence == "" && reTabsShortcode.MatchString(trimmed):
+			if reTabsShortcode.FindStringSubmatch(trimmed)[1] == "" {
+				tabs++
+				group = tabs
+			} else {
+				group = 0
+			}
+			line = line[len(strings.TrimRight(line, "\r\n")):]
+		case fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			fence = trimmed[:3]
+			current, code = nil, nil
+			if m := reFenceAnnotation.FindStringSubmatch(strings.TrimRight(line, "\r\n")); m != nil {
+				a := parseCodeAnnotation(m[2])
+				current = &a
+				line = m[1] + line[len(strings.TrimRight(line, "\r\n")):]
+			}
+			if group != 0 {
+				if current == nil {
+					current = &codeAnnotation{}
+				}
+				if info := strings.Fields(strings.TrimLeft(strings.TrimSpace(line), fence[:1])); len(info) != 0 {
+					current.lang = info[0]
+				}
+				current.tabs, current.tab = group, current.title
+				if current.tab == "" {
+					current.tab = current.lang
+				}
+				if current.tab == "" {
+					current.tab = "Code"
+				}
+			}
+		case fence != "" && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "":
+			fence = ""
+			if current != nil {
+				current.code = strings.Join(code, "")
+				annotations = append(annotations, *current)
+			}
+		case fence != "":
+			code = append(code, strings.TrimRight(line, "\r\n")+"\n")
+		}
+		out.WriteString(line)
+	}
+	return out.Bytes(), annotations
+}
+
+// annotateCode applies the annotations to the code blocks rendered from
+// them: highlighted lines get the class 'line hl', the others 'line',
+// and a title comes before the block as <div class="code-title">. tabs
+// are a tablist before the first block of a group, and a tabpanel around
+// each block, the one for lang shown and the others hidden until the
+// tabs component or a ?lang= link switches them. blocks are found by
+// their code, so other <pre> in the page don't count.
+func annotateCode(page []byte, annotations []codeAnnotation, lang string) []byte {
+	if len(annotations) == 0 {
+		return page
+	}
+	groups := map[int][]codeAnnotation{}
+	selected := map[int]int{} // the tab shown in each group
+	for _, a := range annotations {
+		if a.tabs == 0 {
+			continue
+		}
+		if _, ok := selected[a.tabs]; !ok && a.forLang(lang) {
+			selected[a.tabs] = len(groups[a.tabs])
+		}
+		groups[a.tabs] = append(groups[a.tabs], a)
+	}
+	panels := map[int]int{} // of each group so far
+	return rePreBlock.ReplaceAllFunc(page, func(m []byte) []byte {
+		if len(annotations) == 0 {
+			return m
+		}
+		sub := rePreBlock.FindSubmatch(m)
+		inner := sub[1]
+		if inner == nil {
+			inner = sub[2]
+		}
+		text := html.UnescapeString(reTag.ReplaceAllString(string(inner), ""))
+		var a codeAnnotation
+		for i, c := range annotations {
+			if strings.TrimRight(c.code, "\n") == strings.TrimRight(text, "\n") {
+				a = c
+				annotations = append(annotations[:i:i], annotations[i+1:]...)
+				break
+			}
+			if i == len(annotations)-1 {
+				return m
+			}
+		}
+		var b bytes.Buffer
+		if a.tabs != 0 {
+			n := panels[a.tabs]
+			panels[a.tabs]++
+			if n == 0 {
+				// links, so tabs switch without javascript too
+				fmt.Fprintf(&b, `<div class="md-tabs" role="tablist" id="md-tabs-%d" data-tabs="%d">`, a.tabs, a.tabs)
+				for i, t := range groups[a.tabs] {
+					fmt.Fprintf(&b, `<a role="tab" href="?lang=%s#md-tabs-%d" id="md-tab-%d-%d" aria-controls="md-tabpanel-%d-%d" aria-selected="%t" data-lang="%s">%s</a>`,
+						html.EscapeString(url.QueryEscape(t.tabLang())), a.tabs, a.tabs, i, a.tabs, i, i == selected[a.tabs],
+						html.EscapeString(t.tabLang()), html.EscapeString(t.tab))
+				}
+				b.WriteString("</div>\n")
+			}
+			hidden := ""
+			if n != selected[a.tabs] {
+				hidden = " hidden"
+			}
+			fmt.Fprintf(&b, `<div class="md-tabpanel" role="tabpanel" id="md-tabpanel-%d-%d" aria-labelledby="md-tab-%d-%d" data-tabs="%d" data-tab="%s"%s>`,
+				a.tabs, n, a.tabs, n, a.tabs, html.EscapeString(a.tab), hidden)
+		}
+		if a.title != "" {
+			b.WriteString(`<div class="code-title">` + html.EscapeString(a.title) + `</div>`)
+		}
+		if len(a.lines) == 0 {
+			b.Write(m)
+		} else {
+			start := bytes.Index(m, inner)
+			b.Write(m[:start])
+			// lines go inside <code>, if there is one
+			open := reCodeTag.Find(inner)
+			body := bytes.TrimSuffix(inner[len(open):], []byte("</code>"))
+			b.Write(open)
+			b.Write(wrapLines(body, a))
+			b.Write(inner[len(open)+len(body):])
+			b.Write(m[start+len(inner):])
+		}
+		if a.tabs != 0 {
+			b.WriteString("</div>")
+		}
+		return b.Bytes()
+	})
+}
+
+// langCookie keeps the language picked with ?lang= or a tab, for the
+// next pages
+const langCookie = "markdownd-lang"
+
+// codeLang returns the language of the code tabs to show: ?lang=, which
+// is then kept in a cookie under prefix, or the one in the cookie
+func codeLang(w http.ResponseWriter, r *http.Request, prefix string) string {
+	if lang := r.URL.Query().Get("lang"); lang != "" && len(lang) <= 64 {
+		http.SetCookie(w, &http.Cookie{
+			Name:     langCookie,
+			Value:    url.QueryEscape(lang),
+			Path:     prefix + "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return lang
+	}
+	if c, err := r.Cookie(langCookie); err == nil {
+		if lang, err := url.QueryUnescape(c.Value); err == nil {
+			return lang
+		}
+	}
+	return ""
+}
+
+// wrapLines puts each line of highlighted code in a span, closing the
+// spans of the highlighter at the end of a line and opening them again on
+// the next, so every line is whole
+func wrapLines(code []byte, a codeAnnotation) []byte {
+	var b bytes.Buffer
+	var open []string // span tags open at this point
+	n := 1
+	startLine := func() {
+		if a.highlighted(n) {
+			b.WriteString(`<span class="line hl">`)
+		} else {
+			b.WriteString(`<span class="line">`)
+		}
+		for _, tag := range open {
+			b.WriteString(tag)
+		}
+	}
+	endLine := func() {
+		b.WriteString(strings.Repeat("</span>", len(open)+1))
+	}
+	s := strings.TrimSuffix(string(code), "\n")
+	startLine()
+	for len(s) > 0 {
+		loc := reSpanTag.FindStringIndex(s)
+		text := s
+		if loc != nil {
+			text = s[:loc[0]]
+		}
+		for i, line := range strings.Split(text, "\n") {
+			if i > 0 {
+				endLine()
+				b.WriteString("\n")
+				n++
+				startLine()
+			}
+			b.WriteString(line)
+		}
+		if loc == nil {
+			break
+		}
+		tag := s[loc[0]:loc[1]]
+		b.WriteString(tag)
+		if strings.HasPrefix(tag, "</") {
+			if len(open) != 0 {
+				open = open[:len(open)-1]
+			}
+		} else {
+			open = append(open, tag)
+		}
+		s = s[loc[1]:]
+	}
+	endLine()
+	if strings.HasSuffix(string(code), "\n") {
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCodeAnnotations(t *testing.T) {
+	src := "# x\n\n```go {2-3,5 title=\"main.go\"}\na\nb\nc\nd\ne\n```\n\n```\n{1}\n```\n\n~~~ {1}\n<one>\ntwo\n~~~\n"
+	md, annotations := codeAnnotations([]byte(src))
+	if want := "# x\n\n```go\na\nb\nc\nd\ne\n```\n\n```\n{1}\n```\n\n~~~\n<one>\ntwo\n~~~\n"; string(md) != want {
+		t.Logf("fences: %q, expected %q", md, want)
+		t.Fail()
+	}
+	if len(annotations) != 2 || annotations[0].title != "main.go" || annotations[0].code != "a\nb\nc\nd\ne\n" ||
+		!annotations[0].highlighted(3) || annotations[0].highlighted(4) || !annotations[0].highlighted(5) {
+		t.Logf("annotations: %+v", annotations)
+		t.FailNow()
+	}
+
+	page := annotateCode(markdown2html(md), annotations, "")
+	for _, want := range []string{
+		`<div class="code-title">main.go</div>`,
+		"<span class=\"line\">a</span>\n<span class=\"line hl\">b</span>\n<span class=\"line hl\">c</span>\n<span class=\"line\">d</span>\n<span class=\"line hl\">e</span>\n",
+		"<code>{1}\n</code>",
+		"<span class=\"line hl\">&lt;one&gt;</span>\n<span class=\"line\">two</span>\n</code></pre>",
+	} {
+		if !strings.Contains(string(page), want) {
+			t.Logf("expected %q in\n%s", want, page)
+			t.Fail()
+		}
+	}
+
+	// highlighter spans crossing lines are closed and opened again
+	got := string(wrapLines([]byte("<span class=\"com\">/* a\nb */</span> x\n"), parseCodeAnnotation("2")))
+	if want := "<span class=\"line\"><span class=\"com\">/* a</span></span>\n<span class=\"line hl\"><span class=\"com\">b */</span> x</span>\n"; got != want {
+		t.Logf("wrapped %q, expected %q", got, want)
+		t.Fail()
+	}
+}
+
+func TestCodeTabs(t *testing.T) {
+	src := "{{< tabs >}}\n```sh\ncurl -s localhost\n```\n\n```go {1 title=\"Go\"}\nhttp.Get(url)\n```\n{{< /tabs >}}\n\n```py\noutside\n```\n"
+	md, annotations := codeAnnotations([]byte(src))
+	if strings.Contains(string(md), "tabs") {
+		t.Logf("shortcode lines left in %q", md)
+		t.Fail()
+	}
+	if len(annotations) != 2 || annotations[0].tab != "sh" || annotations[1].tab != "Go" || annotations[1].tabs != 1 {
+		t.Logf("annotations: %+v", annotations)
+		t.FailNow()
+	}
+	page := string(annotateCode(markdown2html(md), annotations, ""))
+	for _, want := range []string{
+		`<div class="md-tabs" role="tablist" id="md-tabs-1" data-tabs="1"><a role="tab" href="?lang=sh#md-tabs-1" id="md-tab-1-0" aria-controls="md-tabpanel-1-0" aria-selected="true" data-lang="sh">sh</a>`,
+		`<a role="tab" href="?lang=go#md-tabs-1" id="md-tab-1-1" aria-controls="md-tabpanel-1-1" aria-selected="false" data-lang="go">Go</a></div>`,
+		`<div class="md-tabpanel" role="tabpanel" id="md-tabpanel-1-0" aria-labelledby="md-tab-1-0" data-tabs="1" data-tab="sh">`,
+		`<div class="md-tabpanel" role="tabpanel" id="md-tabpanel-1-1" aria-labelledby="md-tab-1-1" data-tabs="1" data-tab="Go" hidden><div class="code-title">Go</div>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Logf("expected %q in\n%s", want, page)
+			t.Fail()
+		}
+	}
+	if n := strings.Count(page, "md-tabpanel\""); n != 2 || strings.Count(page, "<div") != strings.Count(page, "</div>") {
+		t.Logf("%d panels, unbalanced divs in\n%s", n, page)
+		t.Fail()
+	}
+
+	// ?lang= shows the tab for the language, by label or language
+	for _, lang := range []string{"GO", "go"} {
+		page = string(annotateCode(markdown2html(md), annotations, lang))
+		if !strings.Contains(page, `data-tab="sh" hidden>`) || !strings.Contains(page, `aria-selected="true" data-lang="go"`) {
+			t.Logf("lang %s:\n%s", lang, page)
+			t.Fail()
+		}
+	}
+	h := Handler{Root: fstest.MapFS{"index.md": {Data: []byte(src)}}, Prefix: "/docs"}
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lang=go", nil)
+	h.ServeHTTP(rec, req)
+	if c := rec.Header().Get("Set-Cookie"); !strings.HasPrefix(c, langCookie+"=go; Path=/docs/;") || !strings.Contains(rec.Body.String(), `data-tab="sh" hidden>`) {
+		t.Logf("cookie %q, page\n%s", c, rec.Body.String())
+		t.Fail()
+	}
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: langCookie, Value: "go"})
+	h.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), `data-tab="sh" hidden>`) || !strings.Contains(strings.Join(rec.Header()["Vary"], ", "), "Cookie") {
+		t.Logf("cookie ignored, vary %q, page\n%s", rec.Header()["Vary"], rec.Body.String())
+		t.Fail()
+	}
+}
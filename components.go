@@ -0,0 +1,260 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// componentsPrefix is where page components are served, for layouts and
+// -header files to load with a script tag
+const componentsPrefix = "/_markdownd/assets/"
+
+// components are scripts a layout can add to its pages. each one styles
+// itself from css custom properties, so a theme sets its colors and sizes
+// in its own stylesheet:
+//
+//	progress.js  a bar at the top of the window filling as the page is
+//	             read. --md-progress-color, --md-progress-height
+//	toc.js       fills the element with data-toc (or id toc) with links to
+//	             the h2 and h3 headings, or uses the list already in it
+//	             (such as the one -toc writes), and marks the link of the
+//	             section being read with the class active. data-headings
+//	             picks other headings. --md-toc-active-color
+//	code.js      adds a copy button to code blocks, and shows highlighted
+//	             lines. --md-code-highlight, --md-code-title-background
+//	tabs.js      switches between the code blocks of a {{< tabs >}} group,
+//	             picking the same language in every group of the page, and
+//	             keeps it in the cookie ?lang= sets, for the next pages.
+//	             --md-tabs-active-color
+var components = map[string]string{
+	"progress.js": `(function () {
+  var bar = document.createElement("div");
+  bar.className = "md-progress";
+  bar.setAttribute("role", "progressbar");
+  bar.setAttribute("aria-label", "Reading progress");
+  bar.style.cssText = "position:fixed;top:0;left:0;z-index:1000;width:0;" +
+    "height:var(--md-progress-height,3px);background:var(--md-progress-color,#0366d6);" +
+    "transition:width .1s linear";
+  function update() {
+    var doc = document.documentElement, max = doc.scrollHeight - doc.clientHeight;
+    var done = max > 0 ? Math.min(100, Math.round(100 * doc.scrollTop / max)) : 100;
+    bar.style.width = done + "%";
+    bar.setAttribute("aria-valuenow", done);
+  }
+  function start() {
+    document.body.appendChild(bar);
+    update();
+    window.addEventListener("scroll", update, {passive: true});
+    window.addEventListener("resize", update);
+  }
+  if (document.readyState === "loading") document.addEventListener("DOMContentLoaded", start);
+  else start();
+})();
+`,
+
+	"code.js": `(function () {
+  function copy(text) {
+    if (navigator.clipboard && window.isSecureContext) return navigator.clipboard.writeText(text);
+    var area = document.createElement("textarea");
+    area.value = text;
+    area.style.cssText = "position:fixed;opacity:0";
+    document.body.appendChild(area);
+    area.select();
+    try { document.execCommand("copy"); } finally { document.body.removeChild(area); }
+    return Promise.resolve();
+  }
+  function start() {
+    var style = document.createElement("style");
+    style.textContent = ".md-code { position: relative; }" +
+      ".md-copy { position: absolute; top: .4em; right: .4em; font-size: .8em; padding: .2em .6em; cursor: pointer;" +
+      " border: 1px solid #ccc; border-radius: 4px; background: #fff; opacity: .6; }" +
+      ".md-code:hover .md-copy, .md-copy:focus { opacity: 1; }" +
+      "pre .line { display: inline-block; min-width: 100%; }" +
+      "pre .line.hl { background: var(--md-code-highlight, rgba(255, 220, 0, .25)); }" +
+      ".code-title { font-size: .85em; padding: .3em 1em; background: var(--md-code-title-background, #eaecef); }";
+    document.head.appendChild(style);
+    document.querySelectorAll("pre").forEach(function (pre) {
+      if (pre.parentNode.classList.contains("md-code")) return;
+      var box = document.createElement("div"), button = document.createElement("button");
+      box.className = "md-code";
+      button.className = "md-copy";
+      button.type = "button";
+      button.textContent = "Copy";
+      button.setAttribute("aria-label", "Copy code");
+      button.addEventListener("click", function () {
+        copy(pre.innerText.replace(/\n$/, "")).then(function () {
+          button.textContent = "Copied";
+          setTimeout(function () { button.textContent = "Copy"; }, 1500);
+        });
+      });
+      pre.parentNode.insertBefore(box, pre);
+      box.appendChild(pre);
+      box.appendChild(button);
+    });
+  }
+  if (document.readyState === "loading") document.addEventListener("DOMContentLoaded", start);
+  else start();
+})();
+`,
+
+	"toc.js": `(function () {
+  function start() {
+    var box = document.querySelector("[data-toc]") || document.getElementById("toc");
+    if (!box) return;
+    var selector = box.getAttribute("data-headings") || "h2, h3";
+    var style = document.createElement("style");
+    style.textContent = ".md-toc a.active { font-weight: bold; color: var(--md-toc-active-color, inherit); }" +
+      ".md-toc ul { list-style: none; padding-left: 1em; margin: 0; }";
+    document.head.appendChild(style);
+    box.classList.add("md-toc");
+    // headings have an id, or an anchor link with a name inside
+    function anchor(h) {
+      var a = h.querySelector("a.anchor[name]");
+      return h.id || (a && a.name);
+    }
+    function target(id) {
+      var el = document.getElementById(id) || document.getElementsByName(id)[0];
+      return el && el.closest("h1, h2, h3, h4, h5, h6") || el;
+    }
+    var links = box.querySelectorAll("a[href^='#']");
+    if (!links.length) {
+      var headings = document.querySelectorAll(selector), list = document.createElement("ul");
+      headings.forEach(function (h) {
+        if (!anchor(h) || box.contains(h)) return;
+        var li = document.createElement("li"), a = document.createElement("a");
+        a.href = "#" + anchor(h);
+        a.textContent = h.textContent;
+        li.style.marginLeft = (parseInt(h.tagName.slice(1), 10) - 2) + "em";
+        li.appendChild(a);
+        list.appendChild(li);
+      });
+      if (!list.children.length) return;
+      box.appendChild(list);
+      links = box.querySelectorAll("a[href^='#']");
+    }
+    var sections = [];
+    links.forEach(function (a) {
+      var h = target(decodeURIComponent(a.getAttribute("href").slice(1)));
+      if (h) sections.push({link: a, heading: h});
+    });
+    var current = null;
+    function update() {
+      var at = null;
+      sections.forEach(function (s) {
+        if (s.heading.getBoundingClientRect().top <= window.innerHeight / 4) at = s;
+      });
+      if (!at && sections.length) at = sections[0];
+      if (at === current) return;
+      if (current) { current.link.classList.remove("active"); current.link.removeAttribute("aria-current"); }
+      current = at;
+      if (current) { current.link.classList.add("active"); current.link.setAttribute("aria-current", "location"); }
+    }
+    update();
+    window.addEventListener("scroll", update, {passive: true});
+    window.addEventListener("resize", update);
+  }
+  if (document.readyState === "loading") document.addEventListener("DOMContentLoaded", start);
+  else start();
+})();
+`,
+
+	"tabs.js": `(function () {
+  var cookie = "markdownd-lang", script = document.currentScript;
+  function remembered() {
+    var m = document.cookie.match(new RegExp("(?:^|; )" + cookie + "=([^;]*)"));
+    return m ? decodeURIComponent(m[1].replace(/\+/g, " ")) : null;
+  }
+  // the server reads the same cookie, and shows the same tabs
+  function remember(lang, path) {
+    document.cookie = cookie + "=" + encodeURIComponent(lang) + "; path=" + path + "; max-age=31536000; samesite=lax";
+  }
+  function lang(tab) { return tab.getAttribute("data-lang") || tab.textContent; }
+  // select shows the tab i of the tablist, and hides the other panels
+  function select(list, i, focus) {
+    var tabs = list.querySelectorAll("[role=tab]");
+    tabs.forEach(function (tab, j) {
+      var panel = document.getElementById(tab.getAttribute("aria-controls"));
+      tab.setAttribute("aria-selected", i === j ? "true" : "false");
+      tab.tabIndex = i === j ? 0 : -1;
+      if (panel) panel.hidden = i !== j;
+    });
+    if (focus) tabs[i].focus();
+  }
+  // selectLang selects the tab for lang in every group that has one
+  function selectLang(lists, want) {
+    want = want.toLowerCase();
+    lists.forEach(function (list) {
+      var tabs = list.querySelectorAll("[role=tab]");
+      for (var i = 0; i < tabs.length; i++) {
+        if (lang(tabs[i]).toLowerCase() === want || tabs[i].textContent.toLowerCase() === want) {
+          select(list, i, false);
+          return;
+        }
+      }
+    });
+  }
+  function start() {
+    var lists = document.querySelectorAll(".md-tabs[role=tablist]");
+    if (!lists.length) return;
+    script = script || document.querySelector("script[src$='/tabs.js']");
+    var path = script ? script.getAttribute("src").replace(/_markdownd\/assets\/tabs\.js$/, "") : "/";
+    var style = document.createElement("style");
+    style.textContent = ".md-tabs { display: flex; flex-wrap: wrap; gap: .2em; margin-top: 1em; }" +
+      ".md-tabs [role=tab] { font-size: .85em; padding: .3em 1em; color: inherit; text-decoration: none;" +
+      " border-bottom: 2px solid transparent; }" +
+      ".md-tabs [role=tab][aria-selected=true] { border-bottom-color: var(--md-tabs-active-color, #0366d6); font-weight: bold; }" +
+      ".md-tabpanel > pre, .md-tabpanel > .highlight > pre { margin-top: 0; }";
+    document.head.appendChild(style);
+    lists.forEach(function (list) {
+      var tabs = list.querySelectorAll("[role=tab]"), shown = 0;
+      tabs.forEach(function (tab, i) {
+        if (tab.getAttribute("aria-selected") === "true") shown = i;
+        tab.addEventListener("click", function (ev) {
+          ev.preventDefault();
+          remember(lang(tab), path);
+          selectLang(lists, lang(tab));
+          select(list, i, true);
+        });
+        tab.addEventListener("keydown", function (ev) {
+          var next = {ArrowLeft: i - 1, ArrowRight: i + 1, Home: 0, End: tabs.length - 1, " ": i}[ev.key];
+          if (next === undefined) return;
+          ev.preventDefault();
+          tabs[(next + tabs.length) % tabs.length].click();
+        });
+      });
+      select(list, shown, false);
+    });
+    // the server picked tabs already, unless the page came from a cache
+    var want = new URLSearchParams(location.search).get("lang") || remembered();
+    if (want) selectLang(lists, want);
+  }
+  if (document.readyState === "loading") document.addEventListener("DOMContentLoaded", start);
+  else start();
+})();
+`,
+}
+
+// serveComponent writes the component named by the url path, or
+// returns false if there is none
+func serveComponent(w http.ResponseWriter, r *http.Request) bool {
+	b, ok := components[strings.TrimPrefix(r.URL.Path, componentsPrefix)]
+	if !ok {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	http.ServeContent(w, r, path.Base(r.URL.Path), started, strings.NewReader(b))
+	return true
+}
+
+// componentTag returns the script tag loading the component name, for
+// the 'component' template function. unknown names give nothing.
+func componentTag(prefix, name string) template.HTML {
+	if _, ok := components[name+".js"]; !ok {
+		return ""
+	}
+	src := template.HTMLEscapeString(path.Join(prefix, "/", componentsPrefix, name+".js"))
+	return template.HTML(`<script src="` + src + `" defer></script>`)
+}
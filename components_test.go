@@ -0,0 +1,44 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestComponents(t *testing.T) {
+	layout := `<main>{{.Content}}</main><aside data-toc></aside>{{component "progress"}}{{component "toc"}}{{component "nope"}}`
+	h := Handler{Prefix: "/docs", Root: fstest.MapFS{
+		"index.md": {Data: []byte("# Home\n\n## Install\n")},
+		layoutName: {Data: []byte(layout)},
+	}}
+	get := func(path string) (int, string, string) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		h.ServeHTTP(rec, req)
+		return rec.Code, rec.Header().Get("Content-Type"), rec.Body.String()
+	}
+	want := `<aside data-toc></aside><script src="/docs/_markdownd/assets/progress.js" defer></script><script src="/docs/_markdownd/assets/toc.js" defer></script>`
+	if code, _, body := get("/"); code != 200 || !strings.HasSuffix(strings.TrimSpace(body), want) {
+		t.Logf("page: %d\n%s\nexpected it to end with\n%s", code, body, want)
+		t.Fail()
+	}
+	for name, b := range components {
+		code, ct, body := get(componentsPrefix + name)
+		if code != 200 || ct != "text/javascript; charset=utf-8" || body != b {
+			t.Logf("%s: %d %q", name, code, ct)
+			t.Fail()
+		}
+	}
+	if code, _, _ := get(componentsPrefix + "nope.js"); code != 404 {
+		t.Logf("unknown component: %d, expected 404", code)
+		t.Fail()
+	}
+	if got := componentTag("", "toc"); got != template.HTML(`<script src="/_markdownd/assets/toc.js" defer></script>`) {
+		t.Log("component tag without a prefix:", got)
+		t.Fail()
+	}
+}
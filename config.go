@@ -0,0 +1,511 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// option is one setting in the config schema. every serve flag is one.
+type option struct {
+	Name    string
+	Type    string // bool, string, int, float, duration or list
+	Default string
+	Env     string // environment variable read when the flag isn't given
+	Usage   string
+	Secret  bool // hidden by 'config explain', may be a file: or ${ENV} reference
+}
+
+// rootEnv names the directory to serve, when no directory is given
+const rootEnv = "MARKDOWND_ROOT"
+
+// flagEnv are the environment variables of flags not named
+// $MARKDOWND_<FLAG>, kept from before every flag had one
+var flagEnv = map[string]string{
+	"token":        "MARKDOWND_TOKEN",
+	"slack-secret": "SLACK_SIGNING_SECRET",
+	"slack-token":  "SLACK_BOT_TOKEN",
+	"environment":  "MARKDOWND_ENV",
+}
+
+// secretFlags hold credentials
+var secretFlags = map[string]bool{
+	"token":        true,
+	"slack-secret": true,
+	"slack-token":  true,
+}
+
+// optionType names the type of a flag's value. repeatable flags don't
+// implement flag.Getter and are lists.
+func optionType(f *flag.Flag) string {
+	g, ok := f.Value.(flag.Getter)
+	if !ok {
+		return "list"
+	}
+	switch g.Get().(type) {
+	case bool:
+		return "bool"
+	case int, int64, uint, uint64:
+		return "int"
+	case float64:
+		return "float"
+	case time.Duration:
+		return "duration"
+	}
+	return "string"
+}
+
+// schema describes the flags of fs as options, sorted by name
+func schema(fs *flag.FlagSet) []option {
+	var opts []option
+	fs.VisitAll(func(f *flag.Flag) {
+		opts = append(opts, option{
+			Name:    f.Name,
+			Type:    optionType(f),
+			Default: f.DefValue,
+			Env:     envName(f.Name),
+			Usage:   f.Usage,
+			Secret:  secretFlags[f.Name],
+		})
+	})
+	return opts
+}
+
+// envName returns the environment variable of a flag: $MARKDOWND_HTTP for
+// -http, $MARKDOWND_LOG_LEVEL for -log-level
+func envName(flag string) string {
+	if env, ok := flagEnv[flag]; ok {
+		return env
+	}
+	return "MARKDOWND_" + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// applyEnv sets the flags of fs not in given from their environment
+// variables, and returns the names it set
+func applyEnv(fs *flag.FlagSet, given map[string]bool) (map[string]bool, error) {
+	set := map[string]bool{}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		env := envName(f.Name)
+		v, ok := os.LookupEnv(env)
+		if !ok || v == "" || given[f.Name] || err != nil {
+			return
+		}
+		if err = fs.Set(f.Name, v); err != nil {
+			err = fmt.Errorf("$%s: %v", env, err)
+			return
+		}
+		set[f.Name] = true
+	})
+	return set, err
+}
+
+// loadSettings applies the environment, then the -config file, to the
+// flags of fs not given on the command line, and pins the flags given and
+// from the environment for reloads. it returns the names each set, and
+// the directory to serve from $MARKDOWND_ROOT or the file.
+func loadSettings(fs *flag.FlagSet, given map[string]bool) (fromEnv, fromFile map[string]bool, dir string, err error) {
+	if fromEnv, err = applyEnv(fs, given); err != nil {
+		return nil, nil, "", err
+	}
+	for name := range given {
+		pinnedFlags[name] = true
+	}
+	for name := range fromEnv {
+		pinnedFlags[name] = true
+	}
+	if fromFile, dir, err = loadConfigFile(fs, pinnedFlags); err != nil {
+		return nil, nil, "", err
+	}
+	if root := os.Getenv(rootEnv); root != "" {
+		dir = root
+	}
+	return fromEnv, fromFile, dir, nil
+}
+
+// editDistance is the levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// suggest returns up to three names close to name, closest first
+func suggest(name string, names []string) []string {
+	type match struct {
+		name string
+		dist int
+	}
+	var matches []match
+	for _, n := range names {
+		d := editDistance(name, n)
+		if d <= 1+len(name)/4 || (len(name) > 2 && strings.HasPrefix(n, name)) {
+			matches = append(matches, match{n, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].dist < matches[j].dist })
+	var out []string
+	for i := 0; i < len(matches) && i < 3; i++ {
+		out = append(out, matches[i].name)
+	}
+	return out
+}
+
+// flagError explains a parse error, suggesting flags for unknown ones
+func flagError(fs *flag.FlagSet, err error) error {
+	const unknown = "flag provided but not defined: -"
+	msg := err.Error()
+	if !strings.HasPrefix(msg, unknown) {
+		return err
+	}
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	near := suggest(strings.TrimPrefix(msg, unknown), names)
+	if len(near) == 0 {
+		return fmt.Errorf("%s, see 'markdownd config explain'", msg)
+	}
+	return fmt.Errorf("%s, did you mean -%s?", msg, strings.Join(near, " or -"))
+}
+
+// parseServeFlags parses serve flags and the directory into the flags of
+// the markdownd command. it returns the names given on the command line.
+func parseServeFlags(args []string) (map[string]bool, []string, error) {
+	check := flag.NewFlagSet("markdownd", flag.ContinueOnError)
+	flag.VisitAll(func(f *flag.Flag) { check.Var(f.Value, f.Name, f.Usage) })
+	check.SetOutput(ioutil.Discard)
+	if err := check.Parse(args); err != nil {
+		return nil, nil, flagError(check, err)
+	}
+	given := map[string]bool{}
+	check.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	return given, check.Args(), nil
+}
+
+// checkConfig returns the problems found in the parsed flags and the
+// directory arguments, as errors (serve would refuse to start) and warnings
+func checkConfig(given map[string]bool, dirs []string) (errs, warns []string) {
+	fail := func(format string, v ...interface{}) { errs = append(errs, fmt.Sprintf(format, v...)) }
+	warn := func(format string, v ...interface{}) { warns = append(warns, fmt.Sprintf(format, v...)) }
+	needs := func(name, other string, on bool) {
+		if given[name] && !on {
+			warn("-%s has no effect without -%s", name, other)
+		}
+	}
+
+	if *vhostFile != "" {
+		if err := vhosts.readFile(*vhostFile); err != nil {
+			fail("-vhosts: %v", err)
+		}
+	}
+	switch {
+	case len(dirs) > 1:
+		fail("one directory to serve, got %d: %s (flags go before the directory)", len(dirs), strings.Join(dirs, " "))
+	case len(dirs) == 0 && len(mounts) == 0 && len(vhosts) == 0:
+		fail("no directory to serve, give one or use -mount or -vhost")
+	case len(dirs) == 1:
+		if fi, err := os.Stat(dirs[0]); err != nil {
+			fail("directory: %v", err)
+		} else if !fi.IsDir() {
+			fail("directory: %s is not a directory", dirs[0])
+		} else if _, err := os.Stat(prepareDirectory(dirs[0]) + *indexPage); err != nil && *indexPage != "gen" {
+			warn("%q not found in %s, did you forget '-index' flag?", *indexPage, dirs[0])
+		}
+	}
+	for _, mp := range mounts {
+		if fi, err := os.Stat(mp.Dir); err != nil || !fi.IsDir() {
+			fail("-mount %s: %s is not a directory", mp.Prefix, mp.Dir)
+		}
+	}
+	for _, v := range vhosts {
+		if fi, err := os.Stat(v.Dir); err != nil || !fi.IsDir() {
+			fail("-vhost %s: %s is not a directory", v.Host, v.Dir)
+		}
+	}
+
+	for _, f := range []struct{ name, file string }{{"header", *header}, {"footer", *footer}} {
+		if f.file != "" {
+			if _, err := ioutil.ReadFile(f.file); err != nil {
+				fail("-%s: %v", f.name, err)
+			}
+		}
+	}
+	if *pageTemplate != "" {
+		if _, err := loadTemplate(*pageTemplate); err != nil {
+			fail("-template: %v", err)
+		}
+		if given["header"] || given["footer"] {
+			warn("-header and -footer have no effect with -template")
+		}
+	}
+	if *varsFile != "" {
+		if err := (varList{}).readFile(*varsFile); err != nil {
+			fail("-vars: %v", err)
+		}
+	}
+	if *canonicalURL != "" {
+		if _, err := parseCanonical(*canonicalURL); err != nil {
+			fail("-canonical: %v", err)
+		}
+	}
+	if *schemaFile != "" {
+		if err := (schemaRegistry{}).readFile(*schemaFile); err != nil {
+			fail("-schemas: %v", err)
+		}
+	}
+	if _, err := parseLogLevel(*logLevelName); err != nil {
+		fail("-log-level: %v", err)
+	}
+	switch *logFormat {
+	case "text", "json", "combined":
+	default:
+		fail("-log-format: unknown log format %q, use text, json or combined", *logFormat)
+	}
+	if err := checkLogIP(*logIP); err != nil {
+		fail("-log-ip: %v", err)
+	}
+	if (*logRetention > 0 || *gdpr) && !logToFile(*logfile) && !logToFile(*accessLogfile) {
+		warn("-log-retention prunes only log files, the logs on %s are kept by whoever reads them", *logfile)
+	}
+	if *analytics != "" {
+		if _, err := analyticsSnippet(*analytics, *analyticsID, *analyticsURL, *consent); err != nil {
+			fail("-analytics: %v", err)
+		}
+	}
+	if _, err := cleanPrefix(*prefix); err != nil {
+		fail("-prefix: %v", err)
+	}
+	if *memoryLimit != "" {
+		if _, err := parseSize(*memoryLimit); err != nil {
+			fail("-memory-limit: %v", err)
+		}
+	}
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{{"read-timeout", *readTimeout}, {"header-timeout", *headerTimeout}, {"write-timeout", *writeTimeout}, {"idle-timeout", *idleTimeout}} {
+		if t.d < 0 {
+			fail("-%s: %v is negative", t.name, t.d)
+		}
+	}
+	if n, err := parseSize(*maxHeaderBytes); err != nil {
+		fail("-max-header-size: %v", err)
+	} else if n < 1 || n > 1<<30 {
+		fail("-max-header-size: %s out of range", *maxHeaderBytes)
+	}
+	if n, err := bandwidthSizes(); err != nil {
+		fail("%v", err)
+	} else if (n[0] != 0 || n[1] != 0) && *writeTimeout != 0 {
+		warn("-bandwidth limits can make large files take longer than -write-timeout %s, which cuts them off", *writeTimeout)
+	}
+	if *maxConns < 0 {
+		fail("-max-conns: %d is negative", *maxConns)
+	}
+	if _, err := parseSize(*maxRender); err != nil {
+		fail("-max-render-size: %v", err)
+	}
+	if _, err := parseSize(*renderCache); err != nil {
+		fail("-render-cache: %v", err)
+	}
+	if _, err := parseSize(*resizeCache); err != nil {
+		fail("-resize-cache: %v", err)
+	}
+	if *rendererCmd != "" {
+		if _, err := parseSize(*rendererMax); err != nil {
+			fail("-renderer-max: %v", err)
+		}
+		if args := strings.Fields(*rendererCmd); len(args) == 0 {
+			fail("-renderer-cmd: empty command")
+		} else if _, err := exec.LookPath(args[0]); err != nil {
+			fail("-renderer-cmd: %v", err)
+		}
+	}
+	for _, f := range forms {
+		if strings.HasPrefix(f.Handler, "file:") {
+			dir := filepath.Dir(strings.TrimPrefix(f.Handler, "file:"))
+			if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+				fail("-form %s: no directory %s", f.Name, dir)
+			}
+		} else if _, err := exec.LookPath(strings.Fields(f.Handler)[0]); err != nil {
+			fail("-form %s: %v", f.Name, err)
+		}
+	}
+	for _, spec := range plugins {
+		if strings.HasSuffix(spec, ".so") {
+			if _, err := os.Stat(spec); err != nil {
+				fail("-plugin: %v", err)
+			}
+		} else if _, err := exec.LookPath(strings.Fields(spec)[0]); err != nil {
+			fail("-plugin: %v", err)
+		}
+	}
+	for _, o := range schema(flag.CommandLine) {
+		v := flag.Lookup(o.Name).Value.String()
+		if !o.Secret || v == "" {
+			continue
+		}
+		if _, err := secretValue(v); err != nil {
+			fail("-%s: %v", o.Name, err)
+		} else if given[o.Name] && !isSecretRef(v) {
+			warn("-%s is inline, where process lists and shell history show it; use 'file:/path' or '${ENV}'", o.Name)
+		}
+	}
+	switch *openapi {
+	case "":
+	case "redoc", "swagger":
+		if err := setOpenAPIAssets(*openapiAssets); err != nil {
+			fail("%v", err)
+		} else if strings.Contains(*openapiAssets, "://") {
+			warn("-openapi-assets %s runs scripts from another site on the docs; a directory serves them from here, as -csp and -gdpr expect", *openapiAssets)
+		}
+	default:
+		fail("-openapi: expected redoc or swagger, got %q", *openapi)
+	}
+	if *autoCache < 0 {
+		fail("-auto-cache: expected a max-age such as 24h, got %v", *autoCache)
+	}
+	if *shadowRate < 0 || *shadowRate > 1 {
+		fail("-shadow-rate: expected a fraction from 0 to 1, got %g", *shadowRate)
+	}
+	if (*geminiAddr != "" || *gopherAddr != "") && len(dirs) != 1 {
+		fail("-gemini and -gopher serve the directory argument, not -mount or -vhost")
+	}
+	if (*geminiCert == "") != (*geminiKey == "") {
+		fail("-gemini-cert and -gemini-key go together")
+	}
+
+	needs("gemini-cert", "gemini", *geminiAddr != "")
+	needs("gemini-key", "gemini", *geminiAddr != "")
+	needs("gopher-host", "gopher", *gopherAddr != "")
+	needs("slack-token", "slack-secret", *slackSecret != "")
+	needs("shadow-rate", "shadow", *shadow != "")
+	needs("consul-service", "consul", *consulAgent != "")
+	needs("burst", "rate", *rate > 0)
+	needs("config-watch", "config", *configPath != "")
+	needs("selftest-slow", "selftest", *selftestRun)
+	needs("analytics-id", "analytics", *analytics != "")
+	needs("analytics-url", "analytics", *analytics != "")
+	needs("consent", "analytics", *analytics != "")
+	needs("feature-admin", "feature", len(rollouts) != 0)
+	needs("drain-time", "health", *health)
+	needs("renderer-timeout", "renderer-cmd", *rendererCmd != "")
+	needs("renderer-max", "renderer-cmd", *rendererCmd != "")
+	needs("vars", "template", *pageTemplate != "")
+	needs("plugin-timeout", "plugin", len(plugins) != 0)
+	needs("var", "template", *pageTemplate != "")
+	needs("openapi-assets", "openapi", *openapi != "")
+	needs("resize-cache", "resize", *resizeImages)
+	return errs, warns
+}
+
+// configCommand checks serve flags, or explains them, without serving
+func configCommand(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "usage: markdownd config <validate|explain> [flags] [directory]")
+		fmt.Fprintln(os.Stderr, "validate checks flags and files as markdownd would, without serving")
+		fmt.Fprintln(os.Stderr, "explain lists every option with its type, default and effective value")
+	}
+	if len(args) == 0 || (args[0] != "validate" && args[0] != "explain") {
+		usage()
+		os.Exit(111)
+	}
+
+	given, dirs, err := parseServeFlags(args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(111)
+	}
+	fromEnv, fromFile, dir, err := loadSettings(flag.CommandLine, given)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(111)
+	}
+	if len(dirs) == 0 && dir != "" {
+		dirs = []string{dir}
+	}
+
+	if args[0] == "explain" {
+		os.Stdout.Write(explain(flag.CommandLine, given, fromFile, fromEnv))
+		return
+	}
+	for name := range fromFile {
+		given[name] = true
+	}
+	for name := range fromEnv {
+		given[name] = true
+	}
+	errs, warns := checkConfig(given, dirs)
+	for _, w := range warns {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+	for _, e := range errs {
+		fmt.Fprintln(os.Stderr, "error:", e)
+	}
+	if len(errs) != 0 {
+		os.Exit(111)
+	}
+	fmt.Fprintln(os.Stderr, "ok")
+}
+
+// explain documents the options of fs, with the effective value of each
+// and where it came from: the command line, the -config file, the
+// environment or the default
+func explain(fs *flag.FlagSet, given, fromFile, fromEnv map[string]bool) []byte {
+	var b strings.Builder
+	for _, o := range schema(fs) {
+		value, source := fs.Lookup(o.Name).Value.String(), "default"
+		switch {
+		case given[o.Name]:
+			source = "flag"
+		case fromFile[o.Name]:
+			source = *configPath
+		case fromEnv[o.Name]:
+			source = "$" + o.Env
+		}
+		if o.Secret && value != "" && !isSecretRef(value) {
+			value = "(hidden)"
+		}
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(&b, "-%s (%s)\n", o.Name, o.Type)
+		fmt.Fprintf(&b, "\t%s\n", o.Usage)
+		if o.Default != "" {
+			fmt.Fprintf(&b, "\tdefault: %s\n", o.Default)
+		}
+		if o.Env != "" {
+			fmt.Fprintf(&b, "\tenvironment: $%s\n", o.Env)
+		}
+		fmt.Fprintf(&b, "\tvalue: %s (%s)\n\n", value, source)
+	}
+	return []byte(b.String())
+}
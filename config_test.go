@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSuggest(t *testing.T) {
+	names := []string{"http", "header", "health", "index", "log", "log-format", "metrics"}
+	for name, want := range map[string]string{
+		"htp":       "http",
+		"headr":     "header",
+		"metric":    "metrics",
+		"logformat": "log-format",
+		"zzz":       "",
+	} {
+		got := suggest(name, names)
+		if (want == "" && len(got) != 0) || (want != "" && (len(got) == 0 || got[0] != want)) {
+			t.Logf("suggest(%q): expected %q first, got %v", name, want, got)
+			t.Fail()
+		}
+	}
+	if d := editDistance("kitten", "sitting"); d != 3 {
+		t.Log("Expected distance 3, got:", d)
+		t.Fail()
+	}
+}
+
+func TestFlagError(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("http", "", "")
+	fs.Bool("health", true, "")
+	err := flagError(fs, errors.New("flag provided but not defined: -htp"))
+	if !strings.HasSuffix(err.Error(), "did you mean -http?") {
+		t.Log("Expected a suggestion, got:", err)
+		t.Fail()
+	}
+	if err := flagError(fs, errors.New("invalid value")); err.Error() != "invalid value" {
+		t.Log("Expected other errors unchanged, got:", err)
+		t.Fail()
+	}
+}
+
+func TestSchema(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("toc", false, "table of contents")
+	fs.Duration("wait", time.Second, "")
+	fs.Float64("rate", 0, "")
+	fs.Int64("size", 0, "")
+	fs.String("token", "", "")
+	var m mountList
+	fs.Var(&m, "mount", "")
+	want := map[string]string{"toc": "bool", "wait": "duration", "rate": "float", "size": "int", "token": "string", "mount": "list"}
+	for _, o := range schema(fs) {
+		if want[o.Name] != o.Type {
+			t.Logf("-%s: expected type %s, got %s", o.Name, want[o.Name], o.Type)
+			t.Fail()
+		}
+		if o.Name == "token" && (!o.Secret || o.Env != "MARKDOWND_TOKEN") {
+			t.Logf("Expected -token secret from $MARKDOWND_TOKEN, got: %+v", o)
+			t.Fail()
+		}
+	}
+
+	defer os.Unsetenv("MARKDOWND_TOKEN")
+	os.Setenv("MARKDOWND_TOKEN", "sekrit")
+	fs.Parse([]string{"-toc"})
+	given := map[string]bool{"toc": true}
+	fromEnv, _ := applyEnv(fs, given)
+	out := string(explain(fs, given, nil, fromEnv))
+	for _, s := range []string{
+		"-toc (bool)\n\ttable of contents\n\tdefault: false\n\tenvironment: $MARKDOWND_TOC\n\tvalue: true (flag)\n",
+		"-token (string)\n",
+		"\tenvironment: $MARKDOWND_TOKEN\n\tvalue: (hidden) ($MARKDOWND_TOKEN)\n",
+		"-wait (duration)\n\t\n\tdefault: 1s\n\tenvironment: $MARKDOWND_WAIT\n\tvalue: 1s (default)\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Logf("Expected %q in:\n%s", s, out)
+			t.Fail()
+		}
+	}
+	if strings.Contains(out, "sekrit") {
+		t.Log("Expected the token hidden:\n" + out)
+		t.Fail()
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	toc := fs.Bool("toc", false, "")
+	level := fs.String("log-level", "info", "")
+	size := fs.Int64("size", 0, "")
+	for env, v := range map[string]string{"MARKDOWND_TOC": "false", "MARKDOWND_LOG_LEVEL": "warn", "MARKDOWND_SIZE": "big"} {
+		defer os.Unsetenv(env)
+		os.Setenv(env, v)
+	}
+	fs.Parse([]string{"-toc"})
+	_, err := applyEnv(fs, map[string]bool{"toc": true})
+	if err == nil || !strings.HasPrefix(err.Error(), "$MARKDOWND_SIZE: ") {
+		t.Log("Expected an error for $MARKDOWND_SIZE, got:", err)
+		t.Fail()
+	}
+	os.Setenv("MARKDOWND_SIZE", "12")
+	set, err := applyEnv(fs, map[string]bool{"toc": true})
+	if err != nil || !*toc || *level != "warn" || *size != 12 || !set["log-level"] || set["toc"] {
+		t.Logf("Unexpected flags from the environment: %v %q %d %v %v", *toc, *level, *size, set, err)
+		t.Fail()
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	defer func(a, c string, r float64) { *geminiAddr, *geminiCert, *shadowRate = a, c, r }(*geminiAddr, *geminiCert, *shadowRate)
+	*geminiCert, *shadowRate = "cert.pem", 2
+
+	errs, warns := checkConfig(map[string]bool{"gemini-cert": true, "burst": true}, []string{"docs"})
+	for _, want := range []string{"-gemini-cert and -gemini-key go together", "-shadow-rate: expected a fraction"} {
+		if !strings.Contains(strings.Join(errs, "\n"), want) {
+			t.Logf("Expected error %q, got: %v", want, errs)
+			t.Fail()
+		}
+	}
+	for _, want := range []string{"-gemini-cert has no effect without -gemini", "-burst has no effect without -rate"} {
+		if !strings.Contains(strings.Join(warns, "\n"), want) {
+			t.Logf("Expected warning %q, got: %v", want, warns)
+			t.Fail()
+		}
+	}
+
+	defer func(v string) { *token = v }(*token)
+	*token = "inline"
+	if _, warns := checkConfig(map[string]bool{"token": true}, nil); !strings.Contains(strings.Join(warns, "\n"), "-token is inline") {
+		t.Log("Expected a warning for an inline token, got:", warns)
+		t.Fail()
+	}
+	*token = "${MARKDOWND_TEST_UNSET}"
+	if errs, _ := checkConfig(map[string]bool{"token": true}, nil); !strings.Contains(strings.Join(errs, "\n"), "-token: $MARKDOWND_TEST_UNSET is not set") {
+		t.Log("Expected an error for an unset secret, got:", errs)
+		t.Fail()
+	}
+
+	*geminiCert, *shadowRate, *token = "", 0.1, ""
+	if errs, warns := checkConfig(map[string]bool{}, []string{"docs"}); len(errs)+len(warns) != 0 {
+		t.Log("Expected docs to be fine, got:", errs, warns)
+		t.Fail()
+	}
+	if errs, _ := checkConfig(map[string]bool{}, []string{"docs", "static"}); len(errs) != 1 {
+		t.Log("Expected an error for two directories, got:", errs)
+		t.Fail()
+	}
+	if errs, _ := checkConfig(map[string]bool{}, []string{"no-such-dir"}); len(errs) != 1 {
+		t.Log("Expected an error for a missing directory, got:", errs)
+		t.Fail()
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// a -config file is a small subset of toml: 'key = value' lines naming
+// flags, with "strings", 'literal strings', bare numbers, booleans and
+// durations, and [lists] which may span lines. [[tables]] hold what
+// flags fit on one line badly:
+//
+//	http = ["127.0.0.1:8080", "unix:/run/markdownd.sock"]
+//	log-level = "warn"
+//	directory = "/srv/docs"
+//
+//	[[mount]]
+//	prefix = "/wiki"
+//	dir = "/srv/wiki"
+//
+//	[[vhost]]
+//	host = "docs.example.com"
+//	dir = "/srv/docs"
+//	rewrite = ["https://wiki.internal/=https://wiki.example.com/"]
+//
+//	[[cache-control]]
+//	pattern = "*.png"
+//	value = "max-age=31536000, immutable"
+var (
+	reConfigKey   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	reConfigBare  = regexp.MustCompile(`^[A-Za-z0-9_.:+/-]+$`)
+	reConfigTable = regexp.MustCompile(`^\[\[\s*([A-Za-z0-9_-]+)\s*\]\]$`)
+)
+
+// configValue is a value of a -config file, with the line it is on
+type configValue struct {
+	line   int
+	values []string
+	list   bool
+}
+
+// configTable is the keys of a [[table]], or of the top of the file
+type configTable struct {
+	name string
+	line int
+	keys map[string]configValue
+}
+
+// configFile is a parsed -config file
+type configFile struct {
+	name   string
+	top    configTable
+	tables []configTable
+}
+
+// configTableKeys are the keys of each [[table]], named for the flag it
+// adds to. the first two are needed.
+var configTableKeys = map[string][]string{
+	"mount":         {"prefix", "dir"},
+	"vhost":         {"host", "dir", "index", "header", "footer", "template", "canonical", "rewrite", "analytics", "analytics-id", "analytics-url"},
+	"cache-control": {"pattern", "value"},
+}
+
+// readConfigFile parses the -config file filename
+func readConfigFile(filename string) (*configFile, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	c := &configFile{name: filename, top: configTable{keys: map[string]configValue{}}}
+	table := &c.top
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			m := reConfigTable.FindStringSubmatch(stripComment(line))
+			if m == nil {
+				return nil, fmt.Errorf("%s:%d: expected [[table]], got %q", filename, n, line)
+			}
+			name := strings.Replace(strings.ToLower(m[1]), "_", "-", -1)
+			if _, ok := configTableKeys[name]; !ok {
+				return nil, fmt.Errorf("%s:%d: unknown table [[%s]], expected [[mount]], [[vhost]] or [[cache-control]]", filename, n, m[1])
+			}
+			c.tables = append(c.tables, configTable{name: name, line: n, keys: map[string]configValue{}})
+			table = &c.tables[len(c.tables)-1]
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 1 {
+			return nil, fmt.Errorf("%s:%d: expected key = value, got %q", filename, n, line)
+		}
+		key := strings.TrimSpace(line[:i])
+		if !reConfigKey.MatchString(key) {
+			return nil, fmt.Errorf("%s:%d: bad key %q", filename, n, key)
+		}
+		key = strings.Replace(strings.ToLower(key), "_", "-", -1)
+		if _, ok := table.keys[key]; ok {
+			return nil, fmt.Errorf("%s:%d: %s is set twice", filename, n, key)
+		}
+		v := configValue{line: n}
+		raw := strings.TrimSpace(line[i+1:])
+		if strings.HasPrefix(raw, "[") {
+			// a list goes on until its closing bracket
+			for !listClosed(raw) && scanner.Scan() {
+				n++
+				raw += "\n" + scanner.Text()
+			}
+			if v.values, err = parseConfigList(raw); err != nil {
+				return nil, fmt.Errorf("%s:%d: %s: %v", filename, v.line, key, err)
+			}
+			v.list = true
+		} else {
+			s, rest, err := parseConfigScalar(raw)
+			if err == nil && strings.TrimSpace(stripComment(rest)) != "" {
+				err = fmt.Errorf("unexpected %q after the value", strings.TrimSpace(rest))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s: %v", filename, n, key, err)
+			}
+			v.values = []string{s}
+		}
+		table.keys[key] = v
+	}
+	return c, scanner.Err()
+}
+
+// stripComment removes a '# comment' from a line without strings
+func stripComment(s string) string {
+	if i := strings.IndexByte(s, '#'); i != -1 {
+		return s[:i]
+	}
+	return s
+}
+
+// parseConfigScalar parses the string, number, boolean or duration at the
+// start of s, and returns the rest
+func parseConfigScalar(s string) (string, string, error) {
+	switch {
+	case s == "":
+		return "", "", fmt.Errorf("expected a value")
+	case s[0] == '"':
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				v, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					return "", "", fmt.Errorf("bad string %s", s[:i+1])
+				}
+				return v, s[i+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string %s", s)
+	case s[0] == '\'':
+		i := strings.IndexByte(s[1:], '\'')
+		if i == -1 {
+			return "", "", fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : i+1], s[i+2:], nil
+	}
+	end := strings.IndexAny(s, ",]#\n")
+	if end == -1 {
+		end = len(s)
+	}
+	v := strings.TrimSpace(s[:end])
+	if !reConfigBare.MatchString(v) {
+		return "", "", fmt.Errorf("expected a number, true, false or a quoted string, got %q", v)
+	}
+	return v, s[end:], nil
+}
+
+// parseConfigList parses a [list] of scalars
+func parseConfigList(s string) ([]string, error) {
+	values := []string{}
+	s = strings.TrimSpace(s[1:])
+	for {
+		s = skipConfigSpace(s)
+		if strings.HasPrefix(s, "]") {
+			if rest := strings.TrimSpace(stripComment(s[1:])); rest != "" {
+				return nil, fmt.Errorf("unexpected %q after the list", rest)
+			}
+			return values, nil
+		}
+		v, rest, err := parseConfigScalar(s)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		s = skipConfigSpace(rest)
+		switch {
+		case strings.HasPrefix(s, ","):
+			s = s[1:]
+		case !strings.HasPrefix(s, "]"):
+			return nil, fmt.Errorf("expected , or ] in the list")
+		}
+	}
+}
+
+// skipConfigSpace skips white space, newlines and comments in a list
+func skipConfigSpace(s string) string {
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if !strings.HasPrefix(s, "#") {
+			return s
+		}
+		if i := strings.IndexByte(s, '\n'); i != -1 {
+			s = s[i:]
+		} else {
+			return ""
+		}
+	}
+}
+
+// listClosed reports whether the list s has its closing bracket, outside
+// of strings and comments
+func listClosed(s string) bool {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == ']':
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets the flags of fs from the file, except those given on the
+// command line, and returns the names it set and the directory to serve
+func (c *configFile) apply(fs *flag.FlagSet, given map[string]bool) (map[string]bool, string, error) {
+	set := map[string]bool{}
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	keys := make([]string, 0, len(c.top.keys))
+	for key := range c.top.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return c.top.keys[keys[i]].line < c.top.keys[keys[j]].line })
+
+	dir := ""
+	for _, key := range keys {
+		v := c.top.keys[key]
+		f := fs.Lookup(key)
+		switch {
+		case key == "directory":
+			if v.list {
+				return nil, "", fmt.Errorf("%s:%d: directory: expected one directory", c.name, v.line)
+			}
+			dir = v.values[0]
+			continue
+		case key == "config":
+			return nil, "", fmt.Errorf("%s:%d: config can't be set in a config file", c.name, v.line)
+		case f == nil:
+			if near := suggest(key, names); len(near) != 0 {
+				return nil, "", fmt.Errorf("%s:%d: unknown option %q, did you mean %s?", c.name, v.line, key, strings.Join(near, " or "))
+			}
+			return nil, "", fmt.Errorf("%s:%d: unknown option %q, see 'markdownd config explain'", c.name, v.line, key)
+		case given[key]:
+			continue
+		case v.list && optionType(f) != "list":
+			return nil, "", fmt.Errorf("%s:%d: %s: expected one value, not a list", c.name, v.line, key)
+		}
+		for _, s := range v.values {
+			if err := fs.Set(key, s); err != nil {
+				return nil, "", fmt.Errorf("%s:%d: %s: %v", c.name, v.line, key, err)
+			}
+		}
+		set[key] = true
+	}
+
+	for _, t := range c.tables {
+		if given[t.name] {
+			continue
+		}
+		spec, err := t.flagValue()
+		if err == nil {
+			err = fs.Set(t.name, spec)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("%s:%d: [[%s]]: %v", c.name, t.line, t.name, err)
+		}
+		set[t.name] = true
+	}
+	return set, dir, nil
+}
+
+// flagValue returns the table as the value of its flag, such as
+// '/wiki=./wiki' for a [[mount]]
+func (t configTable) flagValue() (string, error) {
+	known := configTableKeys[t.name]
+	vals := map[string][]string{}
+	for key, v := range t.keys {
+		i := 0
+		for i < len(known) && known[i] != key {
+			i++
+		}
+		switch {
+		case i == len(known):
+			return "", fmt.Errorf("unknown key %q, expected %s", key, strings.Join(known, ", "))
+		case v.list && key != "rewrite":
+			return "", fmt.Errorf("%s: expected one value, not a list", key)
+		}
+		for _, s := range v.values {
+			if t.name == "vhost" && strings.Contains(s, ",") {
+				return "", fmt.Errorf("%s: %q can't have a comma", key, s)
+			}
+		}
+		vals[key] = v.values
+	}
+	if len(vals[known[0]]) == 0 || len(vals[known[1]]) == 0 {
+		return "", fmt.Errorf("needs %s and %s", known[0], known[1])
+	}
+	spec := vals[known[0]][0] + "=" + vals[known[1]][0]
+	for _, key := range known[2:] {
+		for _, s := range vals[key] {
+			spec += "," + key + "=" + s
+		}
+	}
+	return spec, nil
+}
+
+// loadConfigFile applies the -config file, if any, to the flags of fs not
+// in given. it returns the names it set, and the directory to serve when
+// the file names one.
+func loadConfigFile(fs *flag.FlagSet, given map[string]bool) (map[string]bool, string, error) {
+	if *configPath == "" {
+		return map[string]bool{}, "", nil
+	}
+	c, err := readConfigFile(*configPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("-config: %v", err)
+	}
+	return c.apply(fs, given)
+}
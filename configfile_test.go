@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "markdownd.toml")
+	ioutil.WriteFile(filename, []byte(`# serve the docs
+directory = "/srv/docs"
+toc = true
+log_level = 'warn' # underscores work too
+wait = 5s
+http = [
+	"127.0.0.1:8080", # loopback
+	"unix:/run/markdownd.sock",
+]
+
+[[mount]]
+prefix = "/wiki"
+dir = "/srv/wiki"
+
+[[cache-control]]
+pattern = "*.png"
+value = "max-age=31536000, immutable"
+`), 0600)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	toc := fs.Bool("toc", false, "")
+	level := fs.String("log-level", "info", "")
+	wait := fs.Duration("wait", time.Second, "")
+	addrs := addrList{addrs: []string{"127.0.0.1:8080"}}
+	var mps mountList
+	var rules cacheRuleList
+	fs.Var(&addrs, "http", "")
+	fs.Var(&mps, "mount", "")
+	fs.Var(&rules, "cache-control", "")
+
+	c, err := readConfigFile(filename)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	set, root, err := c.apply(fs, map[string]bool{"log-level": true})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if root != "/srv/docs" || !*toc || *wait != 5*time.Second || len(addrs.addrs) != 2 || addrs.addrs[1] != "unix:/run/markdownd.sock" {
+		t.Logf("Unexpected values: %q %v %v %q", root, *toc, *wait, addrs.addrs)
+		t.Fail()
+	}
+	if *level != "info" || set["log-level"] {
+		t.Log("Expected the command line -log-level to win, got", *level)
+		t.Fail()
+	}
+	if len(mps) != 1 || mps[0].Dir != "/srv/wiki" || len(rules) != 1 || rules[0].Value != "max-age=31536000, immutable" {
+		t.Logf("Unexpected tables: %+v %+v", mps, rules)
+		t.Fail()
+	}
+	if !set["mount"] || !set["http"] {
+		t.Log("Expected mount and http to come from the file:", set)
+		t.Fail()
+	}
+
+	for _, test := range []struct{ file, err string }{
+		{"toc = yes please", `expected a number, true, false or a quoted string`},
+		{"tocc = true", `unknown option "tocc", did you mean toc?`},
+		{"toc = [true]", `expected one value, not a list`},
+		{"[[mount]]\nprefix = \"/wiki\"", `[[mount]]: needs prefix and dir`},
+		{"[server]", `expected [[table]]`},
+		{"http = [\"a\"\n\"b\"]", `expected , or ] in the list`},
+	} {
+		ioutil.WriteFile(filename, []byte(test.file), 0600)
+		c, err := readConfigFile(filename)
+		if err == nil {
+			_, _, err = c.apply(fs, map[string]bool{})
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Logf("%q: expected error %q, got %v", test.file, test.err, err)
+			t.Fail()
+		}
+	}
+}
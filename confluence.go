@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aerth/markdownd/pkg/markdownd"
+	"github.com/russross/blackfriday"
+)
+
+// confluence talks to the confluence rest api
+type confluence struct {
+	base   string // such as https://example.atlassian.net/wiki
+	user   string // basic auth user, or empty for a bearer token
+	token  string
+	client *http.Client
+}
+
+// confluencePage is the part of the content api we use
+type confluencePage struct {
+	ID    string `json:"id,omitempty"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	Space struct {
+		Key string `json:"key"`
+	} `json:"space"`
+	Version   *confluenceVersion `json:"version,omitempty"`
+	Ancestors []confluenceRef    `json:"ancestors,omitempty"`
+	Body      struct {
+		Storage struct {
+			Value          string `json:"value"`
+			Representation string `json:"representation"`
+		} `json:"storage"`
+	} `json:"body"`
+}
+
+type confluenceVersion struct {
+	Number int `json:"number"`
+}
+
+type confluenceRef struct {
+	ID string `json:"id"`
+}
+
+func (c *confluence) do(method, path string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.base+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", serverheader)
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.token)
+	} else if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(b))
+	}
+	if out != nil {
+		return json.Unmarshal(b, out)
+	}
+	return nil
+}
+
+// find returns the existing page with title in space, or nil
+func (c *confluence) find(space, title string) (*confluencePage, error) {
+	var result struct {
+		Results []*confluencePage `json:"results"`
+	}
+	q := url.Values{"spaceKey": {space}, "title": {title}, "expand": {"version"}}
+	if err := c.do("GET", "/rest/api/content?"+q.Encode(), nil, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Results) == 0 {
+		return nil, nil
+	}
+	return result.Results[0], nil
+}
+
+// push creates or updates the page title in space with storage format html,
+// returning "created", "updated", or an error
+func (c *confluence) push(space, parent, title, html string) (string, error) {
+	existing, err := c.find(space, title)
+	if err != nil {
+		return "", err
+	}
+	page := &confluencePage{Type: "page", Title: title}
+	page.Space.Key = space
+	page.Body.Storage.Value = html
+	page.Body.Storage.Representation = "storage"
+
+	if existing == nil {
+		if parent != "" {
+			page.Ancestors = []confluenceRef{{ID: parent}}
+		}
+		return "created", c.do("POST", "/rest/api/content", page, nil)
+	}
+
+	page.ID = existing.ID
+	page.Version = &confluenceVersion{Number: 1}
+	if existing.Version != nil {
+		page.Version.Number = existing.Version.Number + 1
+	}
+	return "updated", c.do("PUT", "/rest/api/content/"+existing.ID, page, nil)
+}
+
+// confluenceTarget is where one markdown file goes
+type confluenceTarget struct {
+	title, space string
+}
+
+// readConfluenceMap reads 'file.md = Page Title [@ SPACE]' lines
+func readConfluenceMap(filename string) (map[string]confluenceTarget, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m := map[string]confluenceTarget{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i == -1 {
+			return nil, fmt.Errorf("%s:%d: expected 'file.md = Page Title'", filename, n)
+		}
+		var t confluenceTarget
+		t.title = strings.TrimSpace(line[i+1:])
+		if j := strings.LastIndex(t.title, "@"); j != -1 {
+			t.space = strings.TrimSpace(t.title[j+1:])
+			t.title = strings.TrimSpace(t.title[:j])
+		}
+		m[filepath.ToSlash(filepath.Clean(strings.TrimSpace(line[:i])))] = t
+	}
+	return m, scanner.Err()
+}
+
+// confluenceHTML renders markdown as xhtml for the confluence storage format
+func confluenceHTML(md []byte) string {
+	html := blackfriday.Markdown(md,
+		blackfriday.HtmlRenderer(blackfriday.HTML_USE_XHTML|blackfriday.HTML_SKIP_HTML, "", ""),
+		markdownd.GFMExtensions)
+	return string(markdownd.Sanitize(html))
+}
+
+// confluenceCommand is 'markdownd confluence', pushing rendered pages
+func confluenceCommand(args []string) {
+	fs := flag.NewFlagSet("confluence", flag.ExitOnError)
+	base := fs.String("url", "", "confluence base url, such as https://example.atlassian.net/wiki")
+	space := fs.String("space", "", "default space key")
+	parent := fs.String("parent", "", "parent page id for new pages")
+	user := fs.String("user", "", "user for basic auth (confluence cloud), empty for a bearer token")
+	tok := fs.String("token", "", "api token or personal access token, or 'file:/path' or '${ENV}' (default from $CONFLUENCE_TOKEN)")
+	mapfile := fs.String("map", "", "file mapping 'file.md = Page Title [@ SPACE]', only mapped files are pushed")
+	dryrun := fs.Bool("n", false, "dry run, only print what would be pushed")
+	outbound.flags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: markdownd confluence -url <url> -space <key> [flags] <directory>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *base == "" {
+		fs.Usage()
+		os.Exit(111)
+	}
+	if *tok == "" {
+		*tok = os.Getenv("CONFLUENCE_TOKEN")
+	}
+	var err error
+	if *tok, err = secretValue(*tok); err != nil {
+		fmt.Fprintln(os.Stderr, "-token:", err)
+		os.Exit(111)
+	}
+	dir := fs.Arg(0)
+
+	var mapping map[string]confluenceTarget
+	if *mapfile != "" {
+		if mapping, err = readConfluenceMap(*mapfile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(111)
+		}
+	}
+
+	c := &confluence{
+		base:   strings.TrimSuffix(*base, "/"),
+		user:   *user,
+		token:  *tok,
+		client: outboundClient(),
+	}
+
+	var failed bool
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || !strings.HasSuffix(path, ".md") || fi.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+
+		target := confluenceTarget{space: *space}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fm, md := parseFrontMatter(b)
+		if mapping != nil {
+			t, ok := mapping[rel]
+			if !ok {
+				return nil
+			}
+			target.title = t.title
+			if t.space != "" {
+				target.space = t.space
+			}
+		}
+		if target.title == "" {
+			target.title = pageTitle(fm, md)
+		}
+		if target.title == "" {
+			target.title = segmentName(filepath.Base(rel))
+		}
+		if target.space == "" {
+			fmt.Fprintf(os.Stderr, "%s: no space, use -space or the map file\n", rel)
+			failed = true
+			return nil
+		}
+
+		if *dryrun {
+			fmt.Printf("%s -> %s: %q\n", rel, target.space, target.title)
+			return nil
+		}
+		action, err := c.push(target.space, *parent, target.title, confluenceHTML(md))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", rel, err)
+			failed = true
+			return nil
+		}
+		fmt.Printf("%s %s -> %s: %q\n", action, rel, target.space, target.title)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(111)
+	}
+	if failed {
+		os.Exit(111)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConfluencePush(t *testing.T) {
+	var created, updated *confluencePage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Query().Get("title") == "Existing":
+			w.Write([]byte(`{"results":[{"id":"42","type":"page","title":"Existing","version":{"number":3}}]}`))
+		case r.Method == "GET":
+			w.Write([]byte(`{"results":[]}`))
+		case r.Method == "POST":
+			created = new(confluencePage)
+			json.NewDecoder(r.Body).Decode(created)
+		case r.Method == "PUT" && r.URL.Path == "/rest/api/content/42":
+			updated = new(confluencePage)
+			json.NewDecoder(r.Body).Decode(updated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := &confluence{base: srv.URL, token: "x", client: srv.Client()}
+	action, err := c.push("DOCS", "7", "New", "<p>new</p>")
+	if err != nil || action != "created" {
+		t.Log("Expected created, got:", action, err)
+		t.FailNow()
+	}
+	if created == nil || created.Space.Key != "DOCS" || len(created.Ancestors) != 1 || created.Body.Storage.Value != "<p>new</p>" {
+		t.Logf("Unexpected created page: %+v", created)
+		t.FailNow()
+	}
+
+	action, err = c.push("DOCS", "7", "Existing", "<p>changed</p>")
+	if err != nil || action != "updated" {
+		t.Log("Expected updated, got:", action, err)
+		t.FailNow()
+	}
+	if updated == nil || updated.Version == nil || updated.Version.Number != 4 {
+		t.Logf("Expected version 4, got: %+v", updated)
+		t.FailNow()
+	}
+}
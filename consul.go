@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// consulService is the consul agent service definition
+type consulService struct {
+	ID      string
+	Name    string
+	Address string       `json:",omitempty"`
+	Port    int          `json:",omitempty"`
+	Check   *consulCheck `json:",omitempty"`
+}
+
+// consulCheck has the agent poll /healthz
+type consulCheck struct {
+	HTTP                           string
+	Interval                       string
+	Timeout                        string
+	DeregisterCriticalServiceAfter string
+}
+
+// consulServiceFor describes the server listening on ln to consul.
+// only tcp listeners can be registered.
+func consulServiceFor(name string, ln net.Listener) (consulService, bool) {
+	addr, ok := ln.Addr().(*net.TCPAddr)
+	if !ok {
+		return consulService{}, false
+	}
+	hostname, _ := os.Hostname()
+	svc := consulService{
+		ID:   name + "-" + hostname + "-" + strconv.Itoa(addr.Port),
+		Name: name,
+		Port: addr.Port,
+	}
+	// a wildcard address is left to the agent, which uses its node address
+	checkHost := "127.0.0.1"
+	if !addr.IP.IsUnspecified() {
+		svc.Address = addr.IP.String()
+		checkHost = svc.Address
+	}
+	if *health {
+		svc.Check = &consulCheck{
+			HTTP:                           "http://" + net.JoinHostPort(checkHost, strconv.Itoa(addr.Port)) + "/healthz",
+			Interval:                       "10s",
+			Timeout:                        "2s",
+			DeregisterCriticalServiceAfter: "1m",
+		}
+	}
+	return svc, true
+}
+
+// consulRequest sends a PUT to the consul agent api
+func consulRequest(agent, path string, body []byte) error {
+	req, err := http.NewRequest("PUT", strings.TrimSuffix(agent, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t := os.Getenv("CONSUL_HTTP_TOKEN"); t != "" {
+		req.Header.Set("X-Consul-Token", t)
+	}
+	resp, err := outboundClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("consul: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// consulRegister registers svc with the agent, returning a function
+// that deregisters it
+func consulRegister(agent string, svc consulService) (func(), error) {
+	body, err := json.Marshal(svc)
+	if err != nil {
+		return nil, err
+	}
+	if err := consulRequest(agent, "/v1/agent/service/register", body); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := consulRequest(agent, "/v1/agent/service/deregister/"+url.PathEscape(svc.ID), nil); err != nil {
+			logger.Println("consul deregister:", err)
+			return
+		}
+		logAt(levelInfo, "consul: deregistered", svc.ID)
+	}, nil
+}
+
+// registerConsul registers the first tcp listener as name, exiting if the
+// agent refuses
+func registerConsul(agent, name string, listeners []net.Listener) func() {
+	for _, ln := range listeners {
+		svc, ok := consulServiceFor(name, ln)
+		if !ok {
+			continue
+		}
+		deregister, err := consulRegister(agent, svc)
+		if err != nil {
+			println(err.Error())
+			os.Exit(111)
+		}
+		logAt(levelInfo, "consul: registered", svc.ID)
+		return deregister
+	}
+	logAt(levelWarn, "consul: no tcp listener to register")
+	return func() {}
+}
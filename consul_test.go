@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestConsulRegister(t *testing.T) {
+	var registered consulService
+	var paths []string
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		if r.URL.Path == "/v1/agent/service/register" {
+			b, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(b, &registered)
+		}
+	}))
+	defer agent.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	deregister := registerConsul(agent.URL, "docs", []net.Listener{ln})
+	if registered.Name != "docs" || registered.Port != port || registered.Address != "127.0.0.1" ||
+		registered.Check == nil || registered.Check.HTTP != "http://127.0.0.1:"+strconv.Itoa(port)+"/healthz" {
+		t.Logf("Unexpected registration: %+v", registered)
+		t.Fail()
+	}
+	deregister()
+	if len(paths) != 2 || paths[1] != "PUT /v1/agent/service/deregister/"+registered.ID {
+		t.Log("Expected register then deregister, got:", paths)
+		t.Fail()
+	}
+}
+
+func TestConsulRefused(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+	}))
+	defer agent.Close()
+	if _, err := consulRegister(agent.URL, consulService{ID: "docs", Name: "docs"}); err == nil {
+		t.Log("Expected an error when the agent refuses")
+		t.Fail()
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// static parts of a minimal wordprocessingml package
+const (
+	docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>
+<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>
+</Types>`
+
+	docxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>
+</Relationships>`
+
+	docxDocumentRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+	docxCore = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<dc:title>%s</dc:title>
+<dc:creator>markdownd %s</dc:creator>
+<dcterms:created xsi:type="dcterms:W3CDTF">%s</dcterms:created>
+</cp:coreProperties>`
+
+	docxDocumentStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:body>
+`
+
+	docxDocumentEnd = `<w:sectPr><w:pgSz w:w="11906" w:h="16838"/><w:pgMar w:top="1134" w:right="1134" w:bottom="1134" w:left="1134" w:header="709" w:footer="709" w:gutter="0"/></w:sectPr>
+</w:body>
+</w:document>`
+)
+
+// docxStyles defines the paragraph styles used by writeDOCX
+var docxStyles = func() string {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:cs="Calibri"/><w:sz w:val="22"/></w:rPr></w:rPrDefault>
+<w:pPrDefault><w:pPr><w:spacing w:after="120" w:line="276" w:lineRule="auto"/></w:pPr></w:pPrDefault></w:docDefaults>
+<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/></w:style>
+`)
+	sizes := []int{36, 30, 26, 24, 22, 22}
+	for i, size := range sizes {
+		fmt.Fprintf(&buf, `<w:style w:type="paragraph" w:styleId="Heading%d"><w:name w:val="heading %d"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/>`+
+			`<w:pPr><w:keepNext/><w:spacing w:before="240" w:after="120"/><w:outlineLvl w:val="%d"/></w:pPr><w:rPr><w:b/><w:sz w:val="%d"/></w:rPr></w:style>
+`, i+1, i+1, i, size)
+	}
+	buf.WriteString(`<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:after="0" w:line="240" w:lineRule="auto"/><w:ind w:left="284"/><w:shd w:val="clear" w:color="auto" w:fill="F2F2F2"/></w:pPr><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="18"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/><w:pPr><w:ind w:left="567"/></w:pPr><w:rPr><w:i/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="ListParagraph"><w:name w:val="List Paragraph"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:after="60"/></w:pPr></w:style>
+</w:styles>`)
+	return buf.String()
+}()
+
+// xmlText escapes s for xml character data
+func xmlText(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// docxParagraph writes one paragraph with the given style (may be empty)
+func docxParagraph(w io.Writer, style, ppr, text string) {
+	fmt.Fprint(w, "<w:p>")
+	if style != "" || ppr != "" {
+		fmt.Fprint(w, "<w:pPr>")
+		if style != "" {
+			fmt.Fprintf(w, `<w:pStyle w:val="%s"/>`, style)
+		}
+		fmt.Fprint(w, ppr, "</w:pPr>")
+	}
+	if text != "" {
+		fmt.Fprintf(w, `<w:r><w:t xml:space="preserve">%s</w:t></w:r>`, xmlText(text))
+	}
+	fmt.Fprint(w, "</w:p>\n")
+}
+
+// writeDOCX renders files, in order, into one word document. the print
+// settings are for pdf, word paginates documents itself.
+func writeDOCX(w io.Writer, title string, files []string, _ printSettings) error {
+	var body bytes.Buffer
+	for i, filename := range files {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		_, md := parseFrontMatter(b)
+		blocks := parseBlocks(md)
+		markers := listMarkers(blocks)
+
+		// each document starts a page
+		if i > 0 {
+			body.WriteString(`<w:p><w:r><w:br w:type="page"/></w:r></w:p>` + "\n")
+		}
+		for j, b := range blocks {
+			switch b.Kind {
+			case blockHeading:
+				docxParagraph(&body, fmt.Sprintf("Heading%d", b.Level), "", b.Text)
+			case blockParagraph:
+				docxParagraph(&body, "", "", b.Text)
+			case blockListItem:
+				ind := fmt.Sprintf(`<w:ind w:left="%d" w:hanging="284"/>`, 567+425*b.Level)
+				docxParagraph(&body, "ListParagraph", ind, markers[j]+" "+b.Text)
+			case blockQuote:
+				docxParagraph(&body, "Quote", "", b.Text)
+			case blockCode:
+				for _, l := range strings.Split(b.Text, "\n") {
+					docxParagraph(&body, "Code", "", l)
+				}
+				docxParagraph(&body, "", "", "")
+			case blockRule:
+				docxParagraph(&body, "", `<w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="auto"/></w:pBdr>`, "")
+			}
+		}
+	}
+
+	created, err := buildTime()
+	if err != nil {
+		return err
+	}
+	z := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxRels},
+		{"docProps/core.xml", fmt.Sprintf(docxCore, xmlText(title), version, created.Format(time.RFC3339))},
+		{"word/_rels/document.xml.rels", docxDocumentRels},
+		{"word/styles.xml", docxStyles},
+		{"word/document.xml", docxDocumentStart + body.String() + docxDocumentEnd},
+	}
+	for _, part := range parts {
+		f, err := z.CreateHeader(&zip.FileHeader{Name: part.name, Method: zip.Deflate, Modified: created})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
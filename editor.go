@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/shurcooL/sanitized_anchor_name"
+)
+
+// the editor api helps editor plugins while a document is being written:
+//
+//	GET  /_markdownd/api/resolve?from=/dir/page.md&link=../other.md#anchor
+//	GET  /_markdownd/api/targets
+//	POST /_markdownd/api/frontmatter (markdown body)
+//	POST /_markdownd/api/preview (markdown body)
+const editorAPIPrefix = "/_markdownd/api/"
+
+// linkTarget is a page that can be linked to
+type linkTarget struct {
+	URL     string   `json:"url"`
+	Title   string   `json:"title"`
+	Anchors []string `json:"anchors,omitempty"`
+}
+
+// resolvedLink describes where a relative link in a document points
+type resolvedLink struct {
+	URL      string `json:"url"`
+	File     string `json:"file,omitempty"`
+	Exists   bool   `json:"exists"`
+	External bool   `json:"external,omitempty"`
+	Anchor   string `json:"anchor,omitempty"`
+	AnchorOK bool   `json:"anchor_exists,omitempty"`
+}
+
+// diagnostic is a problem found in a document, lines start at 1
+type diagnostic struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// pageAnchors returns the ids the renderer gives to headings
+func pageAnchors(md []byte) []string {
+	var anchors []string
+	for _, b := range parseBlocks(md) {
+		if b.Kind == blockHeading {
+			anchors = append(anchors, sanitized_anchor_name.Create(b.Text))
+		}
+	}
+	return anchors
+}
+
+// resolveLink resolves link as written in the page at from
+func (h Handler) resolveLink(from, link string) resolvedLink {
+	u, err := url.Parse(link)
+	if err != nil {
+		return resolvedLink{URL: link}
+	}
+	if u.Scheme != "" || u.Host != "" {
+		return resolvedLink{URL: link, External: true}
+	}
+	res := resolvedLink{Anchor: u.Fragment}
+	p := u.Path
+	switch {
+	case p == "":
+		p = from
+	case !strings.HasPrefix(p, "/"):
+		p = path.Join(path.Dir("/"+strings.TrimPrefix(from, "/")), p)
+		if strings.HasSuffix(u.Path, "/") && !strings.HasSuffix(p, "/") {
+			p += "/"
+		}
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	res.URL = p
+	if u.Fragment != "" {
+		res.URL += "#" + u.Fragment
+	}
+	// path.Join cleaned any '..', a link leaving the root starts with it.
+	// drafts are not found, as they are for readers.
+	if strings.Contains(p, "..") || hideDraft(strings.TrimPrefix(p, "/")+"/", nil) {
+		return res
+	}
+
+	abs, ok := h.resolve(p)
+	if !ok {
+		// static files, and .html served as is
+		if abs, ok = h.localPath(p); !ok {
+			return res
+		}
+		if fi, err := os.Stat(abs); err != nil || fi.IsDir() {
+			return res
+		}
+	}
+	file := filepath.ToSlash(strings.TrimPrefix(abs, h.RootString))
+	if strings.HasSuffix(abs, ".md") {
+		b, err := ioutil.ReadFile(abs)
+		if err != nil {
+			return res
+		}
+		fm, md := parseFrontMatter(b)
+		if hideDraft(file, fm) {
+			return res
+		}
+		for _, a := range pageAnchors(md) {
+			if u.Fragment != "" && a == u.Fragment {
+				res.AnchorOK = true
+				break
+			}
+		}
+	}
+	res.Exists, res.File = true, file
+	return res
+}
+
+// linkTargets lists every page under the root, with its heading anchors,
+// but for drafts and embargoed pages
+func (h Handler) linkTargets() []linkTarget {
+	targets := []linkTarget{}
+	walkMarkdown(h.RootString, func(abs, rel string) error {
+		b, err := ioutil.ReadFile(abs)
+		if err != nil {
+			return nil
+		}
+		fm, md := parseFrontMatter(b)
+		if hideDraft(rel, fm) {
+			return nil
+		}
+		title := pageTitle(fm, md)
+		if title == "" {
+			title = segmentName(path.Base(rel))
+		}
+		targets = append(targets, linkTarget{URL: "/" + rel, Title: title, Anchors: pageAnchors(md)})
+		return nil
+	})
+	return targets
+}
+
+// checkFrontMatter reports front matter the server won't understand, or
+// that doesn't follow the -schemas of its type
+func checkFrontMatter(b []byte) []diagnostic {
+	diags := []diagnostic{}
+	if !bytes.HasPrefix(b, []byte("---")) {
+		return diags
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Scan() // opening '---'
+	n, closed, lastkey := 1, false, ""
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "---" || trimmed == "..." {
+			closed = true
+			break
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") {
+			if lastkey == "" {
+				diags = append(diags, diagnostic{n, "list item without a key"})
+			}
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i == -1 {
+			diags = append(diags, diagnostic{n, "expected 'key: value'"})
+			continue
+		}
+		lastkey = strings.ToLower(strings.TrimSpace(line[:i]))
+		if lastkey == "" {
+			diags = append(diags, diagnostic{n, "missing key"})
+			continue
+		}
+		val := strings.TrimSpace(line[i+1:])
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		}
+		if msg := checkFrontMatterValue(lastkey, val); msg != "" {
+			diags = append(diags, diagnostic{n, msg})
+		}
+	}
+	if !closed {
+		diags = append(diags, diagnostic{1, "front matter is not closed with '---', it will be rendered as markdown"})
+	}
+	return append(diags, schemaDiagnostics(b)...)
+}
+
+// checkFrontMatterValue checks the keys markdownd itself uses
+func checkFrontMatterValue(key, val string) string {
+	if val == "" {
+		return ""
+	}
+	switch key {
+	case "analytics":
+		if _, err := strconv.ParseBool(val); err != nil && val != "yes" && val != "no" {
+			return "analytics should be true or false"
+		}
+	case "date", "expires", "review", "embargo_until":
+		if _, ok := (frontMatter{key: val}).Date(key); !ok {
+			return key + " should look like 2006-01-02 or RFC 3339"
+		}
+	case "cache":
+		if _, err := pageCachePolicy(frontMatter{"cache": val}); err != nil {
+			return "cache should be no-store, no-cache, private or a max-age such as 300 or 5m"
+		}
+	case "layout":
+		if !reLayoutVariant.MatchString(val) {
+			return "layout should be a name such as wide, for a _layout.wide.html"
+		}
+	case "schema":
+		if !strings.EqualFold(val, "Article") && !strings.EqualFold(val, "TechArticle") {
+			return "schema should be Article or TechArticle"
+		}
+	}
+	return ""
+}
+
+// serveEditorAPI answers the editor api
+func (h Handler) serveEditorAPI(w http.ResponseWriter, r *http.Request) {
+	var v interface{}
+	switch r.URL.Path[len(editorAPIPrefix):] {
+	case "resolve":
+		q := r.URL.Query()
+		if q.Get("link") == "" {
+			http.Error(w, "400 bad request: missing link", http.StatusBadRequest)
+			return
+		}
+		v = h.resolveLink(q.Get("from"), q.Get("link"))
+	case "targets":
+		v = h.linkTargets()
+	case "frontmatter", "preview":
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 8<<20))
+		if err != nil {
+			http.Error(w, "400 bad request", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == editorAPIPrefix+"preview" {
+			_, md := parseFrontMatter(b)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(markdown2html(md))
+			return
+		}
+		fm, _ := parseFrontMatter(b)
+		v = map[string]interface{}{"front_matter": fm, "diagnostics": checkFrontMatter(b)}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
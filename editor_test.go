@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEditorResolve(t *testing.T) {
+	*editorAPI = true
+	defer func() { *editorAPI = false }()
+
+	for link, want := range map[string]resolvedLink{
+		"index.md#welcome-to-markdownd": {URL: "/index.md#welcome-to-markdownd", File: "index.md", Exists: true, Anchor: "welcome-to-markdownd", AnchorOK: true},
+		"../index.html#nope":            {URL: "/index.html#nope", File: "index.md", Exists: true, Anchor: "nope"},
+		"/test.html":                    {URL: "/test.html", File: "test.html", Exists: true},
+		"notafile":                      {URL: "/notafile"},
+		"https://example.com/":          {URL: "https://example.com/", External: true},
+	} {
+		req, _ := http.NewRequest("GET", "/_markdownd/api/resolve?from=/page.md&link="+strings.Replace(link, "#", "%23", 1), nil)
+		resp := sendRequest(req)
+		var got resolvedLink
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Log(link, "Expected json, got:", resp.StatusCode, err)
+			t.FailNow()
+		}
+		if got != want {
+			t.Logf("%s: Expected %+v, got %+v", link, want, got)
+			t.Fail()
+		}
+	}
+}
+
+func TestEditorTargets(t *testing.T) {
+	*editorAPI = true
+	defer func() { *editorAPI = false }()
+
+	req, _ := http.NewRequest("GET", "/_markdownd/api/targets", nil)
+	var targets []linkTarget
+	json.NewDecoder(sendRequest(req).Body).Decode(&targets)
+	if len(targets) != 1 || targets[0].URL != "/index.md" || targets[0].Title != "welcome to markdownd" ||
+		len(targets[0].Anchors) == 0 || targets[0].Anchors[0] != "welcome-to-markdownd" {
+		t.Log("Expected index.md with anchors, got:", targets)
+		t.Fail()
+	}
+
+	// anchors match the ids of the rendered page
+	req, _ = http.NewRequest("POST", "/_markdownd/api/preview", strings.NewReader("---\ntitle: x\n---\n# Hello, World!\n"))
+	body, _ := ioutil.ReadAll(sendRequest(req).Body)
+	if want := pageAnchors([]byte("# Hello, World!")); !strings.Contains(string(body), `href="#`+want[0]+`"`) {
+		t.Log("Expected preview with anchor", want, "got:", string(body))
+		t.Fail()
+	}
+}
+
+func TestCheckFrontMatter(t *testing.T) {
+	doc := "---\ntitle: ok\ndate: yesterday\nnot yaml\n- orphan\nanalytics: maybe\n"
+	got := checkFrontMatter([]byte(doc))
+	want := []diagnostic{
+		{3, "date should look like 2006-01-02 or RFC 3339"},
+		{4, "expected 'key: value'"},
+		{6, "analytics should be true or false"},
+		{1, "front matter is not closed with '---', it will be rendered as markdown"},
+	}
+	if len(got) != len(want) {
+		t.Log("Expected", want, "got:", got)
+		t.FailNow()
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Log("Expected", want[i], "got:", got[i])
+			t.Fail()
+		}
+	}
+	if got := checkFrontMatter([]byte("---\ntags:\n- a\ndate: 2020-01-02\n---\n# doc\n")); len(got) != 0 {
+		t.Log("Expected no diagnostics, got:", got)
+		t.Fail()
+	}
+
+	// posted to the api
+	*editorAPI = true
+	defer func() { *editorAPI = false }()
+	req, _ := http.NewRequest("POST", "/_markdownd/api/frontmatter", strings.NewReader("---\nschema: Blog\n---\n"))
+	var v struct {
+		FrontMatter map[string]interface{} `json:"front_matter"`
+		Diagnostics []diagnostic           `json:"diagnostics"`
+	}
+	json.NewDecoder(sendRequest(req).Body).Decode(&v)
+	if v.FrontMatter["schema"] != "Blog" || len(v.Diagnostics) != 1 {
+		t.Log("Expected schema diagnostic, got:", v)
+		t.Fail()
+	}
+}
+
+func TestEditorDrafts(t *testing.T) {
+	*editorAPI = true
+	defer func() { *editorAPI = false }()
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	soon := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	os.Mkdir(dir+"/_drafts", 0755)
+	for name, body := range map[string]string{
+		"index.md":        "# Home\n",
+		"wip.md":          "---\ndraft: true\n---\n# Secret plan\n",
+		"notes.md":        "---\nembargo_until: " + soon + "\n---\n# Release notes\n",
+		"_drafts/idea.md": "# Idea\n",
+	} {
+		ioutil.WriteFile(dir+"/"+name, []byte(body), 0644)
+	}
+	h := Handler{Root: os.DirFS(dir + "/"), RootString: dir + "/"}
+	get := func(path string, v interface{}) {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		json.NewDecoder(w.Body).Decode(v)
+	}
+
+	var targets []linkTarget
+	get("/_markdownd/api/targets", &targets)
+	if len(targets) != 1 || targets[0].URL != "/index.md" {
+		t.Log("Expected only index.md as a target, got:", targets)
+		t.Fail()
+	}
+	for _, link := range []string{"wip.md", "notes.md%23release-notes", "_drafts/idea.md"} {
+		var got resolvedLink
+		get("/_markdownd/api/resolve?from=/index.md&link="+link, &got)
+		if got.Exists || got.File != "" || got.AnchorOK {
+			t.Logf("%s: Expected an unpublished page not to exist, got %+v", link, got)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aerth/markdownd/pkg/markdownd"
+)
+
+// accessCookie holds the early access token given with ?access=
+const accessCookie = "markdownd-access"
+
+// accessGroup is a group of readers who see embargoed pages early: the
+// holders of a token, or the clients in a network
+type accessGroup struct {
+	Name  string
+	Token string
+	Net   *net.IPNet
+}
+
+// accessGroupList is the -early-access groups
+type accessGroupList []accessGroup
+
+var earlyAccess accessGroupList
+
+func (l *accessGroupList) String() string {
+	if l == nil {
+		return ""
+	}
+	var s []string
+	for _, g := range *l {
+		if g.Net != nil {
+			s = append(s, g.Name+"="+g.Net.String())
+		} else {
+			s = append(s, g.Name+"=<token>")
+		}
+	}
+	return strings.Join(s, "; ")
+}
+
+// Set reads 'staff=10.0.0.0/8', or 'press=token' with the token inline,
+// in a file: or from an ${ENV} variable
+func (l *accessGroupList) Set(value string) error {
+	i := strings.IndexByte(value, '=')
+	if i < 1 || strings.TrimSpace(value[i+1:]) == "" {
+		return fmt.Errorf("expected group=cidr or group=token, such as 'staff=10.0.0.0/8', got %q", value)
+	}
+	g := accessGroup{Name: strings.TrimSpace(value[:i])}
+	v := strings.TrimSpace(value[i+1:])
+	if _, n, err := net.ParseCIDR(v); err == nil {
+		g.Net = n
+	} else if g.Token, err = secretValue(v); err != nil {
+		return fmt.Errorf("%s: %v", g.Name, err)
+	}
+	*l = append(*l, g)
+	return nil
+}
+
+// member returns the groups r belongs to: by the client address, or by
+// the bearer token or access cookie
+func (l accessGroupList) member(r *http.Request) []string {
+	var tokens []string
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		tokens = append(tokens, strings.TrimSpace(auth[7:]))
+	}
+	if c, err := r.Cookie(accessCookie); err == nil {
+		tokens = append(tokens, c.Value)
+	}
+	ip := net.ParseIP(clientIP(r))
+	var groups []string
+	for _, g := range l {
+		if g.Net != nil && ip != nil && g.Net.Contains(ip) {
+			groups = append(groups, g.Name)
+			continue
+		}
+		for _, t := range tokens {
+			if g.Token != "" && subtle.ConstantTimeCompare([]byte(t), []byte(g.Token)) == 1 {
+				groups = append(groups, g.Name)
+				break
+			}
+		}
+	}
+	return groups
+}
+
+// embargoed reports whether the page is under embargo at now: made public
+// at its 'embargo_until' time, such as 2026-11-03T09:00:00Z
+func embargoed(fm frontMatter, now time.Time) (time.Time, bool) {
+	return markdownd.Embargoed(fm, now)
+}
+
+// earlyReader reports whether r may read the embargoed page before its
+// time: a member of one of its 'embargo_groups', or of any -early-access
+// group when it lists none. drafts stay hidden.
+func earlyReader(r *http.Request, name string, fm frontMatter) bool {
+	if _, ok := embargoed(fm, time.Now()); !ok || isDraft(name, fm) {
+		return false
+	}
+	groups := earlyAccess.member(r)
+	allowed := fm.List("embargo_groups")
+	if len(allowed) == 0 {
+		return len(groups) != 0
+	}
+	for _, g := range groups {
+		for _, a := range allowed {
+			if g == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// grantAccess answers ?access=token of an early access group with the
+// access cookie, and a redirect to the page without the token, so links
+// can be shared with those who don't send a bearer token. returns false
+// for other requests.
+func grantAccess(w http.ResponseWriter, r *http.Request, prefix string) bool {
+	token := r.URL.Query().Get("access")
+	if token == "" || len(earlyAccess) == 0 {
+		return false
+	}
+	for _, g := range earlyAccess {
+		if g.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(g.Token)) == 1 {
+			http.SetCookie(w, &http.Cookie{
+				Name:     accessCookie,
+				Value:    token,
+				Path:     prefix + "/",
+				MaxAge:   30 * 24 * 60 * 60,
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			u := *r.URL
+			q := u.Query()
+			q.Del("access")
+			u.RawQuery = q.Encode()
+			w.Header().Set("Cache-Control", "no-store")
+			http.Redirect(w, r, prefix+u.RequestURI(), http.StatusSeeOther)
+			return true
+		}
+	}
+	return false
+}
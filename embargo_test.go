@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestEmbargo(t *testing.T) {
+	defer func(l accessGroupList) { earlyAccess = l }(earlyAccess)
+	earlyAccess = nil
+	for _, v := range []string{"staff=10.0.0.0/8", "press=s3cret"} {
+		if err := earlyAccess.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	soon := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	h := Handler{Root: fstest.MapFS{
+		"notes.md":   {Data: []byte("---\nembargo_until: " + soon + "\n---\n# Release notes\n")},
+		"staff.md":   {Data: []byte("---\nembargo_until: " + soon + "\nembargo_groups: [staff]\n---\n# Staff only\n")},
+		"past.md":    {Data: []byte("---\nembargo_until: 2001-01-01\n---\n# Out\n")},
+		"drafted.md": {Data: []byte("---\ndraft: true\nembargo_until: " + soon + "\n---\n# Draft\n")},
+	}, Prefix: "/docs"}
+	get := func(path, addr string, set func(*http.Request)) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = addr + ":1234"
+		if set != nil {
+			set(req)
+		}
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	bearer := func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }
+	cookie := func(r *http.Request) { r.AddCookie(&http.Cookie{Name: accessCookie, Value: "s3cret"}) }
+	for _, c := range []struct {
+		path, addr string
+		set        func(*http.Request)
+		code       int
+	}{
+		{"/notes.md", "192.0.2.1", nil, 404},
+		{"/notes.md", "10.1.2.3", nil, 200},
+		{"/notes.md", "192.0.2.1", bearer, 200},
+		{"/notes.md", "192.0.2.1", cookie, 200},
+		{"/staff.md", "192.0.2.1", bearer, 404},
+		{"/staff.md", "10.1.2.3", nil, 200},
+		{"/past.md", "192.0.2.1", nil, 200},
+		{"/drafted.md", "10.1.2.3", nil, 404},
+	} {
+		rec := get(c.path, c.addr, c.set)
+		if rec.Code != c.code {
+			t.Logf("%s from %s: %d, expected %d", c.path, c.addr, rec.Code, c.code)
+			t.Fail()
+		}
+		if c.code == 200 && c.path != "/past.md" && (rec.Header().Get("Cache-Control") != "private, no-store" || rec.Header().Get("X-Embargo-Until") != soon) {
+			t.Logf("%s early: %v", c.path, rec.Header())
+			t.Fail()
+		}
+	}
+
+	// ?access= keeps the token in a cookie, and drops it from the url
+	rec := get("/notes.md?access=s3cret&x=1", "192.0.2.1", nil)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/docs/notes.md?x=1" ||
+		!strings.HasPrefix(rec.Header().Get("Set-Cookie"), accessCookie+"=s3cret; Path=/docs/;") {
+		t.Logf("access link: %d %v", rec.Code, rec.Header())
+		t.Fail()
+	}
+	if rec := get("/notes.md?access=wrong", "192.0.2.1", nil); rec.Code != 404 {
+		t.Logf("wrong access token: %d", rec.Code)
+		t.Fail()
+	}
+}
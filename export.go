@@ -0,0 +1,228 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var reSummaryLink = regexp.MustCompile(`\[[^\]]*\]\(([^)\s]+)[^)]*\)`)
+
+// isSummary returns true for mdbook/gitbook style table of contents files
+func isSummary(filename string) bool {
+	return strings.EqualFold(filepath.Base(filename), "SUMMARY.md")
+}
+
+// summaryFiles returns the markdown files linked from summary, in order.
+// if root is not empty, files outside of it (or symlinks) are skipped.
+// drafts and embargoed pages are skipped too, they aren't published.
+func summaryFiles(summary, root string) ([]string, error) {
+	b, err := ioutil.ReadFile(summary)
+	if err != nil {
+		return nil, err
+	}
+	_, b = parseFrontMatter(b)
+	dir := filepath.Dir(summary)
+	seen := map[string]bool{}
+	var files []string
+	for _, m := range reSummaryLink.FindAllSubmatch(b, -1) {
+		target := string(m[1])
+		if strings.Contains(target, "://") || strings.HasPrefix(target, "#") {
+			continue
+		}
+		if i := strings.IndexAny(target, "#?"); i != -1 {
+			target = target[:i]
+		}
+		if !strings.HasSuffix(target, ".md") {
+			continue
+		}
+		abs, err := filepath.Abs(filepath.Join(dir, filepath.FromSlash(target)))
+		if err != nil || seen[abs] {
+			continue
+		}
+		if root != "" && (!strings.HasPrefix(abs, root) || !fileisgood(abs)) {
+			logAt(levelWarn, "manual: skipping", target)
+			continue
+		}
+		seen[abs] = true
+		rel := abs
+		if root != "" {
+			rel = strings.TrimPrefix(abs, root)
+		} else if r, err := filepath.Rel(dir, abs); err == nil {
+			rel = r
+		}
+		if page, err := ioutil.ReadFile(abs); err == nil {
+			if fm, _ := parseFrontMatter(page); hideDraft(filepath.ToSlash(rel), fm) {
+				logAt(levelDebug, "manual: skipping unpublished", target)
+				continue
+			}
+		}
+		files = append(files, abs)
+	}
+	return files, nil
+}
+
+// buildTime is the time recorded in exported documents: $SOURCE_DATE_EPOCH
+// if set, so the same pages export to the same bytes, or now
+func buildTime() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Now().UTC(), nil
+	}
+	n, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil || n < 0 {
+		return time.Time{}, fmt.Errorf("SOURCE_DATE_EPOCH: expected seconds since 1970, got %q", epoch)
+	}
+	return time.Unix(n, 0).UTC(), nil
+}
+
+// exporter writes files, in order, into one document
+type exporter struct {
+	contentType string
+	write       func(w io.Writer, title string, files []string, p printSettings) error
+}
+
+// exporters by ?format= and command name
+var exporters = map[string]exporter{
+	"pdf":  {"application/pdf", writePDF},
+	"docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", writeDOCX},
+}
+
+// serveExport renders a markdown file, or all files listed in a SUMMARY.md,
+// in another format
+func (h Handler) serveExport(w http.ResponseWriter, format, abs string, fm frontMatter, md []byte) {
+	files := []string{abs}
+	if isSummary(abs) {
+		var err error
+		files, err = summaryFiles(abs, h.RootString)
+		if err != nil || len(files) == 0 {
+			logger.Println("error reading summary:", abs, err)
+			http.Error(w, "500 bad summary", http.StatusInternalServerError)
+			return
+		}
+	}
+	title := pageTitle(fm, md)
+	p, err := newPrintSettings(*pdfHeader, *pdfFooter, *pdfCover, fm)
+	if err != nil {
+		logger.Println("error exporting:", abs, err)
+		http.Error(w, "500 export error", http.StatusInternalServerError)
+		return
+	}
+	name := strings.TrimSuffix(filepath.Base(abs), ".md") + "." + format
+	w.Header().Set("Content-Type", exporters[format].contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", name))
+	if err := exporters[format].write(w, title, files, p); err != nil {
+		logger.Printf("error writing %s: %s %v", format, abs, err)
+	}
+}
+
+// exportFiles returns the pages of the export command arguments, in
+// order: the pages a SUMMARY.md links, or the files a glob matches
+func exportFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		if isSummary(arg) {
+			f, err := summaryFiles(arg, "")
+			if err != nil {
+				return nil, err
+			}
+			if len(f) == 0 {
+				return nil, fmt.Errorf("%s links no pages", arg)
+			}
+			files = append(files, f...)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil || len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %q", arg)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// exportCommand returns 'markdownd <format>', rendering pages into one document
+func exportCommand(format string) func(args []string) {
+	return func(args []string) {
+		fs := flag.NewFlagSet(format, flag.ExitOnError)
+		out := fs.String("o", "manual."+format, "output file, or '-' for stdout")
+		title := fs.String("title", "", "document title (default: first page title)")
+		header, footer, cover := new(string), new(string), new(string)
+		usage := ""
+		if format == "pdf" {
+			header = fs.String("header", *pdfHeader, "running header of the pages, with {title}, {section}, {page}, {pages} and {date}")
+			footer = fs.String("footer", *pdfFooter, "running footer of the pages, such as '{page} / {pages}'")
+			cover = fs.String("cover", *pdfCover, "cover page: 'title' for the title, subtitle and date, or a markdown file with\n{title}, {subtitle} and {date}")
+			usage = " [-header text] [-footer text] [-cover title|file.md]"
+		}
+		fs.Usage = func() {
+			fmt.Fprintf(os.Stderr, "usage: markdownd %s [-o manual.%s] [-title name]%s <SUMMARY.md | file.md | glob>...\n", format, format, usage)
+			fs.PrintDefaults()
+		}
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			fs.Usage()
+			os.Exit(111)
+		}
+
+		files, err := exportFiles(fs.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(111)
+		}
+
+		// the front matter of the SUMMARY.md, or of the first page, has
+		// the print settings of the document
+		doc := files[0]
+		if isSummary(fs.Arg(0)) {
+			doc = fs.Arg(0)
+		}
+		b, err := ioutil.ReadFile(doc)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(111)
+		}
+		fm, _ := parseFrontMatter(b)
+		if *title == "" {
+			if doc != files[0] {
+				if b, err = ioutil.ReadFile(files[0]); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(111)
+				}
+			}
+			first, md := parseFrontMatter(b)
+			*title = pageTitle(first, md)
+		}
+		p, err := newPrintSettings(*header, *footer, *cover, fm)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(111)
+		}
+
+		w := os.Stdout
+		if *out != "-" {
+			f, err := os.Create(*out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(111)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := exporters[format].write(w, *title, files, p); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(111)
+		}
+		if *out != "-" {
+			fmt.Fprintf(os.Stderr, "wrote %d documents to %s\n", len(files), *out)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPDFRequest(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/index.md?format=pdf", nil)
+	resp := sendRequest(req)
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Type") != "application/pdf" {
+		t.Log("Expected application/pdf, got:", resp.Header.Get("Content-Type"))
+		t.FailNow()
+	}
+	if !bytes.HasPrefix(body, []byte("%PDF-1.4")) || !bytes.HasSuffix(body, []byte("%%EOF\n")) {
+		t.Log("Expected a pdf document")
+		t.FailNow()
+	}
+	if !bytes.Contains(body, []byte("/Outlines")) {
+		t.Log("Expected bookmarks for headings")
+		t.FailNow()
+	}
+}
+
+func TestOutlineTree(t *testing.T) {
+	doc := newPDF("test")
+	doc.addBlocks(parseBlocks([]byte("# a\n## b\n### c\n## d\n# e\n")))
+	roots := doc.outlineTree()
+	if len(roots) != 2 || len(roots[0].children) != 2 || len(roots[0].children[0].children) != 1 {
+		t.Log("Expected nested outline a(b(c), d), e")
+		t.FailNow()
+	}
+}
+
+func TestDOCXRequest(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/index.md?format=docx", nil)
+	resp := sendRequest(req)
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/vnd.openxmlformats") {
+		t.Log("Expected docx content type, got:", resp.Header.Get("Content-Type"))
+		t.FailNow()
+	}
+	z, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Log("Expected a zip file:", err)
+		t.FailNow()
+	}
+	var found bool
+	for _, f := range z.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		found = true
+		rc, _ := f.Open()
+		doc, _ := ioutil.ReadAll(rc)
+		if !strings.Contains(string(doc), `<w:pStyle w:val="Heading1"/>`) {
+			t.Log("Expected a Heading1 paragraph")
+			t.Fail()
+		}
+	}
+	if !found {
+		t.Log("Expected word/document.xml")
+		t.FailNow()
+	}
+}
+
+func TestReproducibleExport(t *testing.T) {
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	os.Setenv("SOURCE_DATE_EPOCH", "1577836800")
+	files := []string{"README.md", "CHANGELOG.md"}
+	for format, e := range exporters {
+		var first, second bytes.Buffer
+		if err := e.write(&first, "manual", files, printSettings{}); err != nil {
+			t.Log(format, err)
+			t.FailNow()
+		}
+		e.write(&second, "manual", files, printSettings{})
+		if !bytes.Equal(first.Bytes(), second.Bytes()) {
+			t.Logf("Expected the same %s twice", format)
+			t.Fail()
+		}
+		if format != "docx" {
+			continue
+		}
+		z, _ := zip.NewReader(bytes.NewReader(first.Bytes()), int64(first.Len()))
+		for _, f := range z.File {
+			if !f.Modified.Equal(time.Unix(1577836800, 0)) {
+				t.Log("Expected the SOURCE_DATE_EPOCH time for", f.Name, "got", f.Modified)
+				t.Fail()
+			}
+		}
+	}
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if err := writeDOCX(ioutil.Discard, "manual", files, printSettings{}); err == nil {
+		t.Log("Expected an error for a bad SOURCE_DATE_EPOCH")
+		t.Fail()
+	}
+}
+
+func TestSummarySkipsUnpublished(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	soon := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	os.Mkdir(dir+"/_drafts", 0755)
+	for name, body := range map[string]string{
+		"SUMMARY.md":      "# Summary\n\n- [Intro](intro.md)\n- [Plan](plan.md)\n- [Notes](notes.md)\n- [Idea](_drafts/idea.md)\n",
+		"notes.md":        "---\nembargo_until: " + soon + "\n---\n# Release notes\n",
+		"intro.md":        "# Intro\n",
+		"plan.md":         "---\ndraft: true\n---\n# Secret plan\n",
+		"_drafts/idea.md": "# Idea\n",
+	} {
+		if err := ioutil.WriteFile(dir+"/"+name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, root := range []string{dir + "/", ""} {
+		files, err := summaryFiles(dir+"/SUMMARY.md", root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 || !strings.HasSuffix(files[0], "/intro.md") {
+			t.Logf("Expected only intro.md in the manual, got %q", files)
+			t.Fail()
+		}
+	}
+}
+
+func TestExportFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, body := range map[string]string{
+		"SUMMARY.md": "# Summary\n\n- [Plan](plan.md)\n",
+		"plan.md":    "---\ndraft: true\n---\n# Secret plan\n",
+		"intro.md":   "# Intro\n",
+	} {
+		if err := ioutil.WriteFile(dir+"/"+name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if files, err := exportFiles([]string{dir + "/SUMMARY.md"}); err == nil || !strings.Contains(err.Error(), "links no pages") {
+		t.Log("Expected an error for a summary linking only drafts, got:", files, err)
+		t.Fail()
+	}
+	if _, err := exportFiles([]string{dir + "/missing*.md"}); err == nil {
+		t.Log("Expected an error for a glob matching nothing")
+		t.Fail()
+	}
+	if files, err := exportFiles([]string{dir + "/intro.md"}); err != nil || len(files) != 1 {
+		t.Log("Expected intro.md, got:", files, err)
+		t.Fail()
+	}
+}
+
+func TestPDFPrintSettings(t *testing.T) {
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	os.Setenv("SOURCE_DATE_EPOCH", "1577836800")
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, body := range map[string]string{
+		"intro.md":   "# Intro\n\nhello\n",
+		"license.md": "---\npdf_footer: none\n---\n# License\n",
+		"cover.md":   "# {title}\n\nprepared on {date}\n",
+	} {
+		ioutil.WriteFile(dir+"/"+name, []byte(body), 0644)
+	}
+	files := []string{dir + "/intro.md", dir + "/license.md"}
+	summary := frontMatter{"subtitle": "Operator guide", "pdf_cover": "true"}
+	p, err := newPrintSettings("{title}: {section}", "{page} / {pages}", "", summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Cover != "title" || p.Date != "2020-01-01" {
+		t.Logf("Expected a title cover dated by SOURCE_DATE_EPOCH, got %+v", p)
+		t.Fail()
+	}
+	var buf bytes.Buffer
+	if err := writePDF(&buf, "Manual", files, p); err != nil {
+		t.Fatal(err)
+	}
+	body := buf.String()
+	for _, want := range []string{"/Count 3 >>", "(Manual)", "(Operator guide)", "(2020-01-01)", "(Manual: Intro)", "(1 / 2)", "(Manual: License)"} {
+		if !strings.Contains(body, want) {
+			t.Logf("Expected %q in the pdf", want)
+			t.Fail()
+		}
+	}
+	if strings.Contains(body, "(2 / 2)") || strings.Contains(body, "(0 / 2)") {
+		t.Log("Expected no footer on the cover, or on the page with 'pdf_footer: none'")
+		t.Fail()
+	}
+
+	// a cover file, and front matter turning the cover off
+	p.Cover = dir + "/cover.md"
+	buf.Reset()
+	if err := writePDF(&buf, "Manual", files, p); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "(prepared on 2020-01-01)") || strings.Count(buf.String(), "/Title <FEFF") != 3 {
+		t.Log("Expected the cover file filled in, without a bookmark for its heading")
+		t.Fail()
+	}
+	if p, _ := newPrintSettings("", "", "title", frontMatter{"pdf_cover": "false"}); p.Cover != "" {
+		t.Log("Expected 'pdf_cover: false' to leave the cover out, got", p.Cover)
+		t.Fail()
+	}
+}
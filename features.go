@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// features are changes to the pipeline that are off until enabled with
+// -feature, so they can be rolled out gradually
+var features = map[string]string{
+	"lazy-images": `load images in rendered markdown lazily (loading="lazy")`,
+}
+
+// featureRule enables a feature for a percentage of clients, on a host
+type featureRule struct {
+	Name    string
+	Percent float64
+	Host    string // "" for every host
+}
+
+// featureList is the repeatable -feature flag, 'name[=percent%][@host]'
+type featureList []featureRule
+
+func (l *featureList) String() string {
+	if l == nil {
+		return ""
+	}
+	var s []string
+	for _, f := range *l {
+		v := f.Name
+		if f.Percent != 100 {
+			v += "=" + strconv.FormatFloat(f.Percent, 'g', -1, 64) + "%"
+		}
+		if f.Host != "" {
+			v += "@" + f.Host
+		}
+		s = append(s, v)
+	}
+	return strings.Join(s, ",")
+}
+
+func (l *featureList) Set(value string) error {
+	f := featureRule{Percent: 100}
+	if i := strings.LastIndexByte(value, '@'); i != -1 {
+		value, f.Host = value[:i], strings.ToLower(value[i+1:])
+	}
+	if i := strings.IndexByte(value, '='); i != -1 {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(value[i+1:], "%"), 64)
+		if err != nil || p < 0 || p > 100 {
+			return fmt.Errorf("expected a percentage from 0 to 100, got %q", value[i+1:])
+		}
+		value, f.Percent = value[:i], p
+	}
+	if _, ok := features[value]; !ok {
+		return fmt.Errorf("unknown feature %q, known: %s", value, strings.Join(featureNames(), ", "))
+	}
+	f.Name = value
+	*l = append(*l, f)
+	return nil
+}
+
+// featureNames returns the known features, sorted
+func featureNames() []string {
+	var names []string
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// featureBucket places a client in 0-100 for a feature, the same on every
+// request so pages don't change between visits
+func featureBucket(name, client string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(name + "\x00" + client))
+	return float64(h.Sum32()%10000) / 100
+}
+
+// featureOn reports whether the feature is enabled for the request.
+// clients in -feature-admin may turn features on or off with
+// 'X-Markdownd-Features: name,-other'.
+func featureOn(r *http.Request, name string) bool {
+	if v := r.Header.Get("X-Markdownd-Features"); v != "" && len(admins) != 0 {
+		if ip := net.ParseIP(clientIP(r)); ip != nil && admins.contains(ip) {
+			for _, f := range strings.Split(v, ",") {
+				switch strings.TrimSpace(f) {
+				case name:
+					return true
+				case "-" + name:
+					return false
+				}
+			}
+		}
+	}
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, f := range rollouts {
+		if f.Name == name && (f.Host == "" || f.Host == host) && featureBucket(name, clientIP(r)) < f.Percent {
+			return true
+		}
+	}
+	return false
+}
+
+var reImgTag = regexp.MustCompile(`<img\s`)
+
+// lazyImages adds loading="lazy" to images, for the lazy-images feature
+func lazyImages(html []byte) []byte {
+	return reImgTag.ReplaceAll(html, []byte(`<img loading="lazy" `))
+}
+
+// lazyImagesHook is the render hook of the lazy-images feature
+func lazyImagesHook(r *http.Request, name string, html []byte) []byte {
+	if !featureOn(r, "lazy-images") {
+		return html
+	}
+	return lazyImages(html)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFeatureList(t *testing.T) {
+	var l featureList
+	for _, v := range []string{"lazy-images", "lazy-images=12.5%@Docs.example.com"} {
+		if err := l.Set(v); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+	}
+	if got := l.String(); got != "lazy-images,lazy-images=12.5%@docs.example.com" {
+		t.Log("Unexpected rules:", got)
+		t.Fail()
+	}
+	for _, bad := range []string{"no-such-feature", "lazy-images=200%", "lazy-images=x"} {
+		if err := l.Set(bad); err == nil {
+			t.Log("Expected an error for", bad)
+			t.Fail()
+		}
+	}
+}
+
+func TestFeatureOn(t *testing.T) {
+	defer func() { rollouts, admins = nil, nil }()
+	request := func(host, addr, override string) *http.Request {
+		r, _ := http.NewRequest("GET", "http://"+host+"/index.md", nil)
+		r.RemoteAddr = addr
+		if override != "" {
+			r.Header.Set("X-Markdownd-Features", override)
+		}
+		return r
+	}
+
+	if featureOn(request("example.com", "192.0.2.1:1", ""), "lazy-images") {
+		t.Log("Expected features off by default")
+		t.Fail()
+	}
+
+	rollouts = featureList{{Name: "lazy-images", Percent: 100, Host: "docs.example.com"}}
+	if !featureOn(request("docs.example.com:8080", "192.0.2.1:1", ""), "lazy-images") ||
+		featureOn(request("wiki.example.com", "192.0.2.1:1", ""), "lazy-images") {
+		t.Log("Expected the feature on docs.example.com only")
+		t.Fail()
+	}
+
+	// a percentage is stable per client, and roughly right
+	rollouts = featureList{{Name: "lazy-images", Percent: 25}}
+	on := 0
+	for i := 0; i < 1000; i++ {
+		addr := fmt.Sprintf("10.0.%d.%d:1", i/256, i%256)
+		if a, b := featureOn(request("x", addr, ""), "lazy-images"), featureOn(request("x", addr, ""), "lazy-images"); a != b {
+			t.Log("Expected the same answer for", addr)
+			t.FailNow()
+		} else if a {
+			on++
+		}
+	}
+	if on < 180 || on > 320 {
+		t.Log("Expected about 250 of 1000 clients, got:", on)
+		t.Fail()
+	}
+
+	// overrides only from admins
+	rollouts = nil
+	admins.Set("127.0.0.1")
+	if !featureOn(request("x", "127.0.0.1:1", "lazy-images"), "lazy-images") {
+		t.Log("Expected an admin to turn the feature on")
+		t.Fail()
+	}
+	if featureOn(request("x", "192.0.2.1:1", "lazy-images"), "lazy-images") {
+		t.Log("Expected overrides from others to be ignored")
+		t.Fail()
+	}
+	rollouts = featureList{{Name: "lazy-images", Percent: 100}}
+	if featureOn(request("x", "127.0.0.1:1", "other, -lazy-images"), "lazy-images") {
+		t.Log("Expected an admin to turn the feature off")
+		t.Fail()
+	}
+}
+
+func TestLazyImages(t *testing.T) {
+	got := string(lazyImages([]byte(`<p><img src="/a.png" alt="a"> <img` + "\n" + `src="b.png"></p>`)))
+	if strings.Count(got, `<img loading="lazy" `) != 2 {
+		t.Log("Expected both images lazy, got:", got)
+		t.Fail()
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fence is a code fence, which can't appear in a raw string
+const fence = "```"
+
+// fixtures is representative content for testing renderers, themes and
+// templates: markdown edge cases, front matter variants, deep nesting and
+// unicode file names. the golden tests render every page.
+var fixtures = map[string]string{
+	"index.md": `---
+title: Fixture site
+description: Pages covering what markdownd renders
+tags: [fixtures, testing]
+---
+# Fixture site
+
+* [Front matter](front-matter/yaml.md)
+* [Markdown](markdown/blocks.md)
+* [Deep nesting](deep/a/b/c/d/e/index.md)
+* [Unicode](unicode/café.md)
+
+![logo](static/logo.svg)
+`,
+
+	// front matter variants
+	"front-matter/yaml.md": `---
+title: "Quoted: with a colon"
+description: 'single quoted'
+author: Ada
+date: 2020-01-02
+draft: false
+weight: 10
+tags:
+  - one
+  - two words
+---
+# Heading after front matter
+`,
+	"front-matter/none.md": `# No front matter
+
+The first paragraph is the summary.
+`,
+	"front-matter/empty.md": `---
+---
+Empty front matter, no heading.
+`,
+	"front-matter/unterminated.md": `---
+title: never closed
+
+So this is all markdown: a thematic break, then text.
+`,
+	"front-matter/not-first.md": `
+---
+title: not at the start
+---
+A blank line first, so this is markdown too.
+`,
+	"front-matter/crlf.md": "---\r\ntitle: Windows line endings\r\n---\r\n# CRLF\r\n\r\ntext\r\n",
+
+	// markdown edge cases
+	"markdown/blocks.md": `# Blocks
+
+Setext heading
+==============
+
+Duplicate
+---------
+
+Duplicate
+---------
+
+> quote
+>> nested quote
+
+1. first
+2. second
+   * nested
+     1. deeper
+- [ ] task
+- [x] done
+
+***
+
+Line with two trailing spaces
+and a break.
+`,
+	"markdown/code.md": "# Code\n\n" +
+		fence + "go\nfunc main() {\n\tfmt.Println(\"<html> & entities\")\n}\n" + fence + "\n\n" +
+		"~~~\ntilde fence with " + fence + " inside\n~~~\n\n" +
+		"    indented code\n\n" +
+		"Inline `` `backticks` `` and `<tags>`.\n\n" +
+		fence + "\n<!--include: ../partials/note.md-->\n" + fence + "\n",
+	"markdown/tables.md": `# Tables
+
+| left | center | right |
+|:-----|:------:|------:|
+| a    | *b*    | ` + "`c`" + ` |
+| pipe \| escaped | | empty |
+
+Not | a | table
+`,
+	"markdown/links.md": `# Links
+
+[relative](../index.md), [html extension](blocks.html), [anchor](#links),
+[up and over](../unicode/café.md), [absolute](/index.md),
+[external](https://example.com/?a=1&b=2), <https://example.com/auto>,
+[reference][ref], [missing reference][nope].
+
+![image](../static/logo.svg "title")
+
+[ref]: https://example.com/ref
+`,
+	"markdown/html.md": `# Inline html
+
+<div class="note">kept <b>html</b></div>
+
+<script>alert("removed")</script>
+
+<a href="javascript:alert(1)" onclick="alert(2)">unsafe link</a>
+
+<img src="x.png" onerror="alert(3)">
+`,
+	"markdown/empty.md":     "",
+	"markdown/long-line.md": "# Long line\n\n" + strings.Repeat("word ", 2000) + "\n",
+	"markdown/includes.md": `# Includes
+
+<!--include: ../partials/note.md-->
+<!--include: ../partials/missing.md-->
+`,
+	"partials/note.md": `---
+title: included files keep no front matter
+---
+> **Note:** this came from partials/note.md
+`,
+
+	// deep nesting and unicode names
+	"deep/a/b/c/d/e/index.md": `# Five levels down
+
+[back to the top](../../../../../../index.md)
+`,
+	"unicode/café.md":      "# Café\n\nAccents, ümlauts and ß.\n",
+	"unicode/日本語.md":       "# 日本語\n\n右から左ではない、縦書きでもない。\n",
+	"unicode/emoji 🎉.md":   "# Emoji 🎉 and spaces\n\nFile names with spaces need escaping in urls.\n",
+	"unicode/rtl-עברית.md": "# עברית\n\nمرحبا بالعالم\n",
+
+	// other files served as they are
+	"static/logo.svg":  `<svg xmlns="http://www.w3.org/2000/svg" width="16" height="16"><rect width="16" height="16"/></svg>` + "\n",
+	"static/notes.txt": "plain text, not rendered\n",
+	"page.html":        "<!DOCTYPE html>\n<title>raw html</title>\n<p>served as it is</p>\n",
+}
+
+// fixtureNames returns the fixture files, sorted
+func fixtureNames() []string {
+	var names []string
+	for name := range fixtures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeFixtures writes the fixtures into dir, which must be empty or
+// missing unless force
+func writeFixtures(dir string, force bool) error {
+	return writeFiles(dir, fixtures, force)
+}
+
+// writeFiles writes files, by slash separated name, into dir, which must
+// be empty or missing unless force
+func writeFiles(dir string, files map[string]string, force bool) error {
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) != 0 && !force {
+		return fmt.Errorf("%s is not empty, use -force to write into it", dir)
+	}
+	for name, data := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fixtureCommand writes the fixture site, 'markdownd gen-fixture dir'
+func fixtureCommand(args []string) {
+	fs := flag.NewFlagSet("gen-fixture", flag.ExitOnError)
+	force := fs.Bool("force", false, "write into a directory that isn't empty, replacing fixture files")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: markdownd gen-fixture [-force] <directory>")
+		fmt.Fprintln(os.Stderr, "writes pages covering markdown edge cases, front matter variants, deep nesting\n"+
+			"and unicode file names, for checking themes, headers and templates with 'markdownd <directory>'")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(111)
+	}
+	if err := writeFixtures(fs.Arg(0), *force); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(111)
+	}
+	fmt.Fprintln(os.Stderr, "wrote", len(fixtures), "files to", fs.Arg(0))
+}
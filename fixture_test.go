@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata/golden from the fixtures")
+
+// TestFixtureGolden renders every fixture page and compares it with
+// testdata/golden. run 'go test -run Golden -update' after changing the
+// renderer on purpose.
+func TestFixtureGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	if err := writeFixtures(dir, false); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if err := writeFixtures(dir, false); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Log("Expected an error writing into a directory that isn't empty, got:", err)
+		t.Fail()
+	}
+
+	root := prepareDirectory(dir)
+	h := Handler{Root: os.DirFS(root), RootString: root}
+	for _, name := range fixtureNames() {
+		if !strings.HasSuffix(name, ".md") {
+			continue
+		}
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.URL.Path = "/" + name
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Log(name, "expected 200, got:", w.Code)
+			t.Fail()
+			continue
+		}
+
+		golden := filepath.Join("testdata", "golden", filepath.FromSlash(name)+".html")
+		if *updateGolden {
+			os.MkdirAll(filepath.Dir(golden), 0755)
+			ioutil.WriteFile(golden, w.Body.Bytes(), 0644)
+			continue
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Log(name, "no golden file, run 'go test -run Golden -update':", err)
+			t.Fail()
+			continue
+		}
+		if !bytes.Equal(w.Body.Bytes(), want) {
+			line, got, expected := firstDiff(w.Body.Bytes(), want)
+			t.Logf("%s differs from %s at line %d:\n got: %q\nwant: %q", name, golden, line, got, expected)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// formPrefix is where forms are posted, /_markdownd/forms/feedback
+const formPrefix = "/_markdownd/forms/"
+
+// form limits: the whole submission, and each field
+const (
+	maxFormBody  = 64 << 10
+	maxFormValue = 10000
+)
+
+// formCookie holds the random value the csrf tokens of a browser are made
+// from
+const formCookie = "markdownd-form"
+
+// a form in a page, and the line ending it
+var (
+	reFormStart = regexp.MustCompile(`^\{\{<\s*form\s+([A-Za-z0-9_-]+)(?:\s+"([^"]*)")?\s*>\}\}$`)
+	reFormEnd   = regexp.MustCompile(`^\{\{<\s*/form\s*>\}\}$`)
+)
+
+// formHandler is where the submissions of a form go: a file of json
+// lines with 'file:', or a command
+type formHandler struct {
+	Name    string
+	Handler string
+}
+
+// formList is the -form handlers
+type formList []formHandler
+
+var forms formList
+
+func (l *formList) String() string {
+	if l == nil {
+		return ""
+	}
+	var s []string
+	for _, f := range *l {
+		s = append(s, f.Name+"="+f.Handler)
+	}
+	return strings.Join(s, "; ")
+}
+
+func (l *formList) Set(value string) error {
+	i := strings.IndexByte(value, '=')
+	if i < 1 || strings.TrimSpace(value[i+1:]) == "" {
+		return fmt.Errorf("expected name=handler, such as 'feedback=file:feedback.jsonl', got %q", value)
+	}
+	name := strings.TrimSpace(value[:i])
+	if !reFormStart.MatchString("{{< form " + name + " >}}") {
+		return fmt.Errorf("bad form name %q, expected letters, digits, - and _", name)
+	}
+	*l = append(*l, formHandler{Name: name, Handler: strings.TrimSpace(value[i+1:])})
+	return nil
+}
+
+// find returns the handler of the form name
+func (l formList) find(name string) (string, bool) {
+	for _, f := range l {
+		if f.Name == name {
+			return f.Handler, true
+		}
+	}
+	return "", false
+}
+
+// formField is one line of a form: 'name type "Label" required'. types
+// are text, email, number, url, textarea, checkbox and select:a,b,c.
+type formField struct {
+	Name     string
+	Type     string
+	Label    string
+	Options  []string // of a select
+	Required bool
+}
+
+// pageForm is a form written in a page
+type pageForm struct {
+	Name   string
+	Submit string // the button label
+	Fields []formField
+}
+
+// formFieldName is what a field may be called; names starting with _
+// are the form's own
+var formFieldName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// parseFormField reads a line of a form, false for a bad one
+func parseFormField(line string) (formField, bool) {
+	var args []string
+	for _, arg := range reShortcodeArg.FindAllString(line, -1) {
+		if strings.HasPrefix(arg, `"`) {
+			arg = strings.Trim(arg, `"`)
+		}
+		args = append(args, arg)
+	}
+	if len(args) == 0 || !formFieldName.MatchString(args[0]) {
+		return formField{}, false
+	}
+	f := formField{Name: args[0], Type: "text", Label: args[0]}
+	if len(args) > 1 {
+		f.Type = args[1]
+	}
+	if strings.HasPrefix(f.Type, "select:") {
+		f.Options = strings.Split(strings.TrimPrefix(f.Type, "select:"), ",")
+		f.Type = "select"
+	}
+	switch f.Type {
+	case "text", "email", "number", "url", "textarea", "checkbox", "select":
+	default:
+		return formField{}, false
+	}
+	for _, arg := range args[2:] {
+		if arg == "required" {
+			f.Required = true
+		} else {
+			f.Label = arg
+		}
+	}
+	return f, true
+}
+
+// pageForms replaces the forms in md, outside of code fences, with a
+// placeholder paragraph each, and returns them in order. fields that
+// can't be read are left out.
+func pageForms(md []byte) ([]byte, []pageForm) {
+	if !bytes.Contains(md, []byte("{{< form")) && !bytes.Contains(md, []byte("{{<form")) {
+		return md, nil
+	}
+	var out bytes.Buffer
+	var found []pageForm
+	var current *pageForm
+	var fenced bool
+	for _, line := range strings.SplitAfter(string(md), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case current == nil && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			fenced = !fenced
+		case fenced:
+		case current == nil && reFormStart.MatchString(trimmed):
+			m := reFormStart.FindStringSubmatch(trimmed)
+			current = &pageForm{Name: m[1], Submit: m[2]}
+			if current.Submit == "" {
+				current.Submit = "Send"
+			}
+			continue
+		case current != nil && reFormEnd.MatchString(trimmed):
+			fmt.Fprintf(&out, "\n%s\n\n", formPlaceholder(len(found)))
+			found = append(found, *current)
+			current = nil
+			continue
+		case current != nil:
+			if f, ok := parseFormField(trimmed); ok {
+				current.Fields = append(current.Fields, f)
+			}
+			continue
+		}
+		out.WriteString(line)
+	}
+	// a form without its end stays as it was written
+	if current != nil {
+		return md, nil
+	}
+	return out.Bytes(), found
+}
+
+// formPlaceholder is the paragraph standing for form i until the page is
+// rendered, as the renderer would remove the html
+func formPlaceholder(i int) string {
+	return fmt.Sprintf("markdowndform%dplaceholder", i)
+}
+
+// formKey signs the csrf tokens of this process
+var formKey = func() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}()
+
+// formToken is the csrf token of the form name in the page, for the
+// browser holding nonce in its form cookie
+func formToken(nonce, name, page string) string {
+	mac := hmac.New(sha256.New, formKey)
+	mac.Write([]byte(nonce + "\x00" + name + "\x00" + page))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// formNonce returns the nonce of the form cookie of r, setting a new one
+// when there is none
+func formNonce(w http.ResponseWriter, r *http.Request, prefix string) string {
+	if c, err := r.Cookie(formCookie); err == nil && len(c.Value) == 32 {
+		return c.Value
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	nonce := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     formCookie,
+		Value:    nonce,
+		Path:     prefix + "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nonce
+}
+
+// insertForms puts the html of the forms of the page name in place of
+// their placeholders. the tokens in them are for this browser, so the
+// page isn't cached.
+func (h Handler) insertForms(w http.ResponseWriter, r *http.Request, name string, md []byte, found []pageForm) []byte {
+	if len(found) == 0 {
+		return md
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Del("Expires")
+	nonce := formNonce(w, r, h.Prefix)
+	for i, f := range found {
+		var b bytes.Buffer
+		if _, ok := forms.find(f.Name); !ok {
+			fmt.Fprintf(&b, "<!-- form %s: no -form handler -->", f.Name)
+		} else {
+			f.writeHTML(&b, fmt.Sprintf("md-form-%d", i), h.Prefix+formPrefix+f.Name, name, formToken(nonce, f.Name, name))
+		}
+		md = bytes.Replace(md, []byte("<p>"+formPlaceholder(i)+"</p>"), b.Bytes(), 1)
+	}
+	return md
+}
+
+// writeHTML writes the form, posting to action, with ids starting with id
+func (f pageForm) writeHTML(b *bytes.Buffer, id, action, page, token string) {
+	esc := html.EscapeString
+	fmt.Fprintf(b, `<form class="md-form" id="%s" method="post" action="%s">`+"\n", id, esc(action))
+	fmt.Fprintf(b, `<input type="hidden" name="_page" value="%s"><input type="hidden" name="_token" value="%s">`+"\n", esc(page), token)
+	for _, field := range f.Fields {
+		fid := id + "-" + field.Name
+		required := ""
+		if field.Required {
+			required = " required"
+		}
+		switch field.Type {
+		case "checkbox":
+			fmt.Fprintf(b, `<p><label><input type="checkbox" id="%s" name="%s"%s> %s</label></p>`, fid, esc(field.Name), required, esc(field.Label))
+		case "textarea":
+			fmt.Fprintf(b, `<p><label for="%s">%s</label><br><textarea id="%s" name="%s" rows="5" maxlength="%d"%s></textarea></p>`,
+				fid, esc(field.Label), fid, esc(field.Name), maxFormValue, required)
+		case "select":
+			fmt.Fprintf(b, `<p><label for="%s">%s</label><br><select id="%s" name="%s"%s>`, fid, esc(field.Label), fid, esc(field.Name), required)
+			for _, o := range field.Options {
+				fmt.Fprintf(b, `<option>%s</option>`, esc(o))
+			}
+			b.WriteString(`</select></p>`)
+		default:
+			fmt.Fprintf(b, `<p><label for="%s">%s</label><br><input type="%s" id="%s" name="%s" maxlength="%d"%s></p>`,
+				fid, esc(field.Label), field.Type, fid, esc(field.Name), maxFormValue, required)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(b, `<p><button type="submit">%s</button></p>`+"\n</form>", esc(f.Submit))
+}
+
+// formSubmission is what a handler gets, as one line of json
+type formSubmission struct {
+	Form   string            `json:"form"`
+	Page   string            `json:"page"`
+	Time   time.Time         `json:"time"`
+	Fields map[string]string `json:"fields"`
+}
+
+// values checks the posted form against the fields of f, and returns
+// them, or what is wrong
+func (f pageForm) values(posted url.Values) (map[string]string, error) {
+	fields := map[string]string{}
+	for _, field := range f.Fields {
+		v := strings.TrimSpace(posted.Get(field.Name))
+		switch {
+		case len(v) > maxFormValue:
+			return nil, fmt.Errorf("%s is too long", field.Label)
+		case field.Type == "checkbox" && v != "":
+			v = "on"
+		case field.Type == "select" && v != "":
+			ok := false
+			for _, o := range field.Options {
+				ok = ok || o == v
+			}
+			if !ok {
+				return nil, fmt.Errorf("%s should be one of %s", field.Label, strings.Join(field.Options, ", "))
+			}
+		}
+		if field.Required && v == "" {
+			return nil, fmt.Errorf("%s is required", field.Label)
+		}
+		fields[field.Name] = v
+	}
+	return fields, nil
+}
+
+// formFiles serializes appending to the files of file: handlers
+var formFiles sync.Mutex
+
+// handle passes the submission to handler, and returns the markdown shown
+// after: from the command, or a thank you for a file
+func (s formSubmission) handle(handler string) ([]byte, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(handler, "file:") {
+		formFiles.Lock()
+		defer formFiles.Unlock()
+		f, err := os.OpenFile(strings.TrimPrefix(handler, "file:"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(append(b, '\n')); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return []byte("Thank you, your response was sent."), f.Close()
+	}
+	return runCommand(handler, b, *pluginWait, 1<<20)
+}
+
+// serveForm answers a form posted to /_markdownd/forms/name, after
+// checking its page, csrf token and fields
+func (h Handler) serveForm(w http.ResponseWriter, r *http.Request, requestid string) {
+	name := strings.TrimPrefix(r.URL.Path, formPrefix)
+	handler, ok := forms.find(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// browsers say where a form came from
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "null" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			http.Error(w, "403 cross-origin form", http.StatusForbidden)
+			return
+		}
+	}
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		http.Error(w, "403 cross-origin form", http.StatusForbidden)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBody)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "400 bad request", http.StatusBadRequest)
+		return
+	}
+	page := r.PostForm.Get("_page")
+	c, err := r.Cookie(formCookie)
+	if err != nil || !hmac.Equal([]byte(r.PostForm.Get("_token")), []byte(formToken(c.Value, name, page))) {
+		logreq(requestid, "form", name, "bad token")
+		http.Error(w, "403 the form expired, reload the page and send it again", http.StatusForbidden)
+		return
+	}
+	// the fields are the ones the page has now
+	b, err := fs.ReadFile(h.Root, page)
+	if !fs.ValidPath(page) || err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	fm, src := parseFrontMatter(b)
+	var form *pageForm
+	_, found := pageForms(src)
+	for i := range found {
+		if found[i].Name == name {
+			form = &found[i]
+			break
+		}
+	}
+	if form == nil || hideDraft(page, fm) {
+		http.NotFound(w, r)
+		return
+	}
+	fields, err := form.values(r.PostForm)
+	if err != nil {
+		http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := formSubmission{Form: name, Page: page, Time: time.Now().UTC(), Fields: fields}.handle(handler)
+	if err != nil {
+		logger.Printf("%s form %s: %v", requestid, name, err)
+		http.Error(w, "500 the form could not be sent", http.StatusInternalServerError)
+		return
+	}
+	logreq(requestid, "form", name, "sent from", page)
+	back := fmt.Sprintf("\n\n[Back to %s](%s)\n", pageTitle(fm, src), h.Prefix+h.pageURL(page))
+	w.Header().Set("Cache-Control", "no-store")
+	h.writePage(w, requestid, page, pageData{
+		Title:   pageTitle(fm, src),
+		Content: template.HTML(markdown2html(append(out, back...))),
+		Path:    h.Prefix + h.pageURL(page),
+		Page:    fm,
+		Site:    siteVars,
+		h:       h,
+		name:    page,
+	}, nil)
+}
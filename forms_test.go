@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestForms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(l formList) { forms = l }(forms)
+	forms = formList{{Name: "feedback", Handler: "file:" + filepath.Join(dir, "feedback.jsonl")}}
+
+	page := "# Docs\n\n{{< form feedback \"Send feedback\" >}}\nname text \"Your name\" required\nrating select:1,2,3\nbad field\n{{< /form >}}\n\n```\n{{< form feedback >}}\n```\n"
+	h := Handler{Root: fstest.MapFS{"index.md": {Data: []byte(page)}}, Index: "index.md", Prefix: "/docs"}
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	h.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	for _, want := range []string{
+		`<form class="md-form" id="md-form-0" method="post" action="/docs/_markdownd/forms/feedback">`,
+		`<input type="text" id="md-form-0-name" name="name" maxlength="10000" required>`,
+		`<select id="md-form-0-rating" name="rating"><option>1</option><option>2</option><option>3</option></select>`,
+		`<button type="submit">Send feedback</button>`,
+		"<code>{{&lt; form feedback &gt;}}\n</code>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Logf("expected %q in\n%s", want, body)
+			t.Fail()
+		}
+	}
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == formCookie {
+			cookie = c
+		}
+	}
+	token := regexp.MustCompile(`name="_token" value="([0-9a-f]+)"`).FindStringSubmatch(body)
+	if cookie == nil || token == nil || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("cookie %v, token %v, cache %q", cookie, token, rec.Header().Get("Cache-Control"))
+	}
+
+	post := func(values url.Values, origin string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", formPrefix+"feedback", strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Host = "docs.example.com"
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		req.AddCookie(cookie)
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	form := url.Values{"_page": {"index.md"}, "_token": {token[1]}, "name": {"Ann"}, "rating": {"2"}, "other": {"dropped"}}
+	if rec := post(form, "https://docs.example.com"); rec.Code != 200 || !strings.Contains(rec.Body.String(), `<a href="/docs/" rel="nofollow">Back to Docs</a>`) {
+		t.Logf("post: %d\n%s", rec.Code, rec.Body.String())
+		t.Fail()
+	}
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "feedback.jsonl"))
+	if !strings.Contains(string(b), `"page":"index.md"`) || !strings.Contains(string(b), `"fields":{"name":"Ann","rating":"2"}`) {
+		t.Logf("saved %s", b)
+		t.Fail()
+	}
+
+	for _, c := range []struct {
+		change func(url.Values)
+		origin string
+		code   int
+	}{
+		{func(v url.Values) { v.Set("_token", strings.Repeat("0", 64)) }, "", 403},
+		{func(v url.Values) { v.Set("_page", "other.md") }, "", 403},
+		{func(v url.Values) {}, "https://evil.example", 403},
+		{func(v url.Values) { v.Del("name") }, "", 400},
+		{func(v url.Values) { v.Set("rating", "9") }, "", 400},
+	} {
+		v := url.Values{}
+		for k, vs := range form {
+			v[k] = vs
+		}
+		c.change(v)
+		if rec := post(v, c.origin); rec.Code != c.code {
+			t.Logf("%v from %q: %d, expected %d: %s", v, c.origin, rec.Code, c.code, rec.Body.String())
+			t.Fail()
+		}
+	}
+}
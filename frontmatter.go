@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/aerth/markdownd/pkg/markdownd"
+)
+
+// frontMatter is the front matter of a markdown file
+type frontMatter = markdownd.FrontMatter
+
+// parseFrontMatter splits a markdown document into front matter and body
+func parseFrontMatter(b []byte) (frontMatter, []byte) {
+	return markdownd.ParseFrontMatter(b)
+}
+
+// hideDraft reports whether the page name, a slash separated path, is
+// kept out of sight: a dot file, a draft, or a page under embargo. -drafts shows
+// drafts, embargoed pages only show to -early-access groups.
+func hideDraft(name string, fm frontMatter) bool {
+	return markdownd.Hidden(name, fm, *drafts, time.Now())
+}
+
+// isDraft reports whether the page name is a draft: 'draft: true' in its
+// front matter, or a file under a _drafts directory, unless serving with
+// -drafts
+func isDraft(name string, fm frontMatter) bool {
+	return !*drafts && markdownd.IsDraft(name, fm)
+}
+
+// pageTitle returns the front matter title, or the first heading
+func pageTitle(fm frontMatter, md []byte) string {
+	return markdownd.Title(fm, md)
+}
+
+// pageSummary returns the front matter description, or the first paragraph
+func pageSummary(fm frontMatter, md []byte) string {
+	if desc := fm.String("description"); desc != "" {
+		return desc
+	}
+	var para []string
+	eachLine(md, func(line string) bool {
+		switch {
+		case line == "":
+			return len(para) == 0
+		case strings.HasPrefix(line, "#"), strings.HasPrefix(line, "!["),
+			strings.HasPrefix(line, "[!["), strings.HasPrefix(line, "<"),
+			strings.HasPrefix(line, "|"):
+			return len(para) == 0
+		}
+		para = append(para, line)
+		return true
+	})
+	return plainInline(strings.Join(para, " "))
+}
+
+// eachLine calls fn with every trimmed line outside of code fences,
+// until fn returns false
+func eachLine(md []byte, fn func(line string) bool) {
+	var fenced bool
+	scanner := bufio.NewScanner(bytes.NewReader(md))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			fenced = !fenced
+			continue
+		}
+		if fenced {
+			continue
+		}
+		if !fn(line) {
+			return
+		}
+	}
+}
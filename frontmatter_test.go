@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	doc := []byte("---\ntitle: \"Hello\"\ntags: [a, b]\nauthors:\n  - x\n  - y\ndraft: true\n---\n# body\n")
+	fm, body := parseFrontMatter(doc)
+	if string(body) != "# body\n" {
+		t.Logf("Expected body %q, got: %q", "# body\n", string(body))
+		t.FailNow()
+	}
+	if fm.String("title") != "Hello" {
+		t.Log("Expected title 'Hello', got:", fm.String("title"))
+		t.FailNow()
+	}
+	if tags := fm.List("tags"); len(tags) != 2 || tags[1] != "b" {
+		t.Log("Expected tags [a b], got:", tags)
+		t.FailNow()
+	}
+	if authors := fm.List("authors"); len(authors) != 2 || authors[0] != "x" {
+		t.Log("Expected authors [x y], got:", authors)
+		t.FailNow()
+	}
+	if !fm.Bool("draft") {
+		t.Log("Expected draft to be true")
+		t.FailNow()
+	}
+}
+
+func TestNoFrontMatter(t *testing.T) {
+	doc := []byte("# title\n\n---\n\nnot front matter\n")
+	fm, body := parseFrontMatter(doc)
+	if len(fm) != 0 || string(body) != string(doc) {
+		t.Log("Expected document unchanged, got:", fm, string(body))
+		t.FailNow()
+	}
+	if title := pageTitle(fm, body); title != "title" {
+		t.Log("Expected title from heading, got:", title)
+		t.FailNow()
+	}
+}
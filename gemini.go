@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"mime"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gemtext converts markdown to text/gemini. gemtext has no inline links,
+// so links follow the line they were found in.
+func gemtext(title string, md []byte) []byte {
+	var buf bytes.Buffer
+	blocks := parseBlocks(md)
+	if title != "" && (len(blocks) == 0 || blocks[0].Kind != blockHeading) {
+		buf.WriteString("# " + title + "\n\n")
+	}
+	markers := listMarkers(blocks)
+	for i, b := range blocks {
+		// list items stay together, everything else gets a blank line
+		if i != 0 && !(b.Kind == blockListItem && blocks[i-1].Kind == blockListItem) {
+			buf.WriteByte('\n')
+		}
+		switch b.Kind {
+		case blockHeading:
+			level := b.Level
+			if level > 3 {
+				level = 3
+			}
+			buf.WriteString(strings.Repeat("#", level) + " " + b.Text + "\n")
+		case blockParagraph:
+			buf.WriteString(b.Text + "\n")
+		case blockListItem:
+			if b.Ordered {
+				buf.WriteString("* " + markers[i] + " " + b.Text + "\n")
+			} else {
+				buf.WriteString("* " + b.Text + "\n")
+			}
+		case blockCode:
+			buf.WriteString("```\n" + b.Text + "\n```\n")
+		case blockQuote:
+			buf.WriteString("> " + b.Text + "\n")
+		case blockRule:
+			continue
+		}
+		for _, link := range inlineLinks(b.Raw) {
+			if link.Text == "" {
+				buf.WriteString("=> " + link.URL + "\n")
+			} else {
+				buf.WriteString("=> " + link.URL + " " + link.Text + "\n")
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// geminiResponse is a status, meta and optional body
+type geminiResponse struct {
+	status int
+	meta   string
+	body   []byte
+}
+
+// geminiRequest answers one gemini request line
+func (h Handler) geminiRequest(line string) geminiResponse {
+	u, err := url.Parse(line)
+	if err != nil || len(line) > 1024 || !u.IsAbs() {
+		return geminiResponse{status: 59, meta: "bad request"}
+	}
+	if u.Scheme != "gemini" {
+		return geminiResponse{status: 53, meta: "proxy request refused"}
+	}
+	p := u.Path
+	if p == "" {
+		// clients resolve relative links against the directory
+		return geminiResponse{status: 31, meta: "gemini://" + u.Host + "/"}
+	}
+	if strings.Contains(p, "..") || hideDraft(p+"/", nil) {
+		return geminiResponse{status: 51, meta: "not found"}
+	}
+
+	if abs, ok := h.resolve(p); ok {
+		b, err := ioutil.ReadFile(abs)
+		if err != nil {
+			return geminiResponse{status: 51, meta: "not found"}
+		}
+		fm, md := parseFrontMatter(b)
+		if hideDraft(p, fm) {
+			return geminiResponse{status: 51, meta: "not found"}
+		}
+		return geminiResponse{status: 20, meta: "text/gemini; charset=utf-8", body: gemtext(fm.String("title"), md)}
+	}
+
+	abs, ok := h.localPath(p)
+	if !ok {
+		return geminiResponse{status: 51, meta: "not found"}
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return geminiResponse{status: 51, meta: "not found"}
+	}
+	if fi.IsDir() {
+		if !strings.HasSuffix(p, "/") {
+			return geminiResponse{status: 31, meta: "gemini://" + u.Host + p + "/"}
+		}
+		if h.index() != "gen" {
+			return geminiResponse{status: 51, meta: "not found"}
+		}
+		return geminiResponse{status: 20, meta: "text/gemini; charset=utf-8", body: geminiIndex(p, abs)}
+	}
+
+	b, err := ioutil.ReadFile(abs)
+	if err != nil {
+		return geminiResponse{status: 51, meta: "not found"}
+	}
+	ct := mime.TypeByExtension(path.Ext(abs))
+	switch {
+	case strings.HasSuffix(abs, ".gmi"):
+		ct = "text/gemini; charset=utf-8"
+	case ct == "":
+		ct = "application/octet-stream"
+	}
+	return geminiResponse{status: 20, meta: ct, body: b}
+}
+
+// geminiIndex lists a directory
+func geminiIndex(urlpath, abs string) []byte {
+	infos, err := ioutil.ReadDir(abs)
+	if err != nil {
+		return nil
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	var buf bytes.Buffer
+	buf.WriteString("# Index of " + urlpath + "\n\n")
+	for _, fi := range infos {
+		name := fi.Name()
+		if strings.HasPrefix(name, ".") || fi.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		if fi.IsDir() {
+			name += "/"
+		}
+		if hideDraft(name+"/", nil) {
+			continue
+		}
+		buf.WriteString("=> " + (&url.URL{Path: name}).String() + " " + name + "\n")
+	}
+	return buf.Bytes()
+}
+
+// serveGeminiConn answers the single request of a gemini connection
+func (h Handler) serveGeminiConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	if !allowedIP(host, allowList, denyList) {
+		io.WriteString(conn, "59 forbidden\r\n")
+		return
+	}
+	// 1024 bytes of url, then CRLF
+	line, err := bufio.NewReaderSize(io.LimitReader(conn, 1026), 1026).ReadString('\n')
+	if err != nil {
+		io.WriteString(conn, "59 bad request\r\n")
+		return
+	}
+	line = strings.TrimRight(line, "\r\n")
+	resp := h.geminiRequest(line)
+	logreq("gemini:", logAddr(conn.RemoteAddr().String()), line, resp.status)
+	io.WriteString(conn, strconv.Itoa(resp.status)+" "+resp.meta+"\r\n")
+	if resp.status == 20 {
+		conn.Write(resp.body)
+	}
+}
+
+// serveGemini accepts gemini connections on ln until it fails
+func (h Handler) serveGemini(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go h.serveGeminiConn(conn)
+	}
+}
+
+// geminiCertificate loads -gemini-cert and -gemini-key, or generates a
+// self-signed certificate (gemini clients trust on first use)
+func geminiCertificate(certfile, keyfile string) (tls.Certificate, error) {
+	if certfile != "" {
+		return tls.LoadX509KeyPair(certfile, keyfile)
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "localhost"
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host, "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// startGemini listens for gemini requests on addr
+func (h Handler) startGemini(addr string) {
+	if *token != "" {
+		println("-gemini can't check -token, refusing to serve private documents")
+		os.Exit(111)
+	}
+	cert, err := geminiCertificate(*geminiCert, *geminiKey)
+	if err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	if *geminiCert == "" {
+		println("warning: gemini certificate is self-signed and changes on restart, use -gemini-cert and -gemini-key")
+	}
+	ln, err := tls.Listen("tcp", addr, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+	if err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	status("gemini:", ln.Addr().String())
+	go func() {
+		logger.Println("gemini:", h.serveGemini(ln))
+	}()
+}
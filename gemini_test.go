@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestGemtext(t *testing.T) {
+	md := []byte("intro with [a link](other.md) and ![logo](logo.png)\n\n#### Deep\n\n- one\n- two\n1. first\n\n```\ncode\n```\n\n> quote\n")
+	want := "# Title\n\n" +
+		"intro with a link and logo\n=> logo.png logo\n=> other.md a link\n\n" +
+		"### Deep\n\n" +
+		"* one\n* two\n* 1. first\n\n" +
+		"```\ncode\n```\n\n" +
+		"> quote\n"
+	if got := string(gemtext("Title", md)); got != want {
+		t.Logf("Expected:\n%s\ngot:\n%s", want, got)
+		t.Fail()
+	}
+}
+
+func TestGemini(t *testing.T) {
+	cert, err := geminiCertificate("", "")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer ln.Close()
+	dir := prepareDirectory("docs")
+	go Handler{RootString: dir}.serveGemini(ln)
+
+	get := func(u string) string {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer conn.Close()
+		conn.Write([]byte(u + "\r\n"))
+		b, _ := ioutil.ReadAll(conn)
+		return string(b)
+	}
+
+	host := "gemini://" + ln.Addr().(*net.TCPAddr).String()
+	for u, prefix := range map[string]string{
+		host + "/index.md":   "20 text/gemini; charset=utf-8\r\nmarkdown\n=> /markdownd.png markdown\n",
+		host + "/index.html": "20 text/gemini",
+		host + "/text.txt":   "20 text/plain",
+		host:                 "31 " + host + "/\r\n",
+		host + "/notafile":   "51 not found\r\n",
+		"https://x/":         "53 ",
+		"not a url":          "59 ",
+	} {
+		if got := get(u); !strings.HasPrefix(got, prefix) {
+			t.Logf("%s: Expected %q, got %q", u, prefix, got)
+			t.Fail()
+		}
+	}
+	if got := get(host + "/index.md"); !strings.Contains(got, "# welcome to markdownd\n") {
+		t.Log("Expected gemtext heading, got:", got)
+		t.Fail()
+	}
+}
@@ -1,10 +1,10 @@
 module github.com/aerth/markdownd
 
-go 1.13
+go 1.16
 
 require (
 	github.com/kr/pretty v0.2.0 // indirect
-	github.com/microcosm-cc/bluemonday v0.0.0-20161202143824-e79763773ab6 // indirect
+	github.com/microcosm-cc/bluemonday v1.0.18
 	github.com/russross/blackfriday v1.5.2
 	github.com/sergi/go-diff v0.0.0-20170409071739-feef008d51ad // indirect
 	github.com/shurcooL/github_flavored_markdown v0.0.0-20181002035957-2122de532470 // indirect
@@ -14,10 +14,9 @@ require (
 	github.com/shurcooL/highlight_go v0.0.0-20170515013102-78fb10f4a5f8 // indirect
 	github.com/shurcooL/octicon v0.0.0-20191102190552-cbb32d6a785c // indirect
 	github.com/shurcooL/octiconssvg v0.0.0-20170121072549-1aed2117d2aa // indirect
-	github.com/shurcooL/sanitized_anchor_name v0.0.0-20170515013256-541ff5ee47f1 // indirect
+	github.com/shurcooL/sanitized_anchor_name v0.0.0-20170515013256-541ff5ee47f1
 	github.com/shurcool/github_flavored_markdown v0.0.0-20170210172023-3c64cb3ce00a
 	github.com/sourcegraph/annotate v0.0.0-20160123013949-f4cad6c6324d // indirect
 	github.com/sourcegraph/syntaxhighlight v0.0.0-20170531221838-bd320f5d308e
 	github.com/stretchr/testify v1.5.1 // indirect
-	golang.org/x/net v0.0.0-20170605033737-59a0b19b5533 // indirect
 )
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// plainText converts markdown to text wrapped at width columns, for gopher.
+// links are listed under the paragraph they were found in.
+func plainText(title string, md []byte, width int) []byte {
+	var buf bytes.Buffer
+	blocks := parseBlocks(md)
+	if title != "" && (len(blocks) == 0 || blocks[0].Kind != blockHeading) {
+		blocks = append([]block{{Kind: blockHeading, Level: 1, Text: title}}, blocks...)
+	}
+	markers := listMarkers(blocks)
+	for i, b := range blocks {
+		if i != 0 && !(b.Kind == blockListItem && blocks[i-1].Kind == blockListItem) {
+			buf.WriteByte('\n')
+		}
+		switch b.Kind {
+		case blockHeading:
+			text := b.Text
+			if b.Level == 1 {
+				text = strings.ToUpper(text)
+			}
+			buf.WriteString(text + "\n")
+			if b.Level <= 2 {
+				underline := "="
+				if b.Level == 2 {
+					underline = "-"
+				}
+				buf.WriteString(strings.Repeat(underline, len([]rune(text))) + "\n")
+			}
+		case blockParagraph:
+			buf.WriteString(wrapText(b.Text, width, "", ""))
+		case blockListItem:
+			marker := "*"
+			if b.Ordered {
+				marker = markers[i]
+			}
+			indent := strings.Repeat("  ", b.Level)
+			buf.WriteString(wrapText(b.Text, width, indent+marker+" ", indent+strings.Repeat(" ", len(marker)+1)))
+		case blockCode:
+			for _, line := range strings.Split(b.Text, "\n") {
+				buf.WriteString("    " + line + "\n")
+			}
+		case blockQuote:
+			buf.WriteString(wrapText(b.Text, width, "> ", "> "))
+		case blockRule:
+			buf.WriteString(strings.Repeat("-", width) + "\n")
+		}
+		for _, link := range inlineLinks(b.Raw) {
+			buf.WriteString("    <" + link.URL + ">\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// wrapText wraps words at width, starting with first and continuing with
+// the rest prefix
+func wrapText(s string, width int, first, rest string) string {
+	var buf bytes.Buffer
+	line := first
+	empty := true
+	for _, word := range strings.Fields(s) {
+		if !empty && len([]rune(line))+1+len([]rune(word)) > width {
+			buf.WriteString(line + "\n")
+			line, empty = rest, true
+		}
+		if !empty {
+			line += " "
+		}
+		line += word
+		empty = false
+	}
+	buf.WriteString(line + "\n")
+	return buf.String()
+}
+
+// gopherItem is one line of a gopher menu
+type gopherItem struct {
+	kind     byte
+	display  string
+	selector string
+}
+
+// gopherType returns the gopher item type for a file name
+func gopherType(name string) byte {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".txt", ".text":
+		return '0'
+	case ".html", ".htm":
+		return 'h'
+	case ".gif":
+		return 'g'
+	case ".png", ".jpg", ".jpeg", ".svg", ".webp":
+		return 'I'
+	}
+	return '9'
+}
+
+// gopherMenu lists the directory abs, found at selector
+func gopherMenu(selector, abs string) []gopherItem {
+	infos, err := ioutil.ReadDir(abs)
+	if err != nil {
+		return nil
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	items := []gopherItem{{'i', "Index of " + selector, ""}}
+	for _, fi := range infos {
+		name := fi.Name()
+		if strings.HasPrefix(name, ".") || fi.Mode()&os.ModeSymlink != 0 || hideDraft(name+"/", nil) {
+			continue
+		}
+		switch {
+		case fi.IsDir():
+			items = append(items, gopherItem{'1', name + "/", selector + name + "/"})
+		case strings.HasSuffix(name, ".md"):
+			display := name
+			if b, err := ioutil.ReadFile(path.Join(abs, name)); err == nil {
+				fm, md := parseFrontMatter(b)
+				if hideDraft(name, fm) {
+					continue
+				}
+				if pageTitle(fm, md) != "" {
+					display = pageTitle(fm, md)
+				}
+			}
+			items = append(items, gopherItem{'0', display, selector + name})
+		default:
+			items = append(items, gopherItem{gopherType(name), name, selector + name})
+		}
+	}
+	return items
+}
+
+// gopher menus point back at this host and port
+var gopherAdvertise struct{ host, port string }
+
+// serveGopherConn answers the single request of a gopher connection
+func (h Handler) serveGopherConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	if !allowedIP(host, allowList, denyList) {
+		io.WriteString(conn, "3forbidden\t\terror.host\t1\r\n.\r\n")
+		return
+	}
+	line, err := bufio.NewReaderSize(io.LimitReader(conn, 1026), 1026).ReadString('\n')
+	if err != nil {
+		return
+	}
+	// gopher+ clients append a tab and more
+	selector := strings.SplitN(strings.TrimRight(line, "\r\n"), "\t", 2)[0]
+	logreq("gopher:", logAddr(conn.RemoteAddr().String()), selector)
+	if !strings.HasPrefix(selector, "/") {
+		selector = "/" + selector
+	}
+
+	abs, ok := h.localPath(selector)
+	fi, err := os.Stat(abs)
+	if !ok || err != nil || hideDraft(selector+"/", nil) {
+		io.WriteString(conn, "3not found\t\terror.host\t1\r\n.\r\n")
+		return
+	}
+
+	w := bufio.NewWriter(conn)
+	defer w.Flush()
+	switch {
+	case fi.IsDir():
+		if !strings.HasSuffix(selector, "/") {
+			selector += "/"
+		}
+		for _, item := range gopherMenu(selector, abs) {
+			w.WriteString(string(item.kind) + item.display + "\t" + item.selector + "\t" +
+				gopherAdvertise.host + "\t" + gopherAdvertise.port + "\r\n")
+		}
+		w.WriteString(".\r\n")
+	case gopherType(abs) == '0':
+		b, err := ioutil.ReadFile(abs)
+		if err != nil {
+			return
+		}
+		if strings.HasSuffix(abs, ".md") {
+			fm, md := parseFrontMatter(b)
+			if hideDraft(selector, fm) {
+				io.WriteString(conn, "3not found\t\terror.host\t1\r\n.\r\n")
+				return
+			}
+			b = plainText(fm.String("title"), md, 70)
+		}
+		// text ends with a line holding a single '.', so double leading dots
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, ".") {
+				line = "." + line
+			}
+			w.WriteString(line + "\r\n")
+		}
+		w.WriteString(".\r\n")
+	default:
+		f, err := os.Open(abs)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		io.Copy(w, f)
+	}
+}
+
+// serveGopher accepts gopher connections on ln until it fails
+func (h Handler) serveGopher(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go h.serveGopherConn(conn)
+	}
+}
+
+// startGopher listens for gopher requests on addr
+func (h Handler) startGopher(addr string) {
+	if *token != "" {
+		println("-gopher can't check -token, refusing to serve private documents")
+		os.Exit(111)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	_, gopherAdvertise.port, _ = net.SplitHostPort(ln.Addr().String())
+	gopherAdvertise.host = *gopherHost
+	if gopherAdvertise.host == "" {
+		gopherAdvertise.host, _ = os.Hostname()
+	}
+	status("gopher:", ln.Addr().String(), "as", gopherAdvertise.host+":"+gopherAdvertise.port)
+	go func() {
+		logger.Println("gopher:", h.serveGopher(ln))
+	}()
+}
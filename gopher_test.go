@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestPlainText(t *testing.T) {
+	md := []byte("## Section\n\nsome words in a paragraph that is long enough to wrap, with [a link](x.md)\n\n1. first\n2. second\n\n    code\n")
+	// the document has its own heading, the title is not added
+	want := "Section\n-------\n\n" +
+		"some words in a paragraph that\nis long enough to wrap, with a\nlink\n    <x.md>\n\n" +
+		"1. first\n2. second\n\n" +
+		"    code\n"
+	if got := string(plainText("Title", md, 30)); got != want {
+		t.Logf("Expected:\n%s\ngot:\n%s", want, got)
+		t.Fail()
+	}
+}
+
+func TestGopher(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer ln.Close()
+	gopherAdvertise.host, gopherAdvertise.port = "example.com", "70"
+	go Handler{RootString: prepareDirectory("docs")}.serveGopher(ln)
+
+	get := func(selector string) string {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+		defer conn.Close()
+		conn.Write([]byte(selector + "\r\n"))
+		b, _ := ioutil.ReadAll(conn)
+		return string(b)
+	}
+
+	menu := get("")
+	for _, want := range []string{
+		"0welcome to markdownd\t/index.md\texample.com\t70\r\n",
+		"Imarkdownd.png\t/markdownd.png\texample.com\t70\r\n",
+		"htest.html\t/test.html\texample.com\t70\r\n",
+		"0text.txt\t/text.txt\texample.com\t70\r\n",
+	} {
+		if !strings.Contains(menu, want) {
+			t.Logf("Expected %q in menu:\n%s", want, menu)
+			t.Fail()
+		}
+	}
+	if !strings.HasSuffix(menu, "\r\n.\r\n") {
+		t.Log("Expected menu to end with '.', got:", menu)
+		t.Fail()
+	}
+	if page := get("/index.md"); !strings.Contains(page, "WELCOME TO MARKDOWND\r\n====") || !strings.HasSuffix(page, "\r\n.\r\n") {
+		t.Log("Expected plain text page, got:", page)
+		t.Fail()
+	}
+	if got := get("/../main.go"); !strings.HasPrefix(got, "3not found") {
+		t.Log("Expected not found, got:", got)
+		t.Fail()
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+)
+
+const graphPath = "/_markdownd/graph"
+
+// graphNode is a page of the link graph
+type graphNode struct {
+	ID    string   `json:"id"` // the path in the root, such as /guide/intro.md
+	Title string   `json:"title"`
+	URL   string   `json:"url"`
+	Tags  []string `json:"tags"`
+	Links int      `json:"links"` // edges in and out
+}
+
+// graphEdge is a link from one page to another
+type graphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// linkGraph is the pages and the links between them
+type linkGraph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+// linkGraph builds the graph of the pages of h from the backlink index
+func (h Handler) linkGraph() linkGraph {
+	ix := newContentIndex(h)
+	g := linkGraph{Nodes: []graphNode{}, Edges: []graphEdge{}}
+	for _, name := range ix.names {
+		p := ix.pages[name]
+		title, _ := p.resolve("title", nil)
+		tags := p.fm.List("tags")
+		if tags == nil {
+			tags = []string{}
+		}
+		g.Nodes = append(g.Nodes, graphNode{
+			ID:    "/" + name,
+			Title: title.(string),
+			URL:   h.Prefix + h.pageURL(name),
+			Tags:  tags,
+			Links: len(p.links) + len(ix.backlinks[name]),
+		})
+		for _, target := range p.links {
+			g.Edges = append(g.Edges, graphEdge{Source: "/" + name, Target: "/" + target})
+		}
+	}
+	return g
+}
+
+// serveGraph answers /_markdownd/graph with the link graph as json, and
+// /_markdownd/graph.html with a page drawing it
+func (h Handler) serveGraph(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == graphPath+".html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		graphPage.Execute(w, h.Prefix+graphPath)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.linkGraph())
+}
+
+// graphPage draws the graph at its json url with a force layout. pages
+// are sized by their links, and open when clicked.
+var graphPage = template.Must(template.New("graph").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Page graph</title>
+<style>
+html, body { margin: 0; height: 100%; font: 14px system-ui, sans-serif; background: #fff; }
+canvas { display: block; width: 100%; height: 100%; cursor: grab; }
+#info { position: fixed; top: 8px; left: 8px; color: #555; }
+input { margin-left: 8px; }
+</style>
+</head>
+<body>
+<div id="info">drag to move, scroll to zoom, click a page to open it<input id="filter" type="search" placeholder="filter"></div>
+<canvas id="graph"></canvas>
+<script>
+var canvas = document.getElementById("graph"), ctx = canvas.getContext("2d");
+var nodes = [], edges = [], byID = {}, scale = 1, ox = 0, oy = 0, hover = null, filter = "";
+function resize() {
+  canvas.width = canvas.clientWidth * devicePixelRatio;
+  canvas.height = canvas.clientHeight * devicePixelRatio;
+}
+window.addEventListener("resize", resize);
+resize();
+fetch({{.}}).then(function (r) { return r.json(); }).then(function (g) {
+  nodes = g.nodes;
+  nodes.forEach(function (n, i) {
+    var a = i * 2.4;
+    n.x = Math.cos(a) * 10 * Math.sqrt(i + 1); n.y = Math.sin(a) * 10 * Math.sqrt(i + 1);
+    n.vx = 0; n.vy = 0; n.r = 4 + 2 * Math.sqrt(n.links);
+    byID[n.id] = n;
+  });
+  edges = g.edges.map(function (e) { return {s: byID[e.source], t: byID[e.target]}; });
+  requestAnimationFrame(tick);
+});
+function step() {
+  for (var i = 0; i < nodes.length; i++) {
+    var a = nodes[i];
+    for (var j = i + 1; j < nodes.length; j++) {
+      var b = nodes[j], dx = a.x - b.x, dy = a.y - b.y, d2 = dx * dx + dy * dy + 0.01, f = 800 / d2;
+      a.vx += dx * f; a.vy += dy * f; b.vx -= dx * f; b.vy -= dy * f;
+    }
+    a.vx -= a.x * 0.002; a.vy -= a.y * 0.002;
+  }
+  edges.forEach(function (e) {
+    var dx = e.t.x - e.s.x, dy = e.t.y - e.s.y, f = 0.01;
+    e.s.vx += dx * f; e.s.vy += dy * f; e.t.vx -= dx * f; e.t.vy -= dy * f;
+  });
+  nodes.forEach(function (n) {
+    if (n === dragged) { n.vx = n.vy = 0; return; }
+    n.vx *= 0.8; n.vy *= 0.8; n.x += n.vx; n.y += n.vy;
+  });
+}
+function tick() {
+  step();
+  var w = canvas.width, h = canvas.height, k = scale * devicePixelRatio;
+  ctx.setTransform(1, 0, 0, 1, 0, 0);
+  ctx.clearRect(0, 0, w, h);
+  ctx.setTransform(k, 0, 0, k, w / 2 + ox * devicePixelRatio, h / 2 + oy * devicePixelRatio);
+  ctx.strokeStyle = "#ccc"; ctx.lineWidth = 1 / scale;
+  edges.forEach(function (e) {
+    ctx.beginPath(); ctx.moveTo(e.s.x, e.s.y); ctx.lineTo(e.t.x, e.t.y); ctx.stroke();
+  });
+  nodes.forEach(function (n) {
+    var match = !filter || n.title.toLowerCase().indexOf(filter) !== -1 || n.tags.join(" ").toLowerCase().indexOf(filter) !== -1;
+    ctx.fillStyle = n === hover ? "#d73a49" : match ? "#0366d6" : "#ddd";
+    ctx.beginPath(); ctx.arc(n.x, n.y, n.r, 0, 2 * Math.PI); ctx.fill();
+    if (match && (n === hover || scale > 0.8)) {
+      ctx.fillStyle = "#24292e"; ctx.font = (12 / scale) + "px system-ui, sans-serif";
+      ctx.fillText(n.title, n.x + n.r + 2, n.y + 4);
+    }
+  });
+  requestAnimationFrame(tick);
+}
+function at(ev) {
+  var x = (ev.offsetX - canvas.clientWidth / 2 - ox) / scale, y = (ev.offsetY - canvas.clientHeight / 2 - oy) / scale;
+  for (var i = nodes.length - 1; i >= 0; i--) {
+    var n = nodes[i], dx = n.x - x, dy = n.y - y;
+    if (dx * dx + dy * dy <= (n.r + 2) * (n.r + 2)) return {node: n, x: x, y: y};
+  }
+  return {node: null, x: x, y: y};
+}
+var dragged = null, panning = null, moved = false;
+canvas.addEventListener("mousedown", function (ev) {
+  var hit = at(ev); moved = false;
+  if (hit.node) dragged = hit.node; else panning = {x: ev.offsetX - ox, y: ev.offsetY - oy};
+});
+canvas.addEventListener("mousemove", function (ev) {
+  var hit = at(ev); hover = hit.node; moved = true;
+  if (dragged) { dragged.x = hit.x; dragged.y = hit.y; }
+  if (panning) { ox = ev.offsetX - panning.x; oy = ev.offsetY - panning.y; }
+  canvas.style.cursor = hover ? "pointer" : "grab";
+});
+canvas.addEventListener("mouseup", function (ev) {
+  var hit = at(ev);
+  if (hit.node && hit.node === dragged && !moved) location.href = hit.node.url;
+  dragged = null; panning = null;
+});
+canvas.addEventListener("wheel", function (ev) {
+  ev.preventDefault();
+  scale = Math.min(8, Math.max(0.1, scale * (ev.deltaY < 0 ? 1.1 : 0.9)));
+}, {passive: false});
+document.getElementById("filter").addEventListener("input", function (ev) { filter = ev.target.value.toLowerCase(); });
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLinkGraph(t *testing.T) {
+	defer func(on bool) { *graph = on }(*graph)
+	*graph = true
+	h := Handler{Prefix: "/docs", Root: fstest.MapFS{
+		"index.md":       {Data: []byte("# Home\n[guide](guide/setup.md) and [[notes]]\n")},
+		"guide/setup.md": {Data: []byte("---\ntitle: Setup\ntags: [ops]\n---\nback [home](../index.md)\n")},
+		"notes.md":       {Data: []byte("# Notes\n")},
+		"wip.md":         {Data: []byte("---\ndraft: true\n---\n[[notes]]\n")},
+	}}
+	get := func(urlpath string) (int, string, string) {
+		req, _ := http.NewRequest("GET", urlpath, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code, rec.Header().Get("Content-Type"), strings.TrimSpace(rec.Body.String())
+	}
+	want := `{"nodes":[` +
+		`{"id":"/guide/setup.md","title":"Setup","url":"/docs/guide/setup.md","tags":["ops"],"links":2},` +
+		`{"id":"/index.md","title":"Home","url":"/docs/","tags":[],"links":3},` +
+		`{"id":"/notes.md","title":"Notes","url":"/docs/notes.md","tags":[],"links":1}],` +
+		`"edges":[{"source":"/guide/setup.md","target":"/index.md"},{"source":"/index.md","target":"/notes.md"},{"source":"/index.md","target":"/guide/setup.md"}]}`
+	if code, ct, body := get(graphPath); code != 200 || ct != "application/json" || body != want {
+		t.Logf("graph: %d %q\n%s\nwant\n%s", code, ct, body, want)
+		t.Fail()
+	}
+	if code, ct, body := get(graphPath + ".html"); code != 200 || !strings.HasPrefix(ct, "text/html") || !strings.Contains(body, `fetch("/docs/_markdownd/graph")`) {
+		t.Logf("graph page: %d %q\n%s", code, ct, body)
+		t.Fail()
+	}
+	*graph = false
+	if code, _, _ := get(graphPath); code != 404 {
+		t.Logf("graph without -graph: %d", code)
+		t.Fail()
+	}
+}
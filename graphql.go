@@ -0,0 +1,933 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shurcooL/sanitized_anchor_name"
+)
+
+// graphqlPath answers graphql queries over the pages, with -graphql
+const graphqlPath = "/_markdownd/graphql"
+
+const (
+	graphqlLimit = 1 << 20 // largest query read
+	graphqlDepth = 10      // deepest selection answered
+	graphqlWidth = 100000  // most fields answered, as nested lists multiply
+)
+
+// graphqlSchema describes what can be queried. it is served to GET
+// requests without a query.
+const graphqlSchema = `# markdownd content, queried with POST {"query": "{ pages { title } }"}
+# or GET ?query=. fragments, mutations and introspection are not supported.
+
+type Query {
+  page(path: String!): Page
+  pages(tag: String, dir: String, first: Int): [Page!]!
+  tag(name: String!): Tag
+  tags: [Tag!]!
+}
+
+type Page {
+  path: String!          # in the root, such as /guide/intro.md
+  url: String!           # with -prefix
+  title: String!
+  description: String!
+  date: String           # front matter date
+  modified: String       # RFC 3339
+  tags: [String!]!
+  frontMatter(key: String): JSON
+  links: [Page!]!        # pages it links to
+  backlinks: [Page!]!    # pages linking to it
+}
+
+type Tag {
+  name: String!
+  slug: String!
+  count: Int!
+  pages: [Page!]!
+}
+`
+
+// gqlField is a field selected in a query
+type gqlField struct {
+	alias, name string
+	args        map[string]interface{} // values, or gqlVariable
+	directives  []gqlDirective
+	sel         []gqlField
+}
+
+// gqlDirective is @skip(if: ...) or @include(if: ...)
+type gqlDirective struct {
+	name string
+	args map[string]interface{}
+}
+
+// gqlVariable is a $variable in an argument
+type gqlVariable string
+
+// gqlOperation is a query of a document
+type gqlOperation struct {
+	name     string
+	defaults map[string]interface{}
+	sel      []gqlField
+}
+
+// gqlParser parses the subset of graphql queries markdownd answers
+type gqlParser struct {
+	src  string
+	pos  int
+	kind byte // 'n' name, 's' string, '0' number, 'p' punctuator, 0 at the end
+	tok  string
+}
+
+// gqlError is a graphql error, with the path of the field that failed
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+func (e gqlError) Error() string { return e.Message }
+
+func (p *gqlParser) fail(format string, v ...interface{}) {
+	panic(gqlError{Message: fmt.Sprintf("syntax error at %d: ", p.pos) + fmt.Sprintf(format, v...)})
+}
+
+// next reads the next token
+func (p *gqlParser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		p.kind, p.tok = 0, ""
+		return
+	}
+	start, c := p.pos, p.src[p.pos]
+	switch {
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for p.pos < len(p.src) && isNameByte(p.src[p.pos]) {
+			p.pos++
+		}
+		p.kind, p.tok = 'n', p.src[start:p.pos]
+	case c == '-' || c >= '0' && c <= '9':
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) != -1 {
+			p.pos++
+		}
+		p.kind, p.tok = '0', p.src[start:p.pos]
+	case c == '"':
+		p.kind, p.tok = 's', p.readString()
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.kind, p.tok = 'p', "..."
+	case strings.IndexByte("!$&():=@[]{}|", c) != -1:
+		p.pos++
+		p.kind, p.tok = 'p', string(c)
+	default:
+		p.fail("unexpected %q", c)
+	}
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// readString reads a quoted string, with json escapes
+func (p *gqlParser) readString() string {
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		p.fail("block strings are not supported")
+	}
+	var b strings.Builder
+	for p.pos++; p.pos < len(p.src); {
+		c := p.src[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return b.String()
+		case c == '\n':
+			p.fail("unterminated string")
+		case c == '\\' && p.pos+1 < len(p.src):
+			e := p.src[p.pos+1]
+			p.pos += 2
+			switch e {
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					p.fail("bad unicode escape")
+				}
+				r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					p.fail("bad unicode escape")
+				}
+				b.WriteRune(rune(r))
+				p.pos += 4
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '/':
+				b.WriteByte(e)
+			default:
+				p.fail("bad escape \\%c", e)
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			b.WriteRune(r)
+			p.pos += size
+		}
+	}
+	p.fail("unterminated string")
+	return ""
+}
+
+// at reports whether the token is the punctuator tok
+func (p *gqlParser) at(tok string) bool {
+	return p.kind == 'p' && p.tok == tok
+}
+
+// expect reads the punctuator tok
+func (p *gqlParser) expect(tok string) {
+	if !p.at(tok) {
+		p.fail("expected %q, got %q", tok, p.tok)
+	}
+	p.next()
+}
+
+// name reads a name
+func (p *gqlParser) name() string {
+	if p.kind != 'n' {
+		p.fail("expected a name, got %q", p.tok)
+	}
+	n := p.tok
+	p.next()
+	return n
+}
+
+// parseQuery parses a graphql document into its query operations
+func parseQuery(src string) (ops []gqlOperation, err error) {
+	defer func() {
+		switch e := recover().(type) {
+		case nil:
+		case gqlError:
+			ops, err = nil, e
+		default:
+			panic(e)
+		}
+	}()
+	p := &gqlParser{src: strings.TrimPrefix(src, "\ufeff")}
+	p.next()
+	for p.kind != 0 {
+		op := gqlOperation{defaults: map[string]interface{}{}}
+		if !p.at("{") {
+			switch kw := p.name(); kw {
+			case "query":
+			case "mutation", "subscription":
+				return nil, gqlError{Message: kw + "s are not supported, only queries"}
+			case "fragment":
+				return nil, gqlError{Message: "fragments are not supported"}
+			default:
+				p.fail("expected query, got %q", kw)
+			}
+			if p.kind == 'n' {
+				op.name = p.name()
+			}
+			if p.at("(") {
+				p.variableDefinitions(op.defaults)
+			}
+			p.directives()
+		}
+		op.sel = p.selectionSet()
+		ops = append(ops, op)
+	}
+	if len(ops) == 0 {
+		return nil, gqlError{Message: "no query"}
+	}
+	return ops, nil
+}
+
+// variableDefinitions reads '($tag: String = "go", $first: Int!)',
+// keeping the defaults. types are not checked.
+func (p *gqlParser) variableDefinitions(defaults map[string]interface{}) {
+	p.expect("(")
+	for !(p.at(")")) {
+		p.expect("$")
+		name := p.name()
+		p.expect(":")
+		p.varType()
+		if p.at("=") {
+			p.next()
+			defaults[name] = p.value(true)
+		}
+		p.directives()
+	}
+	p.next()
+}
+
+// varType reads a type such as '[String!]!'
+func (p *gqlParser) varType() {
+	if p.at("[") {
+		p.next()
+		p.varType()
+		p.expect("]")
+	} else {
+		p.name()
+	}
+	if p.at("!") {
+		p.next()
+	}
+}
+
+// directives reads '@skip(if: $x)' and the like
+func (p *gqlParser) directives() []gqlDirective {
+	var list []gqlDirective
+	for p.at("@") {
+		p.next()
+		d := gqlDirective{name: p.name()}
+		if p.at("(") {
+			d.args = p.arguments()
+		}
+		list = append(list, d)
+	}
+	return list
+}
+
+// selectionSet reads '{ field alias: field(arg: 1) { sub } }'
+func (p *gqlParser) selectionSet() []gqlField {
+	p.expect("{")
+	var fields []gqlField
+	for !(p.at("}")) {
+		if p.at("...") {
+			p.fail("fragments are not supported")
+		}
+		f := gqlField{name: p.name()}
+		if p.at(":") {
+			p.next()
+			f.alias, f.name = f.name, p.name()
+		}
+		if p.at("(") {
+			f.args = p.arguments()
+		}
+		f.directives = p.directives()
+		if p.at("{") {
+			f.sel = p.selectionSet()
+		}
+		if f.alias == "" {
+			f.alias = f.name
+		}
+		fields = append(fields, f)
+	}
+	p.next()
+	if len(fields) == 0 {
+		p.fail("empty selection")
+	}
+	return fields
+}
+
+// arguments reads '(name: value, ...)'
+func (p *gqlParser) arguments() map[string]interface{} {
+	p.expect("(")
+	args := map[string]interface{}{}
+	for !(p.at(")")) {
+		name := p.name()
+		p.expect(":")
+		args[name] = p.value(false)
+	}
+	p.next()
+	return args
+}
+
+// value reads an argument value. constant values can't hold variables.
+func (p *gqlParser) value(constant bool) interface{} {
+	kind, tok := p.kind, p.tok
+	switch {
+	case p.at("$") && !constant:
+		p.next()
+		return gqlVariable(p.name())
+	case kind == 's':
+		p.next()
+		return tok
+	case kind == '0':
+		p.next()
+		if i, err := strconv.Atoi(tok); err == nil {
+			return i
+		}
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			p.fail("bad number %q", tok)
+		}
+		return f
+	case kind == 'n':
+		p.next()
+		switch tok {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return tok // an enum value
+	case p.at("["):
+		p.next()
+		list := []interface{}{}
+		for !(p.at("]")) {
+			list = append(list, p.value(constant))
+		}
+		p.next()
+		return list
+	case p.at("{"):
+		p.next()
+		obj := map[string]interface{}{}
+		for !(p.at("}")) {
+			name := p.name()
+			p.expect(":")
+			obj[name] = p.value(constant)
+		}
+		p.next()
+		return obj
+	}
+	p.fail("expected a value, got %q", tok)
+	return nil
+}
+
+// gqlObject is a value with fields
+type gqlObject interface {
+	typename() string
+	resolve(field string, args map[string]interface{}) (interface{}, error)
+}
+
+// gqlResult is a json object keeping the order of the query
+type gqlResult []gqlPair
+
+type gqlPair struct {
+	key   string
+	value interface{}
+}
+
+func (r gqlResult) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, kv := range r {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(kv.key)
+		v, err := json.Marshal(kv.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// gqlExecutor runs a query against the root object
+type gqlExecutor struct {
+	vars   map[string]interface{}
+	errors []gqlError
+	fields int
+}
+
+// object answers the selection of fields on obj
+func (x *gqlExecutor) object(obj gqlObject, sel []gqlField, at []interface{}) gqlResult {
+	var out gqlResult
+	for _, f := range sel {
+		args := x.args(f.args)
+		if x.skip(f.directives) {
+			continue
+		}
+		fieldPath := append(append([]interface{}{}, at...), f.alias)
+		var v interface{}
+		var err error
+		if x.fields++; x.fields > graphqlWidth {
+			if x.fields == graphqlWidth+1 {
+				x.errors = append(x.errors, gqlError{Message: fmt.Sprintf("query answers more than %d fields", graphqlWidth), Path: fieldPath})
+			}
+			return out
+		}
+		if f.name == "__typename" {
+			v = obj.typename()
+		} else {
+			v, err = obj.resolve(f.name, args)
+		}
+		if err == nil {
+			v, err = x.complete(v, f, fieldPath)
+		}
+		if err != nil {
+			x.errors = append(x.errors, gqlError{Message: err.Error(), Path: fieldPath})
+			v = nil
+		}
+		out = append(out, gqlPair{f.alias, v})
+	}
+	return out
+}
+
+// complete answers the sub selection of the value of field f
+func (x *gqlExecutor) complete(v interface{}, f gqlField, at []interface{}) (interface{}, error) {
+	if len(at) > graphqlDepth*2 {
+		return nil, fmt.Errorf("query is nested deeper than %d", graphqlDepth)
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case gqlObject:
+		if len(f.sel) == 0 {
+			return nil, fmt.Errorf("field %q of type %s must have a selection of subfields", f.name, v.typename())
+		}
+		return x.object(v, f.sel, at), nil
+	case []gqlObject:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			c, err := x.complete(item, f, append(at, i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = c
+		}
+		return list, nil
+	}
+	if len(f.sel) != 0 {
+		return nil, fmt.Errorf("field %q is a scalar and has no subfields", f.name)
+	}
+	return v, nil
+}
+
+// args replaces the variables in args with their values
+func (x *gqlExecutor) args(args map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		out[k] = x.value(v)
+	}
+	return out
+}
+
+func (x *gqlExecutor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case gqlVariable:
+		return x.vars[string(v)]
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			list[i] = x.value(v[i])
+		}
+		return list
+	case map[string]interface{}:
+		return x.args(v)
+	}
+	return v
+}
+
+// skip applies @skip and @include
+func (x *gqlExecutor) skip(directives []gqlDirective) bool {
+	for _, d := range directives {
+		on, _ := x.value(d.args["if"]).(bool)
+		if (d.name == "skip" && on) || (d.name == "include" && !on) {
+			return true
+		}
+	}
+	return false
+}
+
+// executeQuery runs the query document src with variables against root.
+// errors in the document fail the whole query, errors of fields are
+// returned with the data.
+func executeQuery(src, operation string, vars map[string]interface{}, root gqlObject) (gqlResult, []gqlError, error) {
+	ops, err := parseQuery(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	var op *gqlOperation
+	for i := range ops {
+		if ops[i].name == operation || (operation == "" && len(ops) == 1) {
+			op = &ops[i]
+		}
+	}
+	if op == nil {
+		if operation == "" {
+			return nil, nil, gqlError{Message: "several operations, give an operationName"}
+		}
+		return nil, nil, gqlError{Message: fmt.Sprintf("unknown operation %q", operation)}
+	}
+	x := &gqlExecutor{vars: map[string]interface{}{}}
+	for k, v := range op.defaults {
+		x.vars[k] = v
+	}
+	for k, v := range vars {
+		x.vars[k] = v
+	}
+	data := x.object(root, op.sel, nil)
+	return data, x.errors, nil
+}
+
+// argument helpers, checking types
+
+func stringArg(args map[string]interface{}, name string, required bool) (string, error) {
+	switch v := args[name].(type) {
+	case string:
+		return v, nil
+	case nil:
+		if required {
+			return "", fmt.Errorf("argument %q is required", name)
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("argument %q: expected a String, got %v", name, args[name])
+}
+
+func intArg(args map[string]interface{}, name string) (int, bool, error) {
+	switch v := args[name].(type) {
+	case int:
+		return v, true, nil
+	case float64:
+		// json variables
+		if v == float64(int(v)) {
+			return int(v), true, nil
+		}
+	case nil:
+		return 0, false, nil
+	}
+	return 0, false, fmt.Errorf("argument %q: expected an Int, got %v", name, args[name])
+}
+
+func checkArgs(args map[string]interface{}, names ...string) error {
+	for k := range args {
+		var ok bool
+		for _, n := range names {
+			ok = ok || n == k
+		}
+		if !ok {
+			return fmt.Errorf("unknown argument %q", k)
+		}
+	}
+	return nil
+}
+
+// contentIndex is the pages of a Handler, read once for a query
+type contentIndex struct {
+	h         Handler
+	names     []string
+	pages     map[string]*gqlPage
+	backlinks map[string][]string
+}
+
+// gqlPage is a page of the content index
+type gqlPage struct {
+	ix       *contentIndex
+	name     string
+	fm       frontMatter
+	md       []byte
+	modified time.Time
+	links    []string
+}
+
+// gqlTag is a front matter tag
+type gqlTag struct {
+	ix         *contentIndex
+	name, slug string
+	pages      []string
+}
+
+// newContentIndex reads the markdown pages of h, leaving out drafts
+func newContentIndex(h Handler) *contentIndex {
+	ix := &contentIndex{h: h, pages: map[string]*gqlPage{}, backlinks: map[string][]string{}}
+	all := h.wikiPages()
+	for _, name := range all {
+		b, err := fs.ReadFile(h.Root, name)
+		if err != nil {
+			continue
+		}
+		fm, md := parseFrontMatter(b)
+		if hideDraft(name, fm) {
+			continue
+		}
+		p := &gqlPage{ix: ix, name: name, fm: fm, md: md}
+		if fi, err := fs.Stat(h.Root, name); err == nil {
+			p.modified = fi.ModTime()
+		}
+		ix.pages[name] = p
+		ix.names = append(ix.names, name)
+	}
+	sort.Strings(ix.names)
+	for _, name := range ix.names {
+		p := ix.pages[name]
+		for _, target := range outLinks(all, name, p.md) {
+			if _, ok := ix.pages[target]; ok && target != name {
+				p.links = append(p.links, target)
+				ix.backlinks[target] = append(ix.backlinks[target], name)
+			}
+		}
+	}
+	return ix
+}
+
+// list returns the pages named
+func (ix *contentIndex) list(names []string) []gqlObject {
+	list := make([]gqlObject, 0, len(names))
+	for _, name := range names {
+		list = append(list, ix.pages[name])
+	}
+	return list
+}
+
+// tags returns the tags of the pages, by name
+func (ix *contentIndex) tags() []*gqlTag {
+	bySlug := map[string]*gqlTag{}
+	var tags []*gqlTag
+	for _, name := range ix.names {
+		seen := map[string]bool{}
+		for _, t := range ix.pages[name].fm.List("tags") {
+			slug := sanitized_anchor_name.Create(t)
+			if slug == "" || seen[slug] {
+				continue
+			}
+			seen[slug] = true
+			tag, ok := bySlug[slug]
+			if !ok {
+				tag = &gqlTag{ix: ix, name: t, slug: slug}
+				bySlug[slug] = tag
+				tags = append(tags, tag)
+			}
+			tag.pages = append(tag.pages, name)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i].name) < strings.ToLower(tags[j].name) })
+	return tags
+}
+
+func (ix *contentIndex) typename() string { return "Query" }
+
+func (ix *contentIndex) resolve(field string, args map[string]interface{}) (interface{}, error) {
+	switch field {
+	case "page":
+		if err := checkArgs(args, "path"); err != nil {
+			return nil, err
+		}
+		p, err := stringArg(args, "path", true)
+		if err != nil {
+			return nil, err
+		}
+		if page, ok := ix.pages[strings.TrimPrefix(path.Clean("/"+p), "/")]; ok {
+			return page, nil
+		}
+		return nil, nil
+	case "pages":
+		if err := checkArgs(args, "tag", "dir", "first"); err != nil {
+			return nil, err
+		}
+		tag, err := stringArg(args, "tag", false)
+		if err != nil {
+			return nil, err
+		}
+		dir, err := stringArg(args, "dir", false)
+		if err != nil {
+			return nil, err
+		}
+		dir = strings.Trim(path.Clean("/"+dir), "/")
+		first, limited, err := intArg(args, "first")
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, name := range ix.names {
+			if dir != "" && !strings.HasPrefix(name, dir+"/") {
+				continue
+			}
+			if tag != "" {
+				var tagged bool
+				for _, t := range ix.pages[name].fm.List("tags") {
+					tagged = tagged || sanitized_anchor_name.Create(t) == sanitized_anchor_name.Create(tag)
+				}
+				if !tagged {
+					continue
+				}
+			}
+			names = append(names, name)
+		}
+		if limited && first >= 0 && first < len(names) {
+			names = names[:first]
+		}
+		return ix.list(names), nil
+	case "tag":
+		if err := checkArgs(args, "name"); err != nil {
+			return nil, err
+		}
+		name, err := stringArg(args, "name", true)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range ix.tags() {
+			if tag.slug == sanitized_anchor_name.Create(name) {
+				return tag, nil
+			}
+		}
+		return nil, nil
+	case "tags":
+		if err := checkArgs(args); err != nil {
+			return nil, err
+		}
+		var list []gqlObject
+		for _, tag := range ix.tags() {
+			list = append(list, tag)
+		}
+		if list == nil {
+			list = []gqlObject{}
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("cannot query field %q on type Query", field)
+}
+
+func (p *gqlPage) typename() string { return "Page" }
+
+func (p *gqlPage) resolve(field string, args map[string]interface{}) (interface{}, error) {
+	if field == "frontMatter" {
+		if err := checkArgs(args, "key"); err != nil {
+			return nil, err
+		}
+		key, err := stringArg(args, "key", false)
+		if err != nil || key == "" {
+			return p.fm, err
+		}
+		return p.fm[strings.ToLower(key)], nil
+	}
+	if err := checkArgs(args); err != nil {
+		return nil, err
+	}
+	switch field {
+	case "path":
+		return "/" + p.name, nil
+	case "url":
+		return p.ix.h.Prefix + (&url.URL{Path: "/" + p.name}).String(), nil
+	case "title":
+		if title := pageTitle(p.fm, p.md); title != "" {
+			return title, nil
+		}
+		return segmentName(path.Base(p.name)), nil
+	case "description":
+		return pageSummary(p.fm, p.md), nil
+	case "date":
+		if d := p.fm.String("date"); d != "" {
+			return d, nil
+		}
+		return nil, nil
+	case "modified":
+		if p.modified.IsZero() {
+			return nil, nil
+		}
+		return p.modified.UTC().Format(time.RFC3339), nil
+	case "tags":
+		tags := p.fm.List("tags")
+		if tags == nil {
+			tags = []string{}
+		}
+		return tags, nil
+	case "links":
+		return p.ix.list(p.links), nil
+	case "backlinks":
+		return p.ix.list(p.ix.backlinks[p.name]), nil
+	}
+	return nil, fmt.Errorf("cannot query field %q on type Page", field)
+}
+
+func (t *gqlTag) typename() string { return "Tag" }
+
+func (t *gqlTag) resolve(field string, args map[string]interface{}) (interface{}, error) {
+	if err := checkArgs(args); err != nil {
+		return nil, err
+	}
+	switch field {
+	case "name":
+		return t.name, nil
+	case "slug":
+		return t.slug, nil
+	case "count":
+		return len(t.pages), nil
+	case "pages":
+		return t.ix.list(t.pages), nil
+	}
+	return nil, fmt.Errorf("cannot query field %q on type Tag", field)
+}
+
+// serveGraphQL answers a graphql query, posted as json or
+// application/graphql, or given with ?query=. without a query it serves
+// the schema.
+func (h Handler) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+	var badRequest error
+	if r.Method == "POST" {
+		b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, graphqlLimit))
+		switch {
+		case err != nil:
+			badRequest = err
+		case strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql"):
+			req.Query = string(b)
+		default:
+			badRequest = json.Unmarshal(b, &req)
+		}
+	} else {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			badRequest = json.Unmarshal([]byte(v), &req.Variables)
+		}
+	}
+	if badRequest == nil && req.Query == "" {
+		if r.Method == "POST" {
+			badRequest = fmt.Errorf("no query")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(graphqlSchema))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var data gqlResult
+	var errs []gqlError
+	if badRequest == nil {
+		data, errs, badRequest = executeQuery(req.Query, req.OperationName, req.Variables, newContentIndex(h))
+	}
+	if badRequest != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []gqlError{{Message: badRequest.Error()}}})
+		return
+	}
+	resp := gqlResult{{"data", data}}
+	if len(errs) != 0 {
+		resp = append(resp, gqlPair{"errors", errs})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGraphQL(t *testing.T) {
+	defer func(on bool) { *graphql = on }(*graphql)
+	*graphql = true
+	h := Handler{Prefix: "/docs", Root: fstest.MapFS{
+		"index.md":       {Data: []byte("---\ntags: [Intro]\n---\n# Home\n[guide](guide/setup.md) and [[notes]]\n")},
+		"guide/setup.md": {Data: []byte("---\ntitle: Setup\ndate: 2026-01-02\ntags: [intro, ops]\nowner: platform\n---\nback [home](../index.md)\n")},
+		"notes.md":       {Data: []byte("# Notes\n")},
+		"wip.md":         {Data: []byte("---\ndraft: true\n---\n[[notes]]\n")},
+	}}
+	query := func(method, body, contentType string) (int, string) {
+		var req *http.Request
+		if method == "GET" {
+			req, _ = http.NewRequest("GET", graphqlPath+"?"+body, nil)
+		} else {
+			req, _ = http.NewRequest("POST", graphqlPath, strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+	post := func(q string, vars map[string]interface{}) string {
+		b, _ := json.Marshal(map[string]interface{}{"query": q, "variables": vars})
+		_, body := query("POST", string(b), "application/json")
+		return body
+	}
+
+	for _, c := range []struct {
+		query string
+		vars  map[string]interface{}
+		want  string
+	}{
+		{`{ page(path: "/guide/setup.md") { title url date tags owner: frontMatter(key: "owner") links { path } backlinks { path } } }`, nil,
+			`{"data":{"page":{"title":"Setup","url":"/docs/guide/setup.md","date":"2026-01-02","tags":["intro","ops"],"owner":"platform","links":[{"path":"/index.md"}],"backlinks":[{"path":"/index.md"}]}}}`},
+		{`query Tagged($tag: String = "ops") { pages(tag: $tag) { path } }`, nil,
+			`{"data":{"pages":[{"path":"/guide/setup.md"}]}}`},
+		{`query ($tag: String!, $n: Int) { pages(tag: $tag, first: $n) { path __typename } }`, map[string]interface{}{"tag": "intro", "n": 1},
+			`{"data":{"pages":[{"path":"/guide/setup.md","__typename":"Page"}]}}`},
+		{`{ tags { name count pages { title } } }`, nil,
+			`{"data":{"tags":[{"name":"intro","count":2,"pages":[{"title":"Setup"},{"title":"Home"}]},{"name":"ops","count":1,"pages":[{"title":"Setup"}]}]}}`},
+		{`{ notes: page(path: "notes.md") { backlinks { title } } wip: page(path: "wip.md") { title } }`, nil,
+			`{"data":{"notes":{"backlinks":[{"title":"Home"}]},"wip":null}}`},
+		{`query ($all: Boolean) { pages(dir: "guide") { title path @include(if: $all) } }`, map[string]interface{}{"all": false},
+			`{"data":{"pages":[{"title":"Setup"}]}}`},
+		{`{ pages(first: 1) { nope } tag(name: "OPS") { slug } }`, nil,
+			`{"data":{"pages":[{"nope":null}],"tag":{"slug":"ops"}},"errors":[{"message":"cannot query field \"nope\" on type Page","path":["pages",0,"nope"]}]}`},
+		{`{ page(path: "index.md") }`, nil,
+			`{"data":{"page":null},"errors":[{"message":"field \"page\" of type Page must have a selection of subfields","path":["page"]}]}`},
+	} {
+		if got := post(c.query, c.vars); got != c.want {
+			t.Logf("%s:\nexpected %s\n     got %s", c.query, c.want, got)
+			t.Fail()
+		}
+	}
+
+	for body, want := range map[string]string{
+		`{"query": "mutation { x }"}`:                                      `mutations are not supported`,
+		`{"query": "{ pages { ...F } }"}`:                                  `fragments are not supported`,
+		`{"query": "{ pages { title }"}`:                                   `syntax error`,
+		`{"query": "query A { tags { name } } query B { tags { name } }"}`: `several operations`,
+		`not json`: `invalid character`,
+	} {
+		if code, got := query("POST", body, "application/json"); code != 400 || !strings.Contains(got, want) {
+			t.Logf("%s: expected 400 %q, got %d %s", body, want, code, got)
+			t.Fail()
+		}
+	}
+
+	if code, got := query("GET", "query="+url.QueryEscape("{ page(path: \"notes.md\") { title } }"), ""); code != 200 || got != `{"data":{"page":{"title":"Notes"}}}` {
+		t.Log("GET: unexpected", code, got)
+		t.Fail()
+	}
+	if _, got := query("POST", "{ tags { slug } }", "application/graphql"); got != `{"data":{"tags":[{"slug":"intro"},{"slug":"ops"}]}}` {
+		t.Log("application/graphql: unexpected", got)
+		t.Fail()
+	}
+	if code, got := query("GET", "", ""); code != 200 || !strings.Contains(got, "type Page {") {
+		t.Log("Expected the schema, got:", code, got)
+		t.Fail()
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// securityHeaders sets the configured security headers on every response.
+// an empty value (or "none") leaves the header out.
+func securityHeaders(h http.Header) {
+	set := func(key, value string) {
+		if value == "" || strings.EqualFold(value, "none") {
+			return
+		}
+		h.Set(key, value)
+	}
+	reloadMu.RLock()
+	defer reloadMu.RUnlock()
+	set("X-Frame-Options", *frameOptions)
+	set("Content-Security-Policy", *csp)
+	set("Strict-Transport-Security", *hsts)
+	set("Referrer-Policy", *referrerPolicy)
+	if *nosniff {
+		h.Set("X-Content-Type-Options", "nosniff")
+	}
+}
+
+// cacheRule sets Cache-Control for the url paths matching Pattern
+type cacheRule struct {
+	Pattern string
+	Value   string
+}
+
+// cacheRuleList is the -cache-control rules, first match wins
+type cacheRuleList []cacheRule
+
+var cacheRules cacheRuleList
+
+func (c *cacheRuleList) String() string {
+	if c == nil {
+		return ""
+	}
+	var s []string
+	for _, rule := range *c {
+		s = append(s, rule.Pattern+"="+rule.Value)
+	}
+	return strings.Join(s, "; ")
+}
+
+func (c *cacheRuleList) Set(value string) error {
+	i := strings.IndexByte(value, '=')
+	if i < 1 || strings.TrimSpace(value[i+1:]) == "" {
+		return fmt.Errorf("expected pattern=value, such as '*.png=max-age=31536000, immutable', got %q", value)
+	}
+	pattern := strings.TrimSpace(value[:i])
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("bad pattern %q: %v", pattern, err)
+	}
+	*c = append(*c, cacheRule{Pattern: pattern, Value: strings.TrimSpace(value[i+1:])})
+	return nil
+}
+
+// match returns the Cache-Control of the first rule matching the url
+// path. patterns with a slash match the whole path, or everything under
+// it when ending in one ('/blog/'), others the last element ('*.css').
+func (c cacheRuleList) match(urlpath string) (string, bool) {
+	for _, rule := range c {
+		var ok bool
+		switch {
+		case strings.HasSuffix(rule.Pattern, "/"):
+			ok = strings.HasPrefix(urlpath, rule.Pattern)
+		case strings.Contains(rule.Pattern, "/"):
+			ok, _ = path.Match(rule.Pattern, urlpath)
+		default:
+			ok, _ = path.Match(rule.Pattern, path.Base(urlpath))
+		}
+		if ok {
+			return rule.Value, true
+		}
+	}
+	return "", false
+}
+
+// cacheControl sets Cache-Control from the -cache-control rules for the
+// file served at urlpath, and reports whether a rule matched
+func cacheControl(w http.ResponseWriter, urlpath string) bool {
+	reloadMu.RLock()
+	v, ok := cacheRules.match(urlpath)
+	reloadMu.RUnlock()
+	if ok {
+		w.Header().Set("Cache-Control", v)
+	}
+	return ok
+}
+
+// cachePolicy is what the 'cache' front matter of a page allows
+type cachePolicy struct {
+	Header string        // Cache-Control, "" for the defaults
+	Store  bool          // server side caches may keep the rendered page
+	MaxAge time.Duration // and for how long, 0 for as long as the file is unchanged
+
+	Expires time.Time // for the Expires header, zero for none
+}
+
+// pageCachePolicy reads 'cache: no-store', 'no-cache', 'private', or a
+// max-age such as '300', '5m' or 'max-age=300' from front matter
+func pageCachePolicy(fm frontMatter) (cachePolicy, error) {
+	v := strings.ToLower(strings.TrimSpace(fm.String("cache")))
+	switch v {
+	case "":
+		return cachePolicy{Store: true}, nil
+	case "no-store", "false", "off":
+		return cachePolicy{Header: "no-store"}, nil
+	case "no-cache":
+		return cachePolicy{Header: "no-cache"}, nil
+	case "private":
+		return cachePolicy{Header: "private", Store: true}, nil
+	}
+	age := strings.TrimPrefix(v, "max-age=")
+	d, err := time.ParseDuration(age)
+	if n, nerr := strconv.Atoi(age); nerr == nil {
+		d, err = time.Duration(n)*time.Second, nil
+	}
+	if err != nil || d < 0 {
+		return cachePolicy{Store: true}, fmt.Errorf("cache: expected no-store, no-cache, private or a max-age, got %q", v)
+	}
+	if d == 0 {
+		return cachePolicy{Header: "no-cache"}, nil
+	}
+	return cachePolicy{Header: fmt.Sprintf("max-age=%d", int(d.Seconds())), Store: true, MaxAge: d}, nil
+}
+
+// maxExpiry is the longest cache lifetime derived for a page
+const maxExpiry = 365 * 24 * time.Hour
+
+// expiryPolicy derives the cache lifetime of a page without a 'cache'
+// front matter value. an 'expires' or 'review' date (2006-01-02 or RFC
+// 3339) in front matter caps it, and a date gone by asks clients to
+// revalidate. with limit above 0, pages are also cached for a tenth of the
+// time since their file last changed, up to limit: a reference page
+// untouched for a year gets the limit, a changelog edited this morning a
+// few minutes. the zero policy means neither applied.
+func expiryPolicy(fm frontMatter, modified, now time.Time, limit time.Duration) cachePolicy {
+	var age time.Duration
+	var set bool
+	if limit > 0 && !modified.IsZero() {
+		age, set = now.Sub(modified)/10, true
+		if age > limit {
+			age = limit
+		}
+	}
+	for _, key := range []string{"expires", "review"} {
+		date, ok := fm.Date(key)
+		if !ok {
+			continue
+		}
+		until := date.Sub(now)
+		if until > maxExpiry {
+			until = maxExpiry
+		}
+		if !set || until < age {
+			age, set = until, true
+		}
+	}
+	switch {
+	case !set:
+		return cachePolicy{}
+	case age < time.Second:
+		return cachePolicy{Header: "no-cache"}
+	}
+	age = age.Truncate(time.Second)
+	return cachePolicy{Header: fmt.Sprintf("max-age=%d", int(age.Seconds())), Store: true, MaxAge: age, Expires: now.Add(age)}
+}
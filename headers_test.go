@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	resp := sendRequest(req)
+	if resp.Header.Get("X-Frame-Options") != "DENY" {
+		t.Log("Expected default X-Frame-Options DENY, got:", resp.Header.Get("X-Frame-Options"))
+		t.FailNow()
+	}
+
+	*frameOptions = "none"
+	*csp = "default-src 'self'"
+	*nosniff = true
+	defer func() { *frameOptions, *csp, *nosniff = "DENY", "", false }()
+
+	resp = sendRequest(req)
+	if _, ok := resp.Header["X-Frame-Options"]; ok {
+		t.Log("Expected no X-Frame-Options header")
+		t.FailNow()
+	}
+	if resp.Header.Get("Content-Security-Policy") != "default-src 'self'" {
+		t.Log("Expected Content-Security-Policy, got:", resp.Header.Get("Content-Security-Policy"))
+		t.FailNow()
+	}
+	if resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Log("Expected X-Content-Type-Options nosniff")
+		t.FailNow()
+	}
+}
+
+func TestPageCachePolicy(t *testing.T) {
+	for value, want := range map[string]cachePolicy{
+		"":            {Store: true},
+		"no-store":    {Header: "no-store"},
+		"false":       {Header: "no-store"},
+		"No-Cache":    {Header: "no-cache"},
+		"private":     {Header: "private", Store: true},
+		"300":         {Header: "max-age=300", Store: true, MaxAge: 300 * time.Second},
+		"max-age=60":  {Header: "max-age=60", Store: true, MaxAge: time.Minute},
+		"1h":          {Header: "max-age=3600", Store: true, MaxAge: time.Hour},
+		"0":           {Header: "no-cache"},
+		"tomorrow":    {Store: true},
+		"max-age=-10": {Store: true},
+	} {
+		got, err := pageCachePolicy(frontMatter{"cache": value})
+		if got != want || (err != nil) != (value == "tomorrow" || value == "max-age=-10") {
+			t.Logf("%q: expected %+v, got %+v %v", value, want, got, err)
+			t.Fail()
+		}
+	}
+
+	h := Handler{Root: fstest.MapFS{"live.md": {Data: []byte("---\ncache: no-store\n---\n# live\n")}}}
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/live.md", nil)
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Log("Expected Cache-Control no-store, got:", rec.Header().Get("Cache-Control"))
+		t.Fail()
+	}
+}
+
+func TestExpiryPolicy(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		fm       frontMatter
+		modified time.Time
+		limit    time.Duration
+		want     string
+	}{
+		{frontMatter{}, now.AddDate(-1, 0, 0), 0, ""},
+		{frontMatter{}, now.AddDate(-1, 0, 0), 24 * time.Hour, "max-age=86400"},
+		{frontMatter{}, now.Add(-time.Hour), 24 * time.Hour, "max-age=360"},
+		{frontMatter{}, now, 24 * time.Hour, "no-cache"},
+		{frontMatter{"expires": "2026-06-02"}, now, 0, "max-age=43200"},
+		{frontMatter{"review": "2026-06-01T13:00:00Z"}, now.AddDate(-1, 0, 0), 24 * time.Hour, "max-age=3600"},
+		{frontMatter{"expires": "2026-05-01"}, now.AddDate(-1, 0, 0), 24 * time.Hour, "no-cache"},
+		{frontMatter{"expires": "2030-01-01"}, now, 0, "max-age=31536000"},
+		{frontMatter{"expires": "soon"}, now, 0, ""},
+	} {
+		got := expiryPolicy(c.fm, c.modified, now, c.limit)
+		if got.Header != c.want {
+			t.Logf("%v modified %v, -auto-cache %v: expected %q, got %q", c.fm, c.modified, c.limit, c.want, got.Header)
+			t.Fail()
+		}
+		if got.MaxAge != 0 && !got.Expires.Equal(now.Add(got.MaxAge)) {
+			t.Logf("%v: expected Expires %v, got %v", c.fm, now.Add(got.MaxAge), got.Expires)
+			t.Fail()
+		}
+	}
+
+	h := Handler{Root: fstest.MapFS{
+		"old.md":   {Data: []byte("# reference\n"), ModTime: time.Now().AddDate(-1, 0, 0)},
+		"fixed.md": {Data: []byte("---\ncache: 60\nexpires: 2000-01-01\n---\n# fixed\n"), ModTime: time.Now().AddDate(-1, 0, 0)},
+	}}
+	defer func(d time.Duration) { *autoCache = d }(*autoCache)
+	*autoCache = time.Hour
+	for file, want := range map[string]string{"old.md": "max-age=3600", "fixed.md": "max-age=60"} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/"+file, nil)
+		h.ServeHTTP(rec, req)
+		if rec.Header().Get("Cache-Control") != want {
+			t.Logf("%s: expected Cache-Control %q, got %q", file, want, rec.Header().Get("Cache-Control"))
+			t.Fail()
+		}
+		if (rec.Header().Get("Expires") != "") != (file == "old.md") {
+			t.Logf("%s: unexpected Expires %q", file, rec.Header().Get("Expires"))
+			t.Fail()
+		}
+	}
+}
+
+func TestCacheRules(t *testing.T) {
+	defer func(rules cacheRuleList) { cacheRules = rules }(cacheRules)
+	cacheRules = nil
+	for _, v := range []string{"*.png=max-age=31536000, immutable", "/docs/blog/=max-age=300", "/docs/*.md=max-age=60"} {
+		if err := cacheRules.Set(v); err != nil {
+			t.Log(err)
+			t.FailNow()
+		}
+	}
+	for _, v := range []string{"*.png", "=no-store", "[=no-store", "*.css= "} {
+		if err := cacheRules.Set(v); err == nil {
+			t.Logf("expected an error for %q", v)
+			t.Fail()
+		}
+	}
+	h := Handler{Prefix: "/docs", Root: fstest.MapFS{
+		"logo.png":       {Data: []byte("\x89PNG\r\n\x1a\n")},
+		"index.md":       {Data: []byte("# home\n")},
+		"blog/post.md":   {Data: []byte("# post\n")},
+		"blog/cover.png": {Data: []byte("\x89PNG\r\n\x1a\n")},
+		"live.md":        {Data: []byte("---\ncache: no-store\n---\n# live\n")},
+		"list/index.md":  {Data: []byte("# list\n")},
+		"page.html":      {Data: []byte("<!DOCTYPE html><p>hi</p>")},
+	}}
+	for urlpath, want := range map[string]string{
+		"/logo.png":       "max-age=31536000, immutable",
+		"/blog/cover.png": "max-age=31536000, immutable",
+		"/blog/post.md":   "max-age=300",
+		"/index.md":       "max-age=60",
+		"/live.md":        "no-store",
+		"/list/":          "",
+		"/page.html":      "",
+		"/missing.png":    "",
+	} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", urlpath, nil)
+		h.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Cache-Control"); got != want {
+			t.Logf("%s: expected Cache-Control %q, got %q", urlpath, want, got)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// readiness tracks startup tasks that must finish before /readyz succeeds
+type readiness struct {
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+var ready = &readiness{pending: map[string]bool{"root directory": true}}
+
+// wait adds a task to finish before the server is ready
+func (rd *readiness) wait(task string) {
+	rd.mu.Lock()
+	rd.pending[task] = true
+	rd.mu.Unlock()
+}
+
+// done marks a task finished
+func (rd *readiness) done(task string) {
+	rd.mu.Lock()
+	delete(rd.pending, task)
+	rd.mu.Unlock()
+}
+
+// waiting returns the unfinished tasks
+func (rd *readiness) waiting() []string {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	var tasks []string
+	for task := range rd.pending {
+		tasks = append(tasks, task)
+	}
+	sort.Strings(tasks)
+	return tasks
+}
+
+// checkRoot marks the root directory task done if root is a directory
+func checkRoot(root string) error {
+	fi, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{Op: "stat", Path: root, Err: os.ErrInvalid}
+	}
+	ready.done("root directory")
+	return nil
+}
+
+// serveHealth answers /healthz (the process is up) and /readyz (startup
+// finished and the root directory is still there)
+func (h Handler) serveHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Path == "/readyz" {
+		waiting := ready.waiting()
+		if h.RootString != "" {
+			if fi, err := os.Stat(h.RootString); err != nil || !fi.IsDir() {
+				waiting = append(waiting, "root directory missing")
+			}
+		}
+		if len(waiting) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("not ready: " + strings.Join(waiting, ", ") + "\n"))
+			return
+		}
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// drain makes /readyz fail, so load balancers take the server out of
+// rotation while it keeps serving
+func drain() {
+	ready.wait("draining")
+	logAt(levelInfo, "draining: /readyz fails from now on")
+}
+
+// serveDrain starts draining on POST /_markdownd/drain and stops on
+// DELETE. it is only served on the -admin listener, and refuses requests
+// a proxy forwarded there.
+func serveDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != "" {
+		logAt(levelWarn, "admin: refused a forwarded request for", r.URL.Path)
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	switch r.Method {
+	case "POST":
+		drain()
+		w.Write([]byte("draining\n"))
+	case "DELETE":
+		ready.done("draining")
+		logAt(levelInfo, "draining stopped")
+		w.Write([]byte("ok\n"))
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// adminHandler serves the endpoints of the -admin listener
+func adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_markdownd/drain", serveDrain)
+	return mux
+}
+
+// serveAdmin starts the -admin listener, away from the documents and the
+// proxy in front of them
+func serveAdmin(addr string) {
+	if network, sock := splitNetwork(addr); network != "unix" && !isLoopback(sock) {
+		println("warning: -admin", addr, "is not a loopback address, anyone reaching it can drain the server")
+	}
+	ln, err := listen(addr)
+	if err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	status("admin:", describeListener(addr, ln))
+	go func() {
+		logger.Println("admin:", http.Serve(ln, adminHandler()))
+	}()
+}
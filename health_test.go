@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	get := func(path string) (int, string) {
+		req, _ := http.NewRequest("GET", path, nil)
+		resp := sendRequest(req)
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get("/healthz"); code != 200 || body != "ok\n" {
+		t.Log("Expected healthz ok, got:", code, body)
+		t.Fail()
+	}
+
+	ready.wait("root directory")
+	ready.wait("preload")
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || body != "not ready: preload, root directory\n" {
+		t.Log("Expected not ready, got:", code, body)
+		t.Fail()
+	}
+	ready.done("preload")
+	if err := checkRoot("docs"); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if code, body := get("/readyz"); code != 200 || body != "ok\n" {
+		t.Log("Expected ready, got:", code, body)
+		t.Fail()
+	}
+	if err := checkRoot("docs/index.md"); err == nil {
+		t.Log("Expected an error for a file root")
+		t.Fail()
+	}
+
+	// probes don't need the bearer token
+	*token = "secret"
+	defer func() { *token = "" }()
+	if code, _ := get("/readyz"); code != 200 {
+		t.Log("Expected ready without token, got:", code)
+		t.Fail()
+	}
+}
+
+func TestDrain(t *testing.T) {
+	checkRoot("docs")
+	send := func(method, path string, h http.Handler, set func(*http.Request)) (int, string) {
+		req, _ := http.NewRequest(method, path, nil)
+		req.RemoteAddr = "127.0.0.1:1234"
+		if set != nil {
+			set(req)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+	dir := prepareDirectory("docs")
+	site := &Handler{Root: os.DirFS(dir), RootString: dir}
+	admin := adminHandler()
+
+	// not on the listener behind the proxy, where every client is local
+	if code, _ := send("POST", "/_markdownd/drain", site, nil); code != 404 {
+		t.Log("Expected no drain on the site, got:", code)
+		t.Fail()
+	}
+	for _, header := range []string{"X-Forwarded-For", "Forwarded"} {
+		forwarded := func(r *http.Request) { r.Header.Set(header, "for=192.0.2.1") }
+		if code, _ := send("POST", "/_markdownd/drain", admin, forwarded); code != 403 {
+			t.Log("Expected a forwarded drain refused, got:", header, code)
+			t.Fail()
+		}
+	}
+	if code, _ := send("GET", "/readyz", site, nil); code != 200 {
+		t.Log("Expected ready, got:", code)
+		t.Fail()
+	}
+
+	if code, _ := send("POST", "/_markdownd/drain", admin, nil); code != 200 {
+		t.Log("Expected drain from -admin, got:", code)
+		t.Fail()
+	}
+	if code, body := send("GET", "/readyz", site, nil); code != http.StatusServiceUnavailable || body != "not ready: draining\n" {
+		t.Log("Expected not ready while draining, got:", code, body)
+		t.Fail()
+	}
+	if code, _ := send("GET", "/index.md", site, nil); code != 200 {
+		t.Log("Expected pages served while draining, got:", code)
+		t.Fail()
+	}
+	if code, _ := send("DELETE", "/_markdownd/drain", admin, nil); code != 200 {
+		t.Log("Expected draining stopped, got:", code)
+		t.Fail()
+	}
+	if code, _ := send("GET", "/readyz", site, nil); code != 200 {
+		t.Log("Expected ready again, got:", code)
+		t.Fail()
+	}
+}
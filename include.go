@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// reInclude matches an include directive on a line of its own
+var reInclude = regexp.MustCompile(`^<!--\s*include:\s*(\S+?)\s*-->$`)
+
+// maxIncludeDepth limits nested includes
+const maxIncludeDepth = 8
+
+// includes expands '<!--include: partials/header.md-->' lines in the
+// markdown of the file name with the body of the included file. paths are
+// relative to the including file, or to the root with a leading '/'.
+// includes outside the root, in a loop, too deep, missing or not
+// published are left as a comment saying why.
+func (h Handler) includes(name string, src []byte) []byte {
+	if !bytes.Contains(src, []byte("<!--")) {
+		return src
+	}
+	return h.expand([]string{name}, src)
+}
+
+// expand replaces the include lines in src, from the last file of stack
+func (h Handler) expand(stack []string, src []byte) []byte {
+	var out bytes.Buffer
+	var fenced bool
+	for _, line := range bytes.SplitAfter(src, []byte("\n")) {
+		trimmed := bytes.TrimSpace(line)
+		if bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~")) {
+			fenced = !fenced
+		}
+		m := reInclude.FindSubmatch(trimmed)
+		if fenced || m == nil {
+			out.Write(line)
+			continue
+		}
+		body, err := h.include(stack, string(m[1]))
+		if err != nil {
+			logger.Printf("include in %s: %v", stack[len(stack)-1], err)
+			fmt.Fprintf(&out, "<!-- include %s: %s -->\n", m[1], strings.Replace(err.Error(), "--", "", -1))
+			continue
+		}
+		out.Write(body)
+		if len(body) != 0 && body[len(body)-1] != '\n' {
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes()
+}
+
+// include reads the file target, included from the last file of stack,
+// and expands its includes
+func (h Handler) include(stack []string, target string) ([]byte, error) {
+	name := path.Join(path.Dir(stack[len(stack)-1]), target)
+	if strings.HasPrefix(target, "/") {
+		name = strings.TrimPrefix(path.Clean(target), "/")
+	}
+	if !fs.ValidPath(name) || name == "." {
+		return nil, fmt.Errorf("%s is outside the root", target)
+	}
+	for _, s := range stack {
+		if s == name {
+			return nil, fmt.Errorf("include loop: %s -> %s", strings.Join(stack, " -> "), name)
+		}
+	}
+	if len(stack) > maxIncludeDepth {
+		return nil, fmt.Errorf("%s: includes nested deeper than %d", target, maxIncludeDepth)
+	}
+	b, err := fs.ReadFile(h.Root, name)
+	if err != nil {
+		return nil, err
+	}
+	if h.RootString != "" && !fileisgood(filepath.Join(h.RootString, filepath.FromSlash(name))) {
+		return nil, fmt.Errorf("%s is a symlink", target)
+	}
+	// drafts and embargoed pages don't show through the pages including them
+	fm, body := parseFrontMatter(b)
+	if hideDraft(name, fm) {
+		return nil, fmt.Errorf("%s is not published", target)
+	}
+	return h.expand(append(stack[:len(stack):len(stack)], name), body), nil
+}
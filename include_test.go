@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestIncludes(t *testing.T) {
+	h := Handler{Root: fstest.MapFS{
+		"partials/header.md": {Data: []byte("---\ntitle: partial\n---\nshared header\n<!--include: note.md-->")},
+		"partials/note.md":   {Data: []byte("a note\n")},
+		"loop/a.md":          {Data: []byte("<!--include: b.md-->\n")},
+		"loop/b.md":          {Data: []byte("<!--include: /loop/a.md-->\n")},
+	}}
+	src := "<!--include: partials/header.md-->\nbody\n" +
+		"```\n<!--include: partials/note.md-->\n```\n" +
+		"<!-- include: /partials/note.md -->\n" +
+		"<!--include: ../outside.md-->\n" +
+		"<!--include: missing.md-->\n" +
+		"<!--include: loop/a.md-->\n"
+	out := string(h.includes("index.md", []byte(src)))
+	for _, want := range []string{
+		"shared header\na note\nbody\n",
+		"```\n<!--include: partials/note.md-->\n```\n", // not in code
+		"```\na note\n",
+		"<!-- include ../outside.md: ../outside.md is outside the root -->\n",
+		"<!-- include missing.md: open missing.md: file does not exist -->\n",
+		"include loop: index.md -> loop/a.md -> loop/b.md -> loop/a.md",
+	} {
+		if !strings.Contains(out, want) {
+			t.Logf("Expected %q in:\n%s", want, out)
+			t.Fail()
+		}
+	}
+	if strings.Contains(out, "title: partial") {
+		t.Log("Expected front matter of included files dropped:\n" + out)
+		t.Fail()
+	}
+
+	soon := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	h.Root.(fstest.MapFS)["_drafts/idea.md"] = &fstest.MapFile{Data: []byte("secret idea\n")}
+	h.Root.(fstest.MapFS)["plan.md"] = &fstest.MapFile{Data: []byte("---\ndraft: true\n---\nsecret plan\n")}
+	h.Root.(fstest.MapFS)["launch.md"] = &fstest.MapFile{Data: []byte("---\nembargo_until: " + soon + "\n---\nsecret launch\n")}
+	out = string(h.includes("index.md", []byte("<!--include: _drafts/idea.md-->\n<!--include: plan.md-->\n<!--include: launch.md-->\n")))
+	if strings.Contains(out, "secret") || !strings.Contains(out, "<!-- include plan.md: plan.md is not published -->") {
+		t.Log("Expected drafts and embargoed pages not included:\n" + out)
+		t.Fail()
+	}
+}
+
+func TestIncludeSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "index.md"), []byte("# page\n<!--include: secret.md-->\n<!--include: ok.md-->\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "ok.md"), []byte("included *text*\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "..secret"), []byte("secret\n"), 0644)
+	os.Symlink(filepath.Join(dir, "..secret"), filepath.Join(dir, "secret.md"))
+
+	root := prepareDirectory(dir)
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	Handler{Root: os.DirFS(root), RootString: root}.ServeHTTP(w, req)
+	body := w.Body.String()
+	if !strings.Contains(body, "included <em>text</em>") || strings.Contains(body, "secret\n") {
+		t.Log("Expected ok.md included and the symlink refused, got:", body)
+		t.Fail()
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// starter is the site 'markdownd init' writes: a layout with nav,
+// breadcrumbs, a search box, a table of contents, reading progress and
+// copy buttons, site variables, and pages showing front matter, includes,
+// shortcodes, wiki links, tags and drafts
+var starter = map[string]string{
+	"_site.json": `{
+  "name": "My docs",
+  "version": "0.1.0"
+}
+`,
+
+	layoutName: `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} - {{.Site.name}}</title>
+<meta name="description" content="{{.Description}}">
+<style>
+body { margin: 0; font: 16px/1.6 system-ui, sans-serif; color: #222; display: flex; min-height: 100vh; }
+nav.site { width: 16em; padding: 1em; background: #f6f8fa; border-right: 1px solid #ddd; }
+nav.site ul { list-style: none; padding-left: 1em; margin: 0; }
+nav.site > ul { padding: 0; }
+nav.site .current > a { font-weight: bold; }
+nav.site input { width: 100%; box-sizing: border-box; margin-bottom: 1em; }
+main { flex: 1; max-width: 48em; padding: 1em 2em; }
+aside.toc { width: 14em; padding: 1em; font-size: 0.9em; position: sticky; top: 0; align-self: flex-start; }
+:root { --md-progress-color: #0366d6; --md-toc-active-color: #0366d6; }
+.crumbs { font-size: 0.9em; color: #666; }
+pre { background: #f6f8fa; padding: 1em; overflow: auto; }
+a { color: #0366d6; }
+</style>
+</head>
+<body>
+{{define "nav"}}<ul>{{range .}}
+<li{{if .Current}} class="current"{{end}}>{{if .URL}}<a href="{{.URL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}{{if .Children}}{{template "nav" .Children}}{{end}}</li>{{end}}
+</ul>{{end}}
+<nav class="site">
+<p><a href="{{relURL "/"}}"><b>{{.Site.name}}</b></a> {{.Site.version}}</p>
+<input id="search" type="search" placeholder="Search" autocomplete="off">
+<ul id="results"></ul>
+{{template "nav" .Nav}}
+<p><a href="{{relURL "/tags/"}}">Tags</a></p>
+</nav>
+<main>
+<p class="crumbs">{{range $i, $c := .Breadcrumbs}}{{if $i}} / {{end}}<a href="{{$c.URL}}">{{$c.Name}}</a>{{end}}</p>
+{{.Content}}
+{{with .Backlinks}}<h4>Linked from</h4>
+<ul>{{range .}}<li><a href="{{.URL}}">{{.Title}}</a></li>{{end}}</ul>{{end}}
+</main>
+<aside class="toc" data-toc></aside>
+{{component "progress"}}
+{{component "toc"}}
+{{component "code"}}
+<script>
+// needs -search
+var box = document.getElementById("search"), list = document.getElementById("results");
+box.addEventListener("input", function () {
+  if (box.value.length < 2) { list.innerHTML = ""; return; }
+  fetch("{{relURL "/_markdownd/search"}}?limit=8&q=" + encodeURIComponent(box.value))
+    .then(function (r) { return r.json(); })
+    .then(function (results) {
+      list.innerHTML = "";
+      results.forEach(function (r) {
+        var li = document.createElement("li"), a = document.createElement("a");
+        a.href = r.url; a.textContent = r.title;
+        li.appendChild(a); list.appendChild(li);
+      });
+    });
+});
+</script>
+</body>
+</html>
+`,
+
+	"index.md": `---
+title: Welcome
+description: A starter site for markdownd
+---
+# Welcome
+
+This site was written by ` + "`markdownd init`" + `. Every page is a markdown file:
+edit them, and reload to see the change.
+
+* [[Getting started]] explains how the site is served
+* [[Writing pages]] shows what a page can hold
+* the [blog](blog/) has posts [tagged](tags/) by topic
+
+<!--include: _partials/note.md-->
+`,
+
+	"_partials/note.md": `> Files and directories starting with ` + "`_`" + ` are left out of the nav:
+> this note is included from _partials/note.md.
+`,
+
+	"guide/index.md": `---
+title: Guide
+weight: 1
+---
+# Guide
+
+{{< list >}}
+`,
+
+	"guide/getting-started.md": `---
+title: Getting started
+weight: 1
+tags: [setup]
+---
+# Getting started
+
+Serve this directory again with the settings ` + "`markdownd init`" + ` used:
+
+` + fence + `
+markdownd -vars _site.json -search -tags -wiki .
+` + fence + `
+
+* _layout.html is the page template, with the nav, breadcrumbs and search box
+* _site.json holds the site variables, such as ` + "`{{.Site.name}}`" + `
+* -search answers the search box, -tags serves [the tag pages](/tags/),
+  and -wiki resolves links like [[Writing pages]]
+
+Run ` + "`markdownd -h`" + ` for every flag, and ` + "`markdownd config explain`" + `
+for the value each one has.
+`,
+
+	"guide/writing-pages.md": `---
+title: Writing pages
+description: Front matter, links, includes and shortcodes
+weight: 2
+tags: [setup, writing]
+---
+# Writing pages
+
+## Front matter
+
+A ` + "`---`" + ` block at the top of a page sets its title, description, nav
+weight, tags, and more:
+
+` + fence + `yaml
+---
+title: Writing pages
+weight: 2
+tags: [setup, writing]
+draft: true
+---
+` + fence + `
+
+Pages with ` + "`draft: true`" + `, and files under _drafts/, are only served with
+-drafts.
+
+## Links
+
+Link with markdown, [like this](getting-started.md), or by page name, like
+[[Getting started]] or [[hello|the first post]].
+
+## Code
+
+` + fence + `yaml {2 title="front matter"}
+---
+title: Writing pages
+---
+` + fence + `
+
+## Shortcodes
+
+This page was changed on {{< modified "January 2, 2006" >}}.
+`,
+
+	"blog/index.md": `---
+title: Blog
+weight: 2
+---
+# Blog
+
+{{< list >}}
+`,
+
+	"blog/hello.md": `---
+title: Hello, markdownd
+date: 2026-01-01
+tags: [news]
+---
+# Hello, markdownd
+
+Posts are pages with a date and tags. [All tags](/tags/) are listed, newest
+post first.
+`,
+
+	"_drafts/next-post.md": `---
+title: Next post
+tags: [news]
+---
+# Next post
+
+Only served with -drafts.
+`,
+}
+
+// starterFlags are the serve flags the starter site is made for
+var starterFlags = []string{"-vars", "_site.json", "-search", "-tags", "-wiki"}
+
+// writeStarter writes the starter site into dir, which must be empty or
+// missing unless force
+func writeStarter(dir string, force bool) error {
+	return writeFiles(dir, starter, force)
+}
+
+// initCommand writes the starter site and serves it, 'markdownd init dir'
+func initCommand(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	force := fs.Bool("force", false, "write into a directory that isn't empty, replacing starter files")
+	noServe := fs.Bool("no-serve", false, "write the site without serving it")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: markdownd init [-force] [-no-serve] <directory> [flags]")
+		fmt.Fprintln(os.Stderr, "writes a starter site, with a layout, nav, search, tags and example pages,\n"+
+			"and serves it on -http (flags after the directory are passed to markdownd)")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(111)
+	}
+	dir := fs.Arg(0)
+	if err := writeStarter(dir, *force); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(111)
+	}
+	fmt.Fprintln(os.Stderr, "wrote", len(starter), "files to", dir)
+
+	// -vars is relative to the directory
+	serveFlags := append([]string{}, starterFlags...)
+	serveFlags[1] = filepath.Join(dir, serveFlags[1])
+	fmt.Fprintln(os.Stderr, "serve it with: markdownd", strings.Join(serveFlags, " "), dir)
+	if *noServe {
+		return
+	}
+	given, rest, err := parseServeFlags(append(serveFlags, fs.Args()[1:]...))
+	if err == nil {
+		_, _, _, err = loadSettings(flag.CommandLine, given)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(111)
+	}
+	if len(rest) != 0 {
+		fmt.Fprintln(os.Stderr, "init: unexpected", strings.Join(rest, " "), "(flags go after the directory)")
+		os.Exit(111)
+	}
+	serve([]string{dir})
+}
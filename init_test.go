@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStarterSite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	if err := writeStarter(dir, false); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if err := writeStarter(dir, false); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Log("Expected an error writing into a directory that isn't empty, got:", err)
+		t.Fail()
+	}
+
+	defer func(w, tp bool, vars varList) { *wiki, *tagPages, siteVars = w, tp, vars }(*wiki, *tagPages, siteVars)
+	*wiki, *tagPages, siteVars = true, true, varList{}
+	if err := siteVars.readFile(dir + "/_site.json"); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	root := prepareDirectory(dir)
+	h := Handler{Root: os.DirFS(root), RootString: root}
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		h.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+	for name := range starter {
+		if !strings.HasSuffix(name, ".md") || strings.HasPrefix(name, "_") {
+			continue
+		}
+		if code, body := get("/" + name); code != 200 || !strings.Contains(body, "<title>") {
+			t.Logf("%s: expected the page in the layout, got %d:\n%s", name, code, body)
+			t.Fail()
+		}
+	}
+	code, body := get("/")
+	for _, want := range []string{
+		"<title>Welcome - My docs</title>",
+		`<a href="/guide/">Guide</a>`,
+		`href="/guide/getting-started.md" rel="nofollow">Getting started</a>`,
+		"included from _partials/note.md",
+	} {
+		if code != 200 || !strings.Contains(body, want) {
+			t.Logf("/: expected %q, got %d:\n%s", want, code, body)
+			t.Fail()
+		}
+	}
+	if code, _ := get("/_drafts/next-post.md"); code != 404 {
+		t.Log("Expected the draft to be hidden, got", code)
+		t.Fail()
+	}
+	if code, body := get("/tags/"); code != 200 || !strings.Contains(body, "setup</a> (2)") {
+		t.Logf("/tags/: expected the starter tags, got %d:\n%s", code, body)
+		t.Fail()
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// crumb is one step of the navigation path to a page
+type crumb struct {
+	Name string
+	URL  string
+}
+
+// breadcrumbs returns the trail of directories leading to urlpath,
+// ending with the page itself (titled title, if not empty)
+func breadcrumbs(urlpath, title string) []crumb {
+	trail := []crumb{{Name: "Home", URL: "/"}}
+	segments := strings.Split(strings.Trim(urlpath, "/"), "/")
+	for i, seg := range segments {
+		if seg == "" {
+			continue
+		}
+		u := "/" + strings.Join(segments[:i+1], "/")
+		last := i == len(segments)-1
+		if !last || strings.HasSuffix(urlpath, "/") {
+			u += "/"
+		}
+		name := segmentName(seg)
+		if last && title != "" {
+			name = title
+		}
+		trail = append(trail, crumb{Name: name, URL: u})
+	}
+	return trail
+}
+
+// segmentName makes a human friendly name from a path segment
+func segmentName(seg string) string {
+	seg = strings.TrimSuffix(seg, path.Ext(seg))
+	seg = strings.NewReplacer("-", " ", "_", " ").Replace(seg)
+	if seg == "" {
+		return seg
+	}
+	return strings.ToUpper(seg[:1]) + seg[1:]
+}
+
+// baseURL returns scheme://host for the request
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// structuredData returns a <script> with schema.org JSON-LD describing the
+// markdown page at urlpath on the site base, such as https://example.com,
+// modified at modified (zero if unknown). front matter 'schema' selects
+// Article or TechArticle.
+func structuredData(base, urlpath string, modified time.Time, fm frontMatter, md []byte) []byte {
+	title := pageTitle(fm, md)
+
+	schema := "Article"
+	if strings.EqualFold(fm.String("schema"), "TechArticle") {
+		schema = "TechArticle"
+	}
+
+	article := map[string]interface{}{
+		"@context": "https://schema.org",
+		"@type":    schema,
+		"headline": title,
+		"url":      base + urlpath,
+	}
+	if desc := pageSummary(fm, md); desc != "" {
+		article["description"] = desc
+	}
+	if author := fm.String("author"); author != "" {
+		article["author"] = map[string]string{"@type": "Person", "name": author}
+	}
+	if date := fm.String("date"); date != "" {
+		article["datePublished"] = date
+	}
+	if !modified.IsZero() {
+		article["dateModified"] = modified.UTC().Format(time.RFC3339)
+	}
+	if *siteName != "" {
+		article["publisher"] = map[string]string{"@type": "Organization", "name": *siteName}
+	}
+	if tags := fm.List("tags"); len(tags) != 0 {
+		article["keywords"] = strings.Join(tags, ", ")
+	}
+
+	var items []map[string]interface{}
+	for i, c := range breadcrumbs(urlpath, title) {
+		items = append(items, map[string]interface{}{
+			"@type":    "ListItem",
+			"position": i + 1,
+			"name":     c.Name,
+			"item":     base + c.URL,
+		})
+	}
+	crumbs := map[string]interface{}{
+		"@context":        "https://schema.org",
+		"@type":           "BreadcrumbList",
+		"itemListElement": items,
+	}
+
+	// json.Marshal escapes '<' so the document can't close the script tag
+	b, err := json.Marshal([]interface{}{article, crumbs})
+	if err != nil {
+		logger.Println("error encoding json-ld:", err)
+		return nil
+	}
+	return []byte("<script type=\"application/ld+json\">" + string(b) + "</script>\n")
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStructuredData(t *testing.T) {
+	*jsonld = true
+	defer func() { *jsonld = false }()
+
+	req, _ := http.NewRequest("GET", "/index.md", nil)
+	req.Host = "example.com"
+	resp := sendRequest(req)
+	body, _ := ioutil.ReadAll(resp.Body)
+	bodystr := string(body)
+
+	if !strings.Contains(bodystr, `<script type="application/ld+json">`) {
+		t.Log("Expected json-ld script in body")
+		t.FailNow()
+	}
+	if !strings.Contains(bodystr, `"@type":"BreadcrumbList"`) {
+		t.Log("Expected BreadcrumbList in json-ld")
+		t.FailNow()
+	}
+	if !strings.Contains(bodystr, `"url":"http://example.com/index.md"`) {
+		t.Log("Expected page url in json-ld")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot is where the cgroup filesystem is mounted
+var cgroupRoot = "/sys/fs/cgroup"
+
+// readCgroup returns the trimmed contents of a cgroup file, "" if missing
+func readCgroup(name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(cgroupRoot, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// cgroupCPUs returns the cpu quota of the container in cpus, 0 for none
+func cgroupCPUs() float64 {
+	// cgroup v2: 'quota period', or 'max period'
+	if f := strings.Fields(readCgroup("cpu.max")); len(f) == 2 && f[0] != "max" {
+		quota, err1 := strconv.ParseFloat(f[0], 64)
+		period, err2 := strconv.ParseFloat(f[1], 64)
+		if err1 == nil && err2 == nil && quota > 0 && period > 0 {
+			return quota / period
+		}
+	}
+	// cgroup v1: quota is -1 without a limit
+	quota, err1 := strconv.ParseFloat(readCgroup("cpu/cpu.cfs_quota_us"), 64)
+	period, err2 := strconv.ParseFloat(readCgroup("cpu/cpu.cfs_period_us"), 64)
+	if err1 == nil && err2 == nil && quota > 0 && period > 0 {
+		return quota / period
+	}
+	return 0
+}
+
+// cgroupMemory returns the memory limit of the container in bytes, 0 for none
+func cgroupMemory() int64 {
+	if v := readCgroup("memory.max"); v != "" && v != "max" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	}
+	// cgroup v1 reports no limit as a huge number
+	if n, err := strconv.ParseInt(readCgroup("memory/memory.limit_in_bytes"), 10, 64); err == nil && n < 1<<62 {
+		return n
+	}
+	return 0
+}
+
+// parseSize parses a byte size such as 512M, 2G or 1048576
+func parseSize(s string) (int64, error) {
+	v := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B"), "I")
+	mult := int64(1)
+	if v != "" {
+		switch v[len(v)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult != 1 {
+			v = v[:len(v)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad size %q, expected bytes or a number with K, M or G", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// resource limits, from flags, the container, or the host
+var (
+	procs        = runtime.NumCPU()
+	memoryBudget int64 // bytes, 0 for unknown
+)
+
+// renderSlots bounds concurrent markdown renders, sized by applyLimits
+var renderSlots = make(chan struct{}, 2*runtime.NumCPU())
+
+// renderMemory is the memory assumed for one render when sizing the pool
+const renderMemory = 8 << 20
+
+// applyLimits sets GOMAXPROCS and sizes the render pool and shadow queue
+// from -procs and -memory-limit, or the cgroup limits of the container
+func applyLimits(cpus int, memory string) error {
+	if cpus <= 0 && os.Getenv("GOMAXPROCS") != "" {
+		cpus = runtime.GOMAXPROCS(0)
+	}
+	if cpus <= 0 {
+		if quota := cgroupCPUs(); quota > 0 {
+			cpus = int(math.Ceil(quota))
+		}
+	}
+	if cpus > 0 {
+		procs = cpus
+		runtime.GOMAXPROCS(procs)
+	}
+	if memory != "" {
+		n, err := parseSize(memory)
+		if err != nil {
+			return fmt.Errorf("-memory-limit: %v", err)
+		}
+		memoryBudget = n
+	} else {
+		memoryBudget = cgroupMemory()
+	}
+	renderSlots = make(chan struct{}, poolSize(2*procs, renderMemory))
+	shadowInflight = make(chan struct{}, poolSize(4*procs, 2*shadowLimit))
+	return nil
+}
+
+// cacheShare is the part of the memory budget a cache takes when its
+// size isn't given: an eighth each for -render-cache and -resize-cache
+const cacheShare = 8
+
+// cacheLimit returns the size of a cache: value when given, or its share
+// of the memory budget when there is one
+func cacheLimit(value string, given bool) (int64, error) {
+	if !given && memoryBudget > 0 {
+		return memoryBudget / cacheShare, nil
+	}
+	return parseSize(value)
+}
+
+// poolSize returns n, or fewer if n items of size bytes don't fit in half
+// the memory budget
+func poolSize(n int, size int64) int {
+	if memoryBudget > 0 {
+		if fit := int(memoryBudget / 2 / size); fit < n {
+			n = fit
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCgroupLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	old := cgroupRoot
+	defer func() { cgroupRoot = old }()
+	write := func(name, content string) {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+
+	// cgroup v1, no limits
+	cgroupRoot = filepath.Join(dir, "v1")
+	write("v1/cpu/cpu.cfs_quota_us", "-1\n")
+	write("v1/cpu/cpu.cfs_period_us", "100000\n")
+	write("v1/memory/memory.limit_in_bytes", "9223372036854771712\n")
+	if cpus, mem := cgroupCPUs(), cgroupMemory(); cpus != 0 || mem != 0 {
+		t.Log("Expected no limits, got:", cpus, mem)
+		t.Fail()
+	}
+	write("v1/cpu/cpu.cfs_quota_us", "150000\n")
+	write("v1/memory/memory.limit_in_bytes", "268435456\n")
+	if cpus, mem := cgroupCPUs(), cgroupMemory(); cpus != 1.5 || mem != 256<<20 {
+		t.Log("Expected 1.5 cpus and 256M, got:", cpus, mem)
+		t.Fail()
+	}
+
+	// cgroup v2
+	cgroupRoot = filepath.Join(dir, "v2")
+	write("v2/cpu.max", "max 100000\n")
+	write("v2/memory.max", "max\n")
+	if cpus, mem := cgroupCPUs(), cgroupMemory(); cpus != 0 || mem != 0 {
+		t.Log("Expected no limits, got:", cpus, mem)
+		t.Fail()
+	}
+	write("v2/cpu.max", "200000 100000\n")
+	write("v2/memory.max", "536870912\n")
+	if cpus, mem := cgroupCPUs(), cgroupMemory(); cpus != 2 || mem != 512<<20 {
+		t.Log("Expected 2 cpus and 512M, got:", cpus, mem)
+		t.Fail()
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{"1048576": 1 << 20, "512M": 512 << 20, "2GiB": 2 << 30, "1.5k": 1536, "64mb": 64 << 20} {
+		if got, err := parseSize(in); err != nil || got != want {
+			t.Logf("parseSize(%q): expected %d, got %d %v", in, want, got, err)
+			t.Fail()
+		}
+	}
+	for _, bad := range []string{"", "lots", "-1M", "M"} {
+		if _, err := parseSize(bad); err == nil {
+			t.Log("Expected an error for", bad)
+			t.Fail()
+		}
+	}
+}
+
+func TestPoolSize(t *testing.T) {
+	defer func() { memoryBudget = 0 }()
+	memoryBudget = 0
+	if n := poolSize(8, renderMemory); n != 8 {
+		t.Log("Expected 8 without a budget, got:", n)
+		t.Fail()
+	}
+	memoryBudget = 32 << 20
+	if n := poolSize(8, renderMemory); n != 2 {
+		t.Log("Expected 2 renders in 32M, got:", n)
+		t.Fail()
+	}
+	memoryBudget = 1 << 20
+	if n := poolSize(8, renderMemory); n != 1 {
+		t.Log("Expected at least 1, got:", n)
+		t.Fail()
+	}
+}
+
+func TestCacheLimit(t *testing.T) {
+	defer func() { memoryBudget = 0 }()
+	memoryBudget = 0
+	if n, _ := cacheLimit("32M", false); n != 32<<20 {
+		t.Log("Expected the flag default without a budget, got:", n)
+		t.Fail()
+	}
+	memoryBudget = 512 << 20
+	if n, _ := cacheLimit("32M", false); n != 64<<20 {
+		t.Log("Expected an eighth of 512M, got:", n)
+		t.Fail()
+	}
+	memoryBudget = 64 << 20
+	if n, _ := cacheLimit("32M", false); n != 8<<20 {
+		t.Log("Expected an eighth of 64M, got:", n)
+		t.Fail()
+	}
+	if n, _ := cacheLimit("1M", true); n != 1<<20 {
+		t.Log("Expected the size given, got:", n)
+		t.Fail()
+	}
+	if _, err := cacheLimit("lots", true); err == nil {
+		t.Log("Expected an error for a bad size")
+		t.Fail()
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"html"
+	"io/fs"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// links to markdown files in rendered markdown, with an optional #anchor
+var reMarkdownLink = regexp.MustCompile(`(<a\s[^>]*?href=")([^":#?]+\.md)([#?][^"]*)?"`)
+
+// pageURL is the root relative url a markdown file name is served at:
+// its directory for an index page, without .md with -pretty-urls
+func (h Handler) pageURL(name string) string {
+	switch {
+	case path.Base(name) == h.index():
+		name = strings.TrimSuffix(name, h.index())
+	case *prettyURLs:
+		name = strings.TrimSuffix(name, ".md")
+	}
+	return (&url.URL{Path: "/" + name}).String()
+}
+
+// pageLinks points relative and root relative links to markdown files in
+// the html rendered from the file name at the urls they are served at,
+// so './other.md' keeps working from '/guide/' and with -pretty-urls.
+// links to files that don't exist are left alone.
+func (h Handler) pageLinks(name string, md []byte) []byte {
+	return reMarkdownLink.ReplaceAllFunc(md, func(m []byte) []byte {
+		sub := reMarkdownLink.FindSubmatch(m)
+		target, err := url.PathUnescape(html.UnescapeString(string(sub[2])))
+		if err != nil || strings.HasPrefix(target, "//") {
+			return m
+		}
+		file := path.Join(path.Dir(name), target)
+		if strings.HasPrefix(target, "/") {
+			file = strings.TrimPrefix(path.Clean(target), "/")
+		}
+		if !fs.ValidPath(file) {
+			return m
+		}
+		if fi, err := fs.Stat(h.Root, file); err != nil || !fi.Mode().IsRegular() {
+			return m
+		}
+		return []byte(string(sub[1]) + html.EscapeString(h.pageURL(file)) + string(sub[3]) + `"`)
+	})
+}
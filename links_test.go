@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPageLinks(t *testing.T) {
+	h := Handler{Prefix: "/docs", Root: fstest.MapFS{
+		"index.md":            {Data: []byte("# Home\n")},
+		"guide/index.md":      {Data: []byte("# Guide\n[intro](./intro.md#setup), [home](../index.md), [up](/guide/index.md)\n")},
+		"guide/intro.md":      {Data: []byte("# Intro\n[next](next%20steps.md?raw), [gone](missing.md), [site](https://example.com/a.md), [out](../../etc/x.md)\n")},
+		"guide/next steps.md": {Data: []byte("# Next\n")},
+	}}
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		h.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+	defer func(on bool) { *prettyURLs = on }(*prettyURLs)
+	for _, pretty := range []bool{false, true} {
+		*prettyURLs = pretty
+		intro, next := "/docs/guide/intro.md#setup", "/docs/guide/next%20steps.md?raw"
+		if pretty {
+			intro, next = "/docs/guide/intro#setup", "/docs/guide/next%20steps?raw"
+		}
+		for path, want := range map[string][]string{
+			"/guide/":         {`href="` + intro + `"`, `href="/docs/"`, `href="/docs/guide/"`},
+			"/guide/intro.md": {`href="` + next + `"`, `href="missing.md"`, `href="https://example.com/a.md"`, `href="../../etc/x.md"`},
+		} {
+			_, body := get(path)
+			for _, w := range want {
+				if !strings.Contains(body, w) {
+					t.Logf("-pretty-urls=%v %s: expected %s in:\n%s", pretty, path, w, body)
+					t.Fail()
+				}
+			}
+		}
+		code, body := get("/guide/intro")
+		if pretty != (code == 200 && strings.Contains(body, "Intro</h1>")) {
+			t.Logf("-pretty-urls=%v: /guide/intro answered %d", pretty, code)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// listenFDs returns how many sockets systemd passed to this process
+func listenFDs() int {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return 0
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// activationListeners returns the sockets passed by systemd, if any.
+// the variables are unset so child processes don't inherit them.
+func activationListeners() ([]net.Listener, error) {
+	n := listenFDs()
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	var listeners []net.Listener
+	for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return nil, fmt.Errorf("systemd socket %d: %v", fd, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// limitListener accepts at most n connections at once, or any number for
+// n 0. more wait in the backlog of the socket until one is closed.
+func limitListener(ln net.Listener, n int) net.Listener {
+	if n <= 0 {
+		return ln
+	}
+	return &limitedListener{Listener: ln, slots: make(chan struct{}, n), done: make(chan struct{})}
+}
+
+// limitedListener is a listener with a slot for each open connection
+type limitedListener struct {
+	net.Listener
+	slots chan struct{}
+	done  chan struct{} // closed with the listener
+	once  sync.Once
+}
+
+func (l *limitedListener) Accept() (net.Conn, error) {
+	select {
+	case l.slots <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	return &limitedConn{Conn: c, release: func() { <-l.slots }}, nil
+}
+
+func (l *limitedListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitedConn gives back its slot when closed
+type limitedConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// addrList is the repeatable -http flag. the first value replaces the default.
+type addrList struct {
+	addrs []string
+	set   bool
+}
+
+func (a *addrList) String() string {
+	if a == nil {
+		return ""
+	}
+	return strings.Join(a.addrs, ",")
+}
+
+func (a *addrList) Set(value string) error {
+	if !a.set {
+		a.addrs, a.set = nil, true
+	}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		network, address := splitNetwork(v)
+		if network != "unix" {
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				return err
+			}
+		}
+		a.addrs = append(a.addrs, v)
+	}
+	return nil
+}
+
+// splitNetwork splits 'tcp4:addr', 'tcp6:addr', 'tcp:addr' or
+// 'unix:path' into network and address. plain addresses are tcp.
+func splitNetwork(addr string) (string, string) {
+	for _, network := range []string{"tcp4", "tcp6", "tcp", "unix"} {
+		if strings.HasPrefix(addr, network+":") {
+			return network, addr[len(network)+1:]
+		}
+	}
+	return "tcp", addr
+}
+
+// ephemeral reports whether the -http address asks for a free port, as
+// ':0' or '127.0.0.1:0' do
+func ephemeral(addr string) bool {
+	network, address := splitNetwork(addr)
+	_, port, err := net.SplitHostPort(address)
+	return network != "unix" && err == nil && port == "0"
+}
+
+// describeListener names the network and address actually bound, for the log
+func describeListener(addr string, ln net.Listener) string {
+	network, _ := splitNetwork(addr)
+	if addr == "" {
+		network = ln.Addr().Network()
+	}
+	if network == "tcp" {
+		// a wildcard tcp listener accepts ipv4 and ipv6
+		if a, ok := ln.Addr().(*net.TCPAddr); ok && a.IP.IsUnspecified() {
+			network = "tcp (dual-stack)"
+		}
+	}
+	return network + " " + ln.Addr().String()
+}
+
+// listen opens a listener for -http: a tcp address, optionally restricted to
+// ipv4 ('tcp4:') or ipv6 ('tcp6:'), or a unix socket ('unix:/path/to.sock')
+func listen(addr string) (net.Listener, error) {
+	network, sock := splitNetwork(addr)
+	if network != "unix" {
+		return net.Listen(network, sock)
+	}
+	mode, err := strconv.ParseUint(*socketMode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad -socket-mode %q: %v", *socketMode, err)
+	}
+
+	// a socket left behind by a crash, but never a regular file
+	if fi, err := os.Lstat(sock); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", sock)
+		}
+		if conn, err := net.Dial("unix", sock); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use", sock)
+		}
+		os.Remove(sock)
+	}
+
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(sock, os.FileMode(mode)); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
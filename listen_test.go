@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "markdownd.sock")
+
+	ln, err := listen("unix:" + sock)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if fi, err := os.Stat(sock); err != nil || fi.Mode().Perm() != 0660 {
+		t.Log("Expected socket with mode 0660, got:", fi.Mode(), err)
+		t.Fail()
+	}
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }))
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://markdownd/")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Log("Expected ok, got:", string(body))
+		t.Fail()
+	}
+
+	// a socket in use is not taken over
+	if _, err := listen("unix:" + sock); err == nil {
+		t.Log("Expected an error for a socket in use")
+		t.Fail()
+	}
+	client.Transport.(*http.Transport).CloseIdleConnections()
+	ln.Close()
+
+	// never replace a regular file
+	file := filepath.Join(dir, "file")
+	ioutil.WriteFile(file, []byte("keep"), 0644)
+	if _, err := listen("unix:" + file); err == nil {
+		t.Log("Expected an error for a regular file")
+		t.Fail()
+	}
+}
+
+func TestActivationListeners(t *testing.T) {
+	if os.Getenv("MARKDOWND_TEST_ACTIVATION") != "" {
+		// child: systemd would have set LISTEN_PID after forking
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		listeners, err := activationListeners()
+		if err != nil || len(listeners) != 1 || os.Getenv("LISTEN_FDS") != "" {
+			os.Exit(1)
+		}
+		conn, err := listeners[0].Accept()
+		if err != nil {
+			os.Exit(1)
+		}
+		conn.Write([]byte("activated"))
+		conn.Close()
+		os.Exit(0)
+	}
+
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "1")
+	if listeners, err := activationListeners(); err != nil || len(listeners) != 0 {
+		t.Log("Expected no listeners for another pid, got:", listeners, err)
+		t.Fail()
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer f.Close()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestActivationListeners$")
+	cmd.Env = append(os.Environ(), "MARKDOWND_TEST_ACTIVATION=1", "LISTEN_FDS=1")
+	cmd.ExtraFiles = []*os.File{f}
+	if err := cmd.Start(); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	b, _ := ioutil.ReadAll(conn)
+	conn.Close()
+	if err := cmd.Wait(); err != nil || string(b) != "activated" {
+		t.Log("Expected the child to answer on the inherited socket, got:", string(b), err)
+		t.Fail()
+	}
+}
+
+func TestAddrList(t *testing.T) {
+	a := addrList{addrs: []string{"127.0.0.1:8080"}}
+	if err := a.Set("tcp4:0.0.0.0:8080,tcp6:[::1]:8080"); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if err := a.Set("unix:/run/markdownd.sock"); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if got := a.String(); got != "tcp4:0.0.0.0:8080,tcp6:[::1]:8080,unix:/run/markdownd.sock" {
+		t.Log("Expected the default to be replaced, got:", got)
+		t.Fail()
+	}
+	if err := a.Set("8080"); err == nil {
+		t.Log("Expected an error for a port without ':'")
+		t.Fail()
+	}
+
+	ln, err := listen("tcp4:127.0.0.1:0")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer ln.Close()
+	if got := describeListener("tcp4:127.0.0.1:0", ln); got != "tcp4 "+ln.Addr().String() {
+		t.Log("Expected tcp4 listener, got:", got)
+		t.Fail()
+	}
+	if _, err := listen("tcp4:[::1]:0"); err == nil {
+		t.Log("Expected tcp4 to refuse an ipv6 address")
+		t.Fail()
+	}
+	for addr, expected := range map[string]bool{":0": true, "tcp4:127.0.0.1:0": true, "[::1]:0": true, ":8080": false, "unix:/run/0": false} {
+		if ephemeral(addr) != expected {
+			t.Logf("Expected ephemeral(%q) %v", addr, expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := limitListener(inner, 1)
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- c
+		}
+	}()
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+	first := <-accepted
+	select {
+	case <-accepted:
+		t.Log("accepted a second connection while the first is open")
+		t.Fail()
+	case <-time.After(100 * time.Millisecond):
+	}
+	// closing the first makes room for the second
+	first.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(time.Second):
+		t.Log("second connection not accepted")
+		t.Fail()
+	}
+	ln.Close()
+	if _, ok := <-accepted; ok {
+		t.Log("accepted after close")
+		t.Fail()
+	}
+}
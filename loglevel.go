@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// log levels, from the most detail to the least
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// logLevel is the least a line needs to be logged, from -log-level, -v
+// or -quiet. errors are always logged.
+var logLevel = levelInfo
+
+// parseLogLevel reads debug, info, warn or error
+func parseLogLevel(s string) (int, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) || (name == "warn" && strings.EqualFold(s, "warning")) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, use debug, info, warn or error", s)
+}
+
+// setLogLevel applies -log-level, or -v for debug and -quiet for warn when
+// it isn't given
+func setLogLevel() error {
+	given := false
+	flag.Visit(func(f *flag.Flag) { given = given || f.Name == "log-level" })
+	level, err := parseLogLevel(*logLevelName)
+	switch {
+	case err != nil:
+		return fmt.Errorf("-log-level: %v", err)
+	case !given && *verbose:
+		level = levelDebug
+	case !given && *quiet:
+		level = levelWarn
+	}
+	logLevel = level
+	return nil
+}
+
+// logAt logs v if level is logged
+func logAt(level int, v ...interface{}) {
+	if level >= logLevel {
+		logger.Println(v...)
+	}
+}
+
+// logfAt is logAt with a format
+func logfAt(level int, format string, v ...interface{}) {
+	if level >= logLevel {
+		logger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLogLevels(t *testing.T) {
+	for s, expected := range map[string]int{"debug": levelDebug, "INFO": levelInfo, "warning": levelWarn, "error": levelError} {
+		if level, err := parseLogLevel(s); err != nil || level != expected {
+			t.Logf("%s: expected %d, got %d %v", s, expected, level, err)
+			t.Fail()
+		}
+	}
+	if _, err := parseLogLevel("loud"); err == nil {
+		t.Log("expected an error for an unknown level")
+		t.Fail()
+	}
+
+	var b bytes.Buffer
+	defer func(level int, out io.Writer) { logLevel = level; logger.SetOutput(out) }(logLevel, logger.Writer())
+	logger.SetOutput(&b)
+	logLevel = levelWarn
+	logAt(levelInfo, "listening")
+	logreq("request-1 serving markdown")
+	logfAt(levelWarn, "%s: bad signature", "slack")
+	logger.Println("error reading file")
+	if s := b.String(); strings.Contains(s, "listening") || strings.Contains(s, "serving markdown") ||
+		!strings.Contains(s, "slack: bad signature") || !strings.Contains(s, "error reading file") {
+		t.Log("expected warnings and errors only, got:", s)
+		t.Fail()
+	}
+}
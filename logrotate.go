@@ -0,0 +1,219 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// logFile is a log file that rotates by size and age, and can be reopened
+// (after an external logrotate moved it away)
+type logFile struct {
+	path     string
+	maxSize  int64         // bytes, 0 for no limit
+	maxAge   time.Duration // 0 for no limit
+	keep     int           // rotated files to keep, 0 keeps all
+	keepFor  time.Duration // age of rotated files to keep, 0 for any
+	compress bool
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	created time.Time
+}
+
+// open log files, for reopening on SIGHUP
+var (
+	logFilesMu sync.Mutex
+	logFiles   []*logFile
+)
+
+func newLogFile(path string) (*logFile, error) {
+	l := &logFile{
+		path:     path,
+		maxSize:  *logMaxSize << 20,
+		maxAge:   *logMaxAge,
+		keep:     *logKeep,
+		keepFor:  *logRetention,
+		compress: *logCompress,
+	}
+	if l.keepFor > 0 && l.maxAge == 0 {
+		// old lines go a day at a time
+		l.maxAge = 24 * time.Hour
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	if l.keepFor > 0 {
+		go l.prune()
+	}
+	logFilesMu.Lock()
+	logFiles = append(logFiles, l)
+	logFilesMu.Unlock()
+	return l, nil
+}
+
+// open (re)opens the file. caller holds l.mu, or l is new
+func (l *logFile) open() error {
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0660)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if l.f != nil {
+		l.f.Close()
+	}
+	l.f = f
+	l.size = fi.Size()
+	l.created = time.Now()
+	return nil
+}
+
+func (l *logFile) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if (l.maxSize > 0 && l.size > 0 && l.size+int64(len(b)) > l.maxSize) ||
+		(l.maxAge > 0 && time.Since(l.created) > l.maxAge) {
+		if err := l.rotate(); err != nil {
+			// keep logging to the old file
+			os.Stderr.WriteString("error rotating log: " + err.Error() + "\n")
+		}
+	}
+	n, err := l.f.Write(b)
+	l.size += int64(n)
+	return n, err
+}
+
+// Reopen closes and opens the file again
+func (l *logFile) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.open()
+}
+
+// rotate moves the file aside with a timestamp and starts a new one.
+// caller holds l.mu
+func (l *logFile) rotate() error {
+	rotated := l.path + "." + time.Now().Format("20060102-150405")
+	if _, err := os.Stat(rotated); err == nil {
+		rotated += "." + strconv.Itoa(time.Now().Nanosecond())
+	}
+	l.f.Close()
+	if err := os.Rename(l.path, rotated); err != nil {
+		l.f = nil
+		if err2 := l.open(); err2 != nil {
+			return err2
+		}
+		return err
+	}
+	l.f = nil
+	if err := l.open(); err != nil {
+		return err
+	}
+	go func() {
+		if l.compress {
+			if err := gzipFile(rotated); err != nil {
+				os.Stderr.WriteString("error compressing log: " + err.Error() + "\n")
+			}
+		}
+		l.prune()
+	}()
+	return nil
+}
+
+// prune removes the oldest rotated files, keeping l.keep, and those last
+// written more than l.keepFor ago
+func (l *logFile) prune() {
+	if l.keep <= 0 && l.keepFor <= 0 {
+		return
+	}
+	matches, _ := filepath.Glob(l.path + ".*")
+	var rotated []string
+	for _, m := range matches {
+		// rotated files start with a timestamp, skip compressions in progress
+		if suffix := strings.TrimPrefix(m, l.path+"."); len(suffix) >= 15 && suffix[8] == '-' && !strings.HasSuffix(m, ".tmp") {
+			rotated = append(rotated, m)
+		}
+	}
+	sort.Strings(rotated)
+	if l.keepFor > 0 {
+		kept := rotated[:0]
+		for _, m := range rotated {
+			if fi, err := os.Stat(m); err == nil && time.Since(fi.ModTime()) > l.keepFor {
+				os.Remove(m)
+				continue
+			}
+			kept = append(kept, m)
+		}
+		rotated = kept
+	}
+	if l.keep <= 0 || len(rotated) <= l.keep {
+		return
+	}
+	for _, old := range rotated[:len(rotated)-l.keep] {
+		os.Remove(old)
+	}
+}
+
+// gzipFile compresses filename to filename.gz and removes it
+func gzipFile(filename string) error {
+	in, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := filename + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		return err
+	}
+	z := gzip.NewWriter(out)
+	if _, err := io.Copy(z, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := z.Close(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filename+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(filename)
+}
+
+// reopenLogsOnHangup reopens log files on SIGHUP
+func reopenLogsOnHangup() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			logFilesMu.Lock()
+			for _, l := range logFiles {
+				if err := l.Reopen(); err != nil {
+					os.Stderr.WriteString("error reopening log: " + err.Error() + "\n")
+				}
+			}
+			logFilesMu.Unlock()
+			logAt(levelInfo, "reopened log files")
+		}
+	}()
+}
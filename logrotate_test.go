@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "md.log")
+	l := &logFile{path: path, maxSize: 10, keep: 1}
+	if err := l.open(); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	l.Write([]byte("0123456789"))
+	l.Write([]byte("abc\n"))      // rotates
+	l.Write([]byte("0123456789")) // rotates again, prunes the first
+
+	// prune runs in the background
+	var rotated []string
+	for i := 0; i < 50; i++ {
+		rotated, _ = filepath.Glob(path + ".*")
+		if len(rotated) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(rotated) != 1 {
+		t.Log("Expected 1 rotated file, got:", rotated)
+		t.FailNow()
+	}
+	b, _ := ioutil.ReadFile(rotated[0])
+	if string(b) != "abc\n" {
+		t.Logf("Expected rotated file to have %q, got %q", "abc\n", string(b))
+		t.FailNow()
+	}
+
+	// reopen after the file was moved away
+	os.Rename(path, path+".moved")
+	l.Reopen()
+	l.Write([]byte("new\n"))
+	b, _ = ioutil.ReadFile(path)
+	if !strings.HasSuffix(string(b), "new\n") {
+		t.Log("Expected reopened file to have the new line, got:", string(b))
+		t.FailNow()
+	}
+}
+
+func TestLogRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "md.log")
+	old, recent := path+".20260101-000000", path+".20260301-000000.gz"
+	for _, name := range []string{path, old, recent} {
+		ioutil.WriteFile(name, []byte("line\n"), 0600)
+	}
+	month := time.Now().Add(-31 * 24 * time.Hour)
+	os.Chtimes(old, month, month)
+
+	l := &logFile{path: path, keepFor: 30 * 24 * time.Hour}
+	l.prune()
+	if _, err := os.Stat(old); err == nil {
+		t.Log("Expected the rotated file past -log-retention to be removed")
+		t.Fail()
+	}
+	for _, name := range []string{path, recent} {
+		if _, err := os.Stat(name); err != nil {
+			t.Log("Expected to keep", name)
+			t.Fail()
+		}
+	}
+}
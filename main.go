@@ -26,40 +26,183 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
+	"math"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/russross/blackfriday"
-	"github.com/shurcool/github_flavored_markdown"
+	"github.com/aerth/markdownd/pkg/markdownd"
 	"github.com/sourcegraph/syntaxhighlight"
 )
 
 // flags
 var (
-	addr          = flag.String("http", "127.0.0.1:8080", "address to listen on format 'address:port',\n\tif address is omitted will listen on all interfaces")
-	logfile       = flag.String("log", os.Stderr.Name(), "redirect logs to this file")
-	indexPage     = flag.String("index", "index.md", "filename to use for paths ending in '/',\n\ttry something like '-index=README.md' or '-index=gen' to generate a simple one.")
-	header        = flag.String("header", "", "html header filename for markdown requests")
-	footer        = flag.String("footer", "", "html footer filename for markdown requests")
-	toc           = flag.Bool("toc", false, "generate table of contents at the top of each markdown page")
-	plain         = flag.Bool("plain", false, "disable github flavored markdown")
-	syntaxEnabled = flag.Bool("syntax", false, "highlight syntax in .html")
+	configPath     = flag.String("config", "", "read flags from a toml file, 'log-level = \"warn\"', with [[mount]], [[vhost]]\n\tand [[cache-control]] tables and the directory to serve (flags given win)")
+	socketMode     = flag.String("socket-mode", "0660", "permissions of the -http unix socket")
+	logfile        = flag.String("log", os.Stderr.Name(), "redirect logs to this file")
+	logFormat      = flag.String("log-format", "text", "request log format: text, json (one object per request),\n\tor combined (apache/ncsa combined access log)")
+	logMaxSize     = flag.Int64("log-max-size", 0, "rotate log files larger than this many megabytes (0 = never)")
+	logMaxAge      = flag.Duration("log-max-age", 0, "rotate log files older than this, such as '24h' (0 = never)")
+	logKeep        = flag.Int("log-keep", 0, "number of rotated log files to keep (0 = all)")
+	logCompress    = flag.Bool("log-compress", false, "gzip rotated log files")
+	logRetention   = flag.Duration("log-retention", 0, "remove rotated log files older than this, such as '720h', and rotate daily\n\tunless -log-max-age is set (0 = keep)")
+	logIP          = flag.String("log-ip", "full", "client addresses in logs: full, truncate (ipv4 to /24, ipv6 to /48),\n\thash (with a salt changed daily) or none")
+	logUA          = flag.Bool("log-user-agent", true, "log user agents")
+	gdpr           = flag.Bool("gdpr", false, "log with privacy defaults: -log-ip truncate -log-user-agent=false -log-retention 720h,\n\tfor those not given")
+	accessLogfile  = flag.String("access-log", "", "write json or combined access logs to this file instead of -log")
+	indexPage      = flag.String("index", "index.md", "filename to use for paths ending in '/',\n\ttry something like '-index=README.md' or '-index=gen' to generate a simple one.")
+	header         = flag.String("header", "", "html header filename for markdown requests")
+	footer         = flag.String("footer", "", "html footer filename for markdown requests")
+	pageTemplate   = flag.String("template", "", "html/template file for markdown requests, instead of -header and -footer,\n\twith {{.Title}}, {{.Content}}, {{.Page.name}} front matter and {{.Site.name}} variables\n\t(the nearest _layout.html in a page's directory or above is used instead)")
+	varsFile       = flag.String("vars", "", "json file of site variables for -template, such as {\"version\": \"2.1\"}")
+	autoCache      = flag.Duration("auto-cache", 0, "cache pages for a tenth of the time since they changed, up to this max-age, such as '24h'\n\t(front matter expires or review dates cap it, 0 = only those)")
+	prettyURLs     = flag.Bool("pretty-urls", false, "serve guide/intro.md at /guide/intro too, and link pages there")
+	toc            = flag.Bool("toc", false, "generate table of contents at the top of each markdown page")
+	copyCode       = flag.Bool("copy-code", false, "add copy buttons to code blocks, and styles for highlighted lines,\n\tto every page (layouts can use {{component \"code\"}} instead)")
+	tagPages       = flag.Bool("tags", false, "serve /tags/ and /tags/<tag>/ listing pages from front matter tags, and /categories/ from categories")
+	pdfHeader      = flag.String("pdf-header", "", "running header of ?format=pdf pages, with {title}, {section} (the page title), {page}, {pages}\n\tand {date} (front matter 'pdf_header' overrides it, 'none' for none)")
+	pdfFooter      = flag.String("pdf-footer", "", "running footer of ?format=pdf pages, such as '{page} / {pages}' (front matter 'pdf_footer')")
+	pdfCover       = flag.String("pdf-cover", "", "cover page of ?format=pdf documents: 'title' for the title, subtitle and date, or a markdown\n\tfile with {title}, {subtitle} and {date} (front matter 'pdf_cover: true' or false)")
+	openapi        = flag.String("openapi", "", "show openapi.yaml and swagger.json documents to browsers with 'redoc' or 'swagger' ui (?raw for the file)")
+	openapiAssets  = flag.String("openapi-assets", "", "directory holding the "+redocPackage+" and "+swaggerUIPackage+" packages for -openapi,\n\tserved from "+openAPIAssetsPrefix+", or their base url, such as https://cdn.jsdelivr.net/npm")
+	drafts         = flag.Bool("drafts", false, "serve drafts: pages with 'draft: true' front matter and files under _drafts/ (404 otherwise)")
+	wiki           = flag.Bool("wiki", false, "resolve [[Page Name]] wiki links against the served pages, as in an obsidian vault")
+	plain          = flag.Bool("plain", false, "disable github flavored markdown")
+	noInlineHTML   = flag.Bool("no-inline-html", false, "strip html embedded in markdown (rendered html is always sanitized)")
+	syntaxEnabled  = flag.Bool("syntax", false, "highlight syntax in .html")
+	jsonld         = flag.Bool("jsonld", false, "emit schema.org JSON-LD (Article, BreadcrumbList) in markdown pages")
+	analytics      = flag.String("analytics", "", "inject analytics snippet in markdown pages: plausible, matomo, or ga\n\tpages can opt out with 'analytics: false' front matter")
+	analyticsID    = flag.String("analytics-id", "", "analytics site id (plausible domain, matomo site id, ga measurement id)")
+	analyticsURL   = flag.String("analytics-url", "", "analytics server url (matomo, self-hosted plausible)")
+	consent        = flag.Bool("consent", false, "ask visitors for consent before running analytics")
+	stats          = flag.Bool("stats", false, "serve json statistics (pageviews, cookie-free visitor estimate) at /_markdownd/stats")
+	watch          = flag.Bool("watch", false, "serve change notifications (long polling) at /_markdownd/api/watch?path=&since=")
+	changes        = flag.Bool("changes", false, "keep the previous rendering of pages and show what changed at /_markdownd/api/changed/<path>")
+	health         = flag.Bool("health", true, "serve /healthz and /readyz for load balancer and kubernetes probes")
+	metricsEnabled = flag.Bool("metrics", false, "serve prometheus metrics at /_markdownd/metrics,\n\tand json for 'markdownd top' at /_markdownd/status")
+	searchEnabled  = flag.Bool("search", false, "serve json full text search at /_markdownd/search?q=")
+	graphql        = flag.Bool("graphql", false, "answer graphql queries over pages, tags, front matter and links at /_markdownd/graphql")
+	graph          = flag.Bool("graph", false, "serve the link graph of pages as json at /_markdownd/graph,\n\tand draw it at /_markdownd/graph.html")
+	editorAPI      = flag.Bool("editor-api", false, "serve link resolution, link targets, front matter checks and previews\n\tfor editor plugins at /_markdownd/api/")
+	rate           = flag.Float64("rate", 0, "limit each client ip to this many requests per second (0 = unlimited)")
+	burst          = flag.Int("burst", 0, "allow bursts of this many requests per client ip (default: -rate)")
+	bandwidthAll   = flag.String("bandwidth", "0", "send responses at this many bytes per second in total, such as 10M (0 = unlimited;\n\traise -write-timeout for large files)")
+	bandwidthIP    = flag.String("bandwidth-ip", "0", "send responses at this many bytes per second to each client ip, such as 1M (0 = unlimited)")
+	quotaAll       = flag.String("quota", "0", "bytes sent in total each day (UTC), such as 20G, then answer 509 (0 = unlimited)")
+	quotaIP        = flag.String("quota-ip", "0", "bytes sent to each client ip each day (UTC), such as 1G, then answer 429 (0 = unlimited)")
+	frameOptions   = flag.String("frame-options", "DENY", "X-Frame-Options header (DENY, SAMEORIGIN, or none)")
+	csp            = flag.String("csp", "", "Content-Security-Policy header")
+	hsts           = flag.String("hsts", "", "Strict-Transport-Security header, such as 'max-age=31536000'")
+	referrerPolicy = flag.String("referrer-policy", "", "Referrer-Policy header, such as 'no-referrer'")
+	nosniff        = flag.Bool("nosniff", false, "send 'X-Content-Type-Options: nosniff'")
+	og             = flag.Bool("og", false, "emit Open Graph meta tags in markdown pages (link unfurls)")
+	twitterSite    = flag.String("twitter-site", "", "twitter @account of the site, for -og twitter cards")
+	siteName       = flag.String("site-name", "", "site name for Open Graph and structured data")
+	environment    = flag.String("environment", "", "name of this deployment, such as staging, shown by the {{< env >}} shortcode\n\t(default from $MARKDOWND_ENV)")
+	slackSecret    = flag.String("slack-secret", "", "slack signing secret, enables the events api at /_markdownd/slack/events\n\tand slash commands at /_markdownd/slack/command\n\t(default from $SLACK_SIGNING_SECRET)")
+	slackToken     = flag.String("slack-token", "", "slack bot token for chat.unfurl (default from $SLACK_BOT_TOKEN)")
+	geminiAddr     = flag.String("gemini", "", "also serve gemini:// (gemtext) on this address, such as :1965")
+	geminiCert     = flag.String("gemini-cert", "", "gemini tls certificate file (default: self-signed)")
+	geminiKey      = flag.String("gemini-key", "", "gemini tls key file")
+	readTimeout    = flag.Duration("read-timeout", 5*time.Second, "time limit for reading a request with its body (0 = none)")
+	headerTimeout  = flag.Duration("header-timeout", 5*time.Second, "time limit for reading the headers of a request (0 = -read-timeout)")
+	writeTimeout   = flag.Duration("write-timeout", 5*time.Second, "time limit for writing a response, from the end of its request headers (0 = none)")
+	idleTimeout    = flag.Duration("idle-timeout", 30*time.Second, "how long an idle keep-alive connection waits for its next request (0 = -read-timeout)")
+	keepAlives     = flag.Bool("keep-alives", true, "reuse connections for more requests, such as the css and images of a page")
+	maxHeaderBytes = flag.String("max-header-size", "1K", "largest request headers accepted, such as 1K or 16K")
+	maxConns       = flag.Int("max-conns", 0, "connections served at once, idle keep-alive ones too, more wait to be accepted (0 = no limit)")
+	shutdownWait   = flag.Duration("shutdown-timeout", 10*time.Second, "on SIGINT or SIGTERM, wait this long for requests in flight")
+	drainTime      = flag.Duration("drain-time", 0, "on SIGINT or SIGTERM, fail /readyz and keep serving this long before shutting down\n\t(drain any time with 'curl -X POST' to /_markdownd/drain on the -admin address)")
+	gopherAddr     = flag.String("gopher", "", "also serve gopher (directory menus, markdown as plain text) on this address, such as :70")
+	gopherHost     = flag.String("gopher-host", "", "host name in gopher menus (default: hostname)")
+	shadow         = flag.String("shadow", "", "mirror a sample of GET requests to another markdownd, such as http://127.0.0.1:8081,\n\tand log where its responses differ")
+	shadowRate     = flag.Float64("shadow-rate", 0.1, "fraction of requests to mirror with -shadow")
+	consulAgent    = flag.String("consul", "", "register in consul with this agent, such as http://127.0.0.1:8500,\n\tand deregister on shutdown (token from $CONSUL_HTTP_TOKEN)")
+	consulName     = flag.String("consul-service", "markdownd", "service name to register in consul")
+	prefix         = flag.String("prefix", "", "serve under this url path, such as /docs, behind a reverse proxy's 'location /docs/'")
+	canonicalURL   = flag.String("canonical", "", "public url of the site, such as https://docs.example.com, for <link rel=\"canonical\">,\n\tOpen Graph and JSON-LD urls wherever the pages are served")
+	vhostFile      = flag.String("vhosts", "", "file of -vhost entries, one per line")
+	schemaFile     = flag.String("schemas", "", "json file of front matter schemas by content type, such as\n\t{\"runbook\": {\"required\": [\"owner\", \"severity\"]}} for pages with 'type: runbook'")
+	maxProcs       = flag.Int("procs", 0, "cpus to use (default: the container cpu quota, $GOMAXPROCS, or all)")
+	memoryLimit    = flag.String("memory-limit", "", "memory to size pools for, such as 512M (default: the container memory limit)")
+	rendererCmd    = flag.String("renderer-cmd", "", "render markdown with this command instead, such as 'pandoc -f markdown -t html'\n\t(markdown on stdin, html on stdout; falls back to the built-in renderer on errors)")
+	rendererWait   = flag.Duration("renderer-timeout", 10*time.Second, "time limit for each -renderer-cmd run")
+	rendererMax    = flag.String("renderer-max", "8M", "largest html -renderer-cmd may output")
+	maxRender      = flag.String("max-render-size", "16M", "markdown files larger than this are served raw instead of rendered (0 = no limit)")
+	renderCache    = flag.String("render-cache", "32M", "memory for keeping rendered pages until their markdown changes (0 = off)\n\t(with -memory-limit or a container memory limit, the default is an eighth of it)")
+	preloadPages   = flag.Bool("preload", false, "render every page into the render cache at startup, logging front matter problems\n\t(/readyz waits for it)")
+	resizeImages   = flag.Bool("resize", false, "serve png and jpeg images scaled down for ?w= and ?h= (pixels)")
+	resizeCache    = flag.String("resize-cache", "64M", "memory for keeping -resize images\n\t(with -memory-limit or a container memory limit, the default is an eighth of it)")
+	pluginWait     = flag.Duration("plugin-timeout", 10*time.Second, "time limit for each run of a -plugin process")
+	quiet          = flag.Bool("quiet", false, "print nothing at startup, and log only warnings and errors (-log-level warn)")
+	verbose        = flag.Bool("v", false, "log the details of every request (-log-level debug)")
+	logLevelName   = flag.String("log-level", "info", "log debug (details of every request), info (a line per request),\n\twarn or error lines")
+	configWatch    = flag.Bool("config-watch", false, "reload when the -config file changes, as on SIGHUP")
+	selftestRun    = flag.Bool("selftest", false, "once listening, request every page over http, logging errors and slow pages,\n\tand exit 1 if one fails (/readyz waits for it)")
+	selftestSlow   = flag.Duration("selftest-slow", time.Second, "pages answering slower than this are logged by -selftest (0 = none)")
+	openURL        = flag.Bool("open", false, "open the site in the default browser once listening")
+	showVersion    = flag.Bool("version", false, "print the version, commit, build date and renderer, and exit")
+	versionHeader  = flag.Bool("version-header", true, "send the version in an X-Markdownd-Version header (and the Server header)")
+	startupJSON    = flag.Bool("startup-json", false, "print one json line to stdout once listening (version, pid, root, addrs, features)")
+	pprofAddr      = flag.String("pprof", "", "serve net/http/pprof on this address, such as 127.0.0.1:6060")
+	adminAddr      = flag.String("admin", "", "serve POST and DELETE /_markdownd/drain on this address, such as 127.0.0.1:8079\n\tor unix:/run/markdownd-admin.sock, never behind the proxy")
+	token          = flag.String("token", "", "require 'Authorization: Bearer <token>' on every request\n\t(default from $MARKDOWND_TOKEN, or read from 'file:/run/secrets/token' or '${ENV}')")
 )
 
+// repeatable flags
+var (
+	allowList cidrList
+	denyList  cidrList
+	proxies   proxyList
+	httpAddrs = addrList{addrs: []string{"127.0.0.1:8080"}}
+	mounts    mountList
+	vhosts    vhostList
+	rollouts  featureList
+	admins    cidrList
+	plugins   pluginList
+)
+
+func init() {
+	flag.Var(&httpAddrs, "http", "address to listen on format 'address:port' (comma separated or repeated),\n\tif address is omitted will listen on all interfaces (ipv4 and ipv6),\n\t'tcp4:' or 'tcp6:' before the address restricts it to one family,\n\tor a unix socket 'unix:/run/markdownd.sock'")
+	flag.Var(&mounts, "mount", "also serve a directory under a url prefix, '/wiki=./wiki' (repeatable)")
+	flag.Var(siteVars, "var", "set a site variable for -template, 'name=value' (repeatable, overrides -vars)")
+	flag.Var(&vhosts, "vhost", "serve a directory for a host name, 'docs.example.com=./docs',\n\toptionally with ',index=README.md', ',header=file', ',footer=file', ',template=file',\n\t',canonical=https://docs.example.com', ',rewrite=from=to',\n\t',analytics=plausible|matomo|ga|none', ',analytics-id=id', ',analytics-url=url' (repeatable)")
+	flag.Var(&linkRewrites, "rewrite-link", "replace the start of absolute links in pages, such as\n\t'https://wiki.internal.corp/=https://wiki.example.com/' (repeatable)")
+	flag.Var(&allowList, "allow", "only serve clients in these CIDR ranges (comma separated or repeated)")
+	flag.Var(&denyList, "deny", "refuse clients in these CIDR ranges (comma separated or repeated)")
+	flag.Var(&rollouts, "feature", "enable a feature, 'name', for a percentage of clients 'name=10%',\n\tor on one host 'name@docs.example.com' (repeatable), features: "+strings.Join(featureNames(), ", "))
+	flag.Var(&admins, "feature-admin", "clients in these CIDR ranges may override features per request\n\twith 'X-Markdownd-Features: name,-other'")
+	flag.Var(&plugins, "plugin", "transform or render markdown with a go plugin 'links.so', exporting Transform or Render,\n\tor a command reading a json page on stdin and writing json on stdout (repeatable, run in order)")
+	flag.Var(&forms, "form", "accept a form of the pages, '{{< form feedback >}}', appending what is sent\n\tto a file 'feedback=file:feedback.jsonl' or passing it as json to a command\n\t'calc=./calc.sh' whose markdown output is shown (repeatable)")
+	flag.Var(&earlyAccess, "early-access", "a group reading pages before their 'embargo_until' time: clients in a network\n\t'staff=10.0.0.0/8', or holding a token 'press=file:/run/secrets/press' sent as a bearer token\n\tor once as ?access= (repeatable, 'embargo_groups' front matter picks groups)")
+	flag.Var(&cacheRules, "cache-control", "set Cache-Control for files matching a pattern, '*.png=max-age=31536000, immutable',\n\t'/blog/=max-age=300' or '/api/*.json=no-store' (repeatable, first match wins,\n\t'cache' front matter wins for pages)")
+	flag.Var(&proxies, "trust-proxy", "use X-Forwarded-For and X-Real-IP from proxies on loopback,\n\tor in these CIDR ranges with '-trust-proxy=10.0.0.0/8' (comma separated or repeated)")
+}
+
+// per ip rate limiter, if -rate is set
+var limiter *rateLimiter
+
 // log to file
 var logger = log.New(os.Stderr, "[markdownd] ", log.LstdFlags)
 
-const version = "0.0.12"
-const sig = "[markdownd v" + version + "] https://github.com/aerth/markdownd"
-const serverheader = "markdownd/" + version
+var sig = "[markdownd v" + version + "] https://github.com/aerth/markdownd"
+var serverheader = "markdownd/" + version
+
 const usage = `
 USAGE
 
@@ -70,25 +213,95 @@ EXAMPLES
 Serve current directory on 127.0.0.1:8080:
 	markdownd .
 
+Preview a folder in the default browser:
+	markdownd -open notes
+
+Serve on a free port, printing its url:
+	markdownd -quiet -http 127.0.0.1:0 notes
+
 Serve current directory on all interfaces, port 8080, log to stderr:
 	markdownd -log /dev/stderr -http 0.0.0.0:8080 .
 
 Serve 'docs' directory on port 8081, log to 'md.log':
 	markdownd -log md.log -http :8081 docs
 
+Serve 'docs', keeping 30 days of logs without personal data in 'md.log':
+	markdownd -gdpr -log md.log docs
+
+Serve with the flags, mounts and vhosts in 'markdownd.toml', overriding one:
+	markdownd -config markdownd.toml -log-level debug
+
+Serve from the environment of a container or systemd unit, every flag
+has one, $MARKDOWND_LOG_LEVEL for -log-level:
+	MARKDOWND_ROOT=/srv/docs MARKDOWND_HTTP=:8080 markdownd
+
 Serve docs with header, footer, and table of contents. Disable Logs:
 	markdownd -log none -header bar.html -footer foo.html -toc docs
 
+Serve docs through an html/template page, with site variables:
+	markdownd -template page.html -vars site.json -var version=2.1 docs
+
+Render the pages listed in docs/SUMMARY.md into one pdf (or docx):
+	markdownd pdf -o manual.pdf docs/SUMMARY.md
+
+With page numbers and a cover page:
+	markdownd pdf -footer '{page} / {pages}' -cover title -o manual.pdf docs/SUMMARY.md
+
+Push rendered docs into a confluence space:
+	markdownd confluence -url https://example.atlassian.net/wiki -space DOCS -user me@example.com docs
+
+Install as a systemd (or launchd on macos) service serving docs on port 8080:
+	markdownd service install -http :8080 docs
+
+Check flags and files before deploying, or list every option and its value:
+	markdownd config validate -http :8080 -header head.html docs
+	markdownd config explain -http :8080 docs
+
+Start a new site from a starter layout and pages, and serve it:
+	markdownd init mysite -http 127.0.0.1:8080
+
+Check links, wiki links and #anchors in CI, and external links too:
+	markdownd check -external docs
+
+Request every page once listening, exiting 1 if one fails:
+	markdownd -selftest -http :8080 docs
+
+Check a header and footer against edge cases, unicode names and deep nesting:
+	markdownd gen-fixture /tmp/site && markdownd -header head.html -footer foot.html /tmp/site
+
+Watch requests, slow pages and errors of a markdownd running with -metrics:
+	markdownd top http://127.0.0.1:8080
+
 Serve docs only on localhost:
 	markdownd -http 127.0.0.1:8080 docs
+
+Keep what readers send with the {{< form feedback >}} of the pages:
+	markdownd -form feedback=file:/var/lib/markdownd/feedback.jsonl docs
+
+Serve docs on all interfaces, only to the office network:
+	markdownd -http :8080 -allow 10.0.0.0/8 docs
+
+Serve two directories under /docs/ and /wiki/:
+	markdownd -mount /docs=./docs -mount /wiki=./wiki
+
+Serve docs behind a reverse proxy at /docs/ (nginx 'location /docs/'):
+	markdownd -prefix /docs docs
+
+Serve two host names from different directories on one listener:
+	markdownd -vhost docs.example.com=./docs -vhost wiki.example.com=./wiki,index=home.md
+
+Serve docs on ipv4 localhost and every ipv6 address:
+	markdownd -http tcp4:127.0.0.1:8080 -http tcp6:[::]:8080 docs
+
+Serve docs on a unix socket for nginx or caddy:
+	markdownd -http unix:/run/markdownd.sock -socket-mode 0660 docs
 FLAGS
 `
 
 // redefine flag Usage
 func init() {
 	flag.Usage = func() {
-		fmt.Println(usage)
-		//fmt.Println("FLAGS")
+		fmt.Print(usage)
 		flag.PrintDefaults()
 	}
 	rand.Seed(time.Now().UnixNano())
@@ -96,94 +309,408 @@ func init() {
 
 // Handler handles markdown requests
 type Handler struct {
-	Root           http.FileSystem // directory to serve
-	RootString     string          // keep directory name for comparing prefix
-	header, footer []byte          // for not-raw markdown requests
+	Root           fs.FS              // files to serve, os.DirFS(RootString) or embedded
+	RootString     string             // directory of Root on disk, "" if it has none
+	header, footer []byte             // for not-raw markdown requests
+	template       *template.Template // page template, instead of header and footer
+	analytics      []byte             // analytics snippet for markdown requests
+	Prefix         string             // url path the directory is mounted at, "" for /
+	Index          string             // index page, "" for -index
+	canonical      string             // public scheme://host of the pages, "" for the one requested
+	rewrites       []linkRewrite      // absolute links replaced in pages
+
+	before      []markdownd.RequestHook // run once a request is authorized
+	afterRender []markdownd.RenderHook  // change the html of rendered pages
+	onError     markdownd.ErrorHandler  // answers missing files, nil for http.NotFound
+}
+
+// notFound answers a request for a missing or hidden file with onError,
+// or http.NotFound
+func (h Handler) notFound(w http.ResponseWriter, r *http.Request) {
+	if h.onError != nil {
+		h.onError(w, r, http.StatusNotFound, &fs.PathError{Op: "open", Path: r.URL.Path, Err: fs.ErrNotExist})
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// index returns the index page for paths ending in '/', or "gen"
+func (h Handler) index() string {
+	if h.Index != "" {
+		return h.Index
+	}
+	return *indexPage
+}
+
+// subcommands, run as 'markdownd <command> [flags]'
+var commands = map[string]func(args []string){
+	"pdf":         exportCommand("pdf"),
+	"docx":        exportCommand("docx"),
+	"confluence":  confluenceCommand,
+	"service":     serviceCommand,
+	"top":         topCommand,
+	"config":      configCommand,
+	"gen-fixture": fixtureCommand,
+	"init":        initCommand,
+	"check":       checkCommand,
 }
 
 // markdown command
 func main() {
-	fmt.Println(sig)
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
 	flag.Parse()
-	serve(flag.Args())
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	_, _, dir, err := loadSettings(flag.CommandLine, given)
+	if err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	if *showVersion {
+		printVersion(os.Stdout)
+		return
+	}
+	if !*quiet && !*startupJSON {
+		fmt.Println(sig)
+	}
+	args := flag.Args()
+	if len(args) == 0 && dir != "" {
+		args = []string{dir}
+	}
+	serve(args)
 }
 
 func serve(args []string) {
-	// need only 1 argument, the directory to serve
-	if len(args) != 1 {
+	if err := setLogLevel(); err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	if err := setLogPrivacy(); err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	if *vhostFile != "" {
+		if err := vhosts.readFile(*vhostFile); err != nil {
+			println(err.Error())
+			os.Exit(111)
+		}
+	}
+
+	// need only 1 argument, the directory to serve (or none with -mount or -vhost)
+	if len(args) > 1 || (len(args) == 0 && len(mounts) == 0 && len(vhosts) == 0) {
 		flag.Usage()
 		os.Exit(111)
 		return
 	}
 
-	// get absolute path of flag.Arg(0)
-	dir := flag.Arg(0)
-	dir = prepareDirectory(dir)
+	// new markdown handler
+	mdhandler := &Handler{afterRender: []markdownd.RenderHook{lazyImagesHook}}
+
+	// get absolute path of the directory
+	if len(args) == 1 {
+		dir := prepareDirectory(args[0])
+
+		if err := checkRoot(dir); err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err)
+		}
+
+		if *indexPage != "gen" {
+			_, err := os.Stat(dir + *indexPage)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %q not found, did you forget '-index' flag?\n", *indexPage)
+			}
+		}
+
+		mdhandler.Root, mdhandler.RootString = os.DirFS(dir), dir
+	}
+
+	if err := applyLimits(*maxProcs, *memoryLimit); err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	if memoryBudget > 0 {
+		status("limits:", procs, "cpus,", memoryBudget>>20, "MiB memory")
+	} else {
+		status("limits:", procs, "cpus")
+	}
+
+	if n, err := parseSize(*maxRender); err != nil {
+		println("-max-render-size:", err.Error())
+		os.Exit(111)
+	} else {
+		renderLimit = n
+	}
 
-	if *indexPage != "gen" {
-		_, err := os.Stat(dir + *indexPage)
+	// caches not given a size take theirs from the memory budget
+	sized := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { sized[f.Name] = true })
+	if n, err := cacheLimit(*renderCache, sized["render-cache"]); err != nil {
+		println("-render-cache:", err.Error())
+		os.Exit(111)
+	} else {
+		renders.setLimit(n)
+	}
+
+	if *resizeImages {
+		n, err := cacheLimit(*resizeCache, sized["resize-cache"])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "warning: %q not found, did you forget '-index' flag?\n", *indexPage)
+			println("-resize-cache:", err.Error())
+			os.Exit(111)
 		}
+		resizedImages.setLimit(n)
 	}
 
-	// new markdown handler
-	mdhandler := &Handler{
-		Root:       http.Dir(dir),
-		RootString: dir,
+	if *rendererCmd != "" {
+		n, err := parseSize(*rendererMax)
+		if err != nil {
+			println("-renderer-max:", err.Error())
+			os.Exit(111)
+		}
+		rendererLimit = n
+		if args := strings.Fields(*rendererCmd); len(args) == 0 {
+			println("-renderer-cmd: empty command")
+			os.Exit(111)
+		} else if _, err := exec.LookPath(args[0]); err != nil {
+			println("warning:", err.Error())
+		}
+		status("renderer:", *rendererCmd)
+	}
+	if *openapi != "" {
+		if err := setOpenAPIAssets(*openapiAssets); err != nil {
+			println(err.Error())
+			os.Exit(111)
+		}
+	}
+	if err := loadPlugins(plugins, *pluginWait); err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	for _, p := range pagePlugins {
+		status("plugin:", p.name)
+	}
+
+	if p, err := cleanPrefix(*prefix); err != nil {
+		println(err.Error())
+		os.Exit(111)
+	} else if p != "" {
+		mdhandler.Prefix = p
+		status("url prefix:", p+"/")
+	}
+
+	if n, err := bandwidthSizes(); err != nil {
+		println(err.Error())
+		os.Exit(111)
+	} else if n != [4]int64{} {
+		shaper = newBandwidthShaper(n[0], n[1], n[2], n[3])
+		status("bandwidth:", fmt.Sprintf("%s/s in total, %s/s per ip, daily quota %s in total, %s per ip (0 = unlimited)", *bandwidthAll, *bandwidthIP, *quotaAll, *quotaIP))
+	}
+
+	if *canonicalURL != "" {
+		u, err := parseCanonical(*canonicalURL)
+		if err != nil {
+			println("-canonical:", err.Error())
+			os.Exit(111)
+		}
+		mdhandler.canonical = u
+		status("canonical url:", u+mdhandler.Prefix+"/")
+	}
+	mdhandler.rewrites = linkRewrites
+
+	if *rate > 0 {
+		limiter = newRateLimiter(*rate, *burst)
+		status("rate limit:", fmt.Sprintf("%g/s, burst %.0f", limiter.rate, limiter.burst))
+	}
+
+	// file: and ${ENV} references in secrets
+	if err := resolveSecrets(flag.CommandLine); err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	if *slackSecret != "" {
+		status("slack events: /_markdownd/slack/events")
+		status("slack slash command: /_markdownd/slack/command")
+	}
+
+	if *token != "" {
+		status("bearer token required")
 	}
 
-	h := http.DefaultServeMux
-	h.Handle("/", mdhandler)
 	// print absolute directory we are serving
-	println("serving filesystem:", dir)
+	if mdhandler.RootString != "" {
+		status("serving filesystem:", mdhandler.RootString)
+	}
+
+	switch *logFormat {
+	case "text", "json", "combined":
+	default:
+		println("unknown log format:", *logFormat)
+		os.Exit(111)
+	}
 
 	// take care of opening log file
 	openLogFile()
-	println("logging to:", *logfile)
+	status("logging to:", *logfile)
+	openAccessLog()
+	if *accessLogfile != "" {
+		status("access log:", *accessLogfile)
+	}
+	reopenLogsOnHangup()
 
 	if *header != "" {
-		println("html header:", *header)
-		b, err := ioutil.ReadFile(*header)
-		if err != nil {
+		status("html header:", *header)
+	}
+	if *footer != "" {
+		status("html footer:", *footer)
+	}
+	if *pageTemplate != "" {
+		status("page template:", *pageTemplate)
+	}
+	if *analytics != "" {
+		status("analytics:", *analytics)
+	}
+	if err := mdhandler.readPageFiles(); err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	if *varsFile != "" {
+		if err := siteVars.readFile(*varsFile); err != nil {
 			println(err.Error())
 			os.Exit(111)
 		}
-		mdhandler.header = b
-	} else {
-		mdhandler.header = []byte("<!DOCTYPE html>\n")
 	}
-
-	if *footer != "" {
-		println("html footer:", *footer)
-		b, err := ioutil.ReadFile(*footer)
-		if err != nil {
+	if *schemaFile != "" {
+		if err := schemas.readFile(*schemaFile); err != nil {
 			println(err.Error())
 			os.Exit(111)
 		}
-		mdhandler.footer = b
 	}
 
-	// create a http server
+	h, err := siteHandler(mdhandler)
+	if err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	// the handler of the last SIGHUP reload
+	site := &liveHandler{}
+	site.set(h)
+	reloadOnHangup(*mdhandler, site)
+
+	if (*geminiAddr != "" || *gopherAddr != "") && mdhandler.RootString == "" {
+		println("-gemini and -gopher serve the directory argument, not -mount or -vhost")
+		os.Exit(111)
+	}
+
+	if *geminiAddr != "" {
+		mdhandler.startGemini(*geminiAddr)
+	}
+
+	if *gopherAddr != "" {
+		mdhandler.startGopher(*gopherAddr)
+	}
+
+	if *pprofAddr != "" {
+		servePprof(*pprofAddr)
+	}
+
+	if *adminAddr != "" {
+		serveAdmin(*adminAddr)
+	}
+
+	if *selftestRun {
+		ready.wait("selftest")
+	}
+	if *preloadPages {
+		ready.wait("preload")
+		go func() {
+			start := time.Now()
+			pages, problems := preload(preloadHandlers(*mdhandler))
+			logfAt(levelInfo, "preload: rendered %d pages in %v, %d problems", pages, time.Since(start).Round(time.Millisecond), problems)
+			ready.done("preload")
+		}()
+	}
+
+	// create a http server, with timeouts so slow clients can't hold
+	// connections open
+	headerBytes, err := parseSize(*maxHeaderBytes)
+	if err != nil || headerBytes < 1 || headerBytes > 1<<30 {
+		println("-max-header-size: bad size", *maxHeaderBytes)
+		os.Exit(111)
+	}
 	server := &http.Server{
-		Addr:              *addr,
-		Handler:           h,
+		Handler:           site,
 		ErrorLog:          logger,
-		MaxHeaderBytes:    (1 << 10), // 1KB
-		ReadTimeout:       (time.Second * 5),
-		WriteTimeout:      (time.Second * 5),
-		ReadHeaderTimeout: (time.Second * 5),
-		IdleTimeout:       (time.Second * 5),
+		MaxHeaderBytes:    int(headerBytes),
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		ReadHeaderTimeout: *headerTimeout,
+		IdleTimeout:       *idleTimeout,
 	}
 
-	// disable keepalives
-	server.SetKeepAlivesEnabled(false)
+	server.SetKeepAlivesEnabled(*keepAlives)
 
-	// trick to show listening port
-	go func() { <-time.After(time.Second); logger.Println("listening:", *addr) }()
+	// finish requests in flight on SIGINT and SIGTERM
+	stopped := shutdownOnSignal(server, *drainTime, *shutdownWait)
 
-	// start serving
-	err := server.ListenAndServe()
+	// start serving, on the sockets from systemd if started by one
+	listeners, err := activationListeners()
+	requested := make([]string, len(listeners)) // none for systemd sockets
+	if err == nil && len(listeners) == 0 {
+		for _, a := range httpAddrs.addrs {
+			var ln net.Listener
+			if ln, err = listen(a); err != nil {
+				break
+			}
+			listeners = append(listeners, ln)
+			requested = append(requested, a)
+		}
+	}
+	if err == nil && len(listeners) == 0 {
+		err = fmt.Errorf("nothing to listen on, see -http")
+	}
+	if err == nil {
+		errc := make(chan error, len(listeners))
+		for i, ln := range listeners {
+			logAt(levelInfo, "listening:", describeListener(requested[i], ln))
+			go func(ln net.Listener) { errc <- server.Serve(limitListener(ln, *maxConns)) }(ln)
+			if u := browserURL(ln, mdhandler.Prefix); u != "" && ephemeral(requested[i]) && !*startupJSON {
+				// the system picked the port, scripts read the url here
+				fmt.Println(u)
+			}
+		}
+		if *startupJSON {
+			os.Stdout.Write(startupLine(mdhandler, listeners))
+		}
+		if *openURL {
+			for _, ln := range listeners {
+				if u := browserURL(ln, mdhandler.Prefix); u != "" {
+					status("opening:", u)
+					if err := openBrowser(u); err != nil {
+						logAt(levelWarn, "open:", err)
+					}
+					break
+				}
+			}
+		}
+		if *selftestRun {
+			go runSelftest(*mdhandler, listeners)
+		}
+		deregister := func() {}
+		if *consulAgent != "" {
+			deregister = registerConsul(*consulAgent, *consulName, listeners)
+		}
+		err = <-errc
+		deregister()
+	}
+	if err == http.ErrServerClosed {
+		<-stopped
+		logAt(levelInfo, "stopped")
+		os.Exit(0)
+	}
 
 	// print usage info, probably started wrong or port is occupied
 	flag.Usage()
@@ -201,36 +728,197 @@ func rfid() string {
 }
 
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// all we want is GET
-	if r.Method != "GET" {
-		logger.Println("bad method:", r.RemoteAddr, r.Method, r.URL.Path, r.UserAgent())
+	// the real client, for logs, rate limits and acls
+	if len(proxies.cidrList) != 0 {
+		r.RemoteAddr = forwardedFor(r, proxies.cidrList)
+	}
+	if shaper != nil {
+		w = shaper.writer(w, r)
+	}
+
+	// record status and size for the access log
+	rec := newAccessRecorder(w, r)
+	var mirror *http.Request
+	if shadowSample(r) {
+		if req, err := shadowCopy(*shadow, r); err == nil {
+			mirror, rec.body = req, &shadowCapture{}
+		}
+	}
+	serverMetrics.begin()
+	h.serve(rec, r, &rec.entry)
+	rec.finish()
+	serverMetrics.end(&rec.entry)
+	if mirror != nil {
+		go shadowCompare(rec.entry.ID, mirror, rec.entry.Status, rec.body)
+	}
+}
+
+func (h Handler) serve(w http.ResponseWriter, r *http.Request, entry *accessEntry) {
+	// probes from load balancers and kubernetes skip the checks below
+	if *health && (r.URL.Path == "/healthz" || r.URL.Path == "/readyz") && (r.Method == "GET" || r.Method == "HEAD") {
+		h.serveHealth(w, r)
+		return
+	}
+
+	// check ip allow/deny lists before anything else
+	if !allowedIP(clientIP(r), allowList, denyList) {
+		logreq("forbidden address:", entry.RemoteAddr, r.Method, r.URL.Path, entry.UserAgent)
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return
+	}
+
+	// per ip rate limit
+	if limiter != nil {
+		if ok, wait := limiter.allow(clientIP(r)); !ok {
+			logreq("rate limited:", entry.RemoteAddr, r.Method, r.URL.Path, entry.UserAgent)
+			w.Header().Set("Retry-After", fmt.Sprintf("%.0f", math.Ceil(wait.Seconds())))
+			http.Error(w, "429 too many requests", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	// daily transfer quotas
+	if shaper != nil {
+		if code, wait := shaper.overQuota(clientIP(r), time.Now()); code != 0 {
+			logreq("over quota:", entry.RemoteAddr, r.Method, r.URL.Path, entry.UserAgent)
+			w.Header().Set("Retry-After", fmt.Sprintf("%.0f", math.Ceil(wait.Seconds())))
+			if code == 509 {
+				http.Error(w, "509 bandwidth limit exceeded", code)
+			} else {
+				http.Error(w, "429 daily transfer quota exceeded", code)
+			}
+			return
+		}
+	}
+
+	// slack events api, signed by slack instead of the bearer token
+	if *slackSecret != "" && r.URL.Path == "/_markdownd/slack/events" {
+		logreq(entry.ID, "slack event:", entry.RemoteAddr)
+		h.serveSlackEvents(w, r)
+		return
+	}
+	if *slackSecret != "" && r.URL.Path == "/_markdownd/slack/command" {
+		logreq(entry.ID, "slack command:", entry.RemoteAddr)
+		h.serveSlackCommand(w, r)
+		return
+	}
+
+	// all we want is GET (the editor api posts documents, graphql queries,
+	// and pages forms)
+	if r.Method != "GET" && !(r.Method == "POST" && (*editorAPI && strings.HasPrefix(r.URL.Path, editorAPIPrefix) || *graphql && r.URL.Path == graphqlPath ||
+		len(forms) != 0 && strings.HasPrefix(r.URL.Path, formPrefix))) {
+		logreq("bad method:", entry.RemoteAddr, r.Method, r.URL.Path, entry.UserAgent)
 		http.NotFound(w, r)
 		return
 	}
 
+	// require bearer token
+	reloadMu.RLock()
+	bearer := *token
+	reloadMu.RUnlock()
+	if !authorized(r, bearer) {
+		logreq("unauthorized:", entry.RemoteAddr, r.Method, r.URL.Path, entry.UserAgent)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="markdownd"`)
+		http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// request hooks may answer, or change the request served below
+	for _, hook := range h.before {
+		if r = hook(w, r); r == nil {
+			return
+		}
+	}
+
 	// deny requests containing '..'
 	if strings.Contains(r.URL.Path, "..") {
-		logger.Println("bad path:", r.RemoteAddr, r.Method, r.URL.Path, r.UserAgent())
-		http.NotFound(w, r)
+		logreq("bad path:", entry.RemoteAddr, r.Method, r.URL.Path, entry.UserAgent)
+		h.notFound(w, r)
 		return
 	}
 
-	// start timing
-	t1 := time.Now()
-
 	// Add Server header
-	w.Header().Add("Server", serverheader)
+	if *versionHeader {
+		w.Header().Add("Server", serverheader)
+		w.Header().Set("X-Markdownd-Version", version)
+	} else {
+		w.Header().Add("Server", "markdownd")
+	}
 
-	// Prevent page from being displayed in an iframe
-	w.Header().Add("X-Frame-Options", "DENY")
+	// X-Frame-Options (prevent page from being displayed in an iframe) etc
+	securityHeaders(w.Header())
 
-	// generate unique request id
-	requestid := rfid()
+	// unique request id
+	requestid := entry.ID
 
-	// log how long this takes
-	defer func(t func() time.Time) {
-		logger.Println(requestid, "closed after", t().Sub(t1))
-	}(time.Now)
+	if *stats && r.URL.Path == "/_markdownd/stats" {
+		logreq(requestid, "stats request")
+		serveStats(w, r)
+		return
+	}
+
+	if *metricsEnabled && r.URL.Path == "/_markdownd/metrics" {
+		logreq(requestid, "metrics request")
+		serveMetrics(w, r)
+		return
+	}
+	if *metricsEnabled && r.URL.Path == "/_markdownd/status" {
+		logreq(requestid, "status request")
+		serveStatus(w, r)
+		return
+	}
+
+	if *searchEnabled && r.URL.Path == "/_markdownd/search" {
+		logreq(requestid, "search request:", r.URL.Query().Get("q"))
+		h.serveSearch(w, r)
+		return
+	}
+
+	if *graphql && r.URL.Path == graphqlPath {
+		logreq(requestid, "graphql request")
+		h.serveGraphQL(w, r)
+		return
+	}
+
+	if *graph && (r.URL.Path == graphPath || r.URL.Path == graphPath+".html") {
+		logreq(requestid, "graph request")
+		h.serveGraph(w, r)
+		return
+	}
+
+	if *watch && r.URL.Path == "/_markdownd/api/watch" {
+		logreq(requestid, "watch request:", r.URL.Query().Get("path"))
+		h.serveWatch(w, r)
+		return
+	}
+
+	if *changes && strings.HasPrefix(r.URL.Path, changesPrefix) {
+		logreq(requestid, "changes request:", r.URL.Path)
+		h.serveChanges(w, r)
+		return
+	}
+
+	if len(forms) != 0 && strings.HasPrefix(r.URL.Path, formPrefix) {
+		logreq(requestid, "form:", r.Method, r.URL.Path)
+		h.serveForm(w, r, requestid)
+		return
+	}
+
+	if *editorAPI && strings.HasPrefix(r.URL.Path, editorAPIPrefix) {
+		logreq(requestid, "editor api:", r.Method, r.URL.Path)
+		h.serveEditorAPI(w, r)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, componentsPrefix) && serveComponent(w, r) {
+		logreq(requestid, "component:", r.URL.Path)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, openAPIAssetsPrefix) && serveOpenAPIAsset(w, r) {
+		logreq(requestid, "openapi asset:", r.URL.Path)
+		return
+	}
 
 	if *syntaxEnabled && r.URL.Path == "/gh.css" {
 		b, err := Asset("static/gh.css")
@@ -241,93 +929,138 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// abs is not absolute yet
-	abs := r.URL.Path[1:] // remove slash prefix
-	if abs == "" && *indexPage != "gen" {
-		abs = *indexPage
+	if *tagPages {
+		if name, src, ok := h.tagPage(r.URL.Path); ok {
+			logreq(requestid, "tag page:", r.URL.Path)
+			countPageview(r)
+			h.serveTagPage(w, r, requestid, name, src)
+			return
+		}
+	}
+
+	// name is the file in Root, slash separated without a leading slash
+	index := h.index()
+	name := r.URL.Path[1:] // remove slash prefix
+	if name == "" && index != "gen" {
+		name = index
 	}
 
 	// '/' suffix, add *index.Page
-	if *indexPage != "gen" && strings.HasSuffix(abs, "/") {
-		abs += *indexPage
+	if index != "gen" && strings.HasSuffix(name, "/") {
+		name += index
 	}
 
-	// still not absolute, prepend root directory to filesrc
-	abs = h.RootString + abs
+	// drafts are not found, nor is the _drafts directory
+	if hideDraft(name+"/", nil) {
+		logreq(requestid, "404 draft", r.URL.Path)
+		h.notFound(w, r)
+		return
+	}
 
-	if *indexPage == "gen" && strings.HasSuffix(r.URL.Path, "/") {
-		logger.Println(requestid, "generated index:", abs)
-		http.ServeFile(w, r, abs)
+	if index == "gen" && strings.HasSuffix(r.URL.Path, "/") {
+		logreq(requestid, "generated index:", h.RootString+name)
+		http.FileServer(http.FS(markdownd.FilterListings(h.Root, hideDraft))).ServeHTTP(w, r)
 		return
 	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
 
-	// log now that we have filename
-	logger.Println(requestid, r.RemoteAddr, r.Method, r.URL.Path, "->", abs)
+	// abs names the file on disk, for logs and the features reading files
+	// from there. it is name when Root isn't a directory.
+	abs := name
+	if h.RootString != "" {
+		abs = filepath.Join(h.RootString, filepath.FromSlash(name))
+	}
 
-	// get absolute path of requested file (could not exist)
-	abs, err := filepath.Abs(abs)
-	if err != nil {
-		logger.Println(requestid, "error resolving absolute path:", err)
-		http.NotFound(w, r)
-		return
+	// log now that we have filename
+	logreq(requestid, entry.RemoteAddr, r.Method, r.URL.Path, "->", abs)
+	entry.File = abs
+
+	// no suffix, but .md exists, with -pretty-urls
+	if *prettyURLs && !strings.HasSuffix(name, ".md") {
+		if _, err := fs.Stat(h.Root, name); err != nil {
+			if _, err := fs.Stat(h.Root, name+".md"); err == nil {
+				logreq(requestid, name, "->", name+".md")
+				name, abs = name+".md", abs+".md"
+				entry.File = abs
+			}
+		}
 	}
 
 	// .html suffix, but .md exists. choose to serve .md over .html
-	if strings.HasSuffix(abs, ".html") {
-		trymd := strings.TrimSuffix(abs, ".html") + ".md"
-		_, err := os.Open(trymd)
-		if err == nil {
-			logger.Println(requestid, abs, "->", trymd)
-			abs = trymd
+	if strings.HasSuffix(name, ".html") {
+		trymd := strings.TrimSuffix(name, ".html") + ".md"
+		if _, err := fs.Stat(h.Root, trymd); err == nil {
+			logreq(requestid, name, "->", trymd)
+			name, abs = trymd, strings.TrimSuffix(abs, ".html")+".md"
+			entry.File = abs
 		}
 	}
 
-	// check if exists, or give 404
-	_, err = os.Open(abs)
+	// layouts are templates, not pages
+	if isLayout(name) {
+		logreq(requestid, "404 layout", abs)
+		h.notFound(w, r)
+		return
+	}
+
+	// check if exists, or give 404. Root keeps names inside it.
+	fi, err := fs.Stat(h.Root, name)
 	if err != nil {
-		if strings.Contains(err.Error(), "no such file") {
-			logger.Println(requestid, "404", abs)
-			http.NotFound(w, r)
+		if errors.Is(err, fs.ErrNotExist) {
+			logreq(requestid, "404", abs)
+			h.notFound(w, r)
 			return
 		}
 
 		// probably permissions
 		logger.Println(requestid, "error opening file:", err, abs)
-		http.NotFound(w, r)
+		h.notFound(w, r)
 		return
 	}
 
 	// check if symlink ( to avoid /proc/self/root style attacks )
-	if !fileisgood(abs) {
-		logger.Printf("%s error: %q is symlink. serving 404", requestid, abs)
-		http.NotFound(w, r)
+	if h.RootString != "" && !fileisgood(abs) {
+		logfAt(levelWarn, "%s error: %q is symlink. serving 404", requestid, abs)
+		h.notFound(w, r)
 		return
 	}
 
-	// compare prefix (alternate way of checking symlink?)
-	// above, we checked for abs vs symlink resolved,
-	// here lets check if they have the special prefix of "s.Root"
-	// probably redundant.
-	if !strings.HasPrefix(abs, h.RootString) {
-		logger.Println(requestid, "bad path", abs, "doesnt have prefix:", h.RootString)
-		http.NotFound(w, r)
+	// big files aren't read into memory
+	if tooLarge(name, fi) {
+		h.serveStream(w, r, requestid, abs, name, fi)
 		return
 	}
 
-	// read bytes (for detecting content type )
-	b, err := ioutil.ReadFile(abs)
+	// read bytes (for detecting content type ), into a buffer reused by
+	// later requests, so nothing may keep b after this one
+	buf, err := readFileBuffer(h.Root, name)
 	if err != nil {
 		logger.Printf("%s error reading file: %q", requestid, abs)
-		http.NotFound(w, r)
+		h.notFound(w, r)
 		return
 	}
+	defer putBuffer(buf)
+	b := buf.Bytes()
 
 	// detect content type and encoding
 	ct := http.DetectContentType(b)
 
+	// openapi documents are shown in a viewer, unless asked for raw
+	if *openapi != "" && isOpenAPI(name, b) {
+		w.Header().Add("Vary", "Accept")
+		if !strings.Contains(r.URL.RawQuery, "raw") && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			logreq(requestid, "openapi viewer:", abs)
+			countPageview(r)
+			h.serveOpenAPI(w, r, requestid, abs, name, b)
+			return
+		}
+	}
+
 	// serve raw html if exists
 	if strings.HasSuffix(abs, ".html") && strings.HasPrefix(ct, "text/html") {
-		logger.Println(requestid, "serving raw html:", abs)
+		logreq(requestid, "serving raw html:", abs)
+		countPageview(r)
+		cacheControl(w, h.Prefix+r.URL.Path)
 		w.Header().Add("Content-Type", "text/html")
 		w.Write(b)
 		return
@@ -335,29 +1068,228 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// probably markdown
 	if strings.HasSuffix(abs, ".md") && strings.HasPrefix(ct, "text/plain") {
+		fm, src := parseFrontMatter(b)
+		early := false
+		if until, ok := embargoed(fm, time.Now()); ok {
+			if grantAccess(w, r, h.Prefix) {
+				logreq(requestid, "early access granted:", abs)
+				return
+			}
+			early = earlyReader(r, name, fm)
+			if early {
+				logreq(requestid, "early access:", abs)
+				w.Header().Set("X-Robots-Tag", "noindex")
+				w.Header().Set("X-Embargo-Until", until.UTC().Format(time.RFC3339))
+			} else {
+				// the 404 ends at the embargo
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+		}
+		if hideDraft(name, fm) && !early {
+			logreq(requestid, "404 draft", abs)
+			h.notFound(w, r)
+			return
+		}
+		// caches keep rendered and raw responses apart
+		w.Header().Add("Vary", "Accept")
 		if strings.Contains(r.URL.RawQuery, "raw") {
-			logger.Println(requestid, "raw markdown request:", abs)
+			logreq(requestid, "raw markdown request:", abs)
 			w.Write(b)
 			return
 		}
-		logger.Println(requestid, "serving markdown:", abs)
+		if markdownd.PrefersMarkdown(r.Header.Get("Accept")) {
+			logreq(requestid, "text/markdown request:", abs)
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			w.Write(b)
+			return
+		}
+		if errs := schemas.check(fm); len(errs) != 0 {
+			var msgs []string
+			for _, e := range errs {
+				msgs = append(msgs, e.Key+": "+e.Message)
+			}
+			logfAt(levelWarn, "%s front matter of %q doesn't match its type: %s", requestid, abs, strings.Join(msgs, "; "))
+			http.Error(w, "500 front matter of "+name+" doesn't match its type:\n"+strings.Join(msgs, "\n"), http.StatusInternalServerError)
+			return
+		}
+		policy, err := pageCachePolicy(fm)
+		if err != nil {
+			logger.Printf("%s %q %v", requestid, abs, err)
+		}
+		if policy.Header != "" {
+			w.Header().Set("Cache-Control", policy.Header)
+		}
+		src, dynamic := h.expandPage(name, fi.ModTime(), src)
+		switch {
+		case early:
+			// not for shared caches, nor kept past the embargo
+			w.Header().Set("Cache-Control", "private, no-store")
+		case policy.Header != "":
+		case cacheControl(w, h.Prefix+r.URL.Path):
+		case dynamic:
+			// the page changes without its file changing
+			w.Header().Set("Cache-Control", "no-cache")
+		default:
+			if p := expiryPolicy(fm, fi.ModTime(), time.Now(), *autoCache); p.Header != "" {
+				policy = p
+				w.Header().Set("Cache-Control", policy.Header)
+				if !policy.Expires.IsZero() {
+					w.Header().Set("Expires", policy.Expires.UTC().Format(http.TimeFormat))
+				}
+			}
+		}
+		// exports read the files again from disk
+		if format := r.URL.Query().Get("format"); exporters[format].write != nil && h.RootString != "" {
+			logreq(requestid, format, "request:", abs)
+			h.serveExport(w, format, abs, fm, src)
+			return
+		}
+
+		logreq(requestid, "serving markdown:", abs)
+		countPageview(r)
 
-		md := markdown2html(b)
+		var found []pageForm
+		if len(forms) != 0 {
+			src, found = pageForms(src)
+		}
+
+		rendering := time.Now()
+		renderSlots <- struct{}{}
+		var md []byte
+		lang := codeLang(w, r, h.Prefix)
+		src, md = renderPage(name, fm, src, policy.Store && !dynamic, policy.MaxAge, lang)
+		md = rewriteLinks(prefixLinks(h.pageLinks(name, md), h.Prefix), h.rewrites)
+		if *changes && lang == "" && !dynamic && !early {
+			versions.record(h.versionKey(name), md, time.Now())
+		}
+		md = h.insertForms(w, r, name, md, found)
+		<-renderSlots
+		for _, hook := range h.afterRender {
+			md = hook(r, name, md)
+		}
+		serverMetrics.observeRender(time.Since(rendering))
 		if md == nil {
 			w.WriteHeader(200)
 			return
 		}
+
+		// extra html for the <head>
+		var head [][]byte
+		if link := h.canonicalLink(h.Prefix + r.URL.Path); link != nil {
+			head = append(head, link)
+		}
+		if *jsonld {
+			head = append(head, structuredData(h.siteURL(r), h.Prefix+r.URL.Path, fi.ModTime(), fm, src))
+		}
+		if *og {
+			head = append(head, openGraph(h.siteURL(r), h.Prefix, h.Prefix+r.URL.Path, fm, src))
+		}
+		if *copyCode {
+			head = append(head, []byte(componentTag(h.Prefix, "code")))
+		}
+		if bytes.Contains(md, []byte(`class="md-tabs"`)) {
+			// the tabs shown depend on the lang cookie
+			w.Header().Add("Vary", "Cookie")
+			head = append(head, []byte(componentTag(h.Prefix, "tabs")))
+		}
+		if h.analytics != nil && (fm.String("analytics") == "" || fm.Bool("analytics")) {
+			head = append(head, h.analytics)
+		}
+
+		h.writePage(w, requestid, abs, pageData{
+			Title:       pageTitle(fm, src),
+			Description: pageSummary(fm, src),
+			Content:     template.HTML(md),
+			Path:        h.Prefix + r.URL.Path,
+			Page:        fm,
+			Site:        siteVars,
+			h:           h,
+			name:        name,
+		}, head)
+		return
+	}
+
+	// smaller images for ?w= and ?h=
+	if *resizeImages && (ct == "image/png" || ct == "image/jpeg") && h.serveResized(w, r, requestid, abs, name, ct, fi.ModTime(), b) {
+		return
+	}
+
+	// fallthrough with http.ServeContent
+	logreqf("%s serving %s file: %s", requestid, ct, abs)
+	cacheControl(w, h.Prefix+r.URL.Path)
+
+	http.ServeContent(w, r, name, fi.ModTime(), bytes.NewReader(b))
+}
+
+// writePage writes a rendered page in its layout or the -template, or
+// between the -header and -footer. abs names the page in logs.
+func (h Handler) writePage(w http.ResponseWriter, requestid, abs string, data pageData, head [][]byte) {
+	tmpl, err := h.layout(data.name, data.Page.String("layout"))
+	if err != nil {
+		logger.Printf("%s layout error: %q %v", requestid, abs, err)
+		http.Error(w, "500 template error", http.StatusInternalServerError)
+		return
+	}
+	if tmpl != nil {
+		// the page is buffered so a failing template is still a 500
+		buf := getBuffer()
+		defer putBuffer(buf)
+		if err := h.renderPage(buf, tmpl, data); err != nil {
+			logger.Printf("%s template error: %q %v", requestid, abs, err)
+			http.Error(w, "500 template error", http.StatusInternalServerError)
+			return
+		}
 		w.Header().Add("Content-Type", "text/html")
-		w.Write(h.header)
-		w.Write(md)
-		w.Write(h.footer)
+		markdownd.WriteHead(w, buf.Bytes(), head)
 		return
 	}
 
-	// fallthrough with http.ServeFile
-	logger.Printf("%s serving %s file: %s", requestid, ct, abs)
+	w.Header().Add("Content-Type", "text/html")
+	markdownd.WriteHead(w, h.header, head)
+	io.WriteString(w, string(data.Content))
+	w.Write(h.footer)
+}
+
+// resolve maps a url path to a markdown file in the root directory,
+// the same way requests are served. returns false if there is none.
+func (h Handler) resolve(urlpath string) (string, bool) {
+	if h.RootString == "" || strings.Contains(urlpath, "..") {
+		return "", false
+	}
+	rel := strings.TrimPrefix(urlpath, "/")
+	if index := h.index(); (rel == "" || strings.HasSuffix(rel, "/")) && index != "gen" {
+		rel += index
+	}
+	abs, err := filepath.Abs(h.RootString + filepath.FromSlash(rel))
+	if err != nil {
+		return "", false
+	}
+	if strings.HasSuffix(abs, ".html") {
+		abs = strings.TrimSuffix(abs, ".html") + ".md"
+	}
+	if !strings.HasSuffix(abs, ".md") || !strings.HasPrefix(abs, h.RootString) {
+		return "", false
+	}
+	if fi, err := os.Stat(abs); err != nil || fi.IsDir() || !fileisgood(abs) {
+		return "", false
+	}
+	return abs, true
+}
 
-	http.ServeFile(w, r, abs)
+// localPath maps a url path to a file or directory under the root,
+// refusing symlinks and paths leaving the root
+func (h Handler) localPath(urlpath string) (string, bool) {
+	if h.RootString == "" || strings.Contains(urlpath, "..") {
+		return "", false
+	}
+	abs := filepath.Join(h.RootString, filepath.FromSlash(strings.TrimPrefix(urlpath, "/")))
+	if abs+string(os.PathSeparator) != h.RootString && !strings.HasPrefix(abs, h.RootString) {
+		return "", false
+	}
+	if _, err := os.Lstat(abs); err != nil || !fileisgood(abs) {
+		return "", false
+	}
+	return abs, true
 }
 
 // fileisgood returns false if symlink
@@ -414,52 +1346,59 @@ func prepareDirectory(dir string) string {
 	return dir
 }
 
+// markdown2html renders markdown with -renderer-cmd, or the built-in
+// renderer with the -toc, -plain and -no-inline-html flags
 func markdown2html(in []byte) []byte {
-	if len(in) == 0 {
-		return nil
-	}
-	if *plain {
-		// default flags
-		flags := 0
-		if *toc {
-			flags |= blackfriday.HTML_TOC
-		}
-		md := blackfriday.Markdown(
-			in, blackfriday.HtmlRenderer(
-				// html flags
-				flags,
-				"", ""),
-			// extensions
-			0)
-		return md
-	}
-
-	return github_flavored_markdown.Markdown(in)
+	if *rendererCmd != "" && len(in) != 0 {
+		out, err := renderCommand(*rendererCmd, in, *rendererWait, rendererLimit)
+		if err == nil {
+			return out
+		}
+		logger.Println("renderer:", err)
+	}
+	return markdownd.Render(in, markdownd.RenderOptions{TOC: *toc, Plain: *plain, NoInlineHTML: *noInlineHTML})
 }
 
 // use logfile flag and set logger Logger
 func openLogFile() {
-	switch *logfile {
+	w, name := openLog(*logfile)
+	logger.SetOutput(w)
+	*logfile = name
+}
+
+// open the access log, if separate from the logfile
+func openAccessLog() {
+	if *accessLogfile == "" {
+		return
+	}
+	accessLog, *accessLogfile = openLog(*accessLogfile)
+}
+
+// openLog returns the writer for a log flag value, and its canonical name
+func openLog(name string) (io.Writer, string) {
+	switch name {
 	case os.Stderr.Name(), "stderr":
-		// already stderr
-		*logfile = os.Stderr.Name()
+		return os.Stderr, os.Stderr.Name()
 	case os.Stdout.Name(), "stdout":
-		logger.SetOutput(os.Stdout)
-		*logfile = os.Stdout.Name()
+		return os.Stdout, os.Stdout.Name()
 	case "none", "no", "null", "/dev/null", "nil", "disabled":
-		logger.SetOutput(ioutil.Discard)
-		*logfile = os.DevNull
-	default:
-		func() {
-			logger.Printf("Opening log file: %q", *logfile)
-			f, err := os.OpenFile(*logfile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0660)
-			if err != nil {
-				logger.Fatalf("cant open log file: %s", err)
-			}
-			logger.SetOutput(f)
-		}()
+		return ioutil.Discard, os.DevNull
 	}
+	logfAt(levelInfo, "Opening log file: %q", name)
+	f, err := newLogFile(name)
+	if err != nil {
+		logger.Fatalf("cant open log file: %s", err)
+	}
+	return f, name
+}
 
+// logToFile reports whether a log flag value names a file
+func logToFile(name string) bool {
+	switch name {
+	case "", os.Stderr.Name(), "stderr", os.Stdout.Name(), "stdout", "none", "no", "null", "/dev/null", "nil", "disabled":
+		return false
+	}
+	return true
 }
 
 func highlightSyntaxHTML(in []byte) (out []byte) {
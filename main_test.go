@@ -1,12 +1,16 @@
 package main
 
 import (
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"testing/fstest"
+
+	"github.com/aerth/markdownd/pkg/markdownd"
 )
 
 func TestPrepareDirectory(t *testing.T) {
@@ -58,7 +62,7 @@ func TestRefuseDotDots(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/../main.go", nil)
 	w := httptest.NewRecorder()
 	h := &Handler{
-		Root:       http.Dir(dir),
+		Root:       os.DirFS(dir),
 		RootString: dir,
 	}
 	h.ServeHTTP(w, req)
@@ -86,7 +90,7 @@ func TestHTMLHeaderFooter(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/", nil)
 	w := httptest.NewRecorder()
 	h := &Handler{
-		Root:       http.Dir(dir),
+		Root:       os.DirFS(dir),
 		RootString: dir,
 		header:     []byte("001"),
 		footer:     []byte("002"),
@@ -117,7 +121,7 @@ func sendRequest(req *http.Request) *http.Response {
 	dir := prepareDirectory("docs")
 	w := httptest.NewRecorder()
 	h := &Handler{
-		Root:       http.Dir(dir),
+		Root:       os.DirFS(dir),
 		RootString: dir,
 	}
 	h.ServeHTTP(w, req)
@@ -140,3 +144,196 @@ func TestBadMethods(t *testing.T) {
 
 	}
 }
+
+func TestAcceptMarkdown(t *testing.T) {
+	src, _ := ioutil.ReadFile("docs/index.md")
+	for accept, want := range map[string]bool{
+		"text/markdown":                       true,
+		"text/markdown, */*;q=0.1":            true,
+		"text/html,application/xhtml+xml,*/*": false,
+		"text/html, text/markdown;q=0.5":      false,
+		"text/markdown;q=0":                   false,
+		"":                                    false,
+	} {
+		req, _ := http.NewRequest("GET", "/index.md", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp := sendRequest(req)
+		body, _ := ioutil.ReadAll(resp.Body)
+		got := string(body) == string(src) && resp.Header.Get("Content-Type") == "text/markdown; charset=utf-8"
+		if got != want || resp.Header.Get("Vary") != "Accept" {
+			t.Logf("Accept %q: expected markdown %v, got %v %q", accept, want, resp.Header.Get("Content-Type"), resp.Header.Get("Vary"))
+			t.Fail()
+		}
+	}
+}
+
+func TestServeFS(t *testing.T) {
+	h := &Handler{Root: fstest.MapFS{
+		"index.md":       {Data: []byte("# embedded\n")},
+		"guide/intro.md": {Data: []byte("---\ntitle: Intro\n---\nhello *there*\n")},
+		"style.css":      {Data: []byte("body { color: red }\n")},
+	}}
+	for _, tc := range []struct {
+		path, status, ctype, body string
+	}{
+		{"/", "200", "text/html", "embedded</h1>"},
+		{"/guide/intro.html", "200", "text/html", "hello <em>there</em>"},
+		{"/guide/intro.md?raw", "200", "text/plain", "title: Intro"},
+		{"/style.css", "200", "text/css", "color: red"},
+		{"/guide/", "404", "", ""},
+		{"/guide", "404", "", ""},
+		{"/missing.md", "404", "", ""},
+		{"/../index.md", "404", "", ""},
+	} {
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		resp := w.Result()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if !strings.HasPrefix(resp.Status, tc.status) ||
+			!strings.HasPrefix(resp.Header.Get("Content-Type"), tc.ctype) ||
+			!strings.Contains(string(body), tc.body) {
+			t.Logf("%s: expected %s %s %q, got: %s %s %q", tc.path, tc.status, tc.ctype, tc.body,
+				resp.Status, resp.Header.Get("Content-Type"), string(body))
+			t.Fail()
+		}
+	}
+
+	// features reading files from disk find none
+	if _, ok := h.resolve("/index.md"); ok {
+		t.Log("Expected no file on disk for an embedded root")
+		t.Fail()
+	}
+}
+
+func TestDrafts(t *testing.T) {
+	h := Handler{Root: fstest.MapFS{
+		"index.md":           {Data: []byte("# home\n")},
+		"wip.md":             {Data: []byte("---\ndraft: true\n---\n# wip\n")},
+		"done.md":            {Data: []byte("---\ndraft: false\n---\n# done\n")},
+		"_drafts/idea.md":    {Data: []byte("# idea\n")},
+		"_drafts/sketch.png": {Data: []byte("png")},
+	}}
+	status := func(path string) int {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	defer func(on bool) { *drafts = on }(*drafts)
+	for _, on := range []bool{false, true} {
+		*drafts = on
+		want := 404
+		if on {
+			want = 200
+		}
+		for _, path := range []string{"/wip.md", "/wip.html", "/wip.md?raw", "/_drafts/idea.md", "/_drafts/sketch.png"} {
+			if got := status(path); got != want {
+				t.Logf("-drafts=%v %s: expected %d, got %d", on, path, want, got)
+				t.Fail()
+			}
+		}
+		if got := status("/done.md"); got != 200 {
+			t.Logf("-drafts=%v /done.md: expected 200, got %d", on, got)
+			t.Fail()
+		}
+		if n := len(h.nav("")); n != map[bool]int{false: 1, true: 2}[on] {
+			t.Logf("-drafts=%v: expected the drafts in the nav only with -drafts, got %d items", on, n)
+			t.Fail()
+		}
+		gen := h
+		gen.Index = "gen"
+		req, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		gen.ServeHTTP(w, req)
+		listing := w.Body.String()
+		if !strings.Contains(listing, "done.md") || strings.Contains(listing, "wip.md") == !on || strings.Contains(listing, "_drafts/") == !on {
+			t.Logf("-drafts=%v: expected the drafts in the generated index only with -drafts, got %s", on, listing)
+			t.Fail()
+		}
+	}
+}
+
+func TestDotfiles(t *testing.T) {
+	h := Handler{Root: fstest.MapFS{
+		"index.md":                 {Data: []byte("# home\n")},
+		".env":                     {Data: []byte("SECRET=1\n")},
+		".git/config":              {Data: []byte("[core]\n")},
+		"docs/.notes.md":           {Data: []byte("# notes\n")},
+		".well-known/security.txt": {Data: []byte("Contact: mailto:security@example.com\n")},
+	}}
+	status := func(h Handler, path string) (int, string) {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+	for _, path := range []string{"/.env", "/.git/config", "/docs/.notes.md", "/docs/.notes.html"} {
+		if code, _ := status(h, path); code != 404 {
+			t.Log("Expected 404 for", path, "got:", code)
+			t.Fail()
+		}
+	}
+	if code, _ := status(h, "/.well-known/security.txt"); code != 200 {
+		t.Log("Expected .well-known served, got:", code)
+		t.Fail()
+	}
+	h.Index = "gen"
+	if _, listing := status(h, "/"); strings.Contains(listing, ".env") || strings.Contains(listing, ".git") || !strings.Contains(listing, ".well-known") {
+		t.Log("Expected the dot files left out of the generated index, got:", listing)
+		t.Fail()
+	}
+}
+
+func TestHandlerHooks(t *testing.T) {
+	h := Handler{Root: fstest.MapFS{
+		"index.md": {Data: []byte("# home\n\n![x](x.png)\n")},
+		"new.md":   {Data: []byte("# new\n")},
+	}}
+	h.before = []markdownd.RequestHook{
+		func(w http.ResponseWriter, r *http.Request) *http.Request {
+			if r.URL.Path == "/private.md" {
+				http.Error(w, "403 forbidden", http.StatusForbidden)
+				return nil
+			}
+			if r.URL.Path == "/old.md" {
+				r.URL.Path = "/new.md"
+			}
+			return r
+		},
+	}
+	h.afterRender = []markdownd.RenderHook{
+		func(r *http.Request, name string, html []byte) []byte {
+			return append([]byte("<!-- "+name+" -->"), html...)
+		},
+		lazyImagesHook,
+	}
+	h.onError = func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		w.WriteHeader(status)
+		io.WriteString(w, "custom "+err.Error())
+	}
+	get := func(path string) (int, string) {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+	if code, body := get("/"); code != 200 || !strings.Contains(body, "<!-- index.md -->") || strings.Contains(body, `loading="lazy"`) {
+		t.Log("Expected the render hooks run on the page, got:", code, body)
+		t.Fail()
+	}
+	if code, body := get("/old.md"); code != 200 || !strings.Contains(body, "new") {
+		t.Log("Expected the request hook to rewrite the path, got:", code, body)
+		t.Fail()
+	}
+	if code, _ := get("/private.md"); code != 403 {
+		t.Log("Expected the request hook to answer, got:", code)
+		t.Fail()
+	}
+	if code, body := get("/missing.md"); code != 404 || !strings.HasPrefix(body, "custom open /missing.md") {
+		t.Log("Expected the error handler to answer, got:", code, body)
+		t.Fail()
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// renderBuckets are the upper bounds (seconds) of the render duration histogram
+var renderBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+// metrics are counters exposed in the prometheus text format
+type metrics struct {
+	inflight  int64  // atomic
+	bytes     uint64 // atomic
+	cacheHits uint64 // atomic, pages from the render cache
+
+	mu         sync.Mutex
+	requests   map[int]uint64 // by status
+	renders    []uint64       // cumulative by renderBuckets, then +Inf
+	renderSum  float64
+	renderSeen uint64
+	pages      map[string]*pageTiming // by path, for the slowest pages
+	errors     []recentError          // ring of the last maxErrors
+	errorsNext int
+}
+
+// pageTiming is the time spent serving one path
+type pageTiming struct {
+	Count uint64
+	Total time.Duration
+	Max   time.Duration
+}
+
+// recentError is a request answered with a 4xx or 5xx status
+type recentError struct {
+	Time   time.Time `json:"time"`
+	ID     string    `json:"request_id"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Status int       `json:"status"`
+}
+
+// limits on what the status endpoint remembers
+const (
+	maxPages  = 1000
+	maxErrors = 20
+)
+
+var serverMetrics = &metrics{
+	requests: map[int]uint64{},
+	renders:  make([]uint64, len(renderBuckets)+1),
+}
+
+// begin counts a request in flight
+func (m *metrics) begin() {
+	atomic.AddInt64(&m.inflight, 1)
+}
+
+// end counts a finished request. timings and errors are kept for pages,
+// not the /_markdownd/ endpoints
+func (m *metrics) end(e *accessEntry) {
+	elapsed := time.Since(e.Time)
+	atomic.AddInt64(&m.inflight, -1)
+	atomic.AddUint64(&m.bytes, uint64(e.Bytes))
+	path := e.Path
+	if i := strings.IndexByte(path, '?'); i != -1 {
+		path = path[:i]
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[e.Status]++
+	if strings.HasPrefix(path, "/_markdownd/") {
+		return
+	}
+	if m.pages == nil {
+		m.pages = map[string]*pageTiming{}
+	}
+	p := m.pages[path]
+	if p == nil && len(m.pages) < maxPages {
+		p = &pageTiming{}
+		m.pages[path] = p
+	}
+	if p != nil {
+		p.Count++
+		p.Total += elapsed
+		if elapsed > p.Max {
+			p.Max = elapsed
+		}
+	}
+	if e.Status >= 400 {
+		re := recentError{Time: e.Time, ID: e.ID, Method: e.Method, Path: path, Status: e.Status}
+		if len(m.errors) < maxErrors {
+			m.errors = append(m.errors, re)
+		} else {
+			m.errors[m.errorsNext] = re
+		}
+		m.errorsNext = (m.errorsNext + 1) % maxErrors
+	}
+}
+
+// observeRender records the time spent converting markdown to html
+func (m *metrics) observeRender(d time.Duration) {
+	sec := d.Seconds()
+	m.mu.Lock()
+	for i, le := range renderBuckets {
+		if sec <= le {
+			m.renders[i]++
+		}
+	}
+	m.renders[len(renderBuckets)]++
+	m.renderSum += sec
+	m.renderSeen++
+	m.mu.Unlock()
+}
+
+// cacheHit counts a page served from the render cache
+func (m *metrics) cacheHit() {
+	atomic.AddUint64(&m.cacheHits, 1)
+}
+
+// WriteTo writes the metrics in the prometheus text exposition format
+func (m *metrics) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	printf := func(format string, v ...interface{}) {
+		i, _ := fmt.Fprintf(w, format, v...)
+		n += int64(i)
+	}
+
+	m.mu.Lock()
+	statuses := make([]int, 0, len(m.requests))
+	for code := range m.requests {
+		statuses = append(statuses, code)
+	}
+	sort.Ints(statuses)
+	printf("# HELP markdownd_requests_total Requests served, by status code.\n")
+	printf("# TYPE markdownd_requests_total counter\n")
+	for _, code := range statuses {
+		printf("markdownd_requests_total{code=\"%d\"} %d\n", code, m.requests[code])
+	}
+	printf("# HELP markdownd_render_duration_seconds Time spent rendering markdown to html.\n")
+	printf("# TYPE markdownd_render_duration_seconds histogram\n")
+	for i, le := range renderBuckets {
+		printf("markdownd_render_duration_seconds_bucket{le=\"%g\"} %d\n", le, m.renders[i])
+	}
+	printf("markdownd_render_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.renders[len(renderBuckets)])
+	printf("markdownd_render_duration_seconds_sum %g\n", m.renderSum)
+	printf("markdownd_render_duration_seconds_count %d\n", m.renderSeen)
+	m.mu.Unlock()
+
+	printf("# HELP markdownd_in_flight_requests Requests currently being served.\n")
+	printf("# TYPE markdownd_in_flight_requests gauge\n")
+	printf("markdownd_in_flight_requests %d\n", atomic.LoadInt64(&m.inflight))
+	printf("# HELP markdownd_response_bytes_total Response body bytes sent.\n")
+	printf("# TYPE markdownd_response_bytes_total counter\n")
+	printf("markdownd_response_bytes_total %d\n", atomic.LoadUint64(&m.bytes))
+	printf("# HELP markdownd_pageviews_total Pages (markdown or html) served.\n")
+	printf("# TYPE markdownd_pageviews_total counter\n")
+	printf("markdownd_pageviews_total %d\n", atomic.LoadUint64(&pageviews))
+	entries, size := renders.usage()
+	printf("# HELP markdownd_render_cache_hits_total Pages rendered from the render cache.\n")
+	printf("# TYPE markdownd_render_cache_hits_total counter\n")
+	printf("markdownd_render_cache_hits_total %d\n", atomic.LoadUint64(&m.cacheHits))
+	printf("# HELP markdownd_render_cache_entries Rendered pages in the render cache.\n")
+	printf("# TYPE markdownd_render_cache_entries gauge\n")
+	printf("markdownd_render_cache_entries %d\n", entries)
+	printf("# HELP markdownd_render_cache_bytes Bytes of html in the render cache.\n")
+	printf("# TYPE markdownd_render_cache_bytes gauge\n")
+	printf("markdownd_render_cache_bytes %d\n", size)
+	printf("# HELP markdownd_start_time_seconds Start time of the process since the unix epoch.\n")
+	printf("# TYPE markdownd_start_time_seconds gauge\n")
+	printf("markdownd_start_time_seconds %d\n", started.Unix())
+	return n, nil
+}
+
+// serveMetrics answers /_markdownd/metrics
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	serverMetrics.WriteTo(w)
+}
+
+// serverStatus is the json at /_markdownd/status, read by 'markdownd top'
+type serverStatus struct {
+	Time       time.Time         `json:"time"`
+	Uptime     float64           `json:"uptime_seconds"`
+	Requests   uint64            `json:"requests"`
+	ByStatus   map[string]uint64 `json:"requests_by_status"`
+	InFlight   int64             `json:"in_flight"`
+	Bytes      uint64            `json:"bytes"`
+	Pageviews  uint64            `json:"pageviews"`
+	RenderAvg  float64           `json:"render_avg_ms"`
+	Slowest    []slowPage        `json:"slowest"`
+	Errors     []recentError     `json:"errors"` // newest first
+	Cache      *cacheStatus      `json:"cache,omitempty"`
+	Memory     memoryStatus      `json:"memory"`
+	Goroutines int               `json:"goroutines"`
+}
+
+// slowPage is a path by its average time to serve
+type slowPage struct {
+	Path  string  `json:"path"`
+	Count uint64  `json:"count"`
+	Avg   float64 `json:"avg_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// cacheStatus counts lookups in the render cache, when there is one
+type cacheStatus struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// memoryStatus is from runtime.MemStats
+type memoryStatus struct {
+	HeapAlloc uint64 `json:"heap_alloc"`
+	HeapInuse uint64 `json:"heap_inuse"`
+	Sys       uint64 `json:"sys"`
+	NumGC     uint32 `json:"num_gc"`
+	Limit     int64  `json:"limit,omitempty"` // -memory-limit or the cgroup
+}
+
+// ms converts a duration to milliseconds
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// status returns a snapshot of the metrics, with the n slowest pages
+func (m *metrics) status(n int) serverStatus {
+	now := time.Now()
+	s := serverStatus{
+		Time:       now,
+		Uptime:     now.Sub(started).Seconds(),
+		ByStatus:   map[string]uint64{},
+		InFlight:   atomic.LoadInt64(&m.inflight),
+		Bytes:      atomic.LoadUint64(&m.bytes),
+		Pageviews:  atomic.LoadUint64(&pageviews),
+		Slowest:    []slowPage{},
+		Errors:     []recentError{},
+		Goroutines: runtime.NumGoroutine(),
+	}
+
+	m.mu.Lock()
+	for code, count := range m.requests {
+		s.ByStatus[strconv.Itoa(code)] = count
+		s.Requests += count
+	}
+	if m.renderSeen != 0 {
+		s.RenderAvg = m.renderSum / float64(m.renderSeen) * 1000
+	}
+	for path, p := range m.pages {
+		s.Slowest = append(s.Slowest, slowPage{Path: path, Count: p.Count, Avg: ms(p.Total / time.Duration(p.Count)), Max: ms(p.Max)})
+	}
+	for i := range m.errors {
+		s.Errors = append(s.Errors, m.errors[(m.errorsNext-1-i+2*len(m.errors))%len(m.errors)])
+	}
+	m.mu.Unlock()
+
+	sort.Slice(s.Slowest, func(i, j int) bool {
+		if s.Slowest[i].Avg != s.Slowest[j].Avg {
+			return s.Slowest[i].Avg > s.Slowest[j].Avg
+		}
+		return s.Slowest[i].Path < s.Slowest[j].Path
+	})
+	if len(s.Slowest) > n {
+		s.Slowest = s.Slowest[:n]
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s.Memory = memoryStatus{HeapAlloc: mem.HeapAlloc, HeapInuse: mem.HeapInuse, Sys: mem.Sys, NumGC: mem.NumGC, Limit: memoryBudget}
+	return s
+}
+
+// serveStatus answers /_markdownd/status
+func serveStatus(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.URL.Query().Get("slowest"))
+	if err != nil || n <= 0 || n > 100 {
+		n = 10
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	s := serverMetrics.status(n)
+	s.InFlight-- // not this request
+	json.NewEncoder(w).Encode(s)
+}
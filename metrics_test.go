@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := &metrics{requests: map[int]uint64{}, renders: make([]uint64, len(renderBuckets)+1)}
+	m.begin()
+	m.begin()
+	m.end(&accessEntry{Time: time.Now(), Path: "/index.md", Status: 200, Bytes: 100})
+	m.observeRender(2 * time.Millisecond)
+	m.observeRender(2 * time.Second)
+
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	for _, want := range []string{
+		`markdownd_requests_total{code="200"} 1`,
+		`markdownd_render_duration_seconds_bucket{le="0.001"} 0`,
+		`markdownd_render_duration_seconds_bucket{le="0.0025"} 1`,
+		`markdownd_render_duration_seconds_bucket{le="1"} 1`,
+		`markdownd_render_duration_seconds_bucket{le="+Inf"} 2`,
+		`markdownd_render_duration_seconds_count 2`,
+		`markdownd_in_flight_requests 1`,
+		`markdownd_response_bytes_total 100`,
+	} {
+		if !strings.Contains(buf.String(), want+"\n") {
+			t.Log("Expected", want, "in:\n"+buf.String())
+			t.Fail()
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/_markdownd/metrics", nil)
+	if resp := sendRequest(req); resp.StatusCode != http.StatusNotFound {
+		t.Log("Expected 404 without -metrics, got:", resp.StatusCode)
+		t.Fail()
+	}
+
+	*metricsEnabled = true
+	defer func() { *metricsEnabled = false }()
+	req, _ = http.NewRequest("GET", "/index.md", nil)
+	sendRequest(req)
+	req, _ = http.NewRequest("GET", "/_markdownd/metrics", nil)
+	resp := sendRequest(req)
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") ||
+		!strings.Contains(string(body), `markdownd_requests_total{code="200"}`) ||
+		strings.Contains(string(body), "markdownd_render_duration_seconds_count 0\n") {
+		t.Log("Expected metrics, got:", resp.Header, string(body))
+		t.Fail()
+	}
+}
+
+func TestMetricsStatus(t *testing.T) {
+	m := &metrics{requests: map[int]uint64{}, renders: make([]uint64, len(renderBuckets)+1)}
+	ago := func(d time.Duration) time.Time { return time.Now().Add(-d) }
+	for _, e := range []accessEntry{
+		{Time: ago(time.Millisecond), Path: "/fast.md", Status: 200},
+		{Time: ago(50 * time.Millisecond), Path: "/slow.md?raw", Status: 200},
+		{Time: ago(time.Millisecond), Path: "/missing.md", Status: 404, ID: "first"},
+		{Time: ago(time.Second), Path: "/_markdownd/status", Status: 500},
+		{Time: ago(time.Millisecond), Path: "/broken.md", Status: 500, ID: "second"},
+	} {
+		m.begin()
+		e := e
+		m.end(&e)
+	}
+
+	s := m.status(2)
+	if s.Requests != 5 || s.ByStatus["500"] != 2 || s.InFlight != 0 {
+		t.Logf("Expected 5 requests, 2 with status 500, got: %d %v", s.Requests, s.ByStatus)
+		t.Fail()
+	}
+	if len(s.Slowest) != 2 || s.Slowest[0].Path != "/slow.md" {
+		t.Logf("Expected /slow.md first of 2 slowest pages, got: %+v", s.Slowest)
+		t.Fail()
+	}
+	if len(s.Errors) != 2 || s.Errors[0].ID != "second" || s.Errors[1].ID != "first" {
+		t.Logf("Expected page errors newest first, got: %+v", s.Errors)
+		t.Fail()
+	}
+	if s.Memory.HeapAlloc == 0 || s.Goroutines == 0 {
+		t.Logf("Expected memory stats, got: %+v", s.Memory)
+		t.Fail()
+	}
+
+	// the ring keeps the last maxErrors
+	for i := 0; i < maxErrors+3; i++ {
+		m.begin()
+		m.end(&accessEntry{Time: time.Now(), Path: "/gone.md", Status: 410, ID: fmt.Sprint(i)})
+	}
+	s = m.status(10)
+	if len(s.Errors) != maxErrors || s.Errors[0].ID != fmt.Sprint(maxErrors+2) || s.Errors[maxErrors-1].ID != "3" {
+		t.Logf("Expected the last %d errors, got: %+v", maxErrors, s.Errors)
+		t.Fail()
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// mountPoint serves a directory under a url prefix
+type mountPoint struct {
+	Prefix string
+	Dir    string
+}
+
+// mountList is the repeatable -mount flag, '/prefix=directory'
+type mountList []mountPoint
+
+func (m *mountList) String() string {
+	if m == nil {
+		return ""
+	}
+	var s []string
+	for _, mp := range *m {
+		s = append(s, mp.Prefix+"="+mp.Dir)
+	}
+	return strings.Join(s, ",")
+}
+
+func (m *mountList) Set(value string) error {
+	i := strings.IndexByte(value, '=')
+	if i == -1 {
+		return fmt.Errorf("expected /prefix=directory, got %q", value)
+	}
+	prefix, dir := path.Clean("/"+strings.Trim(value[:i], "/")), value[i+1:]
+	if prefix == "/" || strings.Contains(prefix, "..") || dir == "" {
+		return fmt.Errorf("expected /prefix=directory, got %q", value)
+	}
+	for _, mp := range *m {
+		if mp.Prefix == prefix {
+			return fmt.Errorf("%s is mounted twice", prefix)
+		}
+	}
+	*m = append(*m, mountPoint{Prefix: prefix, Dir: dir})
+	return nil
+}
+
+// siteWide reports whether the path is an endpoint that doesn't need a
+// directory (probes, stats, stylesheet)
+func siteWide(urlpath string) bool {
+	switch urlpath {
+	case "/healthz", "/readyz", "/gh.css", "/_markdownd/stats", "/_markdownd/metrics":
+		return true
+	}
+	return false
+}
+
+// handler returns a copy of root serving the directory of mp, under
+// root.Prefix
+func (mp mountPoint) handler(root Handler) Handler {
+	dir := prepareDirectory(mp.Dir)
+	root.Root, root.RootString, root.Prefix = os.DirFS(dir), dir, root.Prefix+mp.Prefix
+	return root
+}
+
+// mount registers the directories of mounts on mux, under root.Prefix.
+// root handles the rest, or only site wide endpoints when it has no directory.
+func mount(mux *http.ServeMux, root *Handler, mounts mountList) {
+	var first http.Handler
+	if root.Root != nil {
+		first = root
+	}
+	for _, mp := range mounts {
+		m := mp.handler(*root)
+		if err := checkRoot(m.RootString); err != nil {
+			println("warning:", err.Error())
+		}
+		// '/docs' redirects to '/docs/'
+		mux.Handle(m.Prefix+"/", http.StripPrefix(m.Prefix, m))
+		status("mounted:", m.Prefix+"/", "->", m.RootString)
+		if first == nil {
+			first = m
+		}
+	}
+	if root.Root != nil && root.Prefix == "" {
+		mux.Handle("/", root)
+		return
+	}
+	if root.Root != nil {
+		mux.Handle(root.Prefix+"/", http.StripPrefix(root.Prefix, root))
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if siteWide(r.URL.Path) {
+			first.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
+
+// cleanPrefix returns the -prefix flag as '/docs', or "" for none
+func cleanPrefix(prefix string) (string, error) {
+	if strings.Contains(prefix, "..") {
+		return "", fmt.Errorf("bad -prefix %q", prefix)
+	}
+	if prefix = path.Clean("/" + strings.Trim(prefix, "/")); prefix == "/" {
+		return "", nil
+	}
+	return prefix, nil
+}
+
+// root relative links and images in rendered markdown
+var reRootLink = regexp.MustCompile(`(<(?:a|img)\s[^>]*?(?:href|src)=")/([^/])`)
+
+// prefixLinks points root relative links in html at prefix, so documents
+// written for '/' keep working under it
+func prefixLinks(html []byte, prefix string) []byte {
+	if prefix == "" {
+		return html
+	}
+	return reRootLink.ReplaceAll(html, []byte("${1}"+prefix+"/${2}"))
+}
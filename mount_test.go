@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMountList(t *testing.T) {
+	var m mountList
+	if err := m.Set("/docs/=./docs"); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if err := m.Set("wiki=../wiki"); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if got := m.String(); got != "/docs=./docs,/wiki=../wiki" {
+		t.Log("Expected cleaned prefixes, got:", got)
+		t.Fail()
+	}
+	for _, bad := range []string{"/docs=elsewhere", "/=docs", "docs", "/a/../..=docs", "/x="} {
+		if err := m.Set(bad); err == nil {
+			t.Log("Expected an error for", bad)
+			t.Fail()
+		}
+	}
+}
+
+func TestMount(t *testing.T) {
+	*jsonld = true
+	defer func() { *jsonld = false }()
+
+	mux := http.NewServeMux()
+	mount(mux, &Handler{}, mountList{{Prefix: "/docs", Dir: "docs"}, {Prefix: "/more/docs", Dir: "docs"}})
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+		mux.ServeHTTP(w, req)
+		body, _ := ioutil.ReadAll(w.Body)
+		return w.Code, string(body)
+	}
+
+	code, body := get("/docs/index.md")
+	if code != 200 || !strings.Contains(body, `"url":"http://example.com/docs/index.md"`) ||
+		!strings.Contains(body, `"item":"http://example.com/docs/"`) {
+		t.Log("Expected the page with prefixed urls, got:", code, body)
+		t.Fail()
+	}
+	if code, body := get("/more/docs/text.txt"); code != 200 || body == "" {
+		t.Log("Expected text.txt under a nested prefix, got:", code)
+		t.Fail()
+	}
+	if code, _ := get("/docs"); code != http.StatusMovedPermanently {
+		t.Log("Expected a redirect to /docs/, got:", code)
+		t.Fail()
+	}
+	// no directory argument, only site wide endpoints at /
+	if code, _ := get("/index.md"); code != 404 {
+		t.Log("Expected 404 outside the mounts, got:", code)
+		t.Fail()
+	}
+	if code, _ := get("/healthz"); code != 200 {
+		t.Log("Expected /healthz, got:", code)
+		t.Fail()
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	dir := prepareDirectory("docs")
+	mux := http.NewServeMux()
+	mount(mux, &Handler{Root: os.DirFS(dir), RootString: dir, Prefix: "/docs"}, mountList{{Prefix: "/wiki", Dir: "docs"}})
+	get := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+		mux.ServeHTTP(w, req)
+		body, _ := ioutil.ReadAll(w.Body)
+		return w.Code, string(body)
+	}
+
+	code, body := get("/docs/")
+	if code != 200 || !strings.Contains(body, `src="/docs/markdownd.png"`) ||
+		!strings.Contains(body, `href="https://markdownd.herokuapp.com"`) {
+		t.Log("Expected the index with prefixed links, got:", code, body)
+		t.Fail()
+	}
+	if code, body := get("/docs/wiki/"); code != 200 || !strings.Contains(body, `src="/docs/wiki/markdownd.png"`) {
+		t.Log("Expected mounts under the prefix, got:", code, body)
+		t.Fail()
+	}
+	if code, _ := get("/index.md"); code != 404 {
+		t.Log("Expected 404 outside the prefix, got:", code)
+		t.Fail()
+	}
+	if code, _ := get("/healthz"); code != 200 {
+		t.Log("Expected /healthz outside the prefix, got:", code)
+		t.Fail()
+	}
+}
+
+func TestCleanPrefix(t *testing.T) {
+	for in, want := range map[string]string{"": "", "/": "", "docs": "/docs", "/docs/": "/docs", "/a//b": "/a/b"} {
+		if got, err := cleanPrefix(in); err != nil || got != want {
+			t.Logf("cleanPrefix(%q): expected %q, got %q %v", in, want, got, err)
+			t.Fail()
+		}
+	}
+	if _, err := cleanPrefix("/a/.."); err == nil {
+		t.Log("Expected an error for ..")
+		t.Fail()
+	}
+}
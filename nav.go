@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io/fs"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// navItem is a page or directory in the navigation tree of a site
+type navItem struct {
+	Title    string
+	URL      string // "" for a directory without an index page
+	Weight   int    // front matter weight, lighter first
+	Current  bool   // the page being rendered
+	Active   bool   // the page being rendered, or a directory holding it
+	Children []*navItem
+}
+
+// nav builds the navigation tree of the markdown files in Root, for the
+// page name. pages and directories are ordered by front matter weight,
+// then title, and titled by front matter or their first heading. hidden
+// and '_' files, symlinks and directories without markdown are left out.
+// the returned items are the top level, without the home page.
+func (h Handler) nav(current string) []*navItem {
+	index := h.index()
+	root := &navItem{}
+	dirs := map[string]*navItem{".": root}
+	fs.WalkDir(h.Root, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		base := d.Name()
+		if name != "." && (strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_")) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if name != "." {
+				dirs[name] = &navItem{Title: segmentName(base)}
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !strings.HasSuffix(base, ".md") {
+			return nil
+		}
+		b, err := fs.ReadFile(h.Root, name)
+		if err != nil {
+			return nil
+		}
+		fm, md := parseFrontMatter(b)
+		if hideDraft(name, fm) {
+			return nil
+		}
+		item := &navItem{Title: pageTitle(fm, md), URL: h.Prefix + "/" + name, Weight: fm.Int("weight"), Current: name == current}
+		if item.Title == "" {
+			item.Title = segmentName(base)
+		}
+		parent := dirs[path.Dir(name)]
+		if base == index {
+			// the index page names and links its directory
+			item.URL = strings.TrimSuffix(item.URL, index)
+			item.Children = parent.Children
+			*parent = *item
+			return nil
+		}
+		parent.Children = append(parent.Children, item)
+		return nil
+	})
+
+	// attach directories to their parents, deepest first
+	var names []string
+	for name := range dirs {
+		if name != "." {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if di, dj := strings.Count(names[i], "/"), strings.Count(names[j], "/"); di != dj {
+			return di > dj
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		dir := dirs[name]
+		if len(dir.Children) == 0 && dir.URL == "" {
+			continue
+		}
+		if index == "gen" {
+			dir.URL = h.Prefix + "/" + name + "/"
+		}
+		parent := dirs[path.Dir(name)]
+		parent.Children = append(parent.Children, dir)
+	}
+	sortNav(root.Children)
+	return root.Children
+}
+
+// sortNav orders items by weight (unweighted last) and title, and marks
+// the directories leading to the current page
+func sortNav(items []*navItem) bool {
+	weight := func(it *navItem) int {
+		if it.Weight == 0 {
+			return math.MaxInt32
+		}
+		return it.Weight
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if wi, wj := weight(items[i]), weight(items[j]); wi != wj {
+			return wi < wj
+		}
+		return strings.ToLower(items[i].Title) < strings.ToLower(items[j].Title)
+	})
+	var active bool
+	for _, it := range items {
+		if sortNav(it.Children) || it.Current {
+			it.Active = true
+			active = true
+		}
+	}
+	return active
+}
+
+// crumbs returns the breadcrumb trail to urlpath, a path under h.Prefix.
+// directories are titled by their index page, or by their name, and the
+// page itself by title.
+func (h Handler) crumbs(urlpath, title string) []crumb {
+	trail := breadcrumbs(urlpath, title)
+	index := h.index()
+	for i := range trail {
+		c := &trail[i]
+		if i != 0 && i != len(trail)-1 && index != "gen" {
+			name := strings.TrimPrefix(c.URL, "/") + index
+			if b, err := fs.ReadFile(h.Root, name); err == nil && (h.RootString == "" || fileisgood(filepath.Join(h.RootString, filepath.FromSlash(name)))) {
+				if t := pageTitle(parseFrontMatter(b)); t != "" {
+					c.Name = t
+				}
+			}
+		}
+		c.URL = h.Prefix + c.URL
+	}
+	return trail
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNav(t *testing.T) {
+	h := Handler{Prefix: "/docs", Root: fstest.MapFS{
+		"index.md":               {Data: []byte("# Home\n")},
+		"zebra.md":               {Data: []byte("---\nweight: 1\n---\n# Zebra first\n")},
+		"apple.md":               {Data: []byte("# Apple\n")},
+		"guide/index.md":         {Data: []byte("---\ntitle: The guide\nweight: 2\n---\n")},
+		"guide/install.md":       {Data: []byte("# Install\n")},
+		"guide/advanced/deep.md": {Data: []byte("no heading\n")},
+		"empty/notes.txt":        {Data: []byte("no markdown here\n")},
+		"_partials/header.md":    {Data: []byte("# Partial\n")},
+		".hidden.md":             {Data: []byte("# Hidden\n")},
+	}}
+	var lines []string
+	var walk func(items []*navItem, depth int)
+	walk = func(items []*navItem, depth int) {
+		for _, it := range items {
+			line := strings.Repeat("  ", depth) + it.Title + " " + it.URL
+			if it.Current {
+				line += " current"
+			} else if it.Active {
+				line += " active"
+			}
+			lines = append(lines, line)
+			walk(it.Children, depth+1)
+		}
+	}
+	walk(h.nav("guide/advanced/deep.md"), 0)
+	got := strings.Join(lines, "\n")
+	want := strings.Join([]string{
+		"Zebra first /docs/zebra.md",
+		"The guide /docs/guide/ active",
+		"  Advanced  active",
+		"    Deep /docs/guide/advanced/deep.md current",
+		"  Install /docs/guide/install.md",
+		"Apple /docs/apple.md",
+	}, "\n")
+	if got != want {
+		t.Logf("Expected nav:\n%s\ngot:\n%s", want, got)
+		t.Fail()
+	}
+}
+
+func TestNavTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(`{{define "nav"}}<ul>{{range .}}<li{{if .Current}} class="current"{{end}}>` +
+		`<a href="{{.URL}}">{{.Title}}</a>{{if .Children}}{{template "nav" .Children}}{{end}}</li>{{end}}</ul>{{end}}` +
+		`<nav>{{template "nav" .Nav}}</nav>{{.Content}}`))
+	h := Handler{template: tmpl, Root: fstest.MapFS{
+		"index.md":   {Data: []byte("# Home\n")},
+		"a/index.md": {Data: []byte("# Section\n")},
+		"a/b.md":     {Data: []byte("# Page\n")},
+	}}
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/a/b.md", nil)
+	h.ServeHTTP(rec, req)
+	want := `<nav><ul><li><a href="/a/">Section</a><ul><li class="current"><a href="/a/b.md">Page</a></li></ul></li></ul></nav>`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Logf("Expected %s in:\n%s", want, rec.Body.String())
+		t.Fail()
+	}
+}
+
+func TestBreadcrumbs(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(`{{range .Breadcrumbs}}[{{.Name}}]({{.URL}}) {{end}}`))
+	h := Handler{template: tmpl, Prefix: "/docs", Root: fstest.MapFS{
+		"index.md":                        {Data: []byte("---\ntitle: Site\n---\n")},
+		"user-guide/index.md":             {Data: []byte("---\ntitle: The User Guide\n---\n")},
+		"user-guide/getting_started/a.md": {Data: []byte("# Page A\n")},
+	}}
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/user-guide/getting_started/a.md", nil)
+	h.ServeHTTP(rec, req)
+	want := "[Home](/docs/) [The User Guide](/docs/user-guide/) [Getting started](/docs/user-guide/getting_started/) [Page A](/docs/user-guide/getting_started/a.md) "
+	if rec.Body.String() != want {
+		t.Logf("Expected %q, got %q", want, rec.Body.String())
+		t.Fail()
+	}
+}
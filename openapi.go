@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// reOpenAPI matches the version key starting an openapi or swagger
+// document, in yaml or json
+var reOpenAPI = regexp.MustCompile(`(?m)^(?:openapi|swagger)\s*:|^\s*\{?\s*"(?:openapi|swagger)"\s*:`)
+
+// reOpenAPITitle matches the indented title of the info of a yaml document
+var reOpenAPITitle = regexp.MustCompile(`(?m)^[ \t]+title:[ \t]*(.+?)[ \t]*$`)
+
+// isOpenAPI reports whether the file name holding b is an openapi or
+// swagger document: a .yaml, .yml or .json file saying so near its top
+func isOpenAPI(name string, b []byte) bool {
+	switch path.Ext(name) {
+	case ".yaml", ".yml", ".json":
+	default:
+		return false
+	}
+	if len(b) > 4096 {
+		b = b[:4096]
+	}
+	return reOpenAPI.Match(b)
+}
+
+// openAPITitle returns the info title of an openapi document, or ""
+func openAPITitle(b []byte) string {
+	var doc struct {
+		Info struct {
+			Title string `json:"title"`
+		} `json:"info"`
+	}
+	if json.Unmarshal(b, &doc) == nil {
+		return doc.Info.Title
+	}
+	if i := bytes.Index(b, []byte("\ninfo:")); i != -1 {
+		if m := reOpenAPITitle.FindSubmatch(b[i+1:]); m != nil {
+			return strings.Trim(string(m[1]), `"'`)
+		}
+	}
+	return ""
+}
+
+// the viewer packages -openapi loads, pinned so a new release isn't run
+// on the docs before it is looked at
+const (
+	redocPackage     = "redoc@2.1.5"
+	swaggerUIPackage = "swagger-ui-dist@5.17.14"
+)
+
+// openAPIAssetsPrefix is where a -openapi-assets directory is served
+const openAPIAssetsPrefix = componentsPrefix + "openapi/"
+
+// openAPIDir is the -openapi-assets directory, "" when it is a url
+var openAPIDir string
+
+// openAPIViewer is the page content showing a document with redoc or
+// swagger ui, loaded from -openapi-assets
+var openAPIViewer = template.Must(template.New("openapi").Parse(`{{if eq .UI "swagger"}}<link rel="stylesheet" href="{{.Assets}}/` + swaggerUIPackage + `/swagger-ui.css">
+<div id="openapi"></div>
+<script src="{{.Assets}}/` + swaggerUIPackage + `/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: {{.Spec}}, dom_id: "#openapi"});</script>
+{{else}}<div id="openapi"></div>
+<script src="{{.Assets}}/` + redocPackage + `/bundles/redoc.standalone.js"></script>
+<script>Redoc.init({{.Spec}}, {}, document.getElementById("openapi"));</script>
+{{end}}`))
+
+// setOpenAPIAssets checks -openapi-assets: a directory holding the viewer
+// packages, served from this server, or the url of one
+func setOpenAPIAssets(assets string) error {
+	openAPIDir = ""
+	if assets == "" {
+		return fmt.Errorf("-openapi needs -openapi-assets, a directory holding %s and %s, or their url", redocPackage, swaggerUIPackage)
+	}
+	fi, err := os.Stat(assets)
+	switch {
+	case err == nil && fi.IsDir():
+		openAPIDir = assets
+	case err == nil:
+		return fmt.Errorf("-openapi-assets: %s is not a directory", assets)
+	case strings.Contains(assets, "://") || strings.HasPrefix(assets, "/"):
+		// a url, on this server or another
+	default:
+		return fmt.Errorf("-openapi-assets: %v", err)
+	}
+	return nil
+}
+
+// openAPIAssets returns the base url of the viewer packages
+func (h Handler) openAPIAssets() string {
+	if openAPIDir != "" {
+		return h.Prefix + strings.TrimSuffix(openAPIAssetsPrefix, "/")
+	}
+	return strings.TrimSuffix(*openapiAssets, "/")
+}
+
+// serveOpenAPIAsset serves the file of the -openapi-assets directory
+// named by the url path, or returns false if there is none
+func serveOpenAPIAsset(w http.ResponseWriter, r *http.Request) bool {
+	if openAPIDir == "" || !strings.HasPrefix(r.URL.Path, openAPIAssetsPrefix) {
+		return false
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.StripPrefix(openAPIAssetsPrefix, http.FileServer(http.Dir(openAPIDir))).ServeHTTP(w, r)
+	return true
+}
+
+// serveOpenAPI shows the openapi document name, at urlpath, in the page
+// layout or between -header and -footer. the viewer fetches the document
+// itself with '?raw'.
+func (h Handler) serveOpenAPI(w http.ResponseWriter, r *http.Request, requestid, abs, name string, b []byte) {
+	var content bytes.Buffer
+	err := openAPIViewer.Execute(&content, struct{ UI, Assets, Spec string }{
+		UI:     *openapi,
+		Assets: h.openAPIAssets(),
+		Spec:   h.Prefix + r.URL.Path + "?raw",
+	})
+	if err != nil {
+		logger.Printf("%s openapi error: %q %v", requestid, abs, err)
+		http.Error(w, "500 template error", http.StatusInternalServerError)
+		return
+	}
+	title := openAPITitle(b)
+	if title == "" {
+		title = path.Base(name)
+	}
+	fm := frontMatter{"title": title}
+	var head [][]byte
+	if h.analytics != nil {
+		head = append(head, h.analytics)
+	}
+	h.writePage(w, requestid, abs, pageData{
+		Title:   title,
+		Content: template.HTML(content.String()),
+		Path:    h.Prefix + r.URL.Path,
+		Page:    fm,
+		Site:    siteVars,
+		h:       h,
+		name:    name,
+	}, head)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOpenAPI(t *testing.T) {
+	yaml := "openapi: 3.0.0\ninfo:\n  title: 'Pet store'\n  version: 1.0.0\npaths: {}\n"
+	json := `{"swagger": "2.0", "info": {"title": "Legacy API"}}`
+	h := Handler{Prefix: "/docs", Root: fstest.MapFS{
+		"api/openapi.yaml": {Data: []byte(yaml)},
+		"swagger.json":     {Data: []byte(json)},
+		"data.json":        {Data: []byte(`{"a": 1}`)},
+	}}
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	browser := "text/html,application/xhtml+xml,*/*;q=0.8"
+
+	defer func(ui string) { *openapi = ui }(*openapi)
+	*openapi = ""
+	if body := get("/api/openapi.yaml", browser).Body.String(); body != yaml {
+		t.Log("Expected the raw document without -openapi, got:", body)
+		t.Fail()
+	}
+
+	*openapi = "redoc"
+	rec := get("/api/openapi.yaml", browser)
+	for _, want := range []string{"redoc.standalone.js", `Redoc.init("/docs/api/openapi.yaml?raw"`} {
+		if !strings.Contains(rec.Body.String(), want) || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+			t.Logf("Expected %q in a html page, got %s:\n%s", want, rec.Header().Get("Content-Type"), rec.Body.String())
+			t.Fail()
+		}
+	}
+	for path, want := range map[string]string{"/api/openapi.yaml?raw": yaml, "/data.json": `{"a": 1}`} {
+		if body := get(path, browser).Body.String(); body != want {
+			t.Logf("%s: expected the file, got: %s", path, body)
+			t.Fail()
+		}
+	}
+	if body := get("/swagger.json", "application/json").Body.String(); body != json {
+		t.Log("Expected the file for api clients, got:", body)
+		t.Fail()
+	}
+
+	*openapi = "swagger"
+	if body := get("/swagger.json", browser).Body.String(); !strings.Contains(body, `SwaggerUIBundle({url: "/docs/swagger.json?raw"`) {
+		t.Log("Expected swagger ui, got:", body)
+		t.Fail()
+	}
+
+	// self-hosted viewer packages
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, redocPackage, "bundles"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, redocPackage, "bundles", "redoc.standalone.js"), []byte("var Redoc;"), 0644)
+	defer setOpenAPIAssets("https://cdn.jsdelivr.net/npm")
+	for _, bad := range []string{"", "missing-vendor", filepath.Join(dir, redocPackage, "bundles", "redoc.standalone.js")} {
+		if err := setOpenAPIAssets(bad); err == nil {
+			t.Logf("Expected an error for -openapi-assets %q", bad)
+			t.Fail()
+		}
+	}
+	if err := setOpenAPIAssets(dir); err != nil {
+		t.Fatal(err)
+	}
+	*openapi = "redoc"
+	script := "/_markdownd/assets/openapi/" + redocPackage + "/bundles/redoc.standalone.js"
+	if body := get("/api/openapi.yaml", browser).Body.String(); !strings.Contains(body, `src="/docs`+script+`"`) {
+		t.Log("Expected redoc from this server, got:", body)
+		t.Fail()
+	}
+	if body := get(script, "*/*").Body.String(); body != "var Redoc;" {
+		t.Log("Expected the self-hosted script, got:", body)
+		t.Fail()
+	}
+
+	for doc, want := range map[string]string{yaml: "Pet store", json: "Legacy API", "openapi: 3.1.0\n": ""} {
+		if got := openAPITitle([]byte(doc)); got != want {
+			t.Logf("Expected title %q, got %q", want, got)
+			t.Fail()
+		}
+	}
+}
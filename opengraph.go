@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// openGraph returns Open Graph and twitter card meta tags for the markdown
+// page at urlpath of the site base, under the url prefix, so links unfurl
+// with a title, summary and image in chat and social media
+func openGraph(base, prefix, urlpath string, fm frontMatter, md []byte) []byte {
+	var buf strings.Builder
+	meta := func(attr, property, content string) {
+		if content != "" {
+			fmt.Fprintf(&buf, "<meta %s=\"%s\" content=\"%s\">\n", attr, property, html.EscapeString(content))
+		}
+	}
+	title, description := pageTitle(fm, md), truncate(pageSummary(fm, md), 300)
+	image, alt := pageImage(base, prefix, urlpath, fm, md)
+	meta("property", "og:type", "article")
+	meta("property", "og:title", title)
+	meta("property", "og:description", description)
+	meta("property", "og:url", base+urlpath)
+	meta("property", "og:site_name", *siteName)
+	meta("property", "og:image", image)
+	meta("property", "og:image:alt", alt)
+	card := "summary"
+	if image != "" {
+		card = "summary_large_image"
+	}
+	meta("name", "twitter:card", card)
+	meta("name", "twitter:site", *twitterSite)
+	meta("name", "twitter:title", title)
+	meta("name", "twitter:description", description)
+	meta("name", "twitter:image", image)
+	meta("name", "twitter:image:alt", alt)
+	return []byte(buf.String())
+}
+
+// pageImage returns the absolute url and alt text of the front matter
+// 'image' of a page, or of its first markdown image. relative images are
+// resolved against the page at urlpath, and root relative ones under the
+// url prefix, as links are.
+func pageImage(base, prefix, urlpath string, fm frontMatter, md []byte) (src, alt string) {
+	src, alt = fm.String("image"), fm.String("image_alt")
+	if src == "" {
+		if m := reImageURL.FindSubmatch(md); m != nil {
+			src, alt = string(m[2]), string(m[1])
+		}
+	}
+	if src == "" {
+		return "", ""
+	}
+	if strings.HasPrefix(src, "/") && !strings.HasPrefix(src, "//") {
+		src = prefix + src
+	}
+	page, err := url.Parse(base + urlpath)
+	if err != nil {
+		return "", ""
+	}
+	u, err := page.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", ""
+	}
+	return u.String(), alt
+}
+
+// truncate shortens s to at most n runes, at a word boundary
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	cut := string(runes[:n])
+	if i := strings.LastIndex(cut, " "); i > n/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
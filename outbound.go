@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// clientConfig configures the http client used for outgoing requests
+// (slack, confluence, and anything else fetching remote content)
+type clientConfig struct {
+	proxy   string
+	timeout time.Duration
+	retries int
+	caFile  string
+}
+
+var outbound clientConfig
+
+func init() {
+	outbound.flags(flag.CommandLine)
+}
+
+// flags registers the outgoing request flags on fs, subcommands share them
+func (c *clientConfig) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.proxy, "client-proxy", "", "proxy url for outgoing requests (default from $HTTPS_PROXY, $HTTP_PROXY, $NO_PROXY)")
+	fs.DurationVar(&c.timeout, "client-timeout", 30*time.Second, "timeout for each outgoing request")
+	fs.IntVar(&c.retries, "client-retries", 2, "retry idempotent outgoing requests this many times on network errors, 429 and 5xx")
+	fs.StringVar(&c.caFile, "client-ca", "", "pem file with extra certificate authorities for outgoing requests (corporate proxies)")
+}
+
+// newHTTPClient returns a client for the configuration
+func (c *clientConfig) newHTTPClient() (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if c.proxy != "" {
+		u, err := url.Parse(c.proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("bad -client-proxy %q", c.proxy)
+		}
+		proxy = http.ProxyURL(u)
+	}
+	var tlsConfig *tls.Config
+	if c.caFile != "" {
+		pem, err := ioutil.ReadFile(c.caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", c.caFile)
+		}
+		tlsConfig = &tls.Config{RootCAs: pool}
+	}
+	transport := &http.Transport{
+		Proxy: proxy,
+		// happy eyeballs: try ipv4 if ipv6 doesn't connect quickly
+		DialContext: (&net.Dialer{
+			Timeout:       10 * time.Second,
+			KeepAlive:     30 * time.Second,
+			FallbackDelay: 300 * time.Millisecond,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: c.timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &http.Client{
+		Transport: &retryTransport{next: transport, retries: c.retries},
+		Timeout:   c.timeout * time.Duration(c.retries+1),
+	}, nil
+}
+
+// shared client, made on first use
+var (
+	httpClientOnce sync.Once
+	httpClient     *http.Client
+)
+
+// outboundClient returns the shared client for outgoing requests
+func outboundClient() *http.Client {
+	httpClientOnce.Do(func() {
+		var err error
+		if httpClient, err = outbound.newHTTPClient(); err != nil {
+			logger.Println("outgoing requests:", err)
+			httpClient = &http.Client{Timeout: outbound.timeout}
+		}
+	})
+	return httpClient
+}
+
+// retryTransport retries idempotent requests on network errors, 429 and
+// 502, 503, 504, with exponential backoff
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int
+}
+
+// retryLimit caps the wait between attempts, even if Retry-After asks for more
+const retryLimit = 10 * time.Second
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	idempotent := req.Method == "GET" || req.Method == "HEAD" || req.Method == "PUT" ||
+		req.Method == "DELETE" || req.Method == "OPTIONS"
+	if !idempotent || (req.Body != nil && req.GetBody == nil) {
+		return t.next.RoundTrip(req)
+	}
+	wait := 250 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		try := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			// round trippers must not modify the request
+			try = req.Clone(req.Context())
+			try.Body = body
+		}
+		resp, err := t.next.RoundTrip(try)
+		if attempt >= t.retries || !retryable(resp, err) {
+			return resp, err
+		}
+		delay := wait
+		if resp != nil {
+			if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+				delay = time.Duration(s) * time.Second
+			}
+			resp.Body.Close()
+		}
+		if delay > retryLimit {
+			delay = retryLimit
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		wait *= 2
+	}
+}
+
+// retryable reports whether a response or error is worth another attempt
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var nerr net.Error
+		return errors.As(err, &nerr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	c := clientConfig{timeout: 5 * time.Second, retries: 2}
+	client, err := c.newHTTPClient()
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	// PUT is idempotent, the body is sent again
+	req, _ := http.NewRequest("PUT", server.URL, strings.NewReader("page"))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != "page" || atomic.LoadInt32(&calls) != 3 {
+		t.Log("Expected success on the third attempt, got:", resp.StatusCode, string(body), calls)
+		t.Fail()
+	}
+
+	// POST is not
+	atomic.StoreInt32(&calls, 0)
+	resp, err = client.Post(server.URL, "text/plain", strings.NewReader("x"))
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(&calls) != 1 {
+		t.Log("Expected one attempt for POST, got:", err, calls)
+		t.Fail()
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+	}))
+	defer proxy.Close()
+
+	c := clientConfig{proxy: proxy.URL, timeout: 5 * time.Second}
+	client, err := c.newHTTPClient()
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	resp, err := client.Get("http://docs.example.invalid/page")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	resp.Body.Close()
+	if got := <-proxied; got != "http://docs.example.invalid/page" {
+		t.Log("Expected the request through the proxy, got:", got)
+		t.Fail()
+	}
+
+	dir, _ := ioutil.TempDir("", "markdownd")
+	defer os.RemoveAll(dir)
+	notpem := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(notpem, []byte("not a certificate"), 0644)
+	for _, bad := range []clientConfig{{proxy: "not a url"}, {caFile: notpem}, {caFile: filepath.Join(dir, "missing")}} {
+		if _, err := bad.newHTTPClient(); err == nil {
+			t.Logf("Expected an error for %+v", bad)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// A4 in points, with 2cm margins
+const (
+	pdfWidth  = 595.0
+	pdfHeight = 842.0
+	pdfMargin = 56.0
+)
+
+// standard type1 fonts, no embedding needed
+const (
+	fontRegular = "F1" // Helvetica
+	fontBold    = "F2" // Helvetica-Bold
+	fontMono    = "F3" // Courier
+	fontItalic  = "F4" // Helvetica-Oblique
+)
+
+var pdfFontNames = []string{"Helvetica", "Helvetica-Bold", "Courier", "Helvetica-Oblique"}
+
+// widths of WinAnsi characters 32-126, from the Adobe font metrics
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// winAnsi maps the few non latin-1 characters WinAnsiEncoding has
+var winAnsi = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// toWinAnsi encodes s for the standard fonts, unknown characters become '?'
+func toWinAnsi(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			out = append(out, "    "...)
+		case r >= 32 && r < 127, r >= 160 && r <= 255:
+			out = append(out, byte(r))
+		case winAnsi[r] != 0:
+			out = append(out, winAnsi[r])
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// textWidth returns the width of encoded text in points
+func textWidth(text []byte, font string, size float64) float64 {
+	var w int
+	for _, c := range text {
+		switch {
+		case font == fontMono:
+			w += 600
+		case c >= 32 && c < 127 && font == fontBold:
+			w += helveticaBoldWidths[c-32]
+		case c >= 32 && c < 127:
+			w += helveticaWidths[c-32]
+		case c == 0x95:
+			w += 350
+		default:
+			w += 556
+		}
+	}
+	return float64(w) * size / 1000
+}
+
+// pdfString escapes encoded text for a pdf literal string
+func pdfString(text []byte) string {
+	var buf bytes.Buffer
+	buf.WriteByte('(')
+	for _, c := range text {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < 32 || c > 126:
+			fmt.Fprintf(&buf, "\\%03o", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+// pdfTextString encodes s as utf-16 for outlines and document info
+func pdfTextString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&buf, "%04X", u)
+	}
+	buf.WriteByte('>')
+	return buf.String()
+}
+
+// printSettings are the running header and footer of the pages of an
+// exported pdf, and its cover page. the header and footer are text with
+// {title}, {section} (the title of the page), {page}, {pages} and {date},
+// 'none' for nothing.
+type printSettings struct {
+	Header, Footer string
+	Cover          string // "", "title" for a title page, or a markdown file
+	Subtitle, Date string
+}
+
+// newPrintSettings returns the print settings of the flags, with the front
+// matter of the document (the page, or SUMMARY.md) overriding them
+func newPrintSettings(header, footer, cover string, fm frontMatter) (printSettings, error) {
+	p := printSettings{Header: header, Footer: footer, Cover: cover, Subtitle: fm.String("subtitle"), Date: fm.String("date")}
+	p = p.override(fm)
+	if _, ok := fm["pdf_cover"]; ok {
+		switch {
+		case !fm.Bool("pdf_cover"):
+			p.Cover = ""
+		case p.Cover == "":
+			p.Cover = "title"
+		}
+	}
+	if p.Date == "" {
+		t, err := buildTime()
+		if err != nil {
+			return p, err
+		}
+		p.Date = t.Format("2006-01-02")
+	}
+	return p, nil
+}
+
+// override returns p with the pdf_header and pdf_footer of the front
+// matter fm
+func (p printSettings) override(fm frontMatter) printSettings {
+	if _, ok := fm["pdf_header"]; ok {
+		p.Header = fm.String("pdf_header")
+	}
+	if _, ok := fm["pdf_footer"]; ok {
+		p.Footer = fm.String("pdf_footer")
+	}
+	return p
+}
+
+// expand fills in the placeholders of the header, footer or cover s
+func (p printSettings) expand(s, title, section string, page, pages int) string {
+	if strings.EqualFold(strings.TrimSpace(s), "none") {
+		return ""
+	}
+	return strings.NewReplacer("{title}", title, "{subtitle}", p.Subtitle, "{section}", section,
+		"{page}", strconv.Itoa(page), "{pages}", strconv.Itoa(pages), "{date}", p.Date).Replace(s)
+}
+
+// writePDF renders files, in order, into one pdf with bookmarks, and the
+// header, footer and cover page of p
+func writePDF(w io.Writer, title string, files []string, p printSettings) error {
+	doc := newPDF(title)
+	doc.print = p
+	if p.Cover != "" {
+		if err := doc.addCover(); err != nil {
+			return err
+		}
+	}
+	for _, filename := range files {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		fm, md := parseFrontMatter(b)
+		blocks := parseBlocks(md)
+		name := pageTitle(fm, md)
+		if name == "" {
+			name = segmentName(filepath.Base(filename))
+		}
+
+		// each document starts a page, with its own header and footer
+		page := p.override(fm)
+		doc.current = runningText{header: page.Header, footer: page.Footer, section: name}
+		doc.newPage()
+		if len(blocks) == 0 || blocks[0].Kind != blockHeading {
+			doc.bookmark(name, 1)
+		}
+		doc.addBlocks(blocks)
+	}
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// outlineItem is a pdf bookmark
+type outlineItem struct {
+	title    string
+	level    int
+	page     int
+	y        float64
+	parent   *outlineItem
+	children []*outlineItem
+	id       int
+}
+
+// runningText is what the header and footer of a page say
+type runningText struct {
+	header, footer, section string
+}
+
+// pdfDoc lays out blocks of text onto pages
+type pdfDoc struct {
+	title    string
+	pages    []*bytes.Buffer
+	running  []runningText // of each page
+	current  runningText   // of the pages started next
+	cover    int           // pages of the cover, without header or footer
+	print    printSettings
+	y        float64
+	outlines []*outlineItem
+}
+
+func newPDF(title string) *pdfDoc {
+	return &pdfDoc{title: title}
+}
+
+// newPage starts a page
+func (d *pdfDoc) newPage() {
+	d.pages = append(d.pages, new(bytes.Buffer))
+	d.running = append(d.running, d.current)
+	d.y = pdfHeight - pdfMargin
+}
+
+// addCover lays out the cover page, a third down the page: the markdown
+// file of the cover, or the title, subtitle and date
+func (d *pdfDoc) addCover() error {
+	d.newPage()
+	d.y = pdfHeight * 2 / 3
+	if d.print.Cover == "title" {
+		d.centered(d.title, fontBold, 28)
+		if d.print.Subtitle != "" {
+			d.space(8)
+			d.centered(d.print.Subtitle, fontRegular, 16)
+		}
+		d.space(24)
+		d.centered(d.print.Date, fontRegular, 11)
+	} else {
+		b, err := ioutil.ReadFile(d.print.Cover)
+		if err != nil {
+			return err
+		}
+		_, md := parseFrontMatter(b)
+		md = []byte(d.print.expand(string(md), d.title, "", 0, 0))
+		// the headings of the cover aren't bookmarks
+		outlines := len(d.outlines)
+		d.addBlocks(parseBlocks(md))
+		d.outlines = d.outlines[:outlines]
+	}
+	d.cover = len(d.pages)
+	return nil
+}
+
+// runningMarks returns the header and footer of page i, centered in the
+// margins
+func (d *pdfDoc) runningMarks(i int) string {
+	var buf bytes.Buffer
+	r := d.running[i]
+	for _, mark := range []struct {
+		text string
+		y    float64
+	}{{r.header, pdfHeight - pdfMargin/2 - 4}, {r.footer, pdfMargin/2 - 4}} {
+		text := toWinAnsi(d.print.expand(mark.text, d.title, r.section, i-d.cover+1, len(d.pages)-d.cover))
+		if len(text) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "BT /%s 9.0 Tf %.2f %.2f Td %s Tj ET\n",
+			fontRegular, (pdfWidth-textWidth(text, fontRegular, 9))/2, mark.y, pdfString(text))
+	}
+	return buf.String()
+}
+
+// space makes sure there is room for h points, or starts a page
+func (d *pdfDoc) space(h float64) {
+	if len(d.pages) == 0 || d.y-h < pdfMargin {
+		d.newPage()
+	}
+	d.y -= h
+}
+
+// line writes one line of text at the current position
+func (d *pdfDoc) line(text []byte, font string, size, x float64) {
+	d.space(size * 1.4)
+	fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %.1f Tf %.2f %.2f Td %s Tj ET\n",
+		font, size, x, d.y, pdfString(text))
+}
+
+// wrap breaks text into encoded lines no wider than width
+func wrap(text string, font string, size, width float64) [][]byte {
+	var lines [][]byte
+	var cur []byte
+	for _, word := range strings.Fields(text) {
+		w := toWinAnsi(word)
+		try := w
+		if len(cur) != 0 {
+			try = append(append(append([]byte{}, cur...), ' '), w...)
+		}
+		if len(cur) != 0 && textWidth(try, font, size) > width {
+			lines = append(lines, cur)
+			cur = w
+			continue
+		}
+		cur = try
+	}
+	if len(cur) != 0 {
+		lines = append(lines, cur)
+	}
+	return lines
+}
+
+// paragraph wraps text to the page width and writes it
+func (d *pdfDoc) paragraph(text string, font string, size, indent float64) {
+	for _, l := range wrap(text, font, size, pdfWidth-2*pdfMargin-indent) {
+		d.line(l, font, size, pdfMargin+indent)
+	}
+}
+
+// centered wraps text to the page width and writes it centered
+func (d *pdfDoc) centered(text string, font string, size float64) {
+	for _, l := range wrap(text, font, size, pdfWidth-2*pdfMargin) {
+		d.line(l, font, size, (pdfWidth-textWidth(l, font, size))/2)
+	}
+}
+
+// bookmark adds an outline entry pointing at the current position
+func (d *pdfDoc) bookmark(title string, level int) {
+	if len(d.pages) == 0 {
+		d.newPage()
+	}
+	d.outlines = append(d.outlines, &outlineItem{
+		title: title,
+		level: level,
+		page:  len(d.pages) - 1,
+		y:     d.y,
+	})
+}
+
+// headingSizes for levels 1-6
+var headingSizes = [...]float64{20, 16, 13, 12, 11, 11}
+
+// addBlocks lays out a markdown document
+func (d *pdfDoc) addBlocks(blocks []block) {
+	markers := listMarkers(blocks)
+	for i, b := range blocks {
+		switch b.Kind {
+		case blockHeading:
+			size := headingSizes[b.Level-1]
+			d.space(size * 0.8)
+			d.bookmark(b.Text, b.Level)
+			d.paragraph(b.Text, fontBold, size, 0)
+		case blockParagraph:
+			d.paragraph(b.Text, fontRegular, 11, 0)
+		case blockListItem:
+			indent := 14 + 14*float64(b.Level)
+			d.paragraph(markers[i]+" "+b.Text, fontRegular, 11, indent)
+		case blockQuote:
+			d.paragraph(b.Text, fontItalic, 11, 20)
+		case blockCode:
+			for _, l := range strings.Split(b.Text, "\n") {
+				d.line(toWinAnsi(l), fontMono, 9, pdfMargin+10)
+			}
+		case blockRule:
+			d.space(12)
+			fmt.Fprintf(d.pages[len(d.pages)-1], "%.2f %.2f m %.2f %.2f l S\n",
+				pdfMargin, d.y+6, pdfWidth-pdfMargin, d.y+6)
+			continue
+		}
+		d.space(6)
+	}
+}
+
+// outlineTree nests the flat bookmark list by heading level
+func (d *pdfDoc) outlineTree() []*outlineItem {
+	var roots, stack []*outlineItem
+	for _, o := range d.outlines {
+		for len(stack) != 0 && stack[len(stack)-1].level >= o.level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, o)
+		} else {
+			o.parent = stack[len(stack)-1]
+			o.parent.children = append(o.parent.children, o)
+		}
+		stack = append(stack, o)
+	}
+	return roots
+}
+
+// WriteTo writes the finished pdf
+func (d *pdfDoc) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.newPage()
+	}
+
+	// object numbers: 1 catalog, 2 pages, 3 info, fonts, then page+content pairs,
+	// then outline root and items
+	fontObj := 4
+	pageObj := fontObj + len(pdfFontNames)
+	outlineObj := pageObj + 2*len(d.pages)
+	roots := d.outlineTree()
+	next := outlineObj + 1
+	var number func(items []*outlineItem)
+	number = func(items []*outlineItem) {
+		for _, o := range items {
+			o.id = next
+			next++
+			number(o.children)
+		}
+	}
+	number(roots)
+
+	var buf bytes.Buffer
+	offsets := make([]int, next)
+	obj := func(n int, body string) {
+		offsets[n] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", n, body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	catalog := "<< /Type /Catalog /Pages 2 0 R"
+	if len(roots) != 0 {
+		catalog += fmt.Sprintf(" /Outlines %d 0 R /PageMode /UseOutlines", outlineObj)
+	}
+	obj(1, catalog+" >>")
+
+	var kids []string
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageObj+2*i))
+	}
+	obj(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj(3, fmt.Sprintf("<< /Title %s /Producer (markdownd %s) >>", pdfTextString(d.title), version))
+
+	var fonts []string
+	for i, name := range pdfFontNames {
+		obj(fontObj+i, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+		fonts = append(fonts, fmt.Sprintf("/F%d %d 0 R", i+1, fontObj+i))
+	}
+
+	for i, content := range d.pages {
+		obj(pageObj+2*i, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			pdfWidth, pdfHeight, strings.Join(fonts, " "), pageObj+2*i+1))
+		stream := content.String()
+		if i >= d.cover {
+			stream += d.runningMarks(i)
+		}
+		obj(pageObj+2*i+1, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(stream), stream))
+	}
+
+	// outlines
+	var count func(items []*outlineItem) int
+	count = func(items []*outlineItem) int {
+		n := len(items)
+		for _, o := range items {
+			n += count(o.children)
+		}
+		return n
+	}
+	var writeItems func(items []*outlineItem, parent int)
+	writeItems = func(items []*outlineItem, parent int) {
+		for i, o := range items {
+			s := fmt.Sprintf("<< /Title %s /Parent %d 0 R /Dest [%d 0 R /XYZ 0 %.2f 0]",
+				pdfTextString(o.title), parent, pageObj+2*o.page, o.y+headingSizes[o.level-1])
+			if i > 0 {
+				s += fmt.Sprintf(" /Prev %d 0 R", items[i-1].id)
+			}
+			if i < len(items)-1 {
+				s += fmt.Sprintf(" /Next %d 0 R", items[i+1].id)
+			}
+			if len(o.children) != 0 {
+				s += fmt.Sprintf(" /First %d 0 R /Last %d 0 R /Count %d",
+					o.children[0].id, o.children[len(o.children)-1].id, count(o.children))
+			}
+			obj(o.id, s+" >>")
+			writeItems(o.children, o.id)
+		}
+	}
+	if len(roots) != 0 {
+		obj(outlineObj, fmt.Sprintf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>",
+			roots[0].id, roots[len(roots)-1].id, count(roots)))
+		writeItems(roots, outlineObj)
+	} else {
+		obj(outlineObj, "<< /Type /Outlines /Count 0 >>")
+	}
+
+	// cross reference table
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", next)
+	for _, off := range offsets[1:] {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", next, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
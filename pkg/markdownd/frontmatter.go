@@ -0,0 +1,139 @@
+package markdownd
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// FrontMatter holds the 'key: value' pairs found between '---' lines
+// at the top of a markdown file. values are string or []string.
+type FrontMatter map[string]interface{}
+
+var fmDelim = []byte("---")
+
+// ParseFrontMatter splits a markdown document into front matter and body.
+// only a small subset of yaml is understood: scalars, [inline, lists]
+// and '- item' lists. documents without front matter are returned as-is.
+func ParseFrontMatter(b []byte) (FrontMatter, []byte) {
+	fm := FrontMatter{}
+	if !bytes.HasPrefix(b, fmDelim) {
+		return fm, b
+	}
+
+	// first line must be exactly '---'
+	nl := bytes.IndexByte(b, '\n')
+	if nl == -1 || string(bytes.TrimSpace(b[:nl])) != "---" {
+		return fm, b
+	}
+
+	// find closing delimiter
+	rest := b[nl+1:]
+	end := -1
+	offset := 0
+	for offset < len(rest) {
+		line := rest[offset:]
+		if i := bytes.IndexByte(line, '\n'); i != -1 {
+			line = line[:i+1]
+		}
+		if t := string(bytes.TrimSpace(line)); t == "---" || t == "..." {
+			end = offset
+			offset += len(line)
+			break
+		}
+		offset += len(line)
+	}
+	if end == -1 {
+		return fm, b
+	}
+
+	var lastkey string
+	scanner := bufio.NewScanner(bytes.NewReader(rest[:end]))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// '- item' belongs to the previous key
+		if strings.HasPrefix(trimmed, "- ") && lastkey != "" {
+			list, _ := fm[lastkey].([]string)
+			fm[lastkey] = append(list, unquote(strings.TrimSpace(trimmed[2:])))
+			continue
+		}
+
+		i := strings.IndexByte(line, ':')
+		if i == -1 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		val := strings.TrimSpace(line[i+1:])
+		lastkey = key
+		switch {
+		case val == "":
+			fm[key] = []string{}
+		case strings.HasPrefix(val, "[") && strings.HasSuffix(val, "]"):
+			var list []string
+			for _, item := range strings.Split(val[1:len(val)-1], ",") {
+				if item = unquote(strings.TrimSpace(item)); item != "" {
+					list = append(list, item)
+				}
+			}
+			fm[key] = list
+		default:
+			fm[key] = unquote(val)
+		}
+	}
+
+	return fm, rest[offset:]
+}
+
+// unquote removes matching single or double quotes
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// String returns the value of key, joining lists with ", "
+func (fm FrontMatter) String(key string) string {
+	switch v := fm[key].(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ", ")
+	}
+	return ""
+}
+
+// List returns the value of key as a list (a scalar is split on commas)
+func (fm FrontMatter) List(key string) []string {
+	switch v := fm[key].(type) {
+	case []string:
+		return v
+	case string:
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// Bool returns true if key is set to a true-ish value
+func (fm FrontMatter) Bool(key string) bool {
+	b, _ := strconv.ParseBool(fm.String(key))
+	return b || fm.String(key) == "yes"
+}
+
+// Int returns the value of key as an integer, or 0
+func (fm FrontMatter) Int(key string) int {
+	i, _ := strconv.Atoi(fm.String(key))
+	return i
+}
@@ -0,0 +1,50 @@
+package markdownd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RequestHook runs before a request is served, for authentication or
+// rewriting. it returns the request to serve, changed or not, or nil when
+// it has answered the request itself.
+type RequestHook func(w http.ResponseWriter, r *http.Request) *http.Request
+
+// RenderHook changes the html rendered from the markdown file name,
+// before the header and footer are added
+type RenderHook func(r *http.Request, name string, html []byte) []byte
+
+// ErrorHandler answers a request that failed, such as a missing file with
+// http.StatusNotFound. err wraps fs.ErrNotExist for missing files.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// WithRequestHook runs hook before each request. hooks run in the order
+// they are added, and the first to answer stops the rest.
+func WithRequestHook(hook RequestHook) Option {
+	return func(s *Server) { s.Before = append(s.Before, hook) }
+}
+
+// WithRenderHook runs hook on the html of each rendered page, in the order
+// hooks are added
+func WithRenderHook(hook RenderHook) Option {
+	return func(s *Server) { s.AfterRender = append(s.AfterRender, hook) }
+}
+
+// WithErrorHandler answers failed requests with h instead of http.Error
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(s *Server) { s.OnError = h }
+}
+
+// fail answers a failed request with OnError, or a plain text error
+func (s *Server) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if s.OnError != nil {
+		s.OnError(w, r, status, err)
+		return
+	}
+	if status == http.StatusNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	http.Error(w, fmt.Sprintf("%d %s", status, strings.ToLower(http.StatusText(status))), status)
+}
@@ -0,0 +1,34 @@
+package markdownd
+
+import (
+	"net"
+	"strconv"
+)
+
+// Listen listens on the tcp address addr, such as "127.0.0.1:0" for a free
+// port, and returns the url it is reached at, for programs that start a
+// server and then open or print it:
+//
+//	ln, url, err := markdownd.Listen("127.0.0.1:0")
+//	go http.Serve(ln, markdownd.New(os.DirFS("docs")))
+func Listen(addr string) (net.Listener, string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", err
+	}
+	return ln, URL(ln.Addr()), nil
+}
+
+// URL returns the http url of a tcp address, on localhost when it is every
+// address or loopback, or "" for other networks such as unix sockets
+func URL(addr net.Addr) string {
+	a, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	host := "localhost"
+	if !a.IP.IsUnspecified() && !a.IP.IsLoopback() {
+		host = a.IP.String()
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(a.Port)) + "/"
+}
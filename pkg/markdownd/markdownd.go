@@ -0,0 +1,183 @@
+// Package markdownd renders markdown files as html over http, for mounting
+// in another program's mux:
+//
+//	http.Handle("/docs/", http.StripPrefix("/docs", markdownd.New(os.DirFS("docs"))))
+//
+// Server is a small server of its own: the markdownd command serves with
+// its own handler, which shares the page pipeline of this package (front
+// matter, rendering, sanitizing, titles) and the rules of Hidden, and
+// adds logging, access control, search and the rest.
+package markdownd
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Server renders the markdown files in Root and serves other files as-is.
+// symlinks are followed if Root follows them, as os.DirFS does. dot files,
+// drafts and pages under embargo are not found.
+type Server struct {
+	Root   fs.FS
+	Index  string        // file for paths ending in '/', or "gen" for a listing
+	Header []byte        // html before each rendered page
+	Footer []byte        // html after each rendered page
+	Render RenderOptions // how pages are rendered
+	Drafts bool          // serve drafts, see IsDraft
+
+	Before      []RequestHook // run before each request
+	AfterRender []RenderHook  // run on the html of each rendered page
+	OnError     ErrorHandler  // answers failed requests, nil for http.Error
+
+	files http.Handler
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithIndex serves name for paths ending in '/', "gen" lists the directory
+func WithIndex(name string) Option {
+	return func(s *Server) { s.Index = name }
+}
+
+// WithHeader writes html before each rendered page
+func WithHeader(html []byte) Option {
+	return func(s *Server) { s.Header = html }
+}
+
+// WithFooter writes html after each rendered page
+func WithFooter(html []byte) Option {
+	return func(s *Server) { s.Footer = html }
+}
+
+// WithDrafts serves drafts: pages with 'draft: true' front matter and
+// files under _drafts/
+func WithDrafts() Option {
+	return func(s *Server) { s.Drafts = true }
+}
+
+// WithRenderOptions sets how pages are rendered
+func WithRenderOptions(o RenderOptions) Option {
+	return func(s *Server) { s.Render = o }
+}
+
+// New returns a handler serving root, with index.md for paths ending in '/'
+func New(root fs.FS, opts ...Option) http.Handler {
+	s := &Server{
+		Root:   root,
+		Index:  "index.md",
+		Header: []byte("<!DOCTYPE html>\n"),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.files = http.FileServer(http.FS(FilterListings(root, s.hidden)))
+	return s
+}
+
+// hidden reports whether the file name is not found, see Hidden
+func (s *Server) hidden(name string, fm FrontMatter) bool {
+	return Hidden(name, fm, s.Drafts, time.Now())
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, hook := range s.Before {
+		if r = hook(w, r); r == nil {
+			return
+		}
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		s.fail(w, r, http.StatusNotFound, fmt.Errorf("method %s: %w", r.Method, fs.ErrNotExist))
+		return
+	}
+	if strings.Contains(r.URL.Path, "..") {
+		s.fail(w, r, http.StatusNotFound, &fs.PathError{Op: "open", Path: r.URL.Path, Err: fs.ErrInvalid})
+		return
+	}
+	if s.hidden(strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")+"/", nil) {
+		s.fail(w, r, http.StatusNotFound, &fs.PathError{Op: "open", Path: r.URL.Path, Err: fs.ErrNotExist})
+		return
+	}
+	if s.Index == "gen" && strings.HasSuffix(r.URL.Path, "/") {
+		s.files.ServeHTTP(w, r)
+		return
+	}
+
+	name, err := s.resolve(r.URL.Path)
+	if err != nil {
+		s.fail(w, r, http.StatusNotFound, err)
+		return
+	}
+	if strings.HasSuffix(name, ".md") {
+		s.serveMarkdown(w, r, name)
+		return
+	}
+	s.files.ServeHTTP(w, r)
+}
+
+// resolve maps a url path to the file in Root to serve
+func (s *Server) resolve(urlpath string) (string, error) {
+	name := strings.TrimPrefix(path.Clean("/"+urlpath), "/")
+	if strings.HasSuffix(urlpath, "/") {
+		name = path.Join(name, s.Index)
+	}
+
+	// .html suffix, but .md exists. serve the .md
+	if strings.HasSuffix(name, ".html") {
+		if md := strings.TrimSuffix(name, ".html") + ".md"; isFile(s.Root, md) {
+			name = md
+		}
+	}
+
+	if name == "" {
+		name = "."
+	}
+	fi, err := fs.Stat(s.Root, name)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(urlpath, "/") && !fi.Mode().IsRegular() {
+		return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return name, nil
+}
+
+// serveMarkdown renders the markdown file name, or serves its source when
+// asked for with ?raw or 'Accept: text/markdown'
+func (s *Server) serveMarkdown(w http.ResponseWriter, r *http.Request, name string) {
+	b, err := fs.ReadFile(s.Root, name)
+	if err != nil {
+		s.fail(w, r, http.StatusNotFound, err)
+		return
+	}
+	if fm, _ := ParseFrontMatter(b); s.hidden(name, fm) {
+		s.fail(w, r, http.StatusNotFound, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist})
+		return
+	}
+
+	// caches keep rendered and raw responses apart
+	w.Header().Add("Vary", "Accept")
+	if strings.Contains(r.URL.RawQuery, "raw") || PrefersMarkdown(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Write(b)
+		return
+	}
+	html := RenderPage(b, s.Render).HTML
+	for _, hook := range s.AfterRender {
+		html = hook(r, name, html)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(s.Header)
+	w.Write(html)
+	w.Write(s.Footer)
+}
+
+// isFile reports whether name is a regular file in fsys
+func isFile(fsys fs.FS, name string) bool {
+	fi, err := fs.Stat(fsys, name)
+	return err == nil && fi.Mode().IsRegular()
+}
@@ -0,0 +1,253 @@
+package markdownd
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	root := fstest.MapFS{
+		"index.md":        {Data: []byte("---\ntitle: home\n---\n# welcome\n")},
+		"guide/intro.md":  {Data: []byte("intro <script>alert(1)</script>\n")},
+		"guide/notes.txt": {Data: []byte("plain notes\n")},
+	}
+	h := New(root, WithHeader([]byte("<header>")), WithFooter([]byte("<footer>")))
+	get := func(path, accept string) (int, string, string) {
+		req, _ := http.NewRequest("GET", path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		body, _ := ioutil.ReadAll(w.Body)
+		return w.Code, w.Header().Get("Content-Type"), string(body)
+	}
+
+	code, ct, body := get("/", "")
+	if code != 200 || ct != "text/html; charset=utf-8" || !strings.HasPrefix(body, "<header>") ||
+		!strings.Contains(body, "welcome") || strings.Contains(body, "title: home") || !strings.HasSuffix(body, "<footer>") {
+		t.Log("Expected the rendered index, got:", code, ct, body)
+		t.Fail()
+	}
+	if _, _, body := get("/guide/intro.html", ""); !strings.Contains(body, "intro") || strings.Contains(body, "<script>") {
+		t.Log("Expected intro.md rendered and sanitized for .html, got:", body)
+		t.Fail()
+	}
+	if _, ct, body := get("/index.md", "text/markdown"); ct != "text/markdown; charset=utf-8" || !strings.HasPrefix(body, "---\n") {
+		t.Log("Expected the source, got:", ct, body)
+		t.Fail()
+	}
+	if _, _, body := get("/index.md?raw", ""); !strings.HasPrefix(body, "---\n") {
+		t.Log("Expected the source for ?raw, got:", body)
+		t.Fail()
+	}
+	if code, _, body := get("/guide/notes.txt", ""); code != 200 || body != "plain notes\n" {
+		t.Log("Expected the text file as-is, got:", code, body)
+		t.Fail()
+	}
+	for _, path := range []string{"/missing.md", "/guide/../../etc/passwd", "/guide/"} {
+		if code, _, _ := get(path, ""); code != 404 {
+			t.Log("Expected 404 for", path, "got:", code)
+			t.Fail()
+		}
+	}
+
+	h = New(root, WithIndex("gen"))
+	if code, _, body := get("/guide/", ""); code != 200 || !strings.Contains(body, `href="intro.md"`) {
+		t.Log("Expected a directory listing, got:", code, body)
+		t.Fail()
+	}
+}
+
+func TestServerHides(t *testing.T) {
+	soon := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	root := fstest.MapFS{
+		"index.md":                 {Data: []byte("# home\n")},
+		"plan.md":                  {Data: []byte("---\ndraft: true\n---\n# plan\n")},
+		"launch.md":                {Data: []byte("---\nembargo_until: " + soon + "\n---\n# launch\n")},
+		"_drafts/idea.md":          {Data: []byte("# idea\n")},
+		".env":                     {Data: []byte("SECRET=1\n")},
+		".git/config":              {Data: []byte("[core]\n")},
+		".well-known/security.txt": {Data: []byte("Contact: mailto:security@example.com\n")},
+	}
+	get := func(h http.Handler, path string) (int, string) {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	h := New(root, WithIndex("gen"))
+	for _, path := range []string{"/plan.md", "/plan.html", "/launch.md", "/_drafts/idea.md", "/_drafts/", "/.env", "/.git/config", "/.git/"} {
+		if code, _ := get(h, path); code != 404 {
+			t.Log("Expected 404 for", path, "got:", code)
+			t.Fail()
+		}
+	}
+	if code, _ := get(h, "/.well-known/security.txt"); code != 200 {
+		t.Log("Expected .well-known served, got:", code)
+		t.Fail()
+	}
+	code, body := get(h, "/")
+	if code != 200 || !strings.Contains(body, "index.md") {
+		t.Log("Expected a listing, got:", code, body)
+		t.Fail()
+	}
+	for _, name := range []string{"plan.md", "launch.md", "_drafts", ".env", ".git"} {
+		if strings.Contains(body, `href="`+name) {
+			t.Log("Expected", name, "left out of the listing, got:", body)
+			t.Fail()
+		}
+	}
+
+	h = New(root, WithDrafts())
+	for _, path := range []string{"/plan.md", "/_drafts/idea.md"} {
+		if code, _ := get(h, path); code != 200 {
+			t.Log("Expected the draft", path, "served WithDrafts, got:", code)
+			t.Fail()
+		}
+	}
+	if code, _ := get(h, "/launch.md"); code != 404 {
+		t.Log("Expected the embargoed page hidden WithDrafts too, got:", code)
+		t.Fail()
+	}
+}
+
+func TestRenderPage(t *testing.T) {
+	page := RenderPage([]byte("---\ntags: [a, b]\n---\n"+"```\n# not a heading\n```\n## Title\n<script>x</script>"), RenderOptions{})
+	if page.Title != "Title" || len(page.FrontMatter.List("tags")) != 2 {
+		t.Logf("Expected the first heading outside code and two tags, got %q %v", page.Title, page.FrontMatter)
+		t.Fail()
+	}
+	if html := string(page.HTML); !strings.Contains(html, "Title</h2>") || strings.Contains(html, "<script>") {
+		t.Log("Expected sanitized html, got:", html)
+		t.Fail()
+	}
+	if page := RenderPage([]byte("---\ntitle: From front matter\n---\n# Heading\n"), RenderOptions{}); page.Title != "From front matter" {
+		t.Log("Expected the front matter title, got:", page.Title)
+		t.Fail()
+	}
+}
+
+func TestPrefersMarkdown(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"text/markdown":                       true,
+		"text/markdown, */*;q=0.1":            true,
+		"text/html,application/xhtml+xml,*/*": false,
+		"text/html, text/markdown;q=0.5":      false,
+		"text/markdown;q=0":                   false,
+		"":                                    false,
+	} {
+		if got := PrefersMarkdown(accept); got != want {
+			t.Logf("%q: expected %v, got %v", accept, want, got)
+			t.Fail()
+		}
+	}
+}
+
+func TestWriteHead(t *testing.T) {
+	head := [][]byte{[]byte("<meta a>"), []byte("<meta b>")}
+	for _, header := range []string{"<html><HEAD><title>x</title></HEAD><body>", "<body>", ""} {
+		var b strings.Builder
+		if err := WriteHead(&b, []byte(header), head); err != nil {
+			t.Fatal(err)
+		}
+		if want := string(InjectHead([]byte(header), head)); b.String() != want {
+			t.Logf("%q: wrote %q, expected %q", header, b.String(), want)
+			t.Fail()
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	root := fstest.MapFS{
+		"index.md": {Data: []byte("# welcome\n")},
+		"new.md":   {Data: []byte("moved here\n")},
+	}
+	auth := func(w http.ResponseWriter, r *http.Request) *http.Request {
+		if r.Header.Get("X-User") == "" {
+			http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+			return nil
+		}
+		return r
+	}
+	rewrite := func(w http.ResponseWriter, r *http.Request) *http.Request {
+		if r.URL.Path == "/old.md" {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/new.md"
+			return r2
+		}
+		return r
+	}
+	var rendered []string
+	render := func(r *http.Request, name string, html []byte) []byte {
+		rendered = append(rendered, name)
+		return append(html, []byte("<p>for "+r.Header.Get("X-User")+"</p>")...)
+	}
+	var failed error
+	notFound := func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		failed = err
+		w.WriteHeader(status)
+		w.Write([]byte("custom " + r.URL.Path))
+	}
+	h := New(root, WithRequestHook(auth), WithRequestHook(rewrite), WithRenderHook(render), WithErrorHandler(notFound))
+	get := func(path, user string) (int, string) {
+		req, _ := http.NewRequest("GET", path, nil)
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	if code, _ := get("/", ""); code != 401 || len(rendered) != 0 {
+		t.Log("Expected the first hook to answer 401, got:", code, rendered)
+		t.Fail()
+	}
+	if code, body := get("/old.md", "ann"); code != 200 || !strings.Contains(body, "moved here") || !strings.HasSuffix(body, "<p>for ann</p>") {
+		t.Log("Expected the rewritten page with the render hook's html, got:", code, body)
+		t.Fail()
+	}
+	if len(rendered) != 1 || rendered[0] != "new.md" {
+		t.Log("Expected the render hook to see new.md, got:", rendered)
+		t.Fail()
+	}
+	if code, body := get("/missing.md", "ann"); code != 404 || body != "custom /missing.md" || !errors.Is(failed, fs.ErrNotExist) {
+		t.Log("Expected the error handler for a missing file, got:", code, body, failed)
+		t.Fail()
+	}
+	if code, body := get("/missing.png", "ann"); code != 404 || body != "custom /missing.png" {
+		t.Log("Expected the error handler for a missing static file, got:", code, body)
+		t.Fail()
+	}
+}
+
+func TestListen(t *testing.T) {
+	ln, url, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go http.Serve(ln, New(fstest.MapFS{"index.md": {Data: []byte("# Home\n")}}))
+	if !strings.HasPrefix(url, "http://localhost:") || strings.HasSuffix(url, ":0/") {
+		t.Fatal("expected the bound port in the url, got", url)
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(b), "Home</h1>") {
+		t.Logf("%s: got %q", url, b)
+		t.Fail()
+	}
+}
@@ -0,0 +1,43 @@
+package markdownd
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// Page is a rendered markdown document
+type Page struct {
+	FrontMatter FrontMatter
+	Title       string // front matter title, or the first heading
+	HTML        []byte // sanitized, nil for an empty document
+}
+
+// RenderPage splits the front matter from a markdown document and renders
+// the rest. it is the pipeline Server uses, and the one compiled to
+// WebAssembly for previews in the browser. the command's includes,
+// shortcodes, wiki links and code annotations and tabs are not run.
+func RenderPage(b []byte, o RenderOptions) Page {
+	fm, src := ParseFrontMatter(b)
+	return Page{FrontMatter: fm, Title: Title(fm, src), HTML: Render(src, o)}
+}
+
+// Title returns the front matter title, or the first heading outside of
+// code fences
+func Title(fm FrontMatter, md []byte) string {
+	if title := fm.String("title"); title != "" {
+		return title
+	}
+	var fenced bool
+	scanner := bufio.NewScanner(bytes.NewReader(md))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~"):
+			fenced = !fenced
+		case !fenced && strings.HasPrefix(line, "#"):
+			return strings.TrimSpace(strings.TrimLeft(line, "#"))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package markdownd
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// Date returns the value of key as a date, such as 2006-01-02 or
+// 2006-01-02T15:04:05Z
+func (fm FrontMatter) Date(key string) (time.Time, bool) {
+	v := strings.TrimSpace(fm.String(key))
+	if v == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// IsDraft reports whether the page name, a slash separated path, is a
+// draft: 'draft: true' in its front matter, or a file under a _drafts
+// directory
+func IsDraft(name string, fm FrontMatter) bool {
+	for _, dir := range strings.Split(path.Dir(name), "/") {
+		if dir == "_drafts" {
+			return true
+		}
+	}
+	return fm.Bool("draft")
+}
+
+// Embargoed reports whether the page is under embargo at now: made
+// public at its 'embargo_until' time, such as 2026-11-03T09:00:00Z
+func Embargoed(fm FrontMatter, now time.Time) (time.Time, bool) {
+	until, ok := fm.Date("embargo_until")
+	return until, ok && now.Before(until)
+}
+
+// Hidden reports whether the file name, slash separated and with a
+// trailing slash for directories, is not served: a dot file but for
+// .well-known, a draft unless drafts is true, or a page under embargo at
+// now. Server and the markdownd command both hide files with it.
+func Hidden(name string, fm FrontMatter, drafts bool, now time.Time) bool {
+	if isDotfile(strings.TrimSuffix(name, "/")) || !drafts && IsDraft(name, fm) {
+		return true
+	}
+	_, embargo := Embargoed(fm, now)
+	return embargo
+}
+
+// isDotfile reports whether the slash separated path name has a dot
+// file or directory in it, but for .well-known
+func isDotfile(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if strings.HasPrefix(elem, ".") && elem != "." && elem != ".well-known" {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterListings wraps fsys so the directory listings it gives, such as
+// http.FileServer writes, leave out the entries hide reports. hide gets
+// directories with a trailing slash and no front matter, markdown files
+// with theirs.
+func FilterListings(fsys fs.FS, hide func(name string, fm FrontMatter) bool) fs.FS {
+	return filteredFS{fsys, hide}
+}
+
+type filteredFS struct {
+	fs.FS
+	hide func(name string, fm FrontMatter) bool
+}
+
+func (f filteredFS) Open(name string) (fs.File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := file.(fs.ReadDirFile); ok {
+		return filteredDir{d, f, name}, nil
+	}
+	return file, nil
+}
+
+// filteredDir is a directory of a filteredFS
+type filteredDir struct {
+	fs.ReadDirFile
+	fsys filteredFS
+	name string
+}
+
+func (d filteredDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	for {
+		batch, err := d.ReadDirFile.ReadDir(n)
+		for _, e := range batch {
+			if !d.hidden(e) {
+				entries = append(entries, e)
+			}
+		}
+		if n <= 0 || len(entries) != 0 || err != nil {
+			return entries, err
+		}
+	}
+}
+
+// hidden reports whether the entry e of the directory is left out
+func (d filteredDir) hidden(e fs.DirEntry) bool {
+	name := path.Join(d.name, e.Name())
+	if e.IsDir() {
+		return d.fsys.hide(name+"/", nil)
+	}
+	if !strings.HasSuffix(name, ".md") {
+		return d.fsys.hide(name, nil)
+	}
+	b, err := fs.ReadFile(d.fsys.FS, name)
+	if err != nil {
+		return false
+	}
+	fm, _ := ParseFrontMatter(b)
+	return d.fsys.hide(name, fm)
+}
@@ -0,0 +1,134 @@
+package markdownd
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday"
+	"github.com/shurcool/github_flavored_markdown"
+)
+
+// policy for sanitizing html from the blackfriday renderer.
+// github flavored markdown output is already sanitized by its package.
+var policy = bluemonday.UGCPolicy()
+
+// GFMExtensions are the github flavored markdown parsing extensions,
+// for rendering with blackfriday when the gfm renderer can't be used
+const GFMExtensions = blackfriday.EXTENSION_NO_INTRA_EMPHASIS |
+	blackfriday.EXTENSION_TABLES |
+	blackfriday.EXTENSION_FENCED_CODE |
+	blackfriday.EXTENSION_AUTOLINK |
+	blackfriday.EXTENSION_STRIKETHROUGH |
+	blackfriday.EXTENSION_SPACE_HEADERS |
+	blackfriday.EXTENSION_NO_EMPTY_LINE_BEFORE_BLOCK |
+	blackfriday.EXTENSION_AUTO_HEADER_IDS
+
+// RenderOptions change how markdown is rendered
+type RenderOptions struct {
+	TOC          bool // table of contents at the top
+	Plain        bool // no github flavored markdown extensions
+	NoInlineHTML bool // strip html embedded in markdown
+}
+
+// Render converts markdown to sanitized html, nil for empty input
+func Render(in []byte, o RenderOptions) []byte {
+	if len(in) == 0 {
+		return nil
+	}
+
+	// the gfm renderer has no flags, so skipping inline html
+	// uses blackfriday with the gfm extensions
+	if o.Plain || o.NoInlineHTML {
+		// default flags
+		flags := 0
+		if o.TOC {
+			flags |= blackfriday.HTML_TOC
+		}
+		if o.NoInlineHTML {
+			flags |= blackfriday.HTML_SKIP_HTML
+		}
+		extensions := 0
+		if !o.Plain {
+			extensions = GFMExtensions
+		}
+		md := blackfriday.Markdown(
+			in, blackfriday.HtmlRenderer(
+				// html flags
+				flags,
+				"", ""),
+			// extensions
+			extensions)
+		return Sanitize(md)
+	}
+
+	return github_flavored_markdown.Markdown(in)
+}
+
+// Sanitize removes scripts, event handlers and other unsafe html
+func Sanitize(html []byte) []byte {
+	return policy.SanitizeBytes(html)
+}
+
+// PrefersMarkdown reports whether an Accept header asks for text/markdown
+// over text/html. wildcards only count for html, so browsers get pages.
+func PrefersMarkdown(accept string) bool {
+	var md, html float64
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v := strings.TrimSpace(param); strings.HasPrefix(v, "q=") {
+				if f, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(fields[0])) {
+		case "text/markdown", "text/x-markdown":
+			md = math.Max(md, q)
+		case "text/html", "text/*", "*/*":
+			html = math.Max(html, q)
+		}
+	}
+	return md > 0 && md >= html
+}
+
+// InjectHead inserts html before the closing </head> of header,
+// or appends it if header has no <head>
+func InjectHead(header []byte, html [][]byte) []byte {
+	if len(html) == 0 {
+		return header
+	}
+	extra := bytes.Join(html, nil)
+	i := bytes.Index(bytes.ToLower(header), []byte("</head>"))
+	if i == -1 {
+		return append(append([]byte{}, header...), extra...)
+	}
+	out := make([]byte, 0, len(header)+len(extra))
+	out = append(out, header[:i]...)
+	out = append(out, extra...)
+	return append(out, header[i:]...)
+}
+
+// WriteHead writes header to w with html inserted as InjectHead does,
+// without copying header
+func WriteHead(w io.Writer, header []byte, html [][]byte) error {
+	i := bytes.Index(bytes.ToLower(header), []byte("</head>"))
+	if i == -1 {
+		i = len(header)
+	}
+	if _, err := w.Write(header[:i]); err != nil {
+		return err
+	}
+	for _, b := range html {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(header[i:])
+	return err
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"plugin"
+	"strings"
+	"time"
+
+	"github.com/aerth/markdownd/pkg/markdownd"
+)
+
+// pluginLimit is the largest response read from a plugin process
+const pluginLimit = 8 << 20
+
+// pluginList is the repeatable -plugin flag: a go plugin 'transform.so',
+// or the command line of a plugin process
+type pluginList []string
+
+func (l *pluginList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *pluginList) Set(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("expected a .so file or a command")
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+// pagePlugin changes a markdown page before it is rendered, or renders
+// it. run returns the new markdown, or the html if it rendered the page,
+// or neither to leave the page as it is.
+type pagePlugin struct {
+	name string
+	run  func(name string, fm frontMatter, md []byte) (markdown, html []byte, err error)
+}
+
+// loaded plugins, in the order of the -plugin flags
+var pagePlugins []pagePlugin
+
+// loadPlugins loads the -plugin flags
+func loadPlugins(specs []string, timeout time.Duration) error {
+	for _, spec := range specs {
+		var p pagePlugin
+		var err error
+		if strings.HasSuffix(spec, ".so") {
+			p, err = goPlugin(spec)
+		} else {
+			p = processPlugin(spec, timeout)
+		}
+		if err != nil {
+			return fmt.Errorf("-plugin %s: %v", spec, err)
+		}
+		pagePlugins = append(pagePlugins, p)
+	}
+	return nil
+}
+
+// goPlugin opens a go plugin, built with 'go build -buildmode=plugin',
+// exporting either or both of:
+//
+//	func Transform(name string, frontMatter map[string]interface{}, markdown []byte) ([]byte, error)
+//	func Render(name string, markdown []byte) ([]byte, error)
+func goPlugin(file string) (pagePlugin, error) {
+	so, err := plugin.Open(file)
+	if err != nil {
+		return pagePlugin{}, err
+	}
+	var transform, render interface{}
+	if sym, err := so.Lookup("Transform"); err == nil {
+		transform = sym
+	}
+	if sym, err := so.Lookup("Render"); err == nil {
+		render = sym
+	}
+	return symbolPlugin(file, transform, render)
+}
+
+// symbolPlugin makes a plugin of the functions exported by a go plugin
+func symbolPlugin(name string, transform, render interface{}) (pagePlugin, error) {
+	t, tok := transform.(func(string, map[string]interface{}, []byte) ([]byte, error))
+	r, rok := render.(func(string, []byte) ([]byte, error))
+	switch {
+	case transform != nil && !tok:
+		return pagePlugin{}, fmt.Errorf("Transform is %T, expected func(string, map[string]interface{}, []byte) ([]byte, error)", transform)
+	case render != nil && !rok:
+		return pagePlugin{}, fmt.Errorf("Render is %T, expected func(string, []byte) ([]byte, error)", render)
+	case !tok && !rok:
+		return pagePlugin{}, errors.New("exports neither Transform nor Render")
+	}
+	return pagePlugin{name: name, run: func(page string, fm frontMatter, md []byte) ([]byte, []byte, error) {
+		if tok {
+			out, err := t(page, fm, md)
+			if err != nil {
+				return nil, nil, err
+			}
+			md = out
+		}
+		if rok {
+			html, err := r(page, md)
+			return md, html, err
+		}
+		return md, nil, nil
+	}}, nil
+}
+
+// pluginRequest is written to the stdin of a plugin process
+type pluginRequest struct {
+	Path        string      `json:"path"`
+	FrontMatter frontMatter `json:"front_matter"`
+	Markdown    string      `json:"markdown"`
+}
+
+// pluginResponse is read from its stdout. empty fields leave the page as
+// it is.
+type pluginResponse struct {
+	Markdown *string `json:"markdown"`
+	HTML     *string `json:"html"`
+	Error    string  `json:"error"`
+}
+
+// processPlugin runs a command for each page, with a json pluginRequest
+// on stdin and a json pluginResponse on stdout
+func processPlugin(cmdline string, timeout time.Duration) pagePlugin {
+	return pagePlugin{name: strings.Fields(cmdline)[0], run: func(name string, fm frontMatter, md []byte) ([]byte, []byte, error) {
+		req, err := json.Marshal(pluginRequest{Path: name, FrontMatter: fm, Markdown: string(md)})
+		if err != nil {
+			return nil, nil, err
+		}
+		out, err := runCommand(cmdline, req, timeout, pluginLimit)
+		if err != nil {
+			return nil, nil, err
+		}
+		var resp pluginResponse
+		if err := json.Unmarshal(out, &resp); err != nil {
+			return nil, nil, fmt.Errorf("bad response: %v", err)
+		}
+		switch {
+		case resp.Error != "":
+			return nil, nil, errors.New(resp.Error)
+		case resp.HTML != nil:
+			return md, []byte(*resp.HTML), nil
+		case resp.Markdown != nil:
+			return []byte(*resp.Markdown), nil, nil
+		}
+		return md, nil, nil
+	}}
+}
+
+// applyPlugins passes the markdown file name through the plugins, in
+// order, until one renders it. plugins that fail are logged and skipped.
+// html is nil if no plugin rendered the page, and sanitized if one did.
+func applyPlugins(name string, fm frontMatter, md []byte) (markdown, html []byte) {
+	for _, p := range pagePlugins {
+		out, rendered, err := p.run(name, fm, md)
+		if err != nil {
+			logger.Printf("plugin %s: %s: %v", p.name, name, err)
+			continue
+		}
+		if rendered != nil {
+			return out, markdownd.Sanitize(rendered)
+		}
+		md = out
+	}
+	return md, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessPlugins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	script := func(name, body string) string {
+		file := filepath.Join(dir, name)
+		ioutil.WriteFile(file, []byte("#!/bin/sh\n"+body+"\n"), 0755)
+		return file
+	}
+	upper := script("upper", `tr a-z A-Z | sed 's/"MARKDOWN"/"markdown"/'`)
+	render := script("render", `cat >/dev/null; echo '{"html": "<p>rendered</p><script>x</script>"}'`)
+	fail := script("fail", `cat >/dev/null; echo '{"error": "no thanks"}'`)
+	garbage := script("garbage", `cat >/dev/null; echo not json`)
+
+	defer func(p []pagePlugin) { pagePlugins = p }(pagePlugins)
+	pagePlugins = nil
+	if err := loadPlugins([]string{fail, garbage, upper}, time.Second); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	md, html := applyPlugins("a.md", frontMatter{"title": "x"}, []byte("# hello"))
+	if string(md) != "# HELLO" || html != nil {
+		t.Logf("Expected failing plugins skipped and markdown transformed, got %q %q", md, html)
+		t.Fail()
+	}
+
+	pagePlugins = nil
+	loadPlugins([]string{render, upper}, time.Second)
+	if _, html := applyPlugins("a.md", nil, []byte("# hello\n")); string(html) != "<p>rendered</p>" {
+		t.Logf("Expected sanitized html from the render plugin, got %q", html)
+		t.Fail()
+	}
+}
+
+func TestSymbolPlugin(t *testing.T) {
+	transform := func(name string, fm map[string]interface{}, md []byte) ([]byte, error) {
+		return append(md, []byte(name)...), nil
+	}
+	render := func(name string, md []byte) ([]byte, error) {
+		return []byte("<p>" + string(md) + "</p>"), nil
+	}
+	p, err := symbolPlugin("test.so", transform, render)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	md, html, err := p.run("a.md", nil, []byte("x "))
+	if string(md) != "x a.md" || string(html) != "<p>x a.md</p>" || err != nil {
+		t.Logf("Expected transform then render, got %q %q %v", md, html, err)
+		t.Fail()
+	}
+	for _, tc := range []struct {
+		transform, render interface{}
+		want              string
+	}{
+		{nil, nil, "neither"},
+		{func() {}, nil, "Transform is func()"},
+		{nil, func(string) error { return errors.New("x") }, "Render is func(string) error"},
+	} {
+		if _, err := symbolPlugin("bad.so", tc.transform, tc.render); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Logf("Expected error with %q, got %v", tc.want, err)
+			t.Fail()
+		}
+	}
+}
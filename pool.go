@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// maxPooledBuffer is the largest buffer kept for reuse. the buffers of
+// big files go to the garbage collector, so one video doesn't keep its
+// size of memory in the pool.
+const maxPooledBuffer = 1 << 20
+
+// buffers are reused between requests, for reading files and executing
+// templates
+var buffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	return buffers.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns buf to the pool. nothing may use its bytes after.
+func putBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	buffers.Put(buf)
+}
+
+// readFileBuffer reads the file name into a pooled buffer, for the
+// caller to put back when it is done with the bytes
+func readFileBuffer(fsys fs.FS, name string) (*bytes.Buffer, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := getBuffer()
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 && fi.Size() < 1<<30 {
+		buf.Grow(int(fi.Size()) + bytes.MinRead)
+	}
+	if _, err := buf.ReadFrom(f); err != nil && err != io.EOF {
+		putBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
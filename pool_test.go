@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadFileBuffer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.md":   {Data: []byte("# a\n")},
+		"big.md": {Data: bytes.Repeat([]byte("x"), maxPooledBuffer+1)},
+	}
+	buf, err := readFileBuffer(fsys, "a.md")
+	if err != nil || buf.String() != "# a\n" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+	putBuffer(buf)
+	if _, err := readFileBuffer(fsys, "none.md"); err == nil {
+		t.Fail()
+	}
+	// buffers are empty when they come back
+	big, err := readFileBuffer(fsys, "big.md")
+	if err != nil || big.Len() != maxPooledBuffer+1 {
+		t.Fatalf("read %d bytes, %v", big.Len(), err)
+	}
+	putBuffer(big)
+	if b := getBuffer(); b.Len() != 0 || b.Cap() > maxPooledBuffer {
+		t.Logf("pooled buffer of %d bytes, cap %d", b.Len(), b.Cap())
+		t.Fail()
+	}
+}
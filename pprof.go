@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+)
+
+// isLoopback reports whether addr (host:port) only listens on loopback
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// pprofHandler serves the net/http/pprof endpoints under /debug/pprof/
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// servePprof starts the profiler on its own listener, away from the
+// documents (and their timeouts, a cpu profile takes 30 seconds)
+func servePprof(addr string) {
+	if !isLoopback(addr) {
+		println("warning: -pprof", addr, "is not a loopback address, profiles are exposed")
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		println(err.Error())
+		os.Exit(111)
+	}
+	status("pprof: http://" + ln.Addr().String() + "/debug/pprof/")
+	go func() {
+		logger.Println("pprof:", http.Serve(ln, pprofHandler()))
+	}()
+}
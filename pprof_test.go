@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPprof(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:6060": true,
+		"[::1]:6060":     true,
+		"localhost:6060": true,
+		":6060":          false,
+		"0.0.0.0:6060":   false,
+		"10.1.2.3:6060":  false,
+		"127.0.0.1":      false,
+	} {
+		if isLoopback(addr) != want {
+			t.Log(addr, "Expected loopback", want)
+			t.Fail()
+		}
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil)
+	pprofHandler().ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Log("Expected goroutine profile, got:", w.Code)
+		t.Fail()
+	}
+}
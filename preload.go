@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/fs"
+	"time"
+)
+
+// expandPage runs the includes, wiki links and shortcodes of the markdown
+// of the page name. dynamic is true if shortcodes made it depend on the
+// time of the request.
+func (h Handler) expandPage(name string, modified time.Time, src []byte) (md []byte, dynamic bool) {
+	src = h.includes(name, src)
+	if *wiki {
+		src = h.wikiLinks(name, src)
+	}
+	return h.shortcodes(name, modified, src)
+}
+
+// renderPage renders the expanded markdown of the page name with the
+// plugins, or through the render cache, and annotates its code blocks,
+// showing the code tabs for lang. src is the markdown after transform
+// plugins.
+func renderPage(name string, fm frontMatter, src []byte, store bool, maxAge time.Duration, lang string) ([]byte, []byte) {
+	var md []byte
+	src, annotations := codeAnnotations(src)
+	if src, md = applyPlugins(name, fm, src); md == nil {
+		md = renderCached(src, store, maxAge)
+	}
+	return src, annotateCode(md, annotations, lang)
+}
+
+// preloadHandlers returns a handler for each directory served, as
+// served: the root, -mount and -vhost directories
+func preloadHandlers(root Handler) []Handler {
+	var handlers []Handler
+	if root.Root != nil {
+		handlers = append(handlers, root)
+	}
+	for _, mp := range mounts {
+		handlers = append(handlers, mp.handler(root))
+	}
+	for _, v := range vhosts {
+		h, err := v.handler(root)
+		if err != nil {
+			logger.Printf("preload: vhost %s: %v", v.Host, err)
+			continue
+		}
+		handlers = append(handlers, h)
+	}
+	return handlers
+}
+
+// preload renders every page of the handlers into the render cache,
+// logging front matter problems, so the first visitor of a page doesn't
+// wait for it and broken documents show at startup. returns the pages
+// rendered and the problems found.
+func preload(handlers []Handler) (pages, problems int) {
+	for _, h := range handlers {
+		for _, name := range h.wikiPages() {
+			// served raw, see -max-render-size
+			if fi, err := fs.Stat(h.Root, name); err == nil && tooLarge(name, fi) {
+				continue
+			}
+			b, err := fs.ReadFile(h.Root, name)
+			if err != nil {
+				logger.Printf("preload: %s%s: %v", h.RootString, name, err)
+				problems++
+				continue
+			}
+			for _, d := range checkFrontMatter(b) {
+				logfAt(levelWarn, "preload: %s%s:%d: %s", h.RootString, name, d.Line, d.Message)
+				problems++
+			}
+			fm, src := parseFrontMatter(b)
+			if hideDraft(name, fm) {
+				continue
+			}
+			// a bad cache value was reported above
+			policy, _ := pageCachePolicy(fm)
+			var modified time.Time
+			if fi, err := fs.Stat(h.Root, name); err == nil {
+				modified = fi.ModTime()
+			}
+			src, dynamic := h.expandPage(name, modified, src)
+			if dynamic || !policy.Store {
+				continue
+			}
+			renderSlots <- struct{}{}
+			_, md := renderPage(name, fm, src, true, policy.MaxAge, "")
+			<-renderSlots
+			if *changes {
+				versions.record(h.versionKey(name), rewriteLinks(prefixLinks(h.pageLinks(name, md), h.Prefix), h.rewrites), time.Now())
+			}
+			pages++
+		}
+	}
+	return pages, problems
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPreload(t *testing.T) {
+	defer func(c *byteCache) { renders = c }(renders)
+	renders = newByteCache(1 << 20)
+	h := Handler{Root: fstest.MapFS{
+		"index.md":          {Data: []byte("# Home\n\n<!--include: _partials/note.md-->\n")},
+		"guide.md":          {Data: []byte("---\ntitle: Guide\ndate: someday\n---\n# Guide\n")},
+		"live.md":           {Data: []byte("---\ncache: no-store\n---\n# Live\n")},
+		"now.md":            {Data: []byte("# Now\n\n{{< now >}}\n")},
+		"broken.md":         {Data: []byte("---\ntitle: Broken\n# Broken\n")},
+		"_partials/note.md": {Data: []byte("a note\n")},
+	}}
+	pages, problems := preload([]Handler{h})
+	if entries, _ := renders.usage(); pages != 3 || entries != 3 || problems != 2 {
+		t.Logf("preload: %d pages, %d cached, %d problems, expected 3, 3 and 2", pages, entries, problems)
+		t.Fail()
+	}
+
+	hits := atomic.LoadUint64(&serverMetrics.cacheHits)
+	for _, page := range []string{"/", "/guide.md", "/live.md", "/now.md"} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", page, nil)
+		h.ServeHTTP(rec, req)
+		if rec.Code != 200 {
+			t.Logf("%s: %d", page, rec.Code)
+			t.Fail()
+		}
+		if page == "/" && !strings.Contains(rec.Body.String(), "a note") {
+			t.Logf("%s: expected the include in %s", page, rec.Body.String())
+			t.Fail()
+		}
+	}
+	if got := atomic.LoadUint64(&serverMetrics.cacheHits) - hits; got != 2 {
+		t.Logf("expected 2 pages from the render cache, got %d", got)
+		t.Fail()
+	}
+
+	// changed markdown renders again
+	h.Root.(fstest.MapFS)["guide.md"] = &fstest.MapFile{Data: []byte("# Guide, again\n")}
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/guide.md", nil)
+	h.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "Guide, again") {
+		t.Log("changed page served from the cache:", rec.Body.String())
+		t.Fail()
+	}
+}
+
+func TestPreloadRewrites(t *testing.T) {
+	defer func(c *byteCache) { renders = c }(renders)
+	defer func(b bool, v *versionStore) { *changes, versions = b, v }(*changes, versions)
+	renders, *changes, versions = newByteCache(1<<20), true, newVersionStore(1<<20)
+	h := Handler{Root: fstest.MapFS{"guide.md": {Data: []byte("# Guide\n\nSee [the wiki](https://wiki.internal.corp/x).\n")}},
+		rewrites: []linkRewrite{{"https://wiki.internal.corp/", "https://wiki.example.com/"}}}
+	preload([]Handler{h})
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/guide.md", nil)
+	h.ServeHTTP(rec, req)
+	if p, ok := versions.history(h.versionKey("guide.md")); ok {
+		t.Logf("expected the preloaded rendering to be the one served, got a change from:\n%s\nto:\n%s", p.previous.html, p.current.html)
+		t.Fail()
+	}
+}
+
+func TestPreloadHandlers(t *testing.T) {
+	defer func(m mountList, v vhostList) { mounts, vhosts = m, v }(mounts, vhosts)
+	mounts = mountList{{Prefix: "/wiki", Dir: "docs"}}
+	rewrite := linkRewrite{"https://a.corp/", "https://a.example.com/"}
+	vhosts = vhostList{{Host: "docs.example.com", Dir: "docs", Canonical: "https://docs.example.com", Rewrites: []linkRewrite{rewrite}}}
+	root := Handler{Root: fstest.MapFS{}, Prefix: "/site"}
+	handlers := preloadHandlers(root)
+	if len(handlers) != 3 {
+		t.Fatalf("expected 3 handlers, got %d", len(handlers))
+	}
+	if m := handlers[1]; m.Prefix != "/site/wiki" || !strings.HasSuffix(m.RootString, "/docs/") {
+		t.Logf("expected the mount served at /site/wiki from docs, got %q %q", m.Prefix, m.RootString)
+		t.Fail()
+	}
+	if v := handlers[2]; v.canonical != "https://docs.example.com" || len(v.rewrites) != 1 || v.rewrites[0] != rewrite {
+		t.Logf("expected the canonical url and rewrites of the vhost, got %q %v", v.canonical, v.rewrites)
+		t.Fail()
+	}
+}
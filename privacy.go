@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// logSalt hashes addresses for -log-ip hash. the salt is thrown away
+// every day, like the visitor salt, so a client can be followed through
+// the logs of a day but not across days.
+type logSalt struct {
+	mu   sync.Mutex
+	day  string
+	salt [16]byte
+}
+
+var addrSalt logSalt
+
+// hash returns a short hash of ip for the day of now
+func (s *logSalt) hash(ip string, now time.Time) string {
+	s.mu.Lock()
+	if day := now.UTC().Format("2006-01-02"); day != s.day {
+		s.day = day
+		if _, err := rand.Read(s.salt[:]); err != nil {
+			logger.Println("error generating log salt:", err)
+		}
+	}
+	h := sha256.New()
+	h.Write(s.salt[:])
+	s.mu.Unlock()
+	h.Write([]byte(ip))
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// truncateIP zeroes the host part of ip: ipv4 to its /24, ipv6 to its /48
+func truncateIP(ip string) string {
+	a := net.ParseIP(ip)
+	switch {
+	case a == nil:
+		return ip
+	case a.To4() != nil:
+		return a.Mask(net.CIDRMask(24, 32)).String()
+	default:
+		return a.Mask(net.CIDRMask(48, 128)).String()
+	}
+}
+
+// logAddr returns a client address, with or without port, as -log-ip
+// keeps it in the logs
+func logAddr(addr string) string {
+	if *logIP == "full" {
+		return addr
+	}
+	ip, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		ip = addr
+	}
+	switch *logIP {
+	case "truncate":
+		return truncateIP(ip)
+	case "hash":
+		return addrSalt.hash(ip, time.Now())
+	}
+	return "-"
+}
+
+// logUserAgent returns the user agent as the logs keep it
+func logUserAgent(ua string) string {
+	if !*logUA {
+		return ""
+	}
+	return ua
+}
+
+// checkLogIP checks the -log-ip value
+func checkLogIP(mode string) error {
+	switch mode {
+	case "full", "truncate", "hash", "none":
+		return nil
+	}
+	return fmt.Errorf("expected full, truncate, hash or none, got %q", mode)
+}
+
+// setLogPrivacy applies -gdpr, the privacy defaults for -log-ip,
+// -log-user-agent and -log-retention, to those not given
+func setLogPrivacy() error {
+	if *gdpr {
+		given := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+		if !given["log-ip"] {
+			*logIP = "truncate"
+		}
+		if !given["log-user-agent"] {
+			*logUA = false
+		}
+		if !given["log-retention"] {
+			*logRetention = 30 * 24 * time.Hour
+		}
+	}
+	if err := checkLogIP(*logIP); err != nil {
+		return fmt.Errorf("-log-ip: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLogAddr(t *testing.T) {
+	defer func(mode string) { *logIP = mode }(*logIP)
+	for _, test := range []struct{ mode, addr, want string }{
+		{"full", "192.0.2.77:5555", "192.0.2.77:5555"},
+		{"truncate", "192.0.2.77:5555", "192.0.2.0"},
+		{"truncate", "[2001:db8:1:2::7]:5555", "2001:db8:1::"},
+		{"truncate", "192.0.2.77", "192.0.2.0"},
+		{"none", "192.0.2.77:5555", "-"},
+	} {
+		*logIP = test.mode
+		if got := logAddr(test.addr); got != test.want {
+			t.Logf("-log-ip %s: expected %q for %q, got %q", test.mode, test.want, test.addr, got)
+			t.Fail()
+		}
+	}
+
+	var s logSalt
+	day := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	a, b := s.hash("192.0.2.77", day), s.hash("192.0.2.77", day.Add(time.Hour))
+	if a != b || len(a) != 16 {
+		t.Logf("Expected the same hash all day, got %q and %q", a, b)
+		t.Fail()
+	}
+	if c := s.hash("192.0.2.78", day); c == a {
+		t.Log("Expected another address to hash differently")
+		t.Fail()
+	}
+	if c := s.hash("192.0.2.77", day.Add(24*time.Hour)); c == a {
+		t.Log("Expected a new hash the next day")
+		t.Fail()
+	}
+}
+
+func TestAnonymizedAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	*logFormat, *logIP, *logUA = "json", "truncate", false
+	defer func() {
+		logger.SetOutput(os.Stderr)
+		*logFormat, *logIP, *logUA = "text", "full", true
+	}()
+
+	req, _ := http.NewRequest("GET", "/index.md", nil)
+	req.RemoteAddr = "192.0.2.77:5555"
+	req.Header.Set("User-Agent", "test-agent/1.0")
+	sendRequest(req)
+
+	var entry accessEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Logf("Expected exactly one json line, got %q: %v", buf.String(), err)
+		t.FailNow()
+	}
+	if entry.RemoteAddr != "192.0.2.0" || entry.UserAgent != "" {
+		t.Logf("Expected truncated address and no user agent: %+v", entry)
+		t.Fail()
+	}
+}
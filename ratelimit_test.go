@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(1, 3)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("a"); !ok {
+			t.Log("Expected burst of 3 to be allowed, refused at:", i)
+			t.FailNow()
+		}
+	}
+	ok, wait := l.allow("a")
+	if ok || wait <= 0 {
+		t.Log("Expected 4th request to be refused with wait, got:", ok, wait)
+		t.FailNow()
+	}
+	if ok, _ := l.allow("b"); !ok {
+		t.Log("Expected other client to be allowed")
+		t.FailNow()
+	}
+}
+
+func TestRateLimitRequest(t *testing.T) {
+	limiter = newRateLimiter(0.001, 1)
+	defer func() { limiter = nil }()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:5555"
+	sendRequest(req)
+	resp := sendRequest(req)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Log("Expected 429, got:", resp.StatusCode)
+		t.FailNow()
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Log("Expected Retry-After header")
+		t.FailNow()
+	}
+}
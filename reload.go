@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// reloadFlags are the settings a reload applies without a restart. the
+// others in the -config file need one.
+var reloadFlags = []string{"header", "footer", "template", "analytics", "analytics-id", "analytics-url", "consent", "token", "cache-control",
+	"frame-options", "csp", "hsts", "referrer-policy", "nosniff"}
+
+var (
+	// reloadMu guards the reloaded settings requests read, -token,
+	// -cache-control and the security headers
+	reloadMu sync.RWMutex
+
+	// pinnedFlags were given on the command line or in the environment,
+	// reloads of the -config file leave them alone
+	pinnedFlags = map[string]bool{}
+)
+
+// liveHandler serves with the handler of the last reload
+type liveHandler struct {
+	v atomic.Value // http.Handler
+}
+
+func (l *liveHandler) set(h http.Handler) {
+	l.v.Store(&h)
+}
+
+func (l *liveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*l.v.Load().(*http.Handler)).ServeHTTP(w, r)
+}
+
+// readPageFiles reads what h wraps pages in: the -header, -footer and
+// -template files, and the -analytics snippet
+func (h *Handler) readPageFiles() error {
+	h.header, h.footer, h.template, h.analytics = []byte("<!DOCTYPE html>\n"), nil, nil, nil
+	if *header != "" {
+		b, err := ioutil.ReadFile(*header)
+		if err != nil {
+			return err
+		}
+		h.header = b
+	}
+	if *footer != "" {
+		b, err := ioutil.ReadFile(*footer)
+		if err != nil {
+			return err
+		}
+		h.footer = b
+	}
+	if *pageTemplate != "" {
+		t, err := loadTemplate(*pageTemplate)
+		if err != nil {
+			return err
+		}
+		h.template = t
+	}
+	if *analytics != "" {
+		b, err := analyticsSnippet(*analytics, *analyticsID, *analyticsURL, *consent)
+		if err != nil {
+			return err
+		}
+		h.analytics = b
+	}
+	return nil
+}
+
+// siteHandler returns the handler of the site: root, its -mount
+// directories and the -vhost hosts
+func siteHandler(root *Handler) (http.Handler, error) {
+	var h http.Handler
+	if root.Root != nil || len(mounts) != 0 {
+		mux := http.NewServeMux()
+		mount(mux, root, mounts)
+		h = mux
+	}
+	if len(vhosts) != 0 {
+		vh, err := newVhostMux(root, vhosts, h)
+		if err != nil {
+			return nil, err
+		}
+		h = vh
+	}
+	return h, nil
+}
+
+// reload reads the -config file again, if there is one, and the files
+// of the page settings, and serves root with them from site. on an error
+// nothing changes.
+func reload(root Handler, site *liveHandler) error {
+	var c *configFile
+	if *configPath != "" {
+		var err error
+		if c, err = readConfigFile(*configPath); err != nil {
+			return err
+		}
+	}
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadable := map[string]bool{}
+	for _, name := range reloadFlags {
+		reloadable[name] = true
+	}
+	skip := map[string]bool{}
+	old := map[string]string{}
+	oldRules, oldToken := cacheRules, *token
+	flag.VisitAll(func(f *flag.Flag) {
+		switch {
+		case !reloadable[f.Name] || pinnedFlags[f.Name]:
+			skip[f.Name] = true
+		case f.Name != "cache-control":
+			old[f.Name] = f.Value.String()
+		}
+	})
+	restore := func() {
+		for name, v := range old {
+			flag.Set(name, v)
+		}
+		cacheRules = oldRules
+	}
+
+	if c != nil {
+		// settings the file no longer has go back to their defaults
+		for name := range old {
+			flag.Set(name, flag.Lookup(name).DefValue)
+		}
+		if !skip["cache-control"] {
+			cacheRules = nil
+		}
+		if _, _, err := c.apply(flag.CommandLine, skip); err != nil {
+			restore()
+			return err
+		}
+		if err := resolveSecrets(flag.CommandLine); err != nil {
+			restore()
+			return err
+		}
+		if *token != "" && oldToken == "" && (*geminiAddr != "" || *gopherAddr != "") {
+			restore()
+			return errors.New("-token can't be added by a reload with -gemini or -gopher, which can't check it")
+		}
+	}
+	if err := root.readPageFiles(); err != nil {
+		restore()
+		return err
+	}
+	h, err := siteHandler(&root)
+	if err != nil {
+		restore()
+		return err
+	}
+	site.set(h)
+	return nil
+}
+
+// reloadOnHangup reloads on SIGHUP, and when the -config file changes
+// with -config-watch
+func reloadOnHangup(root Handler, site *liveHandler) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	var changed <-chan time.Time
+	var modified time.Time
+	if *configWatch && *configPath != "" {
+		if fi, err := os.Stat(*configPath); err == nil {
+			modified = fi.ModTime()
+		}
+		changed = time.NewTicker(time.Second).C
+	}
+	go func() {
+		for {
+			select {
+			case <-c:
+			case <-changed:
+				fi, err := os.Stat(*configPath)
+				if err != nil || fi.ModTime().Equal(modified) {
+					continue
+				}
+				modified = fi.ModTime()
+			}
+			if err := reload(root, site); err != nil {
+				logAt(levelError, "reload failed, serving as before:", err)
+				continue
+			}
+			logAt(levelInfo, "reloaded header, footer, template, analytics, token, cache-control and security header settings")
+		}
+	}()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	defer func(path, head, tok, policy string, rules cacheRuleList) {
+		*configPath, *header, *token, *csp, cacheRules = path, head, tok, policy, rules
+	}(*configPath, *header, *token, *csp, cacheRules)
+
+	config := filepath.Join(dir, "markdownd.toml")
+	head := filepath.Join(dir, "header.html")
+	*configPath = config
+	ioutil.WriteFile(head, []byte("<!DOCTYPE html><title>first</title>\n"), 0600)
+	ioutil.WriteFile(config, []byte("header = '"+head+"'\ncsp = \"default-src 'self'\"\n\n[[cache-control]]\npattern = '*.md'\nvalue = 'max-age=60'\n"), 0600)
+
+	root := Handler{Root: fstest.MapFS{"index.md": {Data: []byte("# home\n")}}}
+	site := &liveHandler{}
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/index.md", nil)
+		site.ServeHTTP(rec, req)
+		return rec
+	}
+	if err := reload(root, site); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if rec := get(); !strings.Contains(rec.Body.String(), "<title>first</title>") || rec.Header().Get("Cache-Control") != "max-age=60" ||
+		rec.Header().Get("Content-Security-Policy") != "default-src 'self'" {
+		t.Logf("Expected the header, csp and cache rule of the file, got %v %q", rec.Header(), rec.Body.String())
+		t.Fail()
+	}
+
+	// the token is added, the cache rule and csp removed
+	ioutil.WriteFile(head, []byte("<!DOCTYPE html><title>second</title>\n"), 0600)
+	ioutil.WriteFile(config, []byte("header = '"+head+"'\ntoken = 's3cret'\n"), 0600)
+	if err := reload(root, site); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if rec := get(); rec.Code != http.StatusUnauthorized || len(cacheRules) != 0 || *csp != "" {
+		t.Logf("Expected 401 without cache rules or csp, got %d %v %q", rec.Code, cacheRules, *csp)
+		t.Fail()
+	}
+
+	// a bad file changes nothing
+	ioutil.WriteFile(config, []byte("header = '"+filepath.Join(dir, "missing.html")+"'\n"), 0600)
+	if err := reload(root, site); err == nil {
+		t.Log("Expected an error for a missing header")
+		t.Fail()
+	}
+	if *token != "s3cret" || *header != head {
+		t.Logf("Expected the settings before the failed reload, got %q %q", *token, *header)
+		t.Fail()
+	}
+	if rec := get(); rec.Code != http.StatusUnauthorized {
+		t.Log("Expected to serve as before the failed reload, got", rec.Code)
+		t.Fail()
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aerth/markdownd/pkg/markdownd"
+)
+
+// rendererLimit is -renderer-max in bytes
+var rendererLimit int64 = 8 << 20
+
+// limitedBuffer keeps up to limit bytes. writes past it fail and call
+// full to stop the writer, or are dropped if full is nil. buf isn't
+// embedded, so io.Copy can't use its ReadFrom and skip the limit.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int64
+	full  func()
+	over  bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if int64(b.buf.Len()+len(p)) > b.limit {
+		if b.full == nil {
+			return len(p), nil
+		}
+		if !b.over {
+			b.full()
+		}
+		b.over = true
+		return 0, errors.New("output too large")
+	}
+	return b.buf.Write(p)
+}
+
+// renderCommand pipes markdown through an external command, such as
+// 'pandoc -f markdown -t html'. its html is sanitized like ours.
+func renderCommand(cmdline string, in []byte, timeout time.Duration, limit int64) ([]byte, error) {
+	out, err := runCommand(cmdline, in, timeout, limit)
+	if err != nil {
+		return nil, err
+	}
+	return markdownd.Sanitize(out), nil
+}
+
+// runCommand runs a command line with in on stdin and returns its stdout.
+// the command line is split on spaces and run directly, not by a shell.
+func runCommand(cmdline string, in []byte, timeout time.Duration, limit int64) ([]byte, error) {
+	args := strings.Fields(cmdline)
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(in)
+	out := &limitedBuffer{limit: limit, full: cancel}
+	stderr := &limitedBuffer{limit: 1 << 10}
+	cmd.Stdout, cmd.Stderr = out, stderr
+	err := cmd.Run()
+	switch {
+	case out.over:
+		return nil, fmt.Errorf("%s: output larger than %d bytes", args[0], limit)
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("%s: timed out after %s", args[0], timeout)
+	case err != nil && stderr.buf.Len() != 0:
+		return nil, fmt.Errorf("%s: %v: %s", args[0], err, strings.TrimSpace(stderr.buf.String()))
+	case err != nil:
+		return nil, fmt.Errorf("%s: %v", args[0], err)
+	}
+	return out.buf.Bytes(), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderCommand(t *testing.T) {
+	out, err := renderCommand("tr a-z A-Z", []byte("<p>hello</p><script>x</script>"), time.Second, 1<<10)
+	if err != nil || string(out) != "<p>HELLO</p>" {
+		t.Logf("Expected sanitized output of tr, got: %q %v", out, err)
+		t.Fail()
+	}
+	for cmdline, want := range map[string]string{
+		"sleep 5":               "timed out",
+		"yes":                   "output larger than 1024 bytes",
+		"sh -c false":           "exit status 1",
+		"sh -c oops":            "not found",
+		"no-such-renderer-here": "executable file not found",
+		" ":                     "empty command",
+	} {
+		_, err := renderCommand(cmdline, []byte("x"), 200*time.Millisecond, 1<<10)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Logf("%q: expected error with %q, got: %v", cmdline, want, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestRendererFallback(t *testing.T) {
+	defer func(v string) { *rendererCmd = v }(*rendererCmd)
+	*rendererCmd = "no-such-renderer-here"
+	if out := string(markdown2html([]byte("# title\n"))); !strings.Contains(out, "title</h1>") {
+		t.Log("Expected the built-in renderer when the command fails, got:", out)
+		t.Fail()
+	}
+	*rendererCmd = "cat"
+	if out := string(markdown2html([]byte("# title\n"))); out != "# title\n" {
+		t.Logf("Expected the command's output, got: %q", out)
+		t.Fail()
+	}
+}
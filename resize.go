@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxPixels is the largest image resized, bigger ones are served as is
+const maxPixels = 50 << 20
+
+// resizedImages keeps the most recently served variants, up to
+// -resize-cache
+var resizedImages = newByteCache(64 << 20)
+
+// resizeSize parses the ?w= and ?h= of r. ok is false without either.
+func resizeSize(r *http.Request) (width, height int, ok bool, err error) {
+	q := r.URL.Query()
+	for _, p := range []struct {
+		name string
+		n    *int
+	}{{"w", &width}, {"h", &height}} {
+		s := q.Get(p.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 10000 {
+			return 0, 0, false, fmt.Errorf("bad %s %q, expected pixels from 1 to 10000", p.name, s)
+		}
+		*p.n, ok = n, true
+	}
+	return width, height, ok, nil
+}
+
+// fitSize returns the size of a w by h image scaled to width and height,
+// keeping the aspect ratio, inside both if both are set. images are never
+// made larger.
+func fitSize(w, h, width, height int) (int, int) {
+	scale := 1.0
+	if width > 0 && float64(width)/float64(w) < scale {
+		scale = float64(width) / float64(w)
+	}
+	if height > 0 && float64(height)/float64(h) < scale {
+		scale = float64(height) / float64(h)
+	}
+	nw, nh := int(float64(w)*scale+0.5), int(float64(h)*scale+0.5)
+	if nw < 1 {
+		nw = 1
+	}
+	if nh < 1 {
+		nh = 1
+	}
+	return nw, nh
+}
+
+// scaleImage shrinks src to w by h, averaging the pixels each one covers
+func scaleImage(src image.Image, w, h int) *image.NRGBA {
+	b := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	sw, sh := b.Dx(), b.Dy()
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*sh/h, b.Min.Y+(y+1)*sh/h
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*sw/w, b.Min.X+(x+1)*sw/w
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// premultiplied, so transparent pixels don't darken edges
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			c := color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)}
+			dst.Set(x, y, c)
+		}
+	}
+	return dst
+}
+
+// errNoResize is returned for images served as they are
+var errNoResize = errors.New("not resized")
+
+// resizeImage returns the png or jpeg image b scaled for ?w= and ?h=,
+// encoded as it was
+func resizeImage(b []byte, width, height int) ([]byte, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, errNoResize
+	}
+	w, h := fitSize(cfg.Width, cfg.Height, width, height)
+	if w == cfg.Width && h == cfg.Height {
+		return nil, errNoResize
+	}
+	src, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	dst := scaleImage(src, w, h)
+	var out bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&out, dst, &jpeg.Options{Quality: 85})
+	case "png":
+		err = png.Encode(&out, dst)
+	default:
+		return nil, errNoResize
+	}
+	return out.Bytes(), err
+}
+
+// serveResized answers a request for the image file name with ?w= or ?h=
+// with a smaller copy, from the cache when it was made before. images
+// that are small enough already, or too large to decode, are served as is.
+func (h Handler) serveResized(w http.ResponseWriter, r *http.Request, requestid, abs, name, ct string, modified time.Time, b []byte) bool {
+	width, height, ok, err := resizeSize(r)
+	if !ok && err == nil {
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return true
+	}
+	key := fmt.Sprintf("%s/%s %d %d %dx%d", h.RootString, name, modified.UnixNano(), len(b), width, height)
+	resized, ok := resizedImages.get(key)
+	if !ok {
+		renderSlots <- struct{}{}
+		resized, err = resizeImage(b, width, height)
+		<-renderSlots
+		if err != nil {
+			if err != errNoResize {
+				logger.Printf("%s resize error: %q %v", requestid, abs, err)
+			}
+			return false
+		}
+		resizedImages.put(key, resized, 0)
+	}
+	logreqf("%s serving %s resized to %dx%d: %s", requestid, ct, width, height, abs)
+	w.Header().Set("Content-Type", ct)
+	cacheControl(w, h.Prefix+r.URL.Path)
+	http.ServeContent(w, r, name, modified, bytes.NewReader(resized))
+	return true
+}
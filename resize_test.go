@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestResize(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 20; y++ {
+			src.Set(x, y, color.NRGBA{uint8(x * 6), 0, 0, 255})
+		}
+	}
+	var b bytes.Buffer
+	png.Encode(&b, src)
+	defer func(on bool) { *resizeImages = on }(*resizeImages)
+	*resizeImages = true
+	h := Handler{Root: fstest.MapFS{"shot.png": {Data: b.Bytes()}}}
+	get := func(query string) (int, string, []byte) {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/shot.png"+query, nil)
+		h.ServeHTTP(rec, req)
+		return rec.Code, rec.Header().Get("Content-Type"), rec.Body.Bytes()
+	}
+	for _, c := range []struct {
+		query string
+		w, h  int
+	}{
+		{"", 40, 20},
+		{"?w=10", 10, 5},
+		{"?h=4", 8, 4},
+		{"?w=10&h=2", 4, 2},
+		{"?w=400", 40, 20},
+		{"?w=10", 10, 5}, // cached
+	} {
+		code, ct, body := get(c.query)
+		img, err := png.Decode(bytes.NewReader(body))
+		if code != 200 || ct != "image/png" || err != nil {
+			t.Logf("%q: %d %q %v", c.query, code, ct, err)
+			t.Fail()
+			continue
+		}
+		if size := img.Bounds().Size(); size.X != c.w || size.Y != c.h {
+			t.Logf("%q: got %v, expected %dx%d", c.query, size, c.w, c.h)
+			t.Fail()
+		}
+	}
+	// averaged: the left pixel of a 4 wide copy covers x 0 to 9
+	_, _, body := get("?w=4")
+	img, _ := png.Decode(bytes.NewReader(body))
+	if r, _, _, _ := img.At(0, 0).RGBA(); r>>8 != 27 {
+		t.Logf("left pixel red %d, expected 27", r>>8)
+		t.Fail()
+	}
+	for _, q := range []string{"?w=0", "?h=big", "?w=20000"} {
+		if code, _, _ := get(q); code != 400 {
+			t.Logf("%q: %d, expected 400", q, code)
+			t.Fail()
+		}
+	}
+	*resizeImages = false
+	if _, _, body := get("?w=10"); !bytes.Equal(body, b.Bytes()) {
+		t.Log("resized without -resize")
+		t.Fail()
+	}
+}
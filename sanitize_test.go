@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeMarkdown(t *testing.T) {
+	md := []byte("# hi\n\n<script>alert(1)</script>\n\n<b onclick=\"x()\">bold</b>\n")
+	for _, p := range []bool{false, true} {
+		*plain = p
+		out := string(markdown2html(md))
+		if strings.Contains(out, "<script>") || strings.Contains(out, "onclick") {
+			t.Logf("plain=%v: expected sanitized html, got: %q", p, out)
+			t.Fail()
+		}
+	}
+	*plain = false
+
+	*noInlineHTML = true
+	defer func() { *noInlineHTML = false }()
+	out := string(markdown2html(md))
+	if strings.Contains(out, "<b") || !strings.Contains(out, "<h1") {
+		t.Logf("expected inline html stripped, got: %q", out)
+		t.Fail()
+	}
+}
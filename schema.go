@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fieldSchema is what a front matter key must hold
+type fieldSchema struct {
+	Type string   `json:"type"` // string (the default), date, bool, int or list
+	Enum []string `json:"enum"` // the values allowed, if any
+}
+
+// pageSchema is the front matter of a content type, the pages with
+// 'type: runbook' for example
+type pageSchema struct {
+	Required []string               `json:"required"`
+	Fields   map[string]fieldSchema `json:"fields"`
+}
+
+// schemaRegistry is the -schemas content types, by name
+type schemaRegistry map[string]pageSchema
+
+var schemas = schemaRegistry{}
+
+// readFile adds the content types of a json file, such as
+// {"runbook": {"required": ["owner", "severity", "last_tested"],
+// "fields": {"severity": {"enum": ["sev1", "sev2", "sev3"]}, "last_tested": {"type": "date"}}}}
+func (s schemaRegistry) readFile(filename string) error {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var types map[string]pageSchema
+	if err := json.Unmarshal(b, &types); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	for name, t := range types {
+		// as front matter keys are read
+		fields := map[string]fieldSchema{}
+		for key, f := range t.Fields {
+			switch f.Type {
+			case "", "string", "date", "bool", "int", "list":
+			default:
+				return fmt.Errorf("%s: %s: %s: unknown type %q, use string, date, bool, int or list", filename, name, key, f.Type)
+			}
+			fields[strings.ToLower(key)] = f
+		}
+		for i, key := range t.Required {
+			t.Required[i] = strings.ToLower(key)
+		}
+		t.Fields = fields
+		s[name] = t
+	}
+	return nil
+}
+
+// schemaError is a front matter key that doesn't follow its schema
+type schemaError struct {
+	Key     string
+	Message string
+}
+
+// check returns what is wrong with the front matter for the schema of
+// its 'type'. pages without a type, or without -schemas, are fine.
+func (s schemaRegistry) check(fm frontMatter) []schemaError {
+	name := fm.String("type")
+	if len(s) == 0 || name == "" {
+		return nil
+	}
+	t, ok := s[name]
+	if !ok {
+		var known []string
+		for k := range s {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return []schemaError{{"type", fmt.Sprintf("unknown type %q, expected one of %s", name, strings.Join(known, ", "))}}
+	}
+	var errs []schemaError
+	for _, key := range t.Required {
+		if _, ok := fm[key]; !ok || fm.String(key) == "" {
+			errs = append(errs, schemaError{key, fmt.Sprintf("missing, required for type %s", name)})
+		}
+	}
+	keys := make([]string, 0, len(t.Fields))
+	for key := range t.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if fm.String(key) == "" {
+			continue
+		}
+		if msg := t.Fields[key].check(fm, key); msg != "" {
+			errs = append(errs, schemaError{key, msg})
+		}
+	}
+	return errs
+}
+
+// check returns what is wrong with the value of key, or ""
+func (f fieldSchema) check(fm frontMatter, key string) string {
+	val := fm.String(key)
+	switch f.Type {
+	case "date":
+		if _, ok := fm.Date(key); !ok {
+			return "should be a date, such as 2006-01-02 or RFC 3339"
+		}
+	case "bool":
+		if _, err := strconv.ParseBool(val); err != nil && val != "yes" && val != "no" {
+			return "should be true or false"
+		}
+	case "int":
+		if _, err := strconv.Atoi(val); err != nil {
+			return "should be a whole number"
+		}
+	case "list":
+		if _, ok := fm[key].([]string); !ok {
+			return "should be a list, such as [a, b] or '- a' lines"
+		}
+	}
+	if len(f.Enum) == 0 {
+		return ""
+	}
+	values := []string{val}
+	if f.Type == "list" {
+		values = fm.List(key)
+	}
+	for _, v := range values {
+		found := false
+		for _, e := range f.Enum {
+			found = found || v == e
+		}
+		if !found {
+			return fmt.Sprintf("%q is not one of %s", v, strings.Join(f.Enum, ", "))
+		}
+	}
+	return ""
+}
+
+// schemaDiagnostics checks the front matter of the markdown file b with
+// -schemas, on the lines of the keys, or the first line for missing ones
+func schemaDiagnostics(b []byte) []diagnostic {
+	if len(schemas) == 0 {
+		return nil
+	}
+	fm, _ := parseFrontMatter(b)
+	errs := schemas.check(fm)
+	if len(errs) == 0 {
+		return nil
+	}
+	lines := map[string]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if n > 1 && (line == "---" || line == "...") {
+			break
+		}
+		if i := strings.IndexByte(line, ':'); i > 0 && !strings.HasPrefix(line, "- ") && !strings.HasPrefix(line, "#") {
+			key := strings.ToLower(strings.TrimSpace(line[:i]))
+			if _, ok := lines[key]; !ok {
+				lines[key] = n
+			}
+		}
+	}
+	var diags []diagnostic
+	for _, e := range errs {
+		n := lines[e.Key]
+		if n == 0 {
+			n = 1
+		}
+		diags = append(diags, diagnostic{n, e.Key + ": " + e.Message})
+	}
+	return diags
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSchemas(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "schemas.json")
+	ioutil.WriteFile(file, []byte(`{"runbook": {"required": ["Owner", "severity", "last_tested"],
+		"fields": {"severity": {"enum": ["sev1", "sev2"]}, "last_tested": {"type": "date"}, "tags": {"type": "list", "enum": ["db", "web"]}}}}`), 0644)
+	defer func(s schemaRegistry) { schemas = s }(schemas)
+	schemas = schemaRegistry{}
+	if err := schemas.readFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	good := "---\ntype: runbook\nowner: ops\nseverity: sev1\nlast_tested: 2026-09-01\ntags: [db]\n---\n# Restore\n"
+	bad := "---\ntype: runbook\nseverity: sev5\nlast_tested: last week\ntags: [db, cache]\n---\n# Restore\n"
+	for _, c := range []struct {
+		page     string
+		expected []diagnostic
+	}{
+		{good, nil},
+		{"# No type\n", nil},
+		{"---\ntype: recipe\n---\n", []diagnostic{{2, `type: unknown type "recipe", expected one of runbook`}}},
+		{bad, []diagnostic{
+			{1, "owner: missing, required for type runbook"},
+			{4, "last_tested: should be a date, such as 2006-01-02 or RFC 3339"},
+			{3, `severity: "sev5" is not one of sev1, sev2`},
+			{5, `tags: "cache" is not one of db, web`},
+		}},
+	} {
+		if got := schemaDiagnostics([]byte(c.page)); !reflect.DeepEqual(got, c.expected) {
+			t.Logf("%q: expected %v, got %v", c.page, c.expected, got)
+			t.Fail()
+		}
+	}
+
+	h := Handler{Root: fstest.MapFS{"good.md": {Data: []byte(good)}, "bad.md": {Data: []byte(bad)}}}
+	for path, code := range map[string]int{"/good.md": 200, "/bad.md": 500} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != code {
+			t.Logf("%s: expected %d, got %d %s", path, code, rec.Code, rec.Body.String())
+			t.Fail()
+		}
+	}
+
+	ioutil.WriteFile(file, []byte(`{"runbook": {"fields": {"owner": {"type": "person"}}}}`), 0644)
+	if err := (schemaRegistry{}).readFile(file); err == nil {
+		t.Log("expected an error for an unknown field type")
+		t.Fail()
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// searchResult is one page matching a search
+type searchResult struct {
+	URL     string `json:"url"`
+	Title   string `json:"title"`
+	Snippet string `json:"snippet"`
+	Score   int    `json:"score"`
+}
+
+// walkMarkdown calls fn for every markdown file under root, skipping
+// symlinks and hidden files. rel is the slash separated path from root.
+func walkMarkdown(root string, fn func(abs, rel string) error) error {
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := fi.Name()
+		if path != root && strings.HasPrefix(name, ".") {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() || fi.Mode()&os.ModeSymlink != 0 || !strings.HasSuffix(name, ".md") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		return fn(path, filepath.ToSlash(rel))
+	})
+}
+
+// search finds markdown files under root containing every word of query.
+// title matches count more than body matches.
+func search(root, query string, limit int) []searchResult {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil
+	}
+	var results []searchResult
+	walkMarkdown(root, func(abs, rel string) error {
+		b, err := ioutil.ReadFile(abs)
+		if err != nil {
+			return nil
+		}
+		fm, md := parseFrontMatter(b)
+		if hideDraft(rel, fm) {
+			return nil
+		}
+		title := pageTitle(fm, md)
+		if title == "" {
+			title = segmentName(filepath.Base(rel))
+		}
+		ltitle := strings.ToLower(title)
+		lbody := strings.ToLower(string(md))
+		score := 0
+		for _, term := range terms {
+			n := strings.Count(lbody, term) + 10*strings.Count(ltitle, term)
+			if n == 0 {
+				return nil
+			}
+			score += n
+		}
+		results = append(results, searchResult{
+			URL:     "/" + rel,
+			Title:   title,
+			Snippet: snippet(string(md), terms[0], 160),
+			Score:   score,
+		})
+		return nil
+	})
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].URL < results[j].URL
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// snippet returns plain text around the first match of term
+func snippet(md, term string, width int) string {
+	text := strings.Join(strings.Fields(plainInline(md)), " ")
+	i := strings.Index(strings.ToLower(text), term)
+	if i == -1 {
+		return truncate(text, width)
+	}
+	start := i - width/2
+	if start < 0 {
+		start = 0
+	}
+	// don't cut a word, or a utf-8 sequence
+	for start > 0 && text[start-1] != ' ' {
+		start--
+	}
+	s := truncate(text[start:], width)
+	if start > 0 {
+		s = "…" + s
+	}
+	return s
+}
+
+// serveSearch answers /_markdownd/search?q= with json results
+func (h Handler) serveSearch(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	results := search(h.RootString, r.URL.Query().Get("q"), limit)
+	if results == nil {
+		results = []searchResult{}
+	}
+	for i := range results {
+		results[i].URL = h.Prefix + results[i].URL
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
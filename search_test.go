@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "guide"), 0755)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	files := map[string]string{
+		"install.md":         "# Installing\n\nRun the installer, then configure the server.\n",
+		"guide/deploy.md":    "---\ntitle: Deploying the server\n---\nCopy the binary to the server.\n",
+		"guide/unrelated.md": "# Something else\n\nNothing to see.\n",
+		".git/notes.md":      "server server server\n",
+		"server.txt":         "server\n",
+	}
+	for name, body := range files {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644)
+	}
+
+	results := search(dir, "Server", 10)
+	if len(results) != 2 {
+		t.Log("Expected 2 results, got:", results)
+		t.FailNow()
+	}
+	// title matches rank first
+	if results[0].URL != "/guide/deploy.md" || results[0].Title != "Deploying the server" {
+		t.Log("Expected deploy.md first, got:", results[0])
+		t.Fail()
+	}
+	if results[1].URL != "/install.md" || !strings.Contains(results[1].Snippet, "configure the server") {
+		t.Log("Expected install.md with snippet, got:", results[1])
+		t.Fail()
+	}
+
+	// every word must match
+	if results := search(dir, "server installer", 10); len(results) != 1 || results[0].URL != "/install.md" {
+		t.Log("Expected only install.md, got:", results)
+		t.Fail()
+	}
+	if results := search(dir, "  ", 10); results != nil {
+		t.Log("Expected no results for empty query, got:", results)
+		t.Fail()
+	}
+}
+
+func TestSearchEndpoint(t *testing.T) {
+	*searchEnabled = true
+	defer func() { *searchEnabled = false }()
+
+	req, _ := http.NewRequest("GET", "/_markdownd/search?q=welcome", nil)
+	resp := sendRequest(req)
+	var results []searchResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil || resp.StatusCode != 200 {
+		t.Log("Expected json results, got:", resp.StatusCode, err)
+		t.FailNow()
+	}
+	if len(results) != 1 || results[0].URL != "/index.md" {
+		t.Log("Expected index.md, got:", results)
+		t.Fail()
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// reEnvRef matches ${NAME} in secret values
+var reEnvRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// isSecretRef reports whether a secret value refers to the secret instead
+// of holding it
+func isSecretRef(v string) bool {
+	return strings.HasPrefix(v, "file:") || reEnvRef.MatchString(v)
+}
+
+// secretValue resolves a secret value. 'file:/run/secrets/token' reads the
+// file, without its trailing newline, and ${NAME} is replaced with the
+// environment variable. anything else is the secret itself.
+func secretValue(v string) (string, error) {
+	if strings.HasPrefix(v, "file:") {
+		name := strings.TrimPrefix(v, "file:")
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		s := strings.TrimRight(string(b), "\r\n")
+		if s == "" {
+			return "", fmt.Errorf("%s: empty secret", name)
+		}
+		return s, nil
+	}
+	var err error
+	s := reEnvRef.ReplaceAllStringFunc(v, func(ref string) string {
+		name := reEnvRef.FindStringSubmatch(ref)[1]
+		val, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("$%s is not set", name)
+		}
+		return val
+	})
+	return s, err
+}
+
+// resolveSecrets replaces references in the secret flags of fs with the
+// secrets
+func resolveSecrets(fs *flag.FlagSet) error {
+	for name := range secretFlags {
+		f := fs.Lookup(name)
+		if f == nil || !isSecretRef(f.Value.String()) {
+			continue
+		}
+		s, err := secretValue(f.Value.String())
+		if err == nil {
+			err = f.Value.Set(s)
+		}
+		if err != nil {
+			return fmt.Errorf("-%s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecretValue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "token")
+	ioutil.WriteFile(file, []byte("from-file\n"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "empty"), []byte("\n"), 0600)
+	defer os.Unsetenv("MARKDOWND_TEST_SECRET")
+	os.Setenv("MARKDOWND_TEST_SECRET", "from-env")
+
+	for v, want := range map[string]string{
+		"file:" + file:                    "from-file",
+		"${MARKDOWND_TEST_SECRET}":        "from-env",
+		"Bearer ${MARKDOWND_TEST_SECRET}": "Bearer from-env",
+		"plain$secret":                    "plain$secret",
+	} {
+		if got, err := secretValue(v); err != nil || got != want {
+			t.Logf("%q: expected %q, got %q %v", v, want, got, err)
+			t.Fail()
+		}
+	}
+	for _, v := range []string{"file:" + filepath.Join(dir, "missing"), "file:" + filepath.Join(dir, "empty"), "${MARKDOWND_TEST_UNSET}"} {
+		if _, err := secretValue(v); err == nil {
+			t.Logf("%q: expected an error", v)
+			t.Fail()
+		}
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	tok := fs.String("token", "", "")
+	site := fs.String("site-name", "", "")
+	fs.Parse([]string{"-token", "file:" + file, "-site-name", "${MARKDOWND_TEST_SECRET}"})
+	if err := resolveSecrets(fs); err != nil || *tok != "from-file" || *site != "${MARKDOWND_TEST_SECRET}" {
+		t.Log("Expected only secret flags resolved, got:", *tok, *site, err)
+		t.Fail()
+	}
+	fs.Set("token", "${MARKDOWND_TEST_UNSET}")
+	if err := resolveSecrets(fs); err == nil || !strings.HasPrefix(err.Error(), "-token: ") {
+		t.Log("Expected an error naming -token, got:", err)
+		t.Fail()
+	}
+}
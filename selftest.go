@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// selftestWorkers is how many pages -selftest requests at once
+const selftestWorkers = 4
+
+// selftestPage is a page -selftest requests, on a -vhost host or ""
+type selftestPage struct {
+	host, path string
+}
+
+// selftestResult is how a page answered
+type selftestResult struct {
+	page    selftestPage
+	status  int
+	elapsed time.Duration
+	err     error
+}
+
+// selftestPages returns the url of every page served: in the root, -mount
+// and -vhost directories. drafts and embargoed pages are left out, they
+// answer 404.
+func selftestPages(root Handler) []selftestPage {
+	var pages []selftestPage
+	add := func(h Handler, host string) {
+		for _, name := range h.wikiPages() {
+			if b, err := fs.ReadFile(h.Root, name); err == nil {
+				if fm, _ := parseFrontMatter(b); hideDraft(name, fm) {
+					continue
+				}
+			}
+			pages = append(pages, selftestPage{host, h.Prefix + h.pageURL(name)})
+		}
+	}
+	if root.Root != nil {
+		add(root, "")
+	}
+	for _, mp := range mounts {
+		add(mp.handler(root), "")
+	}
+	for _, v := range vhosts {
+		h := root
+		h.Root, h.Index = os.DirFS(prepareDirectory(v.Dir)), v.Index
+		add(h, v.Host)
+	}
+	return pages
+}
+
+// selftestClient returns a client for the pages on ln, and the url the
+// paths go after
+func selftestClient(ln net.Listener) (*http.Client, string) {
+	transport := &http.Transport{MaxIdleConnsPerHost: selftestWorkers}
+	base := strings.TrimSuffix(browserURL(ln, ""), "/")
+	if ln.Addr().Network() == "unix" {
+		addr := ln.Addr().String()
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", addr)
+		}
+		base = "http://markdownd"
+	}
+	return &http.Client{Transport: transport, Timeout: time.Minute}, base
+}
+
+// fetch requests the page, waiting out 429 answers from -rate a few times
+func (p selftestPage) fetch(client *http.Client, base, bearer string) selftestResult {
+	res := selftestResult{page: p}
+	for try := 0; ; try++ {
+		req, err := http.NewRequest("GET", base+p.path, nil)
+		if err != nil {
+			res.err = err
+			return res
+		}
+		if p.host != "" {
+			req.Host = p.host
+		}
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		req.Header.Set("User-Agent", "markdownd-selftest/"+version)
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			res.err = err
+			return res
+		}
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		res.status, res.elapsed, res.err = resp.StatusCode, time.Since(start), err
+		wait, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if resp.StatusCode != http.StatusTooManyRequests || try == 3 || wait > 10 {
+			return res
+		}
+		time.Sleep(time.Duration(wait+1) * time.Second)
+	}
+}
+
+// failed reports whether the page answered with an error
+func (r selftestResult) failed() bool {
+	return r.err != nil || r.status >= 400
+}
+
+func (r selftestResult) String() string {
+	s := r.page.path
+	if r.page.host != "" {
+		s = r.page.host + s
+	}
+	if r.err != nil {
+		return s + ": " + r.err.Error()
+	}
+	return s + ": " + strconv.Itoa(r.status) + " in " + r.elapsed.Round(time.Millisecond).String()
+}
+
+// selftest requests every page of root through ln, logging the pages
+// that fail and those slower than slow. it returns the pages requested
+// and how many failed.
+func selftest(root Handler, ln net.Listener, slow time.Duration) (pages, failed int) {
+	client, base := selftestClient(ln)
+	reloadMu.RLock()
+	bearer := *token
+	reloadMu.RUnlock()
+
+	todo := make(chan selftestPage)
+	results := make(chan selftestResult)
+	var wg sync.WaitGroup
+	for i := 0; i < selftestWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range todo {
+				results <- p.fetch(client, base, bearer)
+			}
+		}()
+	}
+	go func() {
+		for _, p := range selftestPages(root) {
+			todo <- p
+		}
+		close(todo)
+		wg.Wait()
+		close(results)
+	}()
+	for r := range results {
+		pages++
+		switch {
+		case r.failed():
+			failed++
+			logAt(levelError, "selftest: failed:", r)
+		case slow > 0 && r.elapsed > slow:
+			logAt(levelWarn, "selftest: slow:", r)
+		}
+	}
+	return pages, failed
+}
+
+// runSelftest runs the -selftest once listening, marking the server
+// ready when every page answered, and exiting when one didn't
+func runSelftest(root Handler, listeners []net.Listener) {
+	start := time.Now()
+	pages, failed := selftest(root, listeners[0], *selftestSlow)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if failed != 0 {
+		logfAt(levelError, "selftest: %d of %d pages failed in %v", failed, pages, elapsed)
+		os.Exit(1)
+	}
+	logfAt(levelInfo, "selftest: %d pages ok in %v", pages, elapsed)
+	ready.done("selftest")
+}
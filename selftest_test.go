@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSelftest(t *testing.T) {
+	h := Handler{Root: fstest.MapFS{
+		"index.md":       {Data: []byte("# home\n")},
+		"guide/intro.md": {Data: []byte("# intro\n")},
+		"broken.md":      {Data: []byte("# broken\n")},
+		"draft.md":       {Data: []byte("---\ndraft: true\n---\n# draft\n")},
+		"_partial.md":    {Data: []byte("partial\n")},
+	}}
+	pages := selftestPages(h)
+	want := map[string]bool{"/": true, "/guide/intro.md": true, "/broken.md": true}
+	if len(pages) != len(want) {
+		t.Logf("Expected %d pages, got %v", len(want), pages)
+		t.Fail()
+	}
+	for _, p := range pages {
+		if !want[p.path] || p.host != "" {
+			t.Log("Unexpected page:", p)
+			t.Fail()
+		}
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer ln.Close()
+	var mu sync.Mutex
+	var requested []string
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.UserAgent())
+		mu.Unlock()
+		if r.URL.Path == "/broken.md" {
+			http.Error(w, "500 broken", http.StatusInternalServerError)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	n, failed := selftest(h, ln, 0)
+	if n != 3 || failed != 1 {
+		t.Logf("Expected 3 pages and 1 failure, got %d and %d", n, failed)
+		t.Fail()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requested) == 0 || requested[0] != "markdownd-selftest/"+version {
+		t.Log("Expected requests from the selftest user agent, got", requested)
+		t.Fail()
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// service describes markdownd installed as a native service
+type service struct {
+	Name string   // unit name, launchd label suffix
+	Exe  string   // absolute path of the binary
+	Args []string // flags and directory for serving
+	Dir  string   // working directory, for relative paths in Args
+	User bool     // per user instead of system wide
+}
+
+// reServiceName matches the service names usable as a unit file name and
+// launchd label
+var reServiceName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.@-]*$`)
+
+// systemdQuote quotes an ExecStart argument
+func systemdQuote(s string) string {
+	s = strings.Replace(s, "%", "%%", -1)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;$") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$").Replace(s) + `"`
+}
+
+// systemdUnit returns a systemd service unit
+func (s service) systemdUnit() []byte {
+	args := []string{systemdQuote(s.Exe)}
+	for _, a := range s.Args {
+		args = append(args, systemdQuote(a))
+	}
+	target := "multi-user.target"
+	if s.User {
+		target = "default.target"
+	}
+	return []byte(`[Unit]
+Description=` + s.Name + ` markdown server
+After=network.target
+
+[Service]
+ExecStart=` + strings.Join(args, " ") + `
+WorkingDirectory=` + strings.Replace(s.Dir, "%", "%%", -1) + `
+Restart=on-failure
+NoNewPrivileges=true
+
+[Install]
+WantedBy=` + target + `
+`)
+}
+
+// launchdLabel is the launchd job label
+func (s service) launchdLabel() string {
+	return "com.github.aerth." + s.Name
+}
+
+// launchdPlist returns a launchd property list
+func (s service) launchdPlist() []byte {
+	esc := func(v string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(v))
+		return buf.String()
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>` + esc(s.launchdLabel()) + `</string>
+	<key>ProgramArguments</key>
+	<array>
+`)
+	for _, a := range append([]string{s.Exe}, s.Args...) {
+		buf.WriteString("\t\t<string>" + esc(a) + "</string>\n")
+	}
+	buf.WriteString(`	</array>
+	<key>WorkingDirectory</key>
+	<string>` + esc(s.Dir) + `</string>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+</dict>
+</plist>
+`)
+	return buf.Bytes()
+}
+
+// unitFile returns where the unit or plist is installed for system
+func (s service) unitFile(system string) (string, error) {
+	if !reServiceName.MatchString(s.Name) {
+		return "", fmt.Errorf("bad service name %q, use letters, digits and _ . @ -", s.Name)
+	}
+	home, _ := os.UserHomeDir()
+	switch {
+	case system == "systemd" && s.User:
+		return filepath.Join(home, ".config", "systemd", "user", s.Name+".service"), nil
+	case system == "systemd":
+		return filepath.Join("/etc/systemd/system", s.Name+".service"), nil
+	case system == "launchd" && s.User:
+		return filepath.Join(home, "Library", "LaunchAgents", s.launchdLabel()+".plist"), nil
+	case system == "launchd":
+		return filepath.Join("/Library/LaunchDaemons", s.launchdLabel()+".plist"), nil
+	}
+	return "", fmt.Errorf("unknown service system %q, use systemd or launchd", system)
+}
+
+// serviceRun runs a service manager command, showing it first
+func serviceRun(name string, args ...string) error {
+	fmt.Fprintln(os.Stderr, "+", name, strings.Join(args, " "))
+	cmd := exec.Command(name, args...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	return cmd.Run()
+}
+
+// install writes the unit and starts the service
+func (s service) install(system string) error {
+	file, err := s.unitFile(system)
+	if err != nil {
+		return err
+	}
+	unit := s.systemdUnit()
+	if system == "launchd" {
+		unit = s.launchdPlist()
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file, unit, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "wrote", file)
+	if system == "launchd" {
+		return serviceRun("launchctl", "load", "-w", file)
+	}
+	systemctl := []string{}
+	if s.User {
+		systemctl = append(systemctl, "--user")
+	}
+	if err := serviceRun("systemctl", append(systemctl, "daemon-reload")...); err != nil {
+		return err
+	}
+	return serviceRun("systemctl", append(systemctl, "enable", "--now", s.Name+".service")...)
+}
+
+// uninstall stops the service and removes the unit
+func (s service) uninstall(system string) error {
+	file, err := s.unitFile(system)
+	if err != nil {
+		return err
+	}
+	if system == "launchd" {
+		serviceRun("launchctl", "unload", "-w", file)
+	} else {
+		systemctl := []string{}
+		if s.User {
+			systemctl = append(systemctl, "--user")
+		}
+		serviceRun("systemctl", append(systemctl, "disable", "--now", s.Name+".service")...)
+		defer serviceRun("systemctl", append(systemctl, "daemon-reload")...)
+	}
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "removed", file)
+	return nil
+}
+
+// serviceCommand installs markdownd as a systemd or launchd service
+func serviceCommand(args []string) {
+	fs := flag.NewFlagSet("service", flag.ExitOnError)
+	name := fs.String("name", "markdownd", "service name")
+	system := fs.String("system", "", "systemd or launchd (default: launchd on macos, systemd elsewhere)")
+	user := fs.Bool("user", false, "install for the current user instead of system wide")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: markdownd service [-name markdownd] [-system systemd|launchd] [-user] <install|uninstall|print> [flags] <directory>")
+		fmt.Fprintln(os.Stderr, "flags and directory after the action are passed to markdownd, as if run from the current directory")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(111)
+	}
+	if *system == "" {
+		*system = "systemd"
+		if runtime.GOOS == "darwin" {
+			*system = "launchd"
+		}
+	}
+	if runtime.GOOS == "windows" {
+		fmt.Fprintln(os.Stderr, "windows services are not supported, markdownd can't answer the service control manager.\n"+
+			"run it with a service wrapper such as winsw or nssm")
+		os.Exit(111)
+	}
+
+	action, serveArgs := fs.Arg(0), fs.Args()[1:]
+	// catch bad flags now rather than in a restart loop
+	if action != "uninstall" {
+		if _, _, err := parseServeFlags(serveArgs); err != nil {
+			fmt.Fprintln(os.Stderr, "markdownd", strings.Join(serveArgs, " ")+":", err)
+			os.Exit(111)
+		}
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	cwd, _ := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(111)
+	}
+	s := service{Name: *name, Exe: exe, Args: serveArgs, Dir: cwd, User: *user}
+
+	switch action {
+	case "print":
+		if _, err = s.unitFile(*system); err == nil {
+			if *system == "launchd" {
+				os.Stdout.Write(s.launchdPlist())
+			} else {
+				os.Stdout.Write(s.systemdUnit())
+			}
+		}
+	case "install":
+		err = s.install(*system)
+	case "uninstall":
+		err = s.uninstall(*system)
+	default:
+		fs.Usage()
+		os.Exit(111)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(111)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemdUnit(t *testing.T) {
+	s := service{Name: "docs", Exe: "/usr/local/bin/markdownd", Args: []string{"-http", ":8080", "-header", "my head.html", "100%"}, Dir: "/srv"}
+	unit := string(s.systemdUnit())
+	for _, want := range []string{
+		"Description=docs markdown server\n",
+		`ExecStart=/usr/local/bin/markdownd -http :8080 -header "my head.html" 100%%` + "\n",
+		"WorkingDirectory=/srv\n",
+		"WantedBy=multi-user.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Logf("Expected %q in unit:\n%s", want, unit)
+			t.Fail()
+		}
+	}
+	s.User = true
+	if !strings.Contains(string(s.systemdUnit()), "WantedBy=default.target\n") {
+		t.Log("Expected user units wanted by default.target")
+		t.Fail()
+	}
+	if f, err := s.unitFile("systemd"); err != nil || !strings.HasSuffix(f, "/.config/systemd/user/docs.service") {
+		t.Log("Unexpected user unit file:", f, err)
+		t.Fail()
+	}
+	s.Dir = "/srv/my docs/100%"
+	if unit := string(s.systemdUnit()); !strings.Contains(unit, "WorkingDirectory=/srv/my docs/100%%\n") {
+		t.Logf("Expected the working directory unquoted in unit:\n%s", unit)
+		t.Fail()
+	}
+	for _, name := range []string{"../x", "a/b", "", ".docs", "docs\nExecStartPre=/bin/sh"} {
+		if _, err := (service{Name: name}).unitFile("systemd"); err == nil {
+			t.Logf("Expected an error for the service name %q", name)
+			t.Fail()
+		}
+	}
+	if _, err := s.unitFile("upstart"); err == nil {
+		t.Log("Expected an error for an unknown system")
+		t.Fail()
+	}
+}
+
+func TestLaunchdPlist(t *testing.T) {
+	s := service{Name: "docs", Exe: "/usr/local/bin/markdownd", Args: []string{"-site-name", "R&D <docs>", "docs"}, Dir: "/srv"}
+	plist := string(s.launchdPlist())
+	for _, want := range []string{
+		"<string>com.github.aerth.docs</string>",
+		"\t\t<string>/usr/local/bin/markdownd</string>\n\t\t<string>-site-name</string>\n\t\t<string>R&amp;D &lt;docs&gt;</string>\n\t\t<string>docs</string>\n",
+		"<key>WorkingDirectory</key>\n\t<string>/srv</string>",
+	} {
+		if !strings.Contains(plist, want) {
+			t.Logf("Expected %q in plist:\n%s", want, plist)
+			t.Fail()
+		}
+	}
+	if f, _ := s.unitFile("launchd"); f != "/Library/LaunchDaemons/com.github.aerth.docs.plist" {
+		t.Log("Unexpected plist file:", f)
+		t.Fail()
+	}
+}
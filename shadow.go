@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+// shadowLimit is how much of each response is kept for comparing
+const shadowLimit = 1 << 20
+
+// shadowInflight caps concurrent mirrored requests, more are dropped
+var shadowInflight = make(chan struct{}, 16)
+
+// shadowCapture keeps the start of a response for comparing with the shadow
+type shadowCapture struct {
+	buf  bytes.Buffer
+	size int64
+}
+
+func (c *shadowCapture) write(b []byte) {
+	c.size += int64(len(b))
+	if room := shadowLimit - c.buf.Len(); room > 0 {
+		if len(b) > room {
+			b = b[:room]
+		}
+		c.buf.Write(b)
+	}
+}
+
+// shadowSample reports whether r should be mirrored to -shadow
+func shadowSample(r *http.Request) bool {
+	if *shadow == "" || (r.Method != "GET" && r.Method != "HEAD") {
+		return false
+	}
+	if siteWide(r.URL.Path) || strings.HasPrefix(r.URL.Path, "/_markdownd/") {
+		return false
+	}
+	return rand.Float64() < *shadowRate
+}
+
+// shadowCopy makes the request sent to the shadow instance. headers are
+// copied, except those about the connection.
+func shadowCopy(base string, r *http.Request) (*http.Request, error) {
+	req, err := http.NewRequest(r.Method, strings.TrimSuffix(base, "/")+r.URL.RequestURI(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range r.Header {
+		switch k {
+		case "Connection", "Keep-Alive", "Te", "Trailer", "Transfer-Encoding", "Upgrade":
+			continue
+		}
+		req.Header[k] = v
+	}
+	req.Header.Set("X-Markdownd-Shadow", "1")
+	req.Host = r.Host
+	return req, nil
+}
+
+// shadowCompare sends req to the shadow and logs how its response differs
+// from the one we served
+func shadowCompare(id string, req *http.Request, status int, served *shadowCapture) {
+	select {
+	case shadowInflight <- struct{}{}:
+		defer func() { <-shadowInflight }()
+	default:
+		logAt(levelDebug, id, "shadow: busy, dropped")
+		return
+	}
+	resp, err := outboundClient().Do(req)
+	if err != nil {
+		logger.Println(id, "shadow:", err)
+		return
+	}
+	defer resp.Body.Close()
+	var got shadowCapture
+	n, _ := io.Copy(ioutil.Discard, io.TeeReader(resp.Body, writerFunc(got.write)))
+	got.size = n
+
+	path := req.URL.RequestURI()
+	switch {
+	case resp.StatusCode != status:
+		logfAt(levelWarn, "%s shadow: %s status %d, shadow %d", id, path, status, resp.StatusCode)
+	case got.size != served.size || !bytes.Equal(got.buf.Bytes(), served.buf.Bytes()):
+		line, ours, theirs := firstDiff(served.buf.Bytes(), got.buf.Bytes())
+		logfAt(levelWarn, "%s shadow: %s body %d bytes, shadow %d, line %d: %q != %q",
+			id, path, served.size, got.size, line, ours, theirs)
+	}
+}
+
+// writerFunc adapts a function to io.Writer
+type writerFunc func([]byte)
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	f(b)
+	return len(b), nil
+}
+
+// firstDiff returns the first line that differs between a and b, numbered
+// from 1, shortened for the log
+func firstDiff(a, b []byte) (int, string, string) {
+	al, bl := strings.Split(string(a), "\n"), strings.Split(string(b), "\n")
+	for i := 0; ; i++ {
+		var x, y string
+		if i < len(al) {
+			x = al[i]
+		}
+		if i < len(bl) {
+			y = bl[i]
+		}
+		if x != y || i >= len(al) || i >= len(bl) {
+			return i + 1, truncate(x, 120), truncate(y, 120)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShadow(t *testing.T) {
+	seen := make(chan *http.Request, 1)
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r
+		w.Write([]byte("<h1>welcome</h1>\n<p>changed</p>\n"))
+	}))
+	defer mirror.Close()
+	*shadow, *shadowRate = mirror.URL, 1
+	defer func() { *shadow, *shadowRate = "", 0.1 }()
+
+	var logs bytes.Buffer
+	out := logger.Writer()
+	logger.SetOutput(&logs)
+	defer logger.SetOutput(out)
+
+	req, _ := http.NewRequest("GET", "http://docs.example.com/index.md?x=1", nil)
+	req.Header.Set("Accept-Language", "de")
+	if !shadowSample(req) {
+		t.Log("Expected the request to be sampled")
+		t.FailNow()
+	}
+	copied, err := shadowCopy(*shadow, req)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	served := &shadowCapture{}
+	served.write([]byte("<h1>welcome</h1>\n<p>original</p>\n"))
+	shadowCompare("request-TEST", copied, 200, served)
+
+	select {
+	case r := <-seen:
+		if r.URL.RequestURI() != "/index.md?x=1" || r.Host != "docs.example.com" ||
+			r.Header.Get("Accept-Language") != "de" || r.Header.Get("X-Markdownd-Shadow") != "1" {
+			t.Log("Unexpected mirrored request:", r.Host, r.URL, r.Header)
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.Log("Expected a mirrored request")
+		t.FailNow()
+	}
+	if !strings.Contains(logs.String(), `line 2: "<p>original</p>" != "<p>changed</p>"`) {
+		t.Log("Expected the differing line in the log, got:", logs.String())
+		t.Fail()
+	}
+
+	for _, path := range []string{"/healthz", "/_markdownd/stats"} {
+		if r, _ := http.NewRequest("GET", "http://example.com"+path, nil); shadowSample(r) {
+			t.Log("Expected no mirroring for", path)
+			t.Fail()
+		}
+	}
+	if r, _ := http.NewRequest("POST", "http://example.com/index.md", nil); shadowSample(r) {
+		t.Log("Expected no mirroring for POST")
+		t.Fail()
+	}
+}
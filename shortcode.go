@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reShortcode matches '{{< name arg "quoted arg" >}}'
+var reShortcode = regexp.MustCompile(`\{\{<\s*([a-z]+)((?:\s+(?:"[^"]*"|[^\s">]+))*)\s*>\}\}`)
+
+// reShortcodeArg matches one argument of a shortcode
+var reShortcodeArg = regexp.MustCompile(`"[^"]*"|[^\s">]+`)
+
+// shortcodeFuncs are the shortcodes, evaluated for every request so their
+// output is current:
+//
+//	{{< now "2006-01-02 15:04" >}}  the time, in a go time layout
+//	{{< modified >}}              when the page was last changed
+//	{{< list docs >}}             a list of the pages in a directory
+//	{{< env >}}                   the -environment, such as staging
+//
+// '{{< tabs >}}' and '{{< /tabs >}}' lines around code blocks aren't
+// evaluated here, they make the blocks tabs (see codeAnnotations), and
+// neither are '{{< form >}}' blocks (see pageForms).
+var shortcodeFuncs = map[string]func(h Handler, page shortcodePage, args []string) (string, error){
+	"now": func(h Handler, page shortcodePage, args []string) (string, error) {
+		return time.Now().Format(timeLayout(args)), nil
+	},
+	"modified": func(h Handler, page shortcodePage, args []string) (string, error) {
+		return page.modified.Format(timeLayout(args)), nil
+	},
+	"list": func(h Handler, page shortcodePage, args []string) (string, error) {
+		dir := "."
+		if len(args) != 0 {
+			dir = args[0]
+		}
+		return h.listing(page.name, dir)
+	},
+	"env": func(h Handler, page shortcodePage, args []string) (string, error) {
+		if *environment == "" {
+			return "", nil
+		}
+		return "`" + strings.Replace(*environment, "`", "", -1) + "`", nil
+	},
+}
+
+// shortcodePage is the page a shortcode is evaluated in
+type shortcodePage struct {
+	name     string // in Root
+	modified time.Time
+}
+
+// timeLayout is the go time layout given to a shortcode, or a date
+func timeLayout(args []string) string {
+	if len(args) != 0 && args[0] != "" {
+		return args[0]
+	}
+	return "2006-01-02"
+}
+
+// shortcodes evaluates the shortcodes in the markdown of the file name,
+// outside of code fences. it reports whether there were any, as the page
+// then changes without its file changing. unknown shortcodes are left as
+// they are, and failing ones become a comment saying why.
+func (h Handler) shortcodes(name string, modified time.Time, src []byte) ([]byte, bool) {
+	if !bytes.Contains(src, []byte("{{<")) {
+		return src, false
+	}
+	page := shortcodePage{name, modified}
+	var out bytes.Buffer
+	var fenced, found bool
+	for _, line := range bytes.SplitAfter(src, []byte("\n")) {
+		trimmed := bytes.TrimSpace(line)
+		if bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~")) {
+			fenced = !fenced
+		}
+		if fenced {
+			out.Write(line)
+			continue
+		}
+		out.Write(reShortcode.ReplaceAllFunc(line, func(m []byte) []byte {
+			sub := reShortcode.FindSubmatch(m)
+			fn, ok := shortcodeFuncs[string(sub[1])]
+			if !ok {
+				return m
+			}
+			found = true
+			var args []string
+			for _, arg := range reShortcodeArg.FindAllString(string(sub[2]), -1) {
+				if s, err := strconv.Unquote(arg); err == nil {
+					arg = s
+				}
+				args = append(args, arg)
+			}
+			v, err := fn(h, page, args)
+			if err != nil {
+				logger.Printf("shortcode %s in %s: %v", sub[1], name, err)
+				return []byte(fmt.Sprintf("<!-- %s: %s -->", sub[1], strings.Replace(err.Error(), "--", "", -1)))
+			}
+			return []byte(v)
+		}))
+	}
+	return out.Bytes(), found
+}
+
+// listing is a markdown list of the pages and directories in dir, relative
+// to the page name, or to the root with a leading '/'. hidden and '_'
+// files are left out, and so is the page itself.
+func (h Handler) listing(name, dir string) (string, error) {
+	d := path.Join(path.Dir(name), dir)
+	if strings.HasPrefix(dir, "/") {
+		d = strings.TrimPrefix(path.Clean(dir), "/")
+		if d == "" {
+			d = "."
+		}
+	}
+	if !fs.ValidPath(d) {
+		return "", fmt.Errorf("%s is outside the root", dir)
+	}
+	entries, err := fs.ReadDir(h.Root, d)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	var b strings.Builder
+	for _, e := range entries {
+		file := path.Join(d, e.Name())
+		if strings.HasPrefix(e.Name(), ".") || strings.HasPrefix(e.Name(), "_") || file == name {
+			continue
+		}
+		title, link := segmentName(e.Name()), "/"+file
+		switch {
+		case e.IsDir():
+			title, link = e.Name()+"/", link+"/"
+		case !e.Type().IsRegular():
+			continue
+		case strings.HasSuffix(e.Name(), ".md"):
+			if b, err := fs.ReadFile(h.Root, file); err == nil {
+				fm, md := parseFrontMatter(b)
+				if hideDraft(file, fm) {
+					continue
+				}
+				if t := pageTitle(fm, md); t != "" {
+					title = t
+				}
+			}
+		default:
+			title = e.Name()
+		}
+		fmt.Fprintf(&b, "* [%s](%s)\n", strings.NewReplacer("[", `\[`, "]", `\]`).Replace(title), (&url.URL{Path: link}).String())
+	}
+	return b.String(), nil
+}
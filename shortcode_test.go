@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestShortcodes(t *testing.T) {
+	defer func(env string) { *environment = env }(*environment)
+	*environment = "staging"
+	h := Handler{Root: fstest.MapFS{
+		"status/index.md":        {Data: []byte("# Status\n")},
+		"status/db migration.md": {Data: []byte("---\ntitle: Database [migration]\n---\n")},
+		"status/logs.txt":        {Data: []byte("log\n")},
+		"status/old/a.md":        {Data: []byte("# a\n")},
+		"status/_draft.md":       {Data: []byte("# draft\n")},
+	}}
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	src := "Built {{< now \"2006\" >}}, changed {{< modified >}} at {{< modified \"15:04\" >}} on {{< env >}}.\n" +
+		"{{< list >}}\n" +
+		"{{< list /nowhere >}}\n" +
+		"{{< list ../.. >}}\n" +
+		"{{< unknown thing >}}\n" +
+		"```\n{{< now >}}\n```\n"
+	out, dynamic := h.shortcodes("status/index.md", modified, []byte(src))
+	for _, want := range []string{
+		"Built " + time.Now().Format("2006") + ", changed 2020-01-02 at 03:04 on `staging`.\n",
+		"* [Database \\[migration\\]](/status/db%20migration.md)\n* [logs.txt](/status/logs.txt)\n* [old/](/status/old/)\n",
+		"<!-- list: open nowhere: file does not exist -->",
+		"<!-- list: ../.. is outside the root -->",
+		"{{< unknown thing >}}",
+		"```\n{{< now >}}\n```\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Logf("Expected %q in:\n%s", want, out)
+			t.Fail()
+		}
+	}
+	if !dynamic {
+		t.Log("Expected the page marked dynamic")
+		t.Fail()
+	}
+	if _, dynamic := h.shortcodes("a.md", modified, []byte("{{< unknown >}}\n")); dynamic {
+		t.Log("Expected unknown shortcodes not to count")
+		t.Fail()
+	}
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/status/", nil)
+	h.Root.(fstest.MapFS)["status/index.md"] = &fstest.MapFile{Data: []byte("# Status\n\n{{< now >}}\n")}
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Log("Expected no-cache for a page with shortcodes, got:", rec.Header().Get("Cache-Control"))
+		t.Fail()
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// shutdownOnSignal stops server on SIGINT or SIGTERM. it first drains for
+// drainTime, still accepting requests while load balancers notice /readyz
+// failing, then lets requests in flight finish for up to timeout. the
+// returned channel closes once the server is down.
+func shutdownOnSignal(server *http.Server, drainTime, timeout time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		signal.Stop(c)
+		if drainTime > 0 {
+			logfAt(levelInfo, "%s: draining for %s", sig, drainTime)
+			drain()
+			time.Sleep(drainTime)
+		}
+		logfAt(levelInfo, "%s: shutting down (waiting up to %s)", sig, timeout)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Println("shutdown:", err)
+			server.Close()
+		}
+		close(done)
+	}()
+	return done
+}
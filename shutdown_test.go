@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownOnSignal(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	started := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})}
+	stopped := shutdownOnSignal(server, 0, 5*time.Second)
+	go server.Serve(ln)
+
+	result := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err == nil {
+			resp.Body.Close()
+		}
+		result <- err
+	}()
+	<-started
+	p, _ := os.FindProcess(os.Getpid())
+	p.Signal(syscall.SIGTERM)
+
+	// the request in flight finishes
+	if err := <-result; err != nil {
+		t.Log("Expected the request to finish, got:", err)
+		t.Fail()
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Log("Expected the server to stop")
+		t.FailNow()
+	}
+	if _, err := http.Get("http://" + ln.Addr().String() + "/"); err == nil {
+		t.Log("Expected the listener to be closed")
+		t.Fail()
+	}
+}
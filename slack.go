@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slackAPI is the slack web api base url
+var slackAPI = "https://slack.com/api"
+
+// slackEvent is the part of the events api payload we use
+type slackEvent struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Event     struct {
+		Type      string `json:"type"`
+		Channel   string `json:"channel"`
+		MessageTS string `json:"message_ts"`
+		Links     []struct {
+			URL string `json:"url"`
+		} `json:"links"`
+	} `json:"event"`
+}
+
+// slackSignature checks the X-Slack-Signature of a request body
+func slackSignature(secret string, r *http.Request, body []byte) bool {
+	ts := r.Header.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	// refuse replays
+	if d := time.Since(time.Unix(sec, 0)); d > 5*time.Minute || d < -5*time.Minute {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(want), []byte(r.Header.Get("X-Slack-Signature")))
+}
+
+// serveSlackEvents answers the slack events api, unfurling links to pages
+func (h Handler) serveSlackEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "400 bad request", http.StatusBadRequest)
+		return
+	}
+	if !slackSignature(*slackSecret, r, body) {
+		logAt(levelWarn, "slack: bad signature from", logAddr(r.RemoteAddr))
+		http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var ev slackEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		http.Error(w, "400 bad request", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case ev.Type == "url_verification":
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(ev.Challenge))
+		return
+	case ev.Type == "event_callback" && ev.Event.Type == "link_shared":
+		unfurls := map[string]interface{}{}
+		for _, link := range ev.Event.Links {
+			u, err := url.Parse(link.URL)
+			if err != nil {
+				continue
+			}
+			if !strings.HasPrefix(u.Path, h.Prefix+"/") {
+				continue
+			}
+			name := strings.TrimPrefix(u.Path, h.Prefix)
+			abs, ok := h.resolve(name)
+			if !ok {
+				continue
+			}
+			b, err := ioutil.ReadFile(abs)
+			if err != nil {
+				continue
+			}
+			fm, md := parseFrontMatter(b)
+			if hideDraft(strings.TrimPrefix(name, "/"), fm) {
+				continue
+			}
+			unfurls[link.URL] = map[string]string{
+				"title":      pageTitle(fm, md),
+				"title_link": link.URL,
+				"text":       truncate(pageSummary(fm, md), 300),
+			}
+		}
+		if len(unfurls) != 0 && *slackToken != "" {
+			// slack wants the events answered within 3 seconds
+			go slackUnfurl(ev.Event.Channel, ev.Event.MessageTS, unfurls)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// slackCommandUsage is the help text for the slash command
+const slackCommandUsage = "usage: `%s search <words>` finds pages containing every word"
+
+// serveSlackCommand answers slack slash commands such as '/docs search words'
+// with links to the best matching pages
+func (h Handler) serveSlackCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "400 bad request", http.StatusBadRequest)
+		return
+	}
+	if !slackSignature(*slackSecret, r, body) {
+		logAt(levelWarn, "slack: bad signature from", logAddr(r.RemoteAddr))
+		http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "400 bad request", http.StatusBadRequest)
+		return
+	}
+
+	command := form.Get("command")
+	if command == "" {
+		command = "/docs"
+	}
+	text := strings.TrimSpace(form.Get("text"))
+	if fields := strings.Fields(text); len(fields) != 0 && strings.EqualFold(fields[0], "search") {
+		text = strings.TrimSpace(text[len(fields[0]):])
+	}
+
+	var reply string
+	switch {
+	case text == "" || strings.EqualFold(text, "help"):
+		reply = fmt.Sprintf(slackCommandUsage, command)
+	default:
+		results := search(h.RootString, text, 5)
+		if len(results) == 0 {
+			reply = "no pages found for " + slackEscape(text)
+			break
+		}
+		base := baseURL(r)
+		lines := []string{fmt.Sprintf("%d results for *%s*:", len(results), slackEscape(text))}
+		for _, res := range results {
+			lines = append(lines, fmt.Sprintf("• <%s|%s>\n%s",
+				base+h.Prefix+res.URL, slackEscape(res.Title), slackEscape(res.Snippet)))
+		}
+		reply = strings.Join(lines, "\n")
+	}
+
+	// only the person asking sees the results
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"response_type": "ephemeral",
+		"text":          reply,
+	})
+}
+
+// slackEscape escapes text for slack mrkdwn
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// slackUnfurl posts link previews with chat.unfurl
+func slackUnfurl(channel, ts string, unfurls map[string]interface{}) {
+	b, _ := json.Marshal(map[string]interface{}{
+		"channel": channel,
+		"ts":      ts,
+		"unfurls": unfurls,
+	})
+	req, err := http.NewRequest("POST", slackAPI+"/chat.unfurl", bytes.NewReader(b))
+	if err != nil {
+		logger.Println("slack:", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+*slackToken)
+	resp, err := outboundClient().Do(req)
+	if err != nil {
+		logger.Println("slack: chat.unfurl:", err)
+		return
+	}
+	defer resp.Body.Close()
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if !result.OK {
+		logger.Println("slack: chat.unfurl:", resp.Status, result.Error)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedSlackRequest(secret, body string) *http.Request {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":" + body))
+	req, _ := http.NewRequest("POST", "/_markdownd/slack/events", strings.NewReader(body))
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestSlackEvents(t *testing.T) {
+	*slackSecret, *slackToken = "secret", "xoxb-test"
+	defer func() { *slackSecret, *slackToken = "", "" }()
+
+	// url verification
+	resp := sendRequest(signedSlackRequest("secret", `{"type":"url_verification","challenge":"abc"}`))
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(body) != "abc" {
+		t.Log("Expected challenge, got:", resp.StatusCode, string(body))
+		t.FailNow()
+	}
+
+	// bad signature
+	resp = sendRequest(signedSlackRequest("wrong", `{"type":"url_verification","challenge":"abc"}`))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Log("Expected 401 for bad signature, got:", resp.StatusCode)
+		t.FailNow()
+	}
+
+	// link unfurl
+	unfurled := make(chan map[string]interface{}, 1)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&v)
+		unfurled <- v
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer api.Close()
+	slackAPI = api.URL
+	defer func() { slackAPI = "https://slack.com/api" }()
+
+	ev := `{"type":"event_callback","event":{"type":"link_shared","channel":"C1","message_ts":"1.2",` +
+		`"links":[{"url":"https://docs.example.com/index.html"},{"url":"https://docs.example.com/notafile"}]}}`
+	resp = sendRequest(signedSlackRequest("secret", ev))
+	if resp.StatusCode != 200 {
+		t.Log("Expected 200, got:", resp.StatusCode)
+		t.FailNow()
+	}
+	select {
+	case v := <-unfurled:
+		unfurls, _ := v["unfurls"].(map[string]interface{})
+		b, _ := json.Marshal(unfurls)
+		if len(unfurls) != 1 || !bytes.Contains(b, []byte("welcome to markdownd")) {
+			t.Log("Unexpected unfurls:", string(b))
+			t.FailNow()
+		}
+	case <-time.After(5 * time.Second):
+		t.Log("Expected chat.unfurl call")
+		t.FailNow()
+	}
+
+	// drafts and embargoed pages don't unfurl
+	soon := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(dir+"/_drafts", 0755)
+	for name, body := range map[string]string{
+		"wip.md":          "---\ndraft: true\n---\n# Secret plan\n\nacquire competitor\n",
+		"_drafts/idea.md": "# Idea\n",
+		"notes.md":        "---\nembargo_until: " + soon + "\n---\n# Release notes\n",
+		"public.md":       "# Public\n\nhello\n",
+	} {
+		ioutil.WriteFile(dir+"/"+name, []byte(body), 0644)
+	}
+	h := Handler{Root: os.DirFS(dir + "/"), RootString: dir + "/"}
+	ev = `{"type":"event_callback","event":{"type":"link_shared","channel":"C1","message_ts":"1.2",` +
+		`"links":[{"url":"https://docs.example.com/wip.md"},{"url":"https://docs.example.com/_drafts/idea.md"},` +
+		`{"url":"https://docs.example.com/notes.md"},{"url":"https://docs.example.com/public.md"}]}}`
+	h.ServeHTTP(httptest.NewRecorder(), signedSlackRequest("secret", ev))
+	select {
+	case v := <-unfurled:
+		b, _ := json.Marshal(v["unfurls"])
+		if bytes.Contains(b, []byte("Secret plan")) || bytes.Contains(b, []byte("Idea")) || bytes.Contains(b, []byte("Release")) || !bytes.Contains(b, []byte("Public")) {
+			t.Log("Expected only the published page to unfurl, got:", string(b))
+			t.Fail()
+		}
+	case <-time.After(5 * time.Second):
+		t.Log("Expected chat.unfurl call")
+		t.FailNow()
+	}
+}
+
+func TestOpenGraph(t *testing.T) {
+	*og = true
+	defer func() { *og = false }()
+	req, _ := http.NewRequest("GET", "/index.md", nil)
+	resp := sendRequest(req)
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `<meta property="og:title" content="welcome to markdownd">`) {
+		t.Log("Expected og:title meta tag")
+		t.FailNow()
+	}
+}
+
+func TestOpenGraphImage(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://docs.example.com/guide/intro.md", nil)
+	req.Host = "docs.example.com"
+	for md, want := range map[string]string{
+		"# Intro\n\n![diagram](img/flow.png \"flow\")\n":               `<meta property="og:image" content="http://docs.example.com/docs/guide/img/flow.png">`,
+		"# Intro\n\n![](/static/logo.svg)\n":                           `<meta name="twitter:image" content="http://docs.example.com/docs/static/logo.svg">`,
+		"---\nimage: https://cdn.example.com/card.png\n---\n# Intro\n": `<meta property="og:image" content="https://cdn.example.com/card.png">`,
+		"# Intro\n\n![diagram](img/flow.png)\n":                        `<meta name="twitter:card" content="summary_large_image">`,
+		"# Intro\n\nno image\n":                                        `<meta name="twitter:card" content="summary">`,
+		"# Intro\n\n![alt text](x.png)\n":                              `<meta property="og:image:alt" content="alt text">`,
+	} {
+		fm, body := parseFrontMatter([]byte(md))
+		got := string(openGraph(baseURL(req), "/docs", "/docs/guide/intro.md", fm, body))
+		if !strings.Contains(got, want) || !strings.Contains(got, `<meta name="twitter:title" content="Intro">`) {
+			t.Logf("%q: expected %s in:\n%s", md, want, got)
+			t.Fail()
+		}
+	}
+	if _, alt := pageImage("http://x", "", "/a.md", frontMatter{}, []byte("![a](javascript:alert(1))")); alt != "" {
+		t.Log("Expected no image for a javascript url")
+		t.Fail()
+	}
+}
+
+func TestSlackCommand(t *testing.T) {
+	*slackSecret = "secret"
+	defer func() { *slackSecret = "" }()
+
+	command := func(secret, text string) (int, string) {
+		req := signedSlackRequest(secret, "command=%2Fdocs&text="+text)
+		req.URL.Path = "/_markdownd/slack/command"
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := sendRequest(req)
+		var reply map[string]string
+		json.NewDecoder(resp.Body).Decode(&reply)
+		return resp.StatusCode, reply["text"]
+	}
+
+	code, text := command("secret", "search+welcome")
+	if code != 200 || !strings.Contains(text, "/index.md|welcome to markdownd>") {
+		t.Log("Expected a link to index.md, got:", code, text)
+		t.FailNow()
+	}
+	if _, text := command("secret", "search+nothingmatches"); !strings.HasPrefix(text, "no pages found") {
+		t.Log("Expected no results, got:", text)
+		t.Fail()
+	}
+	if _, text := command("secret", ""); !strings.HasPrefix(text, "usage: `/docs search") {
+		t.Log("Expected usage, got:", text)
+		t.Fail()
+	}
+	if code, _ := command("wrong", "search+welcome"); code != http.StatusUnauthorized {
+		t.Log("Expected 401 for bad signature, got:", code)
+		t.Fail()
+	}
+}
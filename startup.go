@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+)
+
+// status prints startup information to stderr, unless -quiet or
+// -startup-json. warnings and errors are always printed.
+func status(a ...interface{}) {
+	if *quiet || *startupJSON {
+		return
+	}
+	fmt.Fprintln(os.Stderr, a...)
+}
+
+// startupInfo is the -startup-json line, for supervisors
+type startupInfo struct {
+	Version  string            `json:"version"`
+	Commit   string            `json:"commit,omitempty"`
+	PID      int               `json:"pid"`
+	Root     string            `json:"root,omitempty"`
+	Prefix   string            `json:"prefix,omitempty"`
+	Addrs    []string          `json:"addrs"`
+	URLs     []string          `json:"urls"`
+	Mounts   map[string]string `json:"mounts,omitempty"`
+	Vhosts   map[string]string `json:"vhosts,omitempty"`
+	Features []string          `json:"features"`
+}
+
+// enabledFeatures names the optional endpoints and protocols turned on,
+// and the -feature rules
+func enabledFeatures() []string {
+	list := []string{}
+	for _, f := range []struct {
+		name string
+		on   bool
+	}{
+		{"toc", *toc},
+		{"jsonld", *jsonld},
+		{"og", *og},
+		{"health", *health},
+		{"stats", *stats},
+		{"metrics", *metricsEnabled},
+		{"search", *searchEnabled},
+		{"watch", *watch},
+		{"changes", *changes},
+		{"editor-api", *editorAPI},
+		{"slack", *slackSecret != ""},
+		{"token", *token != ""},
+		{"gemini", *geminiAddr != ""},
+		{"gopher", *gopherAddr != ""},
+		{"pprof", *pprofAddr != ""},
+		{"shadow", *shadow != ""},
+		{"consul", *consulAgent != ""},
+		{"renderer-cmd", *rendererCmd != ""},
+		{"template", *pageTemplate != ""},
+		{"plugin", len(plugins) != 0},
+		{"wiki", *wiki},
+		{"drafts", *drafts},
+		{"openapi", *openapi != ""},
+		{"graphql", *graphql},
+		{"graph", *graph},
+		{"resize", *resizeImages},
+		{"copy-code", *copyCode},
+		{"forms", len(forms) != 0},
+		{"schemas", len(schemas) != 0},
+		{"canonical", *canonicalURL != ""},
+		{"bandwidth", shaper != nil},
+		{"gdpr", *gdpr},
+		{"rewrite-link", len(linkRewrites) != 0},
+		{"preload", *preloadPages},
+		{"selftest", *selftestRun},
+		{"pretty-urls", *prettyURLs},
+		{"tags", *tagPages},
+		{"auto-cache", *autoCache > 0},
+	} {
+		if f.on {
+			list = append(list, f.name)
+		}
+	}
+	for _, rule := range rollouts {
+		one := featureList{rule}
+		list = append(list, "feature:"+one.String())
+	}
+	return list
+}
+
+// startupLine describes the running server as one line of json
+func startupLine(root *Handler, listeners []net.Listener) []byte {
+	info := startupInfo{
+		Version:  version,
+		Commit:   commit,
+		PID:      os.Getpid(),
+		Root:     root.RootString,
+		Prefix:   root.Prefix,
+		Addrs:    []string{},
+		URLs:     []string{},
+		Features: enabledFeatures(),
+	}
+	for _, ln := range listeners {
+		info.Addrs = append(info.Addrs, ln.Addr().Network()+":"+ln.Addr().String())
+		if u := browserURL(ln, root.Prefix); u != "" {
+			info.URLs = append(info.URLs, u)
+		}
+	}
+	if len(mounts) != 0 {
+		info.Mounts = map[string]string{}
+		for _, mp := range mounts {
+			info.Mounts[root.Prefix+mp.Prefix+"/"] = prepareDirectory(mp.Dir)
+		}
+	}
+	if len(vhosts) != 0 {
+		info.Vhosts = map[string]string{}
+		for _, v := range vhosts {
+			info.Vhosts[v.Host] = prepareDirectory(v.Dir)
+		}
+	}
+	b, _ := json.Marshal(info)
+	return append(b, '\n')
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestStartupLine(t *testing.T) {
+	*searchEnabled = true
+	defer func() { *searchEnabled = false }()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer ln.Close()
+
+	line := startupLine(&Handler{RootString: "/srv/docs/"}, []net.Listener{ln})
+	if line[len(line)-1] != '\n' {
+		t.Log("Expected one line, got:", string(line))
+		t.Fail()
+	}
+	var info startupInfo
+	if err := json.Unmarshal(line, &info); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if info.PID != os.Getpid() || info.Root != "/srv/docs/" || len(info.Addrs) != 1 ||
+		info.Addrs[0] != "tcp:"+ln.Addr().String() || info.Version != version ||
+		len(info.URLs) != 1 || info.URLs[0] != "http://localhost:"+strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)+"/" {
+		t.Logf("Unexpected startup info: %+v", info)
+		t.Fail()
+	}
+	found := false
+	for _, f := range info.Features {
+		found = found || f == "search"
+	}
+	if !found {
+		t.Log("Expected search in features, got:", info.Features)
+		t.Fail()
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hllPrecision gives 2^14 registers, about 0.8% standard error
+const hllPrecision = 14
+
+// hyperLogLog estimates the number of distinct values added
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+func (h *hyperLogLog) add(x uint64) {
+	idx := x >> (64 - hllPrecision)
+	w := x<<hllPrecision | 1<<(hllPrecision-1) // guard bit, rank never exceeds 64-p+1
+	rank := uint8(1)
+	for w&(1<<63) == 0 {
+		rank++
+		w <<= 1
+	}
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(len(h.registers))
+	var sum float64
+	var zeros int
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// small range correction
+	if e <= 2.5*m && zeros != 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(e + 0.5)
+}
+
+// visitorCounter counts unique visitors per day without cookies.
+// visitors are hashed with a random salt that is thrown away every day,
+// so hashes can't be linked across days or reversed to an address.
+type visitorCounter struct {
+	mu        sync.Mutex
+	day       string
+	salt      [16]byte
+	today     *hyperLogLog
+	yesterday uint64
+	lastDay   string // the day of yesterday, which may be older
+}
+
+// add counts the client of r as a visitor
+func (v *visitorCounter) add(r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rotate(time.Now())
+	h := fnv.New64a()
+	h.Write(v.salt[:])
+	h.Write([]byte(clientIP(r)))
+	h.Write([]byte{0})
+	h.Write([]byte(r.UserAgent()))
+	v.today.add(mix64(h.Sum64()))
+}
+
+// rotate starts a new day with a new salt if now is on another day.
+// caller holds v.mu
+func (v *visitorCounter) rotate(now time.Time) {
+	day := now.UTC().Format("2006-01-02")
+	if day == v.day {
+		return
+	}
+	if v.today != nil {
+		v.yesterday, v.lastDay = v.today.estimate(), v.day
+	}
+	v.day = day
+	v.today = new(hyperLogLog)
+	if _, err := rand.Read(v.salt[:]); err != nil {
+		logger.Println("error generating visitor salt:", err)
+	}
+}
+
+// counts returns the day of now and the estimates for it and the day
+// before, 0 for a day without visitors
+func (v *visitorCounter) counts(now time.Time) (day string, today, yesterday uint64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rotate(now)
+	if v.lastDay == now.UTC().AddDate(0, 0, -1).Format("2006-01-02") {
+		yesterday = v.yesterday
+	}
+	return v.day, v.today.estimate(), yesterday
+}
+
+// mix64 is the splitmix64 finalizer, spreads fnv output across all bits
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// clientIP returns the address of the client, without port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// server statistics
+var (
+	started   = time.Now()
+	pageviews uint64
+	visitors  = &visitorCounter{}
+)
+
+// countPageview records a page (markdown or html) being served
+func countPageview(r *http.Request) {
+	atomic.AddUint64(&pageviews, 1)
+	visitors.add(r)
+}
+
+// serveStats writes the statistics as json
+func serveStats(w http.ResponseWriter, r *http.Request) {
+	day, today, yesterday := visitors.counts(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"started":            started.UTC().Format(time.RFC3339),
+		"uptime_seconds":     int64(time.Since(started).Seconds()),
+		"pageviews":          atomic.LoadUint64(&pageviews),
+		"date":               day,
+		"visitors":           today,
+		"visitors_yesterday": yesterday,
+	})
+}
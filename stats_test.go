@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	h := new(hyperLogLog)
+	for i := 0; i < 3; i++ { // duplicates must not count
+		for j := 0; j < 10000; j++ {
+			h.add(mix64(uint64(j)))
+		}
+	}
+	est := h.estimate()
+	if est < 9700 || est > 10300 {
+		t.Log("Expected estimate near 10000, got:", est)
+		t.FailNow()
+	}
+}
+
+func TestVisitorCounter(t *testing.T) {
+	// a fixed salt, as a random one makes two of the ten share a register
+	// once in a few hundred runs
+	v := &visitorCounter{day: time.Now().UTC().Format("2006-01-02"), today: new(hyperLogLog)}
+	for i := 0; i < 100; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i%10)
+		v.add(req)
+	}
+	now := time.Now()
+	if _, today, _ := v.counts(now); today != 10 {
+		t.Log("Expected 10 visitors, got:", today)
+		t.FailNow()
+	}
+	if _, today, yesterday := v.counts(now.AddDate(0, 0, 1)); today != 0 || yesterday != 10 {
+		t.Log("Expected the 10 visitors yesterday the next day, got:", today, yesterday)
+		t.Fail()
+	}
+
+	// a day without requests in between
+	v = &visitorCounter{day: now.UTC().Format("2006-01-02"), today: new(hyperLogLog)}
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i)
+		v.add(req)
+	}
+	if day, _, yesterday := v.counts(now.AddDate(0, 0, 2)); yesterday != 0 || day != now.UTC().AddDate(0, 0, 2).Format("2006-01-02") {
+		t.Log("Expected no visitors yesterday two days later, got:", day, yesterday)
+		t.Fail()
+	}
+}
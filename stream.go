@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// streamSize is the size above which files are served as they are read
+// from disk, instead of read into memory first
+const streamSize = 32 << 20
+
+// renderLimit is -max-render-size in bytes, 0 for none. larger markdown
+// files are served raw.
+var renderLimit int64 = 16 << 20
+
+// tooLarge reports whether the file is served by serveStream
+func tooLarge(name string, fi fs.FileInfo) bool {
+	if strings.HasSuffix(name, ".md") && renderLimit > 0 && fi.Size() > renderLimit {
+		return true
+	}
+	return fi.Size() > streamSize
+}
+
+// serveStream serves a large file without reading it into memory:
+// markdown raw, html as it is, and other files with their detected
+// content type and range requests. drafts are still hidden, by the front
+// matter at the top of the file.
+func (h Handler) serveStream(w http.ResponseWriter, r *http.Request, requestid, abs, name string, fi fs.FileInfo) {
+	f, err := h.Root.Open(name)
+	if err != nil {
+		logger.Printf("%s error reading file: %q", requestid, abs)
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	// the start of the file, for the content type and front matter
+	sniff := make([]byte, 64<<10)
+	n, err := io.ReadFull(f, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		logger.Printf("%s error reading file: %q %v", requestid, abs, err)
+		http.NotFound(w, r)
+		return
+	}
+	sniff = sniff[:n]
+	ct := http.DetectContentType(sniff)
+	switch {
+	case strings.HasSuffix(name, ".md"):
+		if fm, _ := parseFrontMatter(sniff); hideDraft(name, fm) {
+			logreq(requestid, "404 draft", abs)
+			http.NotFound(w, r)
+			return
+		}
+		logreqf("%s markdown too large to render (%d bytes), serving raw: %s", requestid, fi.Size(), abs)
+		ct = "text/plain; charset=utf-8"
+	case strings.HasSuffix(name, ".html") && strings.HasPrefix(ct, "text/html"):
+		logreq(requestid, "serving raw html:", abs)
+		countPageview(r)
+	default:
+		logreqf("%s streaming %s file: %s", requestid, ct, abs)
+	}
+	w.Header().Set("Content-Type", ct)
+	cacheControl(w, h.Prefix+r.URL.Path)
+
+	// files of directories seek, so ranges work
+	if rs, ok := f.(io.ReadSeeker); ok {
+		if _, err := rs.Seek(0, io.SeekStart); err == nil {
+			http.ServeContent(w, r, name, fi.ModTime(), rs)
+			return
+		}
+	}
+	io.Copy(w, io.MultiReader(bytes.NewReader(sniff), f))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServeStream(t *testing.T) {
+	defer func(n int64) { renderLimit = n }(renderLimit)
+	renderLimit = 100
+	big := "# big\n\n" + strings.Repeat("*words* ", 20)
+	h := Handler{Root: fstest.MapFS{
+		"small.md":      {Data: []byte("# small\n")},
+		"big.md":        {Data: []byte(big)},
+		"draft.md":      {Data: []byte("---\ndraft: true\n---\n" + big)},
+		"video.bin":     {Data: bytes.Repeat([]byte{0, 1, 2, 3}, streamSize/4+1)},
+		"_drafts/ok.md": {Data: []byte(big)},
+	}}
+	get := func(path, ranges string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if ranges != "" {
+			req.Header.Set("Range", ranges)
+		}
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get("/small.md", ""); !strings.Contains(rec.Body.String(), "<h1>") {
+		t.Logf("small page not rendered:\n%s", rec.Body.String())
+		t.Fail()
+	}
+	if rec := get("/big.md", ""); rec.Code != 200 || rec.Body.String() != big || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Logf("big page: %d %q\n%s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+		t.Fail()
+	}
+	for _, path := range []string{"/draft.md", "/_drafts/ok.md"} {
+		if rec := get(path, ""); rec.Code != 404 {
+			t.Logf("%s: %d, expected the draft hidden", path, rec.Code)
+			t.Fail()
+		}
+	}
+	if rec := get("/video.bin", "bytes=4-7"); rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), []byte{0, 1, 2, 3}) {
+		t.Logf("range of a streamed file: %d %v", rec.Code, rec.Body.Bytes())
+		t.Fail()
+	}
+}
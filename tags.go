@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/shurcooL/sanitized_anchor_name"
+)
+
+// taxonomies are the front matter lists given index pages by -tags, at
+// /tags/ and /tags/<tag>/
+var taxonomies = []string{"tags", "categories"}
+
+// tagged is a page listed on a tag page
+type tagged struct {
+	Title string
+	URL   string
+	Date  string
+}
+
+// taxonomy collects the pages of each term of the front matter list key,
+// by slug. pages are ordered newest first by their date, then by title.
+func (h Handler) taxonomy(key string) (terms map[string]string, pages map[string][]tagged) {
+	terms, pages = map[string]string{}, map[string][]tagged{}
+	for _, name := range h.wikiPages() {
+		b, err := fs.ReadFile(h.Root, name)
+		if err != nil {
+			continue
+		}
+		fm, md := parseFrontMatter(b)
+		if hideDraft(name, fm) {
+			continue
+		}
+		title := pageTitle(fm, md)
+		if title == "" {
+			title = segmentName(path.Base(name))
+		}
+		page := tagged{Title: title, URL: (&url.URL{Path: "/" + name}).String(), Date: fm.String("date")}
+		seen := map[string]bool{}
+		for _, term := range fm.List(key) {
+			slug := sanitized_anchor_name.Create(term)
+			if slug == "" || seen[slug] {
+				continue
+			}
+			seen[slug] = true
+			if _, ok := terms[slug]; !ok {
+				terms[slug] = term
+			}
+			pages[slug] = append(pages[slug], page)
+		}
+	}
+	for _, list := range pages {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Date != list[j].Date {
+				return list[i].Date > list[j].Date
+			}
+			return list[i].Title < list[j].Title
+		})
+	}
+	return terms, pages
+}
+
+// tagPage returns the markdown of a generated taxonomy page for the url
+// path, '/tags/' listing the tags and '/tags/go/' the pages tagged go.
+// ok is false for other paths, and for taxonomies with a directory of
+// the same name in Root, as real files win.
+func (h Handler) tagPage(urlpath string) (name string, md []byte, ok bool) {
+	parts := strings.Split(strings.Trim(urlpath, "/"), "/")
+	if !strings.HasSuffix(urlpath, "/") || len(parts) > 2 {
+		return "", nil, false
+	}
+	key := parts[0]
+	var known bool
+	for _, t := range taxonomies {
+		known = known || t == key
+	}
+	if !known {
+		return "", nil, false
+	}
+	if _, err := fs.Stat(h.Root, key); err == nil {
+		return "", nil, false
+	}
+	terms, pages := h.taxonomy(key)
+	escape := strings.NewReplacer("[", `\[`, "]", `\]`, "*", `\*`, "_", `\_`).Replace
+	var b strings.Builder
+	if len(parts) == 1 {
+		slugs := make([]string, 0, len(terms))
+		for slug := range terms {
+			slugs = append(slugs, slug)
+		}
+		sort.Slice(slugs, func(i, j int) bool { return strings.ToLower(terms[slugs[i]]) < strings.ToLower(terms[slugs[j]]) })
+		fmt.Fprintf(&b, "# %s\n\n", segmentName(key))
+		for _, slug := range slugs {
+			fmt.Fprintf(&b, "* [%s](/%s/%s/) (%d)\n", escape(terms[slug]), key, slug, len(pages[slug]))
+		}
+		return key + "/index.md", []byte(b.String()), true
+	}
+	slug := parts[1]
+	if _, ok := terms[slug]; !ok {
+		return "", nil, false
+	}
+	fmt.Fprintf(&b, "# %s\n\n", escape(terms[slug]))
+	for _, p := range pages[slug] {
+		fmt.Fprintf(&b, "* [%s](%s)", escape(p.Title), p.URL)
+		if p.Date != "" {
+			fmt.Fprintf(&b, " %s", escape(p.Date))
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "\n[All %s](/%s/)\n", key, key)
+	return key + "/" + slug + "/index.md", []byte(b.String()), true
+}
+
+// serveTagPage renders a generated taxonomy page like a markdown file
+func (h Handler) serveTagPage(w http.ResponseWriter, r *http.Request, requestid, name string, src []byte) {
+	renderSlots <- struct{}{}
+	md := prefixLinks(h.pageLinks(name, markdown2html(src)), h.Prefix)
+	<-renderSlots
+	fm := frontMatter{}
+	var head [][]byte
+	if h.analytics != nil {
+		head = append(head, h.analytics)
+	}
+	h.writePage(w, requestid, name, pageData{
+		Title:       pageTitle(fm, src),
+		Description: pageSummary(fm, src),
+		Content:     template.HTML(md),
+		Path:        h.Prefix + r.URL.Path,
+		Page:        fm,
+		Site:        siteVars,
+		h:           h,
+		name:        name,
+	}, head)
+}
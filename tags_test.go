@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestTagPages(t *testing.T) {
+	defer func(on bool) { *tagPages = on }(*tagPages)
+	*tagPages = true
+	h := Handler{Prefix: "/blog", Root: fstest.MapFS{
+		"first.md":      {Data: []byte("---\ntitle: First\ndate: 2026-01-02\ntags: [Go, web]\n---\ntext\n")},
+		"posts/next.md": {Data: []byte("---\ndate: 2026-03-04\ntags:\n- go\n- go\ncategories: notes\n---\n# Next post\n")},
+		"untagged.md":   {Data: []byte("# Untagged\n")},
+		"_draft.md":     {Data: []byte("---\ntags: secret\n---\n# Draft\n")},
+	}}
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	for path, want := range map[string][]string{
+		"/tags/":       {"Tags</h1>", `href="/blog/tags/go/" rel="nofollow">Go</a> (2)`, `href="/blog/tags/web/" rel="nofollow">web</a> (1)`},
+		"/tags/go/":    {"Go</h1>", `href="/blog/posts/next.md" rel="nofollow">Next post</a> 2026-03-04</li>`, `href="/blog/first.md" rel="nofollow">First</a>`, `href="/blog/tags/" rel="nofollow">All tags</a>`},
+		"/categories/": {`href="/blog/categories/notes/" rel="nofollow">notes</a> (1)`},
+	} {
+		rec := get(path)
+		body := rec.Body.String()
+		for _, w := range want {
+			if rec.Code != 200 || !strings.Contains(body, w) {
+				t.Logf("%s: expected %q, got %d:\n%s", path, w, rec.Code, body)
+				t.Fail()
+			}
+		}
+		if strings.Contains(body, "secret") {
+			t.Logf("%s: lists a hidden page", path)
+			t.Fail()
+		}
+	}
+	if body := get("/tags/go/").Body.String(); strings.Index(body, "Next post") > strings.Index(body, "First") {
+		t.Log("Expected the newest page first")
+		t.Fail()
+	}
+	for _, path := range []string{"/tags/secret/", "/tags/go/x/", "/tags"} {
+		if rec := get(path); rec.Code != 404 {
+			t.Logf("%s: expected 404, got %d", path, rec.Code)
+			t.Fail()
+		}
+	}
+
+	// a real tags directory wins
+	h.Root.(fstest.MapFS)["tags/index.md"] = &fstest.MapFile{Data: []byte("# My tags\n")}
+	if body := get("/tags/").Body.String(); !strings.Contains(body, "My tags") {
+		t.Log("Expected tags/index.md, got:", body)
+		t.Fail()
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aerth/markdownd/pkg/markdownd"
+)
+
+// varList is the repeatable -var flag, 'name=value', and the variables
+// read from -vars. templates see them as {{.Site.name}}.
+type varList map[string]interface{}
+
+// siteVars are the site wide template variables
+var siteVars = varList{}
+
+func (v varList) String() string {
+	var s []string
+	for name, value := range v {
+		s = append(s, fmt.Sprintf("%s=%v", name, value))
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func (v varList) Set(value string) error {
+	i := strings.IndexByte(value, '=')
+	if i < 1 {
+		return fmt.Errorf("expected name=value, got %q", value)
+	}
+	v[value[:i]] = value[i+1:]
+	return nil
+}
+
+// readFile adds the variables of a json object file, such as
+// {"version": "2.1", "links": [{"name": "Source", "url": "https://..."}]}.
+// variables already set with -var are kept.
+func (v varList) readFile(filename string) error {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var vars map[string]interface{}
+	if err := json.Unmarshal(b, &vars); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	for name, value := range vars {
+		if _, ok := v[name]; !ok {
+			v[name] = value
+		}
+	}
+	return nil
+}
+
+// pageData is what page templates are executed with
+type pageData struct {
+	Title       string        // front matter title, or the first heading
+	Description string        // front matter description, or the first paragraph
+	Content     template.HTML // the rendered page
+	Path        string        // url path of the page
+	Page        frontMatter   // all of the front matter
+	Site        varList       // -vars and -var
+
+	h    Handler
+	name string // the markdown file in h.Root
+}
+
+// Nav is the navigation tree of the site, {{range .Nav}}, built when a
+// template uses it
+func (d pageData) Nav() []*navItem {
+	return d.h.nav(d.name)
+}
+
+// Backlinks are the pages linking to this one, each with a Title and URL,
+// built when a template uses them
+func (d pageData) Backlinks() []backlink {
+	return d.h.backlinks(d.name)
+}
+
+// Breadcrumbs is the trail of directories leading to the page, from Home
+// to the page itself, each with a Name and URL
+func (d pageData) Breadcrumbs() []crumb {
+	return d.h.crumbs(strings.TrimPrefix(d.Path, d.h.Prefix), d.Title)
+}
+
+// templateFuncs are the functions available to page templates. relURL
+// puts paths under the url prefix of the handler, component loads one of
+// the page components.
+func templateFuncs(prefix string) template.FuncMap {
+	return template.FuncMap{
+		"markdownify": func(s string) template.HTML {
+			return template.HTML(markdownd.Render([]byte(s), markdownd.RenderOptions{Plain: *plain, NoInlineHTML: *noInlineHTML}))
+		},
+		"component": func(name string) template.HTML {
+			return componentTag(prefix, name)
+		},
+		"now": time.Now,
+		"relURL": func(s string) string {
+			if strings.Contains(s, "://") || strings.HasPrefix(s, "//") || strings.HasPrefix(s, "#") || strings.HasPrefix(s, "mailto:") {
+				return s
+			}
+			u := path.Join(prefix, "/", s)
+			if strings.HasSuffix(s, "/") && u != "/" {
+				u += "/"
+			}
+			return u
+		},
+	}
+}
+
+// loadTemplate parses a page template file
+func loadTemplate(filename string) (*template.Template, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if reExtends.Match(b) {
+		return nil, fmt.Errorf("%s: -template is what layouts extend, it can't {{extends}}", filename)
+	}
+	return template.New(path.Base(filename)).Funcs(templateFuncs("")).Parse(string(b))
+}
+
+// layoutName is the page template for the markdown files of a directory
+// and the directories below it, used instead of -template
+const layoutName = "_layout.html"
+
+// reExtends is the '{{extends}}' starting a layout built on the layout
+// above it, or on -template: its {{define "name"}} blocks replace the
+// {{block "name" .}} blocks of that layout, and the rest of that layout
+// is kept
+var reExtends = regexp.MustCompile(`^\s*\{\{-?\s*extends\s*-?\}\}`)
+
+// reLayoutVariant is a layout picked with 'layout: wide' in front matter
+var reLayoutVariant = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// isLayout reports whether the file name is a layout, _layout.html or a
+// variant such as _layout.wide.html
+func isLayout(name string) bool {
+	base := path.Base(name)
+	return base == layoutName || strings.HasPrefix(base, "_layout.") && strings.HasSuffix(base, ".html")
+}
+
+// parsed layouts of directories on disk, by file name
+var (
+	layoutsMu sync.Mutex
+	layouts   = map[string]cachedLayout{}
+)
+
+type cachedLayout struct {
+	modified time.Time
+	size     int64
+	parent   *template.Template // the layout extended, if any
+	template *template.Template
+}
+
+// layout returns the page template for the markdown file name: the nearest
+// _layout.html in its directory or above it, or -template, or nil for none.
+// a page with 'layout: wide' gets the nearest _layout.wide.html instead.
+func (h Handler) layout(name, variant string) (*template.Template, error) {
+	if variant != "" {
+		file := "_layout." + variant + ".html"
+		if !reLayoutVariant.MatchString(variant) {
+			return nil, fmt.Errorf("layout: %q, expected a name such as wide for %s", variant, "_layout.wide.html")
+		}
+		if found, fi := h.findLayout(path.Dir(name), file); found != "" {
+			return h.parseLayout(found, fi)
+		}
+		return nil, fmt.Errorf("layout: %s, but there is no %s in its directory or above it", variant, file)
+	}
+	if found, fi := h.findLayout(path.Dir(name), layoutName); found != "" {
+		return h.parseLayout(found, fi)
+	}
+	return h.template, nil
+}
+
+// findLayout returns the nearest layout file named base in dir or above
+// it, or ""
+func (h Handler) findLayout(dir, base string) (string, fs.FileInfo) {
+	for ; ; dir = path.Dir(dir) {
+		file := path.Join(dir, base)
+		if fi, err := fs.Stat(h.Root, file); err == nil && !fi.IsDir() {
+			return file, fi
+		}
+		if dir == "." {
+			return "", nil
+		}
+	}
+}
+
+// parentLayout returns the layout that the layout file extends: for a
+// _layout.html the one above its directory, for a variant the _layout.html
+// of its directory or above, or -template
+func (h Handler) parentLayout(file string) (*template.Template, error) {
+	dir := path.Dir(file)
+	if path.Base(file) == layoutName {
+		if dir == "." {
+			return h.template, nil
+		}
+		dir = path.Dir(dir)
+	}
+	if found, fi := h.findLayout(dir, layoutName); found != "" {
+		return h.parseLayout(found, fi)
+	}
+	return h.template, nil
+}
+
+// parseLayout parses a layout, once for each version of files on disk and
+// of the layout it extends
+func (h Handler) parseLayout(file string, fi fs.FileInfo) (*template.Template, error) {
+	var key string
+	if h.RootString != "" {
+		key = filepath.Join(h.RootString, filepath.FromSlash(file))
+		if !fileisgood(key) {
+			return nil, fmt.Errorf("%s: is a symlink", file)
+		}
+		layoutsMu.Lock()
+		c, ok := layouts[key]
+		layoutsMu.Unlock()
+		if ok && c.modified.Equal(fi.ModTime()) && c.size == fi.Size() {
+			if c.parent == nil {
+				return c.template, nil
+			}
+			if parent, err := h.parentLayout(file); err == nil && parent == c.parent {
+				return c.template, nil
+			}
+		}
+	}
+	b, err := fs.ReadFile(h.Root, file)
+	if err != nil {
+		return nil, err
+	}
+	var t, parent *template.Template
+	if loc := reExtends.FindIndex(b); loc != nil {
+		if parent, err = h.parentLayout(file); err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, fmt.Errorf("%s: extends, but there is no layout above it nor -template", file)
+		}
+		// the blocks of the layout replace those of a copy of its parent
+		if t, err = parent.Clone(); err == nil {
+			_, err = t.New(file).Parse(string(b[loc[1]:]))
+		}
+	} else {
+		t, err = template.New(file).Funcs(templateFuncs("")).Parse(string(b))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		layoutsMu.Lock()
+		layouts[key] = cachedLayout{fi.ModTime(), fi.Size(), parent, t}
+		layoutsMu.Unlock()
+	}
+	return t, nil
+}
+
+// renderPage executes the page template t with data into buf
+func (h Handler) renderPage(buf *bytes.Buffer, t *template.Template, data pageData) error {
+	t, err := t.Clone()
+	if err != nil {
+		return err
+	}
+	return t.Funcs(templateFuncs(h.Prefix)).Execute(buf, data)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPageTemplate(t *testing.T) {
+	page := `<html><head><title>{{.Title}} - {{.Site.name}}</title></head>
+<body><nav>{{range .Site.links}}<a href="{{.url}}">{{.name}}</a>{{end}}</nav>
+<link href="{{relURL "css/site.css"}}"><a href="{{relURL "https://example.com/"}}">x</a>
+<p>{{.Page.author}} {{.Path}} {{now.Year}}</p>
+{{markdownify .Site.tagline}}
+<main>{{.Content}}</main></body></html>`
+	tmpl, err := template.New("page").Funcs(templateFuncs("")).Parse(page)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	vars := filepath.Join(dir, "vars.json")
+	ioutil.WriteFile(vars, []byte(`{"name": "from file", "tagline": "*docs* <script>x</script>",
+		"links": [{"name": "Source", "url": "https://example.com/src"}]}`), 0644)
+
+	defer func(v varList) { siteVars = v }(siteVars)
+	siteVars = varList{}
+	siteVars.Set("name=Docs")
+	if err := siteVars.readFile(vars); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+
+	h := Handler{
+		Root:     fstest.MapFS{"guide.md": {Data: []byte("---\ntitle: Guide\nauthor: Ada\n---\n# Heading\n")}},
+		template: tmpl,
+		Prefix:   "/docs",
+	}
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/guide.md", nil)
+	h.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	for _, want := range []string{
+		"<title>Guide - Docs</title>", // -var wins over the file
+		`<a href="https://example.com/src">Source</a>`,
+		`<link href="/docs/css/site.css"><a href="https://example.com/">`,
+		"<p>Ada /docs/guide.md 20",
+		"<em>docs</em>",
+		"<main><h1",
+	} {
+		if !strings.Contains(body, want) {
+			t.Logf("Expected %q in:\n%s", want, body)
+			t.Fail()
+		}
+	}
+	if strings.Contains(body, "<script>") {
+		t.Log("Expected markdownify to sanitize:\n" + body)
+		t.Fail()
+	}
+}
+
+func TestPageTemplateError(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(`{{.Missing.field}}`))
+	h := Handler{Root: fstest.MapFS{"a.md": {Data: []byte("# a\n")}}, template: tmpl}
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/a.md", nil)
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Log("Expected 500 for a failing template, got", rec.Code)
+		t.Fail()
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	h := Handler{Root: fstest.MapFS{
+		"_layout.html":             {Data: []byte("root: {{.Title}}")},
+		"index.md":                 {Data: []byte("# Home\n")},
+		"guide/_layout.html":       {Data: []byte("guide: {{.Title}}")},
+		"guide/deep/page.md":       {Data: []byte("# Deep\n")},
+		"api/index.md":             {Data: []byte("# API\n")},
+		"broken/_layout.html":      {Data: []byte("{{.Title")},
+		"broken/page.md":           {Data: []byte("# Broken\n")},
+		"plain/_layout.html/x.txt": {Data: []byte("a directory, not a layout")},
+		"plain/page.md":            {Data: []byte("# Plain\n")},
+	}}
+	for _, tc := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/", 200, "root: Home"},
+		{"/guide/deep/page.md", 200, "guide: Deep"},
+		{"/api/", 200, "root: API"},
+		{"/plain/page.md", 200, "root: Plain"},
+		{"/broken/page.md", 500, ""},
+		{"/_layout.html", 404, ""},
+		{"/guide/_layout.html", 404, ""},
+	} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.body) {
+			t.Logf("%s: expected %d %q, got %d %q", tc.path, tc.status, tc.body, rec.Code, rec.Body.String())
+			t.Fail()
+		}
+	}
+}
+
+func TestLayoutInheritance(t *testing.T) {
+	base, err := template.New("base").Parse(`<header>{{block "header" .}}Docs{{end}}</header>{{block "main" .}}{{.Content}}{{end}}<footer>{{block "footer" .}}(c){{end}}</footer>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Handler{template: base, Root: fstest.MapFS{
+		"index.md":                 {Data: []byte("# Home\n")},
+		"api/_layout.html":         {Data: []byte(`{{extends}}{{define "header"}}API{{end}}`)},
+		"api/v2/_layout.html":      {Data: []byte("{{ extends }}\n{{define \"footer\"}}v2 {{.Title}}{{end}}\n")},
+		"api/v2/intro.md":          {Data: []byte("# Intro\n")},
+		"api/v2/_layout.wide.html": {Data: []byte(`{{extends}}{{define "main"}}<div class="wide">{{.Content}}</div>{{end}}`)},
+		"api/v2/wide.md":           {Data: []byte("---\nlayout: wide\n---\n# Wide\n")},
+		"api/missing.md":           {Data: []byte("---\nlayout: print\n---\n# Print\n")},
+	}}
+	for _, tc := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/", 200, "<header>Docs</header>"},
+		{"/api/v2/intro.md", 200, "<header>API</header>"},
+		{"/api/v2/intro.md", 200, "<footer>v2 Intro</footer>"},
+		{"/api/v2/wide.md", 200, `<header>API</header><div class="wide">`},
+		{"/api/v2/wide.md", 200, "<footer>v2 Wide</footer>"},
+		{"/api/missing.md", 500, ""},
+		{"/api/v2/_layout.wide.html", 404, ""},
+	} {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.body) {
+			t.Logf("%s: expected %d %q, got %d %q", tc.path, tc.status, tc.body, rec.Code, rec.Body.String())
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// humanBytes formats a byte count, such as 12.3 MB
+func humanBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// fetchStatus reads /_markdownd/status from a running markdownd
+func fetchStatus(base, token string, slowest int) (*serverStatus, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/_markdownd/status?slowest=%d", strings.TrimSuffix(base, "/"), slowest), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := outboundClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s: no status endpoint, is markdownd running with -metrics?", req.URL)
+	default:
+		return nil, fmt.Errorf("%s: %s", req.URL, resp.Status)
+	}
+	var s serverStatus
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return nil, fmt.Errorf("%s: %v", req.URL, err)
+	}
+	return &s, nil
+}
+
+// topScreen draws one screen of 'markdownd top'. rates are since prev,
+// or since the server started when prev is nil.
+func topScreen(base string, prev, cur *serverStatus) string {
+	var since serverStatus
+	elapsed := cur.Uptime
+	if prev != nil && cur.Uptime < prev.Uptime {
+		prev = nil // restarted, counters are new
+	}
+	if prev != nil {
+		since = *prev
+		elapsed = cur.Time.Sub(prev.Time).Seconds()
+	}
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+	requests := float64(cur.Requests - since.Requests)
+	if prev != nil && requests > 0 {
+		requests-- // the previous poll, counted once it finished
+	}
+	var errors float64
+	for code, n := range cur.ByStatus {
+		if c, _ := strconv.Atoi(code); c >= 400 {
+			errors += float64(n - since.ByStatus[code])
+		}
+	}
+
+	var b strings.Builder
+	line := func(format string, v ...interface{}) {
+		fmt.Fprintf(&b, format+"\n", v...)
+	}
+	line("markdownd top - %s - up %s - %s", base, (time.Duration(cur.Uptime) * time.Second).String(), cur.Time.Local().Format("15:04:05"))
+	line("")
+	line("requests  %8.1f/s   errors %.1f/s   in flight %d   sent %s/s",
+		requests/elapsed, errors/elapsed, cur.InFlight, humanBytes(float64(cur.Bytes-since.Bytes)/elapsed))
+	line("totals    %8d     pageviews %d   render avg %.2fms", cur.Requests, cur.Pageviews, cur.RenderAvg)
+	if c := cur.Cache; c != nil && c.Hits+c.Misses != 0 {
+		line("cache     %7.1f%% hits (%d hits, %d misses)", float64(c.Hits)*100/float64(c.Hits+c.Misses), c.Hits, c.Misses)
+	} else {
+		line("cache          n/a")
+	}
+	limit := ""
+	if cur.Memory.Limit > 0 {
+		limit = "   limit " + humanBytes(float64(cur.Memory.Limit))
+	}
+	line("memory    heap %s   in use %s   sys %s%s   gc %d   goroutines %d",
+		humanBytes(float64(cur.Memory.HeapAlloc)), humanBytes(float64(cur.Memory.HeapInuse)),
+		humanBytes(float64(cur.Memory.Sys)), limit, cur.Memory.NumGC, cur.Goroutines)
+
+	line("")
+	line("%-50s %8s %10s %10s", "SLOWEST PAGES", "COUNT", "AVG", "MAX")
+	for _, p := range cur.Slowest {
+		line("%-50s %8d %8.1fms %8.1fms", truncate(p.Path, 50), p.Count, p.Avg, p.Max)
+	}
+	if len(cur.Slowest) == 0 {
+		line("(none yet)")
+	}
+
+	line("")
+	line("RECENT ERRORS")
+	for _, e := range cur.Errors {
+		line("%s  %d  %-6s %s  %s", e.Time.Local().Format("15:04:05"), e.Status, e.Method, truncate(e.Path, 60), e.ID)
+	}
+	if len(cur.Errors) == 0 {
+		line("(none)")
+	}
+	return b.String()
+}
+
+// topCommand shows live status of a running markdownd
+func topCommand(args []string) {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	interval := fs.Duration("interval", 2*time.Second, "time between updates")
+	slowest := fs.Int("n", 10, "slowest pages to show")
+	token := fs.String("token", "", "bearer token, if markdownd runs with -token (default from $MARKDOWND_TOKEN)")
+	once := fs.Bool("once", false, "print the status once and exit, without clearing the screen")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: markdownd top [flags] [url]")
+		fmt.Fprintln(os.Stderr, "shows requests, slowest pages, errors and memory of a markdownd running with -metrics")
+		fmt.Fprintln(os.Stderr, "(default url: http://127.0.0.1:8080)")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 || *interval <= 0 {
+		fs.Usage()
+		os.Exit(111)
+	}
+	base := "http://127.0.0.1:8080"
+	if fs.NArg() == 1 {
+		base = fs.Arg(0)
+		if !strings.Contains(base, "://") {
+			base = "http://" + base
+		}
+	}
+	if *token == "" {
+		*token = os.Getenv("MARKDOWND_TOKEN")
+	}
+
+	var prev *serverStatus
+	for {
+		cur, err := fetchStatus(base, *token, *slowest)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(111)
+		}
+		if *once {
+			fmt.Print(topScreen(base, nil, cur))
+			return
+		}
+		// clear the screen and draw from the top left
+		fmt.Print("\x1b[H\x1b[2J" + topScreen(base, prev, cur))
+		prev = cur
+		time.Sleep(*interval)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHumanBytes(t *testing.T) {
+	for n, want := range map[float64]string{
+		0:          "0 B",
+		1023:       "1023 B",
+		1536:       "1.5 KB",
+		12.3 * 1e6: "11.7 MB",
+		3 << 30:    "3.0 GB",
+		5000 << 40: "5000.0 TB",
+	} {
+		if got := humanBytes(n); got != want {
+			t.Logf("humanBytes(%v): expected %q, got %q", n, want, got)
+			t.Fail()
+		}
+	}
+}
+
+func TestTopScreen(t *testing.T) {
+	now := time.Now()
+	prev := &serverStatus{Time: now.Add(-2 * time.Second), Uptime: 60, Requests: 100, ByStatus: map[string]uint64{"200": 90, "404": 10}}
+	cur := &serverStatus{
+		Time: now, Uptime: 62, Requests: 121, Bytes: 4096,
+		ByStatus: map[string]uint64{"200": 106, "404": 14, "500": 1},
+		Slowest:  []slowPage{{Path: "/guide/big.md", Count: 3, Avg: 30.5, Max: 80}},
+		Errors:   []recentError{{Time: now, ID: "abc", Method: "GET", Path: "/missing.md", Status: 404}},
+		Cache:    &cacheStatus{Hits: 3, Misses: 1},
+		Memory:   memoryStatus{HeapAlloc: 2 << 20, Limit: 512 << 20},
+	}
+	screen := topScreen("http://127.0.0.1:8080", prev, cur)
+	for _, want := range []string{
+		"up 1m2s",
+		"requests      10.0/s", // 21 less the previous poll, over 2 seconds
+		"errors 2.5/s",
+		"sent 2.0 KB/s",
+		"75.0% hits",
+		"heap 2.0 MB",
+		"limit 512.0 MB",
+		"/guide/big.md",
+		"    30.5ms",
+		"404  GET    /missing.md  abc",
+	} {
+		if !strings.Contains(screen, want) {
+			t.Logf("Expected %q in:\n%s", want, screen)
+			t.Fail()
+		}
+	}
+
+	// a restarted server shows rates since it started
+	cur.Uptime = 1
+	if screen = topScreen("", prev, cur); !strings.Contains(screen, "requests     121.0/s") {
+		t.Log("Expected rates since start after a restart, got:\n" + screen)
+		t.Fail()
+	}
+}
+
+func TestFetchStatus(t *testing.T) {
+	defer func(v string) { *token = v }(*token)
+	defer func(v bool) { *metricsEnabled = v }(*metricsEnabled)
+	*token, *metricsEnabled = "sekrit", true
+	h := &Handler{Root: os.DirFS(prepareDirectory("docs")), RootString: prepareDirectory("docs")}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	if _, err := fetchStatus(ts.URL, "wrong", 5); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Log("Expected 401 with the wrong token, got:", err)
+		t.Fail()
+	}
+	s, err := fetchStatus(ts.URL, "sekrit", 5)
+	if err != nil || s.Uptime <= 0 || s.Goroutines == 0 {
+		t.Logf("Expected status, got: %+v %v", s, err)
+		t.Fail()
+	}
+
+	*metricsEnabled = false
+	if _, err := fetchStatus(ts.URL, "sekrit", 5); err == nil || !strings.Contains(err.Error(), "-metrics") {
+		t.Log("Expected a hint about -metrics, got:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// version, commit and buildDate describe the build, set by 'make' or with
+// go build -ldflags "-X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+	version   = "0.0.12"
+	commit    = ""
+	buildDate = ""
+)
+
+// rendererName is the markdown renderer in use
+func rendererName() string {
+	if *rendererCmd != "" {
+		return "command: " + *rendererCmd
+	}
+	return "built-in (github flavored markdown, blackfriday)"
+}
+
+// printVersion writes what -version prints
+func printVersion(w io.Writer) {
+	unknown := func(s string) string {
+		if s == "" {
+			return "unknown"
+		}
+		return s
+	}
+	fmt.Fprintf(w, "markdownd %s\n", version)
+	fmt.Fprintf(w, "commit:   %s\n", unknown(commit))
+	fmt.Fprintf(w, "built:    %s\n", unknown(buildDate))
+	fmt.Fprintf(w, "renderer: %s\n", rendererName())
+	fmt.Fprintf(w, "go:       %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	defer func(c string) { commit = c }(commit)
+	commit = "abc1234"
+	var b bytes.Buffer
+	printVersion(&b)
+	for _, s := range []string{"markdownd " + version + "\n", "commit:   abc1234\n", "built:    unknown\n", "renderer: built-in"} {
+		if !strings.Contains(b.String(), s) {
+			t.Logf("expected %q in:\n%s", s, b.String())
+			t.Fail()
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	resp := sendRequest(req)
+	if resp.Header.Get("X-Markdownd-Version") != version || resp.Header.Get("Server") != serverheader {
+		t.Log("expected version headers, got:", resp.Header)
+		t.Fail()
+	}
+	defer func(v bool) { *versionHeader = v }(*versionHeader)
+	*versionHeader = false
+	resp = sendRequest(req)
+	if _, ok := resp.Header["X-Markdownd-Version"]; ok || resp.Header.Get("Server") != "markdownd" {
+		t.Log("expected no version headers, got:", resp.Header)
+		t.Fail()
+	}
+}
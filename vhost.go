@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// vhost serves a directory for one host name
+type vhost struct {
+	Host     string
+	Dir      string
+	Index    string // overrides -index
+	Header   string // overrides -header
+	Footer   string // overrides -footer
+	Template string // overrides -template
+
+	Canonical string        // overrides -canonical
+	Rewrites  []linkRewrite // before -rewrite-link
+
+	Analytics    string // overrides -analytics, "none" for no snippet
+	AnalyticsID  string // overrides -analytics-id
+	AnalyticsURL string // overrides -analytics-url
+}
+
+// parseVhost parses 'host=directory[,index=file][,header=file][,footer=file][,template=file]',
+// with ',canonical=url' and ',rewrite=from=to' for mirrors, and
+// ',analytics=provider', ',analytics-id=id' and ',analytics-url=url'
+func parseVhost(s string) (vhost, error) {
+	parts := strings.Split(s, ",")
+	i := strings.IndexByte(parts[0], '=')
+	if i <= 0 || i == len(parts[0])-1 {
+		return vhost{}, fmt.Errorf("expected host=directory, got %q", s)
+	}
+	v := vhost{Host: strings.ToLower(strings.TrimSpace(parts[0][:i])), Dir: strings.TrimSpace(parts[0][i+1:])}
+	for _, opt := range parts[1:] {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return vhost{}, fmt.Errorf("expected key=value, got %q in %q", opt, s)
+		}
+		switch val := strings.TrimSpace(kv[1]); strings.TrimSpace(kv[0]) {
+		case "index":
+			v.Index = val
+		case "header":
+			v.Header = val
+		case "footer":
+			v.Footer = val
+		case "template":
+			v.Template = val
+		case "canonical":
+			u, err := parseCanonical(val)
+			if err != nil {
+				return vhost{}, fmt.Errorf("canonical: %v in %q", err, s)
+			}
+			v.Canonical = u
+		case "rewrite":
+			rw, err := parseLinkRewrite(val)
+			if err != nil {
+				return vhost{}, fmt.Errorf("rewrite: %v", err)
+			}
+			v.Rewrites = append(v.Rewrites, rw)
+		case "analytics":
+			if _, ok := analyticsTemplates[val]; !ok && val != "none" {
+				return vhost{}, fmt.Errorf("analytics: unknown provider %q in %q, expected plausible, matomo, ga or none", val, s)
+			}
+			v.Analytics = val
+		case "analytics-id":
+			v.AnalyticsID = val
+		case "analytics-url":
+			v.AnalyticsURL = val
+		default:
+			return vhost{}, fmt.Errorf("unknown vhost option %q in %q", kv[0], s)
+		}
+	}
+	return v, nil
+}
+
+// vhostList is the repeatable -vhost flag
+type vhostList []vhost
+
+func (l *vhostList) String() string {
+	if l == nil {
+		return ""
+	}
+	var s []string
+	for _, v := range *l {
+		s = append(s, v.Host+"="+v.Dir)
+	}
+	return strings.Join(s, " ")
+}
+
+func (l *vhostList) Set(value string) error {
+	v, err := parseVhost(value)
+	if err != nil {
+		return err
+	}
+	for _, old := range *l {
+		if old.Host == v.Host {
+			return fmt.Errorf("%s is configured twice", v.Host)
+		}
+	}
+	*l = append(*l, v)
+	return nil
+}
+
+// readFile adds the hosts in filename, one per line, '#' for comments
+func (l *vhostList) readFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := l.Set(line); err != nil {
+			return fmt.Errorf("%s:%d: %v", filename, n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// handler returns a copy of root serving the vhost
+func (v vhost) handler(root Handler) (Handler, error) {
+	dir := prepareDirectory(v.Dir)
+	h := root
+	h.Root, h.RootString, h.Index = os.DirFS(dir), dir, v.Index
+	if v.Canonical != "" {
+		h.canonical = v.Canonical
+	}
+	h.rewrites = append(append([]linkRewrite(nil), v.Rewrites...), root.rewrites...)
+	if v.Header != "" {
+		b, err := ioutil.ReadFile(v.Header)
+		if err != nil {
+			return Handler{}, err
+		}
+		h.header = b
+	}
+	if v.Footer != "" {
+		b, err := ioutil.ReadFile(v.Footer)
+		if err != nil {
+			return Handler{}, err
+		}
+		h.footer = b
+	}
+	if v.Template != "" {
+		t, err := loadTemplate(v.Template)
+		if err != nil {
+			return Handler{}, err
+		}
+		h.template = t
+	}
+	if v.Analytics == "none" {
+		h.analytics = nil
+	} else if v.Analytics != "" || v.AnalyticsID != "" || v.AnalyticsURL != "" {
+		b, err := v.analyticsSnippet()
+		if err != nil {
+			return Handler{}, err
+		}
+		h.analytics = b
+	}
+	return h, nil
+}
+
+// analyticsSnippet returns the analytics snippet of the vhost: its
+// provider, id and url, or those of -analytics for the ones not given
+func (v vhost) analyticsSnippet() ([]byte, error) {
+	provider, id, url := v.Analytics, v.AnalyticsID, v.AnalyticsURL
+	if provider == "" || provider == *analytics {
+		provider = *analytics
+		if id == "" {
+			id = *analyticsID
+		}
+		if url == "" {
+			url = *analyticsURL
+		}
+	}
+	if provider == "" {
+		return nil, fmt.Errorf("analytics-id and analytics-url need analytics=provider, or -analytics")
+	}
+	return analyticsSnippet(provider, id, url, *consent)
+}
+
+// vhostMux picks a handler by the Host header
+type vhostMux struct {
+	hosts    map[string]http.Handler
+	fallback http.Handler // unknown hosts
+}
+
+// newVhostMux serves each of hosts with a copy of root. unknown hosts go to
+// fallback, or without one get site wide endpoints only.
+func newVhostMux(root *Handler, hosts vhostList, fallback http.Handler) (vhostMux, error) {
+	m := vhostMux{hosts: make(map[string]http.Handler), fallback: fallback}
+	var first http.Handler
+	for _, v := range hosts {
+		h, err := v.handler(*root)
+		if err != nil {
+			return vhostMux{}, fmt.Errorf("vhost %s: %v", v.Host, err)
+		}
+		if err := checkRoot(h.RootString); err != nil {
+			println("warning:", err.Error())
+		}
+		m.hosts[v.Host] = h
+		if h.Prefix != "" {
+			mux := http.NewServeMux()
+			mount(mux, &h, nil)
+			m.hosts[v.Host] = mux
+		}
+		status("vhost:", v.Host, "->", h.RootString)
+		if first == nil {
+			first = h
+		}
+	}
+	if m.fallback == nil {
+		m.fallback = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if siteWide(r.URL.Path) && first != nil {
+				first.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, "421 misdirected request", http.StatusMisdirectedRequest)
+		})
+	}
+	return m, nil
+}
+
+func (m vhostMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if h, ok := m.hosts[strings.TrimSuffix(host, ".")]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+	m.fallback.ServeHTTP(w, r)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseVhost(t *testing.T) {
+	v, err := parseVhost("Docs.Example.com=./docs,index=text.txt,footer=foot.html")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if v.Host != "docs.example.com" || v.Dir != "./docs" || v.Index != "text.txt" || v.Footer != "foot.html" {
+		t.Logf("Unexpected vhost: %+v", v)
+		t.Fail()
+	}
+	for _, bad := range []string{"docs", "=docs", "docs.example.com=", "a=b,index", "a=b,color=red"} {
+		if _, err := parseVhost(bad); err == nil {
+			t.Log("Expected an error for", bad)
+			t.Fail()
+		}
+	}
+}
+
+func TestVhostFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "vhosts")
+	ioutil.WriteFile(filename, []byte("# hosts\ndocs.example.com=docs\n\nwiki.example.com=wiki,index=home.md\n"), 0644)
+
+	var l vhostList
+	if err := l.readFile(filename); err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	if len(l) != 2 || l[1].Host != "wiki.example.com" || l[1].Index != "home.md" {
+		t.Logf("Unexpected vhosts: %+v", l)
+		t.Fail()
+	}
+	if err := l.Set("docs.example.com=elsewhere"); err == nil {
+		t.Log("Expected an error for a duplicate host")
+		t.Fail()
+	}
+}
+
+func TestVhostMux(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "home.md"), []byte("# the wiki\n"), 0644)
+	footer := filepath.Join(dir, "footer.html")
+	ioutil.WriteFile(footer, []byte("<footer>wiki footer</footer>"), 0644)
+
+	m, err := newVhostMux(&Handler{}, vhostList{
+		{Host: "docs.example.com", Dir: "docs"},
+		{Host: "wiki.example.com", Dir: dir, Index: "home.md", Footer: footer},
+	}, nil)
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	get := func(host, path string) (int, string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://"+host+path, nil)
+		m.ServeHTTP(w, req)
+		body, _ := ioutil.ReadAll(w.Body)
+		return w.Code, string(body)
+	}
+
+	if code, body := get("docs.example.com:8080", "/"); code != 200 || !strings.Contains(body, "welcome to markdownd") {
+		t.Log("Expected the docs index, got:", code, body)
+		t.Fail()
+	}
+	if code, body := get("WIKI.example.com.", "/"); code != 200 || !strings.Contains(body, "the wiki") ||
+		!strings.Contains(body, "wiki footer") {
+		t.Log("Expected the wiki index and footer, got:", code, body)
+		t.Fail()
+	}
+	if code, _ := get("wiki.example.com", "/index.md"); code != 404 {
+		t.Log("Expected 404 for a docs page on the wiki, got:", code)
+		t.Fail()
+	}
+	if code, _ := get("other.example.com", "/index.md"); code != http.StatusMisdirectedRequest {
+		t.Log("Expected 421 for an unknown host, got:", code)
+		t.Fail()
+	}
+	if code, _ := get("127.0.0.1", "/healthz"); code != 200 {
+		t.Log("Expected /healthz for an unknown host, got:", code)
+		t.Fail()
+	}
+}
+
+func TestVhostAnalytics(t *testing.T) {
+	defer func(p, id string) { *analytics, *analyticsID = p, id }(*analytics, *analyticsID)
+	*analytics, *analyticsID = "plausible", "example.com"
+	root := Handler{analytics: []byte("<script>global</script>")}
+	for _, c := range []struct {
+		spec, want string
+	}{
+		{"docs.example.com=docs", "global"},
+		{"docs.example.com=docs,analytics=none", ""},
+		{"docs.example.com=docs,analytics-id=docs.example.com", `data-domain="docs.example.com"`},
+		{"docs.example.com=docs,analytics=matomo,analytics-id=3,analytics-url=https://stats.example.com/", "stats.example.com"},
+	} {
+		v, err := parseVhost(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := v.handler(root)
+		if err != nil || c.want == "" && h.analytics != nil || !strings.Contains(string(h.analytics), c.want) {
+			t.Logf("%s: expected a snippet with %q, got %q %v", c.spec, c.want, h.analytics, err)
+			t.Fail()
+		}
+	}
+	if _, err := parseVhost("docs.example.com=docs,analytics=omniture"); err == nil {
+		t.Log("Expected an error for an unknown provider")
+		t.Fail()
+	}
+	v, _ := parseVhost("docs.example.com=docs,analytics=matomo")
+	if _, err := v.handler(root); err == nil {
+		t.Log("Expected an error for matomo without an id")
+		t.Fail()
+	}
+}
+
+func TestVhostTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "index.md"), []byte("# the wiki\n"), 0644)
+	tmpl := filepath.Join(dir, "wiki.html")
+	ioutil.WriteFile(tmpl, []byte("<main class=\"wiki\">{{.Content}}</main>"), 0644)
+	v, err := parseVhost("wiki.example.com=" + dir + ",template=" + tmpl)
+	if err != nil || v.Template != tmpl {
+		t.Fatal("Unexpected vhost:", v, err)
+	}
+	m, err := newVhostMux(&Handler{}, vhostList{v, {Host: "docs.example.com", Dir: dir}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, want := range map[string]bool{"wiki.example.com": true, "docs.example.com": false} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://"+host+"/", nil)
+		m.ServeHTTP(w, req)
+		if body := w.Body.String(); !strings.Contains(body, "the wiki") || strings.Contains(body, `<main class="wiki">`) != want {
+			t.Logf("%s: expected the vhost template %v, got: %s", host, want, body)
+			t.Fail()
+		}
+	}
+	v.Template = filepath.Join(dir, "missing.html")
+	if _, err := v.handler(Handler{}); err == nil {
+		t.Log("Expected an error for a missing template")
+		t.Fail()
+	}
+}
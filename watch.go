@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// long polls end before the server write timeout, clients poll again
+const (
+	maxWatchWait  = 4 * time.Second
+	watchInterval = 250 * time.Millisecond
+)
+
+// watchHidden reports whether the file abs below root is kept out of
+// sight, see hideDraft
+func watchHidden(root, abs string, fi os.FileInfo) bool {
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return true
+	}
+	name := filepath.ToSlash(rel)
+	if fi.IsDir() {
+		return name != "." && hideDraft(name+"/", nil)
+	}
+	var fm frontMatter
+	if strings.HasSuffix(name, ".md") {
+		if b, err := ioutil.ReadFile(abs); err == nil {
+			fm, _ = parseFrontMatter(b)
+		}
+	}
+	return hideDraft(name, fm)
+}
+
+// watchVersion returns a version string that changes whenever the file
+// abs below root, or any file below the directory, is added, removed or
+// modified. drafts and embargoed pages are not found, nor counted in the
+// version of their directory.
+func watchVersion(root, abs string) (string, bool) {
+	fi, err := os.Lstat(abs)
+	if err != nil || fi.Mode()&os.ModeSymlink != 0 || watchHidden(root, abs, fi) {
+		return "", false
+	}
+	h := fnv.New64a()
+	add := func(path string, fi os.FileInfo) {
+		h.Write([]byte(path))
+		h.Write([]byte(strconv.FormatInt(fi.Size(), 10)))
+		h.Write([]byte(strconv.FormatInt(fi.ModTime().UnixNano(), 10)))
+	}
+	if !fi.IsDir() {
+		add(abs, fi)
+		return strconv.FormatUint(h.Sum64(), 16), true
+	}
+	filepath.Walk(abs, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || path == abs {
+			return nil
+		}
+		if strings.HasPrefix(fi.Name(), ".") || watchHidden(root, path, fi) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// not directories, whose times change with hidden files too
+		if fi.Mode()&(os.ModeSymlink|os.ModeDir) == 0 {
+			add(path, fi)
+		}
+		return nil
+	})
+	return strconv.FormatUint(h.Sum64(), 16), true
+}
+
+// serveWatch answers /_markdownd/api/watch?path=/dir/&since=version, waiting
+// up to 'wait' seconds for the version to change. without 'since' the
+// current version is returned immediately.
+func (h Handler) serveWatch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p := q.Get("path")
+	abs, ok := h.localPath(p)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	version, ok := watchVersion(h.RootString, abs)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	wait := maxWatchWait
+	if s, err := strconv.ParseFloat(q.Get("wait"), 64); err == nil && s >= 0 && s < wait.Seconds() {
+		wait = time.Duration(s * float64(time.Second))
+	}
+	since := q.Get("since")
+	if since != "" && since == version {
+		timeout := time.NewTimer(wait)
+		defer timeout.Stop()
+		tick := time.NewTicker(watchInterval)
+		defer tick.Stop()
+	poll:
+		for version == since {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-timeout.C:
+				break poll
+			case <-tick.C:
+				if version, ok = watchVersion(h.RootString, abs); !ok {
+					// removed
+					version = ""
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":    "/" + strings.TrimPrefix(p, "/"),
+		"version": version,
+		"changed": since != "" && version != since,
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "markdownd")
+	if err != nil {
+		t.Log(err)
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "guide"), 0755)
+	page := filepath.Join(dir, "guide", "page.md")
+	ioutil.WriteFile(page, []byte("# one\n"), 0644)
+
+	*watch = true
+	defer func() { *watch = false }()
+	h := Handler{RootString: prepareDirectory(dir)}
+	poll := func(query string) (v struct {
+		Version string `json:"version"`
+		Changed bool   `json:"changed"`
+	}, code int) {
+		req, _ := http.NewRequest("GET", "/_markdownd/api/watch?"+query, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		json.Unmarshal(w.Body.Bytes(), &v)
+		return v, w.Code
+	}
+
+	first, code := poll("path=/guide/")
+	if code != 200 || first.Version == "" || first.Changed {
+		t.Log("Expected a version, got:", code, first)
+		t.FailNow()
+	}
+
+	// nothing changes
+	v, _ := poll("path=/guide/&wait=0.3&since=" + first.Version)
+	if v.Changed || v.Version != first.Version {
+		t.Log("Expected no change, got:", v)
+		t.Fail()
+	}
+
+	// a file changes while polling
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ioutil.WriteFile(page, []byte("# two\n"), 0644)
+		os.Chtimes(page, time.Now(), time.Now().Add(time.Hour))
+	}()
+	v, _ = poll("path=/guide/&wait=3&since=" + first.Version)
+	if !v.Changed || v.Version == first.Version {
+		t.Log("Expected a change, got:", v)
+		t.Fail()
+	}
+
+	if _, code := poll("path=/../"); code != 404 {
+		t.Log("Expected 404 outside the root, got:", code)
+		t.Fail()
+	}
+	if _, code := poll("path=/missing.md"); code != 404 {
+		t.Log("Expected 404 for a missing file, got:", code)
+		t.Fail()
+	}
+
+	// drafts are not found, and don't change the version of their directory
+	before, _ := poll("path=/guide/")
+	os.Mkdir(filepath.Join(dir, "guide", "_drafts"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "guide", "_drafts", "a.md"), []byte("# a\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "guide", "plan.md"), []byte("---\ndraft: true\n---\n# plan\n"), 0644)
+	for _, path := range []string{"/guide/_drafts/a.md", "/guide/_drafts/", "/guide/plan.md"} {
+		if _, code := poll("path=" + path); code != 404 {
+			t.Log("Expected 404 for the draft", path, "got:", code)
+			t.Fail()
+		}
+	}
+	if v, _ := poll("path=/guide/"); v.Version != before.Version {
+		t.Log("Expected drafts left out of the version of their directory, got:", before.Version, v.Version)
+		t.Fail()
+	}
+}
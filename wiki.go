@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/shurcooL/sanitized_anchor_name"
+)
+
+// reWikiLink matches [[Page Name]], [[folder/Page#Heading]] and
+// [[Page Name|label]]
+var reWikiLink = regexp.MustCompile(`\[\[([^\[\]|#\n]+)(#[^\[\]|\n]*)?(?:\|([^\[\]\n]+))?\]\]`)
+
+// wikiKey normalizes a page name for matching: case, dashes, underscores,
+// spaces and the .md extension don't matter
+func wikiKey(s string) string {
+	s = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), ".md")
+	s = strings.NewReplacer("-", " ", "_", " ").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// wikiPages returns the markdown files in Root, skipping hidden and '_'
+// files as the nav does
+func (h Handler) wikiPages() []string {
+	var pages []string
+	fs.WalkDir(h.Root, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if name != "." && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "_")) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && strings.HasSuffix(name, ".md") {
+			pages = append(pages, name)
+		}
+		return nil
+	})
+	return pages
+}
+
+// resolveWiki finds the page a wiki link from the page name points at.
+// 'Page Name' matches page-name.md in any directory, 'folder/Page' a page
+// ending in that path. pages in the directory of name win, then the
+// shortest path.
+func resolveWiki(pages []string, name, target string) (string, bool) {
+	key := wikiKey(target)
+	var matches []string
+	for _, p := range pages {
+		k := wikiKey(p)
+		if k == key || strings.HasSuffix(k, "/"+key) {
+			matches = append(matches, p)
+		}
+	}
+	if len(matches) == 0 {
+		return "", false
+	}
+	dir := path.Dir(name)
+	sort.Slice(matches, func(i, j int) bool {
+		if ai, aj := path.Dir(matches[i]) == dir, path.Dir(matches[j]) == dir; ai != aj {
+			return ai
+		}
+		if len(matches[i]) != len(matches[j]) {
+			return len(matches[i]) < len(matches[j])
+		}
+		return matches[i] < matches[j]
+	})
+	return matches[0], true
+}
+
+// wikiLinks turns the wiki links in the markdown of the file name into
+// markdown links, outside of code fences. links to missing pages become
+// their label.
+func (h Handler) wikiLinks(name string, src []byte) []byte {
+	if !bytes.Contains(src, []byte("[[")) {
+		return src
+	}
+	pages := h.wikiPages()
+	escape := strings.NewReplacer("[", `\[`, "]", `\]`)
+	var out bytes.Buffer
+	var fenced bool
+	for _, line := range bytes.SplitAfter(src, []byte("\n")) {
+		trimmed := bytes.TrimSpace(line)
+		if bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~")) {
+			fenced = !fenced
+		}
+		if fenced {
+			out.Write(line)
+			continue
+		}
+		out.Write(reWikiLink.ReplaceAllFunc(line, func(m []byte) []byte {
+			sub := reWikiLink.FindSubmatch(m)
+			target, anchor, label := strings.TrimSpace(string(sub[1])), string(sub[2]), strings.TrimSpace(string(sub[3]))
+			if label == "" {
+				label = target + strings.Replace(anchor, "#", " > ", 1)
+			}
+			page, ok := resolveWiki(pages, name, target)
+			if !ok {
+				return []byte(escape.Replace(label))
+			}
+			if anchor != "" {
+				anchor = "#" + sanitized_anchor_name.Create(anchor[1:])
+			}
+			return []byte("[" + escape.Replace(label) + "](" + (&url.URL{Path: "/" + page}).String() + anchor + ")")
+		}))
+	}
+	return out.Bytes()
+}
+
+// backlink is a page linking to another
+type backlink struct {
+	Title string
+	URL   string
+}
+
+// backlinks returns the pages linking to the file name, with wiki links
+// or markdown links, sorted by title
+func (h Handler) backlinks(name string) []backlink {
+	pages := h.wikiPages()
+	var links []backlink
+	for _, p := range pages {
+		if p == name {
+			continue
+		}
+		b, err := fs.ReadFile(h.Root, p)
+		if err != nil {
+			continue
+		}
+		fm, md := parseFrontMatter(b)
+		if hideDraft(p, fm) || !linksTo(pages, p, md, name) {
+			continue
+		}
+		title := pageTitle(fm, md)
+		if title == "" {
+			title = segmentName(path.Base(p))
+		}
+		links = append(links, backlink{Title: title, URL: h.Prefix + (&url.URL{Path: "/" + p}).String()})
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Title < links[j].Title })
+	return links
+}
+
+// linksTo reports whether the markdown md of the page from links to name
+func linksTo(pages []string, from string, md []byte, name string) bool {
+	for _, p := range outLinks(pages, from, md) {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// outLinks returns the names the markdown md of the page from links to,
+// with wiki links or relative and root relative markdown links, in order
+// and without duplicates. markdown links may name files that don't exist.
+func outLinks(pages []string, from string, md []byte) []string {
+	var links []string
+	seen := map[string]bool{}
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			links = append(links, p)
+		}
+	}
+	for _, m := range reWikiLink.FindAllSubmatch(md, -1) {
+		if p, ok := resolveWiki(pages, from, string(m[1])); ok {
+			add(p)
+		}
+	}
+	for _, m := range reSummaryLink.FindAllSubmatch(md, -1) {
+		target := string(m[1])
+		if strings.Contains(target, "://") || strings.HasPrefix(target, "#") || strings.HasPrefix(target, "mailto:") {
+			continue
+		}
+		if i := strings.IndexAny(target, "#?"); i != -1 {
+			target = target[:i]
+		}
+		if t, err := url.PathUnescape(target); err == nil {
+			target = t
+		}
+		p := path.Join(path.Dir(from), target)
+		if strings.HasPrefix(target, "/") {
+			p = strings.TrimPrefix(path.Clean(target), "/")
+		}
+		if fs.ValidPath(p) && p != "." {
+			add(p)
+		}
+	}
+	return links
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWikiLinks(t *testing.T) {
+	h := Handler{Root: fstest.MapFS{
+		"index.md":             {Data: []byte("# Home\n")},
+		"notes/page-name.md":   {Data: []byte("# Page\n")},
+		"notes/sub/other.md":   {Data: []byte("# Other\n")},
+		"archive/other.md":     {Data: []byte("# Old other\n")},
+		"archive/Old Notes.md": {Data: []byte("# Old\n")},
+		".obsidian/x.md":       {Data: []byte("# hidden\n")},
+	}}
+	src := "See [[Page Name]], [[page_name|the page]], [[Page Name#Some Heading]],\n" +
+		"[[Other]] and [[sub/other]], [[Old Notes]], [[Missing [x]]] [[Nowhere]] [[X]].\n" +
+		"```\n[[Page Name]]\n```\n"
+	out := string(h.wikiLinks("notes/index.md", []byte(src)))
+	for _, want := range []string{
+		"See [Page Name](/notes/page-name.md), [the page](/notes/page-name.md), [Page Name > Some Heading](/notes/page-name.md#some-heading),\n",
+		"[Other](/archive/other.md) and [sub/other](/notes/sub/other.md), [Old Notes](/archive/Old%20Notes.md)",
+		"Nowhere X.", // missing pages are left as their label
+		"```\n[[Page Name]]\n```\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Logf("Expected %q in:\n%s", want, out)
+			t.Fail()
+		}
+	}
+	// from inside archive, its own other.md wins
+	if p, _ := resolveWiki(h.wikiPages(), "archive/index.md", "other"); p != "archive/other.md" {
+		t.Log("Expected the page in the same directory, got:", p)
+		t.Fail()
+	}
+}
+
+func TestBacklinks(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(`{{range .Backlinks}}[{{.Title}}]({{.URL}}) {{end}}`))
+	h := Handler{template: tmpl, Prefix: "/wiki", Root: fstest.MapFS{
+		"target.md":      {Data: []byte("# Target\n")},
+		"a.md":           {Data: []byte("# Links with wiki\n[[target]]\n")},
+		"dir/b.md":       {Data: []byte("---\ntitle: B page\n---\n[markdown](../target.md#top)\n")},
+		"c.md":           {Data: []byte("# C\n[absolute](/target.md) [[elsewhere]]\n")},
+		"d.md":           {Data: []byte("# Not linking\n[x](https://example.com/target.md)\n")},
+		"_partials/e.md": {Data: []byte("[[target]]\n")},
+	}}
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/target.md", nil)
+	h.ServeHTTP(rec, req)
+	want := "[B page](/wiki/dir/b.md) [C](/wiki/c.md) [Links with wiki](/wiki/a.md) "
+	if rec.Body.String() != want {
+		t.Logf("Expected %q, got %q", want, rec.Body.String())
+		t.Fail()
+	}
+}